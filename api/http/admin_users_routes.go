@@ -2,48 +2,101 @@
 package http
 
 import (
+	"errors"
 	"net/http"
 	"strconv"
 
 	"github.com/fire-disposal/health_DT_go/internal/models"
+	"github.com/fire-disposal/health_DT_go/internal/service"
 	"github.com/gin-gonic/gin"
 )
 
-var adminUsersStore = make(map[int64]*models.AdminUser)
-var nextAdminID int64 = 1
+var adminUsersService *service.AdminUsersService
 
-func RegisterAdminUsersRoutes(router gin.IRouter) {
-	group := router.Group("/admin_users")
+// CreateAdminUserRequest 创建管理员请求
+type CreateAdminUserRequest struct {
+	Username string `json:"username" binding:"required"`
+	Password string `json:"password" binding:"required"`
+	Email    string `json:"email"`
+	Phone    string `json:"phone"`
+	Role     string `json:"role"`
+	OrgID    int    `json:"org_id"` // 所属组织，仅平台管理员可指定
+}
+
+// UpdateAdminUserRequest 更新管理员请求，未提供的字段保持不变
+type UpdateAdminUserRequest struct {
+	Email    *string `json:"email"`
+	Phone    *string `json:"phone"`
+	Role     *string `json:"role"`
+	IsActive *bool   `json:"is_active"`
+}
+
+// RegisterAdminUsersRoutes 注册管理员管理路由，超级管理员管理本组织管理员，平台管理员可跨组织管理
+func RegisterAdminUsersRoutes(router gin.IRouter, svc *service.AdminUsersService, authService *service.AuthService) {
+	adminUsersService = svc
+	group := router.Group("/admin_users", AuthMiddleware(authService),
+		RequireRoles(models.AdminRolePlatformAdmin, models.AdminRoleSuperAdmin))
 	{
 		group.POST("", createAdminUserHandler())
 		group.GET("/:id", getAdminUserHandler())
 		group.GET("", listAdminUsersHandler())
 		group.PUT("/:id", updateAdminUserHandler())
+		group.POST("/:id/deactivate", setAdminUserActiveHandler(false))
+		group.POST("/:id/activate", setAdminUserActiveHandler(true))
 		group.DELETE("/:id", deleteAdminUserHandler())
 	}
 }
 
+// adminUserErrorStatus 将业务错误映射为 HTTP 状态码
+func adminUserErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, service.ErrAdminUserNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, service.ErrAdminUsernameExists):
+		return http.StatusConflict
+	case errors.Is(err, service.ErrPlatformAdminOnly):
+		return http.StatusForbidden
+	case errors.Is(err, service.ErrInvalidAdminRole), errors.Is(err, service.ErrInvalidAdminInput), errors.Is(err, service.ErrLastSuperAdmin),
+		errors.Is(err, service.ErrLastPlatformAdmin), errors.Is(err, service.ErrWeakPassword):
+		return http.StatusBadRequest
+	}
+	return http.StatusInternalServerError
+}
+
 /*
 @Summary 创建管理员用户
-@Description 新增管理员用户，需提交完整信息
+@Description 新增管理员用户，角色支持 superadmin/admin（platform_admin 仅平台管理员可创建），密码以 bcrypt 哈希存储；
+组织管理员创建的账号固定归属其所属组织
 @Tags AdminUser
 @Accept json
 @Produce json
-@Param body body models.AdminUser true "管理员用户信息"
+@Param body body CreateAdminUserRequest true "管理员用户信息"
 @Success 201 {object} models.AdminUser "创建成功"
 @Failure 400 {object} map[string]string "参数错误"
+@Failure 403 {object} map[string]string "无权创建平台管理员"
+@Failure 409 {object} map[string]string "用户名已存在"
 */
 func createAdminUserHandler() gin.HandlerFunc {
 	return func(c *gin.Context) {
-		var req models.AdminUser
+		var req CreateAdminUserRequest
 		if err := c.ShouldBindJSON(&req); err != nil {
 			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 			return
 		}
-		req.ID = nextAdminID
-		nextAdminID++
-		adminUsersStore[req.ID] = &req
-		c.JSON(http.StatusCreated, req)
+		user, err := adminUsersService.Create(c.Request.Context(), service.CreateAdminUserInput{
+			Username: req.Username,
+			Email:    req.Email,
+			Phone:    req.Phone,
+			Password: req.Password,
+			Role:     req.Role,
+			OrgID:    req.OrgID,
+		})
+		if err != nil {
+			c.JSON(adminUserErrorStatus(err), gin.H{"error": err.Error()})
+			return
+		}
+		recordAudit(c, models.AuditActionCreate, models.AuditResourceAdminUser, user.ID, nil, user)
+		c.JSON(http.StatusCreated, user)
 	}
 }
 
@@ -59,11 +112,12 @@ func createAdminUserHandler() gin.HandlerFunc {
 func getAdminUserHandler() gin.HandlerFunc {
 	return func(c *gin.Context) {
 		id, _ := strconv.ParseInt(c.Param("id"), 10, 64)
-		user, ok := adminUsersStore[id]
-		if !ok {
-			c.JSON(http.StatusNotFound, gin.H{"error": "not found"})
+		user, err := adminUsersService.Get(c.Request.Context(), id)
+		if err != nil {
+			c.JSON(adminUserErrorStatus(err), gin.H{"error": err.Error()})
 			return
 		}
+		recordAudit(c, models.AuditActionView, models.AuditResourceAdminUser, id, nil, nil)
 		c.JSON(http.StatusOK, user)
 	}
 }
@@ -77,22 +131,24 @@ func getAdminUserHandler() gin.HandlerFunc {
 */
 func listAdminUsersHandler() gin.HandlerFunc {
 	return func(c *gin.Context) {
-		var users []*models.AdminUser
-		for _, u := range adminUsersStore {
-			users = append(users, u)
+		users, err := adminUsersService.List(c.Request.Context())
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
 		}
+		recordAudit(c, models.AuditActionList, models.AuditResourceAdminUser, nil, nil, nil)
 		c.JSON(http.StatusOK, users)
 	}
 }
 
 /*
 @Summary 更新管理员用户
-@Description 根据ID更新管理员用户信息
+@Description 根据ID更新管理员用户信息（不含密码）
 @Tags AdminUser
 @Accept json
 @Produce json
 @Param id path int true "管理员用户ID"
-@Param body body models.AdminUser true "管理员用户信息"
+@Param body body UpdateAdminUserRequest true "管理员用户信息"
 @Success 200 {object} models.AdminUser "更新成功"
 @Failure 400 {object} map[string]string "参数错误"
 @Failure 404 {object} map[string]string "未找到"
@@ -100,19 +156,48 @@ func listAdminUsersHandler() gin.HandlerFunc {
 func updateAdminUserHandler() gin.HandlerFunc {
 	return func(c *gin.Context) {
 		id, _ := strconv.ParseInt(c.Param("id"), 10, 64)
-		var req models.AdminUser
+		var req UpdateAdminUserRequest
 		if err := c.ShouldBindJSON(&req); err != nil {
 			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 			return
 		}
-		_, ok := adminUsersStore[id]
-		if !ok {
-			c.JSON(http.StatusNotFound, gin.H{"error": "not found"})
+		before, _ := adminUsersService.Get(c.Request.Context(), id)
+		user, err := adminUsersService.Update(c.Request.Context(), id, service.UpdateAdminUserInput{
+			Email:    req.Email,
+			Phone:    req.Phone,
+			Role:     req.Role,
+			IsActive: req.IsActive,
+		})
+		if err != nil {
+			c.JSON(adminUserErrorStatus(err), gin.H{"error": err.Error()})
 			return
 		}
-		req.ID = id
-		adminUsersStore[id] = &req
-		c.JSON(http.StatusOK, req)
+		recordAudit(c, models.AuditActionUpdate, models.AuditResourceAdminUser, id, before, user)
+		c.JSON(http.StatusOK, user)
+	}
+}
+
+/*
+@Summary 激活/停用管理员用户
+@Description 停用后该管理员现有Token立即失效
+@Tags AdminUser
+@Produce json
+@Param id path int true "管理员用户ID"
+@Success 200 {object} models.AdminUser "操作成功"
+@Failure 400 {object} map[string]string "不允许停用最后一个超级管理员"
+@Failure 404 {object} map[string]string "未找到"
+*/
+func setAdminUserActiveHandler(active bool) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id, _ := strconv.ParseInt(c.Param("id"), 10, 64)
+		before, _ := adminUsersService.Get(c.Request.Context(), id)
+		user, err := adminUsersService.SetActive(c.Request.Context(), id, active)
+		if err != nil {
+			c.JSON(adminUserErrorStatus(err), gin.H{"error": err.Error()})
+			return
+		}
+		recordAudit(c, models.AuditActionUpdate, models.AuditResourceAdminUser, id, before, user)
+		c.JSON(http.StatusOK, user)
 	}
 }
 
@@ -128,12 +213,12 @@ func updateAdminUserHandler() gin.HandlerFunc {
 func deleteAdminUserHandler() gin.HandlerFunc {
 	return func(c *gin.Context) {
 		id, _ := strconv.ParseInt(c.Param("id"), 10, 64)
-		_, ok := adminUsersStore[id]
-		if !ok {
-			c.JSON(http.StatusNotFound, gin.H{"error": "not found"})
+		before, _ := adminUsersService.Get(c.Request.Context(), id)
+		if err := adminUsersService.Delete(c.Request.Context(), id); err != nil {
+			c.JSON(adminUserErrorStatus(err), gin.H{"error": err.Error()})
 			return
 		}
-		delete(adminUsersStore, id)
+		recordAudit(c, models.AuditActionDelete, models.AuditResourceAdminUser, id, before, nil)
 		c.JSON(http.StatusOK, gin.H{"id": id, "message": "deleted"})
 	}
 }
@@ -4,31 +4,51 @@ import (
 	"database/sql"
 	"net/http"
 
+	"github.com/fire-disposal/health_DT_go/internal/models"
 	"github.com/fire-disposal/health_DT_go/internal/repository/postgres"
+	"github.com/fire-disposal/health_DT_go/internal/service"
 	"github.com/gin-gonic/gin"
 )
 
 // RegisterAlertsRoutes 注册告警相关路由
-func RegisterAlertsRoutes(router gin.IRouter, db *sql.DB) {
-	router.GET("/alerts", queryAlertsHandler(db))
+func RegisterAlertsRoutes(router gin.IRouter, db *sql.DB, authService *service.AuthService) {
+	router.GET("/alerts", AuthMiddleware(authService, models.APIKeyScopeReadAlerts), queryAlertsHandler(db))
 }
 
 /*
 // @Summary 查询告警列表
-// @Description 获取所有告警信息
+// @Description 管理员获取本组织全部告警（平台管理员不限组织），App 用户仅获取其可访问档案的告警；
+// @Description 支持具备 read:alerts 授权范围的 API Key；指定 location_id 时仅返回该位置及其下级位置的告警（位置取设备放置位置，其次档案床位）
 // @Tags alerts
 // @Produce json
+// @Param location_id query int false "位置ID"
 // @Success 200 {object} map[string]interface{}
 // @Router /alerts [get]
 */
 func queryAlertsHandler(db *sql.DB) gin.HandlerFunc {
 	return func(c *gin.Context) {
+		scope, err := profileSharingService.Scope(c.Request.Context(), currentPrincipal(c))
+		if err != nil {
+			c.JSON(profileErrorStatus(err), gin.H{"error": err.Error()})
+			return
+		}
+		locationID, ok := locationQuery(c)
+		if !ok {
+			return
+		}
 		repo := postgres.NewAlertsRepository(db)
-		alerts, err := repo.FindAll()
+		var alerts []models.Alert
+		if scope.All || scope.OrgWide {
+			alerts, err = repo.FindAll(c.Request.Context(), locationID)
+		} else {
+			alerts, err = repo.FindByProfileIDs(c.Request.Context(), scope.ProfileIDs, locationID)
+		}
 		if err != nil {
 			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 			return
 		}
+		annotateAlertLocations(c, alerts)
+		recordAudit(c, models.AuditActionList, models.AuditResourceAlert, nil, nil, nil)
 		c.JSON(http.StatusOK, gin.H{"alerts": alerts})
 	}
 }
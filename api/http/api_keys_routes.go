@@ -0,0 +1,169 @@
+// Package http 第三方系统 API Key 管理路由
+package http
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/fire-disposal/health_DT_go/internal/models"
+	"github.com/fire-disposal/health_DT_go/internal/service"
+	"github.com/gin-gonic/gin"
+)
+
+var apiKeyService *service.APIKeyService
+
+// CreateAPIKeyRequest 创建 API Key 请求
+type CreateAPIKeyRequest struct {
+	Name          string   `json:"name" binding:"required"`
+	Scopes        []string `json:"scopes" binding:"required"`
+	ExpiresInDays int      `json:"expires_in_days"` // 有效天数，默认 90，最长 365
+	OrgID         int      `json:"org_id"`          // 所属组织，仅平台管理员可指定
+}
+
+// APIKeyResponse 创建或轮换 API Key 的响应，明文 Key 仅在此返回一次
+type APIKeyResponse struct {
+	Key    string         `json:"key"`
+	APIKey *models.APIKey `json:"api_key"`
+}
+
+// RegisterAPIKeyRoutes 注册 API Key 管理路由，超级管理员管理本组织 Key，平台管理员可跨组织管理
+func RegisterAPIKeyRoutes(router gin.IRouter, svc *service.APIKeyService, authService *service.AuthService) {
+	apiKeyService = svc
+	group := router.Group("/api_keys", AuthMiddleware(authService),
+		RequireRoles(models.AdminRolePlatformAdmin, models.AdminRoleSuperAdmin))
+	{
+		group.POST("", createAPIKeyHandler())
+		group.GET("", listAPIKeysHandler())
+		group.GET("/:id", getAPIKeyHandler())
+		group.POST("/:id/rotate", rotateAPIKeyHandler())
+		group.DELETE("/:id", revokeAPIKeyHandler())
+	}
+}
+
+// apiKeyErrorStatus 将 API Key 业务错误映射为 HTTP 状态码
+func apiKeyErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, service.ErrAPIKeyNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, service.ErrInvalidAPIKeyScope), errors.Is(err, service.ErrInvalidAPIKeyInput):
+		return http.StatusBadRequest
+	}
+	return http.StatusInternalServerError
+}
+
+/*
+@Summary 创建 API Key
+@Description 为第三方系统创建组织级 API Key，可选授权范围：read:alerts、read:health_profiles、write:health_data；明文 Key 仅在响应中返回一次
+@Tags APIKey
+@Accept json
+@Produce json
+@Param body body CreateAPIKeyRequest true "API Key 信息"
+@Success 201 {object} APIKeyResponse "创建成功"
+@Failure 400 {object} map[string]string "参数错误"
+*/
+func createAPIKeyHandler() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var req CreateAPIKeyRequest
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		plaintext, key, err := apiKeyService.Create(c.Request.Context(), currentPrincipal(c).UserID, service.CreateAPIKeyInput{
+			Name:          req.Name,
+			Scopes:        req.Scopes,
+			ExpiresInDays: req.ExpiresInDays,
+			OrgID:         req.OrgID,
+		})
+		if err != nil {
+			c.JSON(apiKeyErrorStatus(err), gin.H{"error": err.Error()})
+			return
+		}
+		recordAudit(c, models.AuditActionCreate, models.AuditResourceAPIKey, key.ID, nil, key)
+		c.JSON(http.StatusCreated, APIKeyResponse{Key: plaintext, APIKey: key})
+	}
+}
+
+/*
+@Summary API Key 列表
+@Description 查询本组织全部 API Key（含已撤销），仅展示前缀
+@Tags APIKey
+@Produce json
+@Success 200 {array} models.APIKey "查询成功"
+*/
+func listAPIKeysHandler() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		keys, err := apiKeyService.List(c.Request.Context())
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, keys)
+	}
+}
+
+/*
+@Summary 获取 API Key 详情
+@Description 根据ID查询 API Key，含最近使用时间
+@Tags APIKey
+@Produce json
+@Param id path int true "API Key ID"
+@Success 200 {object} models.APIKey "查询成功"
+@Failure 404 {object} map[string]string "API Key 不存在"
+*/
+func getAPIKeyHandler() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id, _ := strconv.ParseInt(c.Param("id"), 10, 64)
+		key, err := apiKeyService.Get(c.Request.Context(), id)
+		if err != nil {
+			c.JSON(apiKeyErrorStatus(err), gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, key)
+	}
+}
+
+/*
+@Summary 轮换 API Key
+@Description 生成新的明文 Key，旧 Key 立即失效；名称、授权范围与有效期不变
+@Tags APIKey
+@Produce json
+@Param id path int true "API Key ID"
+@Success 200 {object} APIKeyResponse "轮换成功"
+@Failure 404 {object} map[string]string "API Key 不存在或已撤销"
+*/
+func rotateAPIKeyHandler() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id, _ := strconv.ParseInt(c.Param("id"), 10, 64)
+		before, _ := apiKeyService.Get(c.Request.Context(), id)
+		plaintext, key, err := apiKeyService.Rotate(c.Request.Context(), id)
+		if err != nil {
+			c.JSON(apiKeyErrorStatus(err), gin.H{"error": err.Error()})
+			return
+		}
+		recordAudit(c, models.AuditActionUpdate, models.AuditResourceAPIKey, id, before, key)
+		c.JSON(http.StatusOK, APIKeyResponse{Key: plaintext, APIKey: key})
+	}
+}
+
+/*
+@Summary 撤销 API Key
+@Description 撤销后该 Key 立即无法认证，记录保留用于审计
+@Tags APIKey
+@Produce json
+@Param id path int true "API Key ID"
+@Success 200 {object} map[string]interface{} "撤销成功"
+@Failure 404 {object} map[string]string "API Key 不存在或已撤销"
+*/
+func revokeAPIKeyHandler() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id, _ := strconv.ParseInt(c.Param("id"), 10, 64)
+		before, _ := apiKeyService.Get(c.Request.Context(), id)
+		if err := apiKeyService.Revoke(c.Request.Context(), id); err != nil {
+			c.JSON(apiKeyErrorStatus(err), gin.H{"error": err.Error()})
+			return
+		}
+		recordAudit(c, models.AuditActionDelete, models.AuditResourceAPIKey, id, before, nil)
+		c.JSON(http.StatusOK, gin.H{"id": id, "message": "revoked"})
+	}
+}
@@ -2,11 +2,13 @@
 package http
 
 import (
-	"database/sql"
+	"errors"
 	"net/http"
+	"time"
 
-	"github.com/fire-disposal/health_DT_go/internal/repository/postgres"
+	"github.com/fire-disposal/health_DT_go/internal/models"
 	"github.com/fire-disposal/health_DT_go/internal/service"
+	"github.com/fire-disposal/health_DT_go/internal/wechat"
 	"github.com/gin-gonic/gin"
 )
 
@@ -15,34 +17,64 @@ type LoginRequest struct {
 	Password string `json:"password"`
 }
 
+// 登录与密码找回限流：按客户端 IP 计全部请求，按账号计登录失败、验证码申请与重置尝试
+var (
+	authIPLimiter       = newRateLimiter(30, time.Minute)
+	loginFailureLimiter = newRateLimiter(10, 15*time.Minute)
+	resetRequestLimiter = newRateLimiter(3, 15*time.Minute)
+	resetAttemptLimiter = newRateLimiter(10, 15*time.Minute)
+)
+
+// accountLimited 账号在 limiter 当前窗口内已达上限时返回 429
+func accountLimited(c *gin.Context, limiter *rateLimiter, key string) bool {
+	if !limiter.Blocked(key) {
+		return false
+	}
+	abortRateLimited(c, limiter.retryAfter(key))
+	return true
+}
+
 // 错误响应辅助函数
 func errorResponse(c *gin.Context, status int, msg string) {
 	c.JSON(status, gin.H{"error": msg})
 }
 
 // RegisterAuthRoutes 注册鉴权相关路由
-func RegisterAuthRoutes(r gin.IRouter, db *sql.DB) {
-	authService := service.NewAuthService(postgres.NewAuthRepository(db))
+func RegisterAuthRoutes(r gin.IRouter, authService *service.AuthService) {
 	// @Summary 管理员登录
-	// @Description 管理员账号密码登录
+	// @Description 管理员账号密码登录；启用两步验证时返回 challenge_token，需调用 /api/admin/login/2fa 完成登录
 	// @Tags auth
 	// @Accept json
 	// @Produce json
 	// @Param login body LoginRequest true "登录信息"
 	// @Success 200 {object} map[string]interface{}
 	// @Failure 401 {string} string "认证失败"
+	// @Failure 429 {string} string "请求过于频繁"
 	// @Router /api/admin/login [post]
-	r.POST("/api/admin/login", func(c *gin.Context) {
+	r.POST("/api/admin/login", rateLimitByIP(authIPLimiter), func(c *gin.Context) {
 		var req LoginRequest
 		if err := c.ShouldBindJSON(&req); err != nil {
 			errorResponse(c, http.StatusBadRequest, "参数错误")
 			return
 		}
+		key := accountKey("admin", req.Username)
+		if accountLimited(c, loginFailureLimiter, key) {
+			return
+		}
 		result, err := authService.Login("admin", req.Username, req.Password)
 		if err != nil {
+			loginFailureLimiter.Hit(key)
 			errorResponse(c, http.StatusUnauthorized, err.Error())
 			return
 		}
+		if result.TwoFactorRequired {
+			c.JSON(http.StatusOK, gin.H{
+				"two_factor_required": true,
+				"enrollment_required": result.EnrollmentRequired,
+				"challenge_token":     result.ChallengeToken,
+			})
+			return
+		}
 		c.JSON(http.StatusOK, gin.H{"token": result.Token, "user_id": result.UserID, "role": result.Role})
 	})
 
@@ -54,15 +86,21 @@ func RegisterAuthRoutes(r gin.IRouter, db *sql.DB) {
 	// @Param login body LoginRequest true "登录信息"
 	// @Success 200 {object} map[string]interface{}
 	// @Failure 401 {string} string "认证失败"
+	// @Failure 429 {string} string "请求过于频繁"
 	// @Router /api/app/login [post]
-	r.POST("/api/app/login", func(c *gin.Context) {
+	r.POST("/api/app/login", rateLimitByIP(authIPLimiter), func(c *gin.Context) {
 		var req LoginRequest
 		if err := c.ShouldBindJSON(&req); err != nil {
 			errorResponse(c, http.StatusBadRequest, "参数错误")
 			return
 		}
+		key := accountKey("app", req.Username)
+		if accountLimited(c, loginFailureLimiter, key) {
+			return
+		}
 		result, err := authService.Login("app", req.Username, req.Password)
 		if err != nil {
+			loginFailureLimiter.Hit(key)
 			errorResponse(c, http.StatusUnauthorized, err.Error())
 			return
 		}
@@ -77,29 +115,206 @@ type WechatLoginRequest struct {
 	Code string `json:"code"`
 }
 
+// wechatErrorStatus 将微信登录/绑定错误映射为 HTTP 状态码
+func wechatErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, wechat.ErrInvalidCode), errors.Is(err, wechat.ErrCodeUsed):
+		return http.StatusUnauthorized
+	case errors.Is(err, service.ErrAccountDisabled):
+		return http.StatusForbidden
+	case errors.Is(err, wechat.ErrRateLimited):
+		return http.StatusTooManyRequests
+	case errors.Is(err, wechat.ErrUnavailable):
+		return http.StatusBadGateway
+	case errors.Is(err, wechat.ErrNotConfigured):
+		return http.StatusServiceUnavailable
+	case errors.Is(err, service.ErrWechatAppUserOnly):
+		return http.StatusForbidden
+	case errors.Is(err, service.ErrWechatAccountBound), errors.Is(err, service.ErrWechatOpenIDBound):
+		return http.StatusConflict
+	case errors.Is(err, service.ErrWechatNotBound), errors.Is(err, service.ErrWechatUnbindNoPassword):
+		return http.StatusBadRequest
+	}
+	return http.StatusInternalServerError
+}
+
 // 新增微信登录路由
 // POST /api/app/wechat_login
 // @Summary 微信登录
-// @Description 微信授权码登录
+// @Description 微信授权码登录，openid 未绑定账号时自动注册
 // @Tags auth
 // @Accept json
 // @Produce json
 // @Param code body WechatLoginRequest true "微信授权码"
 // @Success 200 {object} map[string]interface{}
 // @Failure 401 {string} string "认证失败"
+// @Failure 403 {string} string "账号已停用"
+// @Failure 409 {string} string "微信已绑定其他账号"
+// @Failure 429 {string} string "请求过于频繁"
+// @Failure 502 {string} string "微信接口不可用"
 // @Router /api/app/wechat_login [post]
 func RegisterWechatLoginRoute(r gin.IRouter, authService *service.AuthService) {
-	r.POST("/api/app/wechat_login", func(c *gin.Context) {
+	r.POST("/api/app/wechat_login", rateLimitByIP(authIPLimiter), func(c *gin.Context) {
 		var req WechatLoginRequest
 		if err := c.ShouldBindJSON(&req); err != nil || req.Code == "" {
 			errorResponse(c, http.StatusBadRequest, "参数错误")
 			return
 		}
-		result, err := authService.LoginWithWechatCode(req.Code)
+		result, err := authService.LoginWithWechatCode(c.Request.Context(), req.Code)
 		if err != nil {
-			errorResponse(c, http.StatusUnauthorized, err.Error())
+			errorResponse(c, wechatErrorStatus(err), err.Error())
 			return
 		}
 		c.JSON(http.StatusOK, gin.H{"token": result.Token, "user_id": result.UserID, "role": result.Role})
 	})
+
+	// @Summary 绑定微信
+	// @Description 已登录的 App 用户使用微信授权码绑定 openid，之后可通过微信登录同一账号
+	// @Tags auth
+	// @Accept json
+	// @Produce json
+	// @Param code body WechatLoginRequest true "微信授权码"
+	// @Success 200 {object} map[string]interface{}
+	// @Failure 409 {string} string "账号或微信已绑定"
+	// @Router /api/app/wechat/bind [post]
+	r.POST("/api/app/wechat/bind", AuthMiddleware(authService), func(c *gin.Context) {
+		var req WechatLoginRequest
+		if err := c.ShouldBindJSON(&req); err != nil || req.Code == "" {
+			errorResponse(c, http.StatusBadRequest, "参数错误")
+			return
+		}
+		if err := authService.BindWechat(c.Request.Context(), currentPrincipal(c), req.Code); err != nil {
+			errorResponse(c, wechatErrorStatus(err), err.Error())
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"message": "微信已绑定"})
+	})
+
+	// @Summary 解绑微信
+	// @Description App 用户解绑微信，未设置密码的账号不可解绑
+	// @Tags auth
+	// @Produce json
+	// @Success 200 {object} map[string]interface{}
+	// @Failure 400 {string} string "未绑定或未设置密码"
+	// @Router /api/app/wechat/bind [delete]
+	r.DELETE("/api/app/wechat/bind", AuthMiddleware(authService), func(c *gin.Context) {
+		if err := authService.UnbindWechat(c.Request.Context(), currentPrincipal(c)); err != nil {
+			errorResponse(c, wechatErrorStatus(err), err.Error())
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"message": "微信已解绑"})
+	})
+}
+
+// ChangePasswordRequest 修改密码请求
+type ChangePasswordRequest struct {
+	CurrentPassword string `json:"current_password" binding:"required"`
+	NewPassword     string `json:"new_password" binding:"required"`
+}
+
+// ForgotPasswordRequest 申请重置验证码请求
+type ForgotPasswordRequest struct {
+	Username string `json:"username" binding:"required"`
+}
+
+// ResetPasswordRequest 验证码重置密码请求
+type ResetPasswordRequest struct {
+	Username    string `json:"username" binding:"required"`
+	Code        string `json:"code" binding:"required"`
+	NewPassword string `json:"new_password" binding:"required"`
+}
+
+// passwordErrorStatus 将密码业务错误映射为 HTTP 状态码
+func passwordErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, service.ErrWrongPassword), errors.Is(err, service.ErrInvalidResetCode):
+		return http.StatusUnauthorized
+	case errors.Is(err, service.ErrWeakPassword):
+		return http.StatusBadRequest
+	}
+	return http.StatusInternalServerError
+}
+
+// RegisterPasswordRoutes 注册密码修改与找回路由
+func RegisterPasswordRoutes(r gin.IRouter, passwordService *service.PasswordService, authService *service.AuthService) {
+	// @Summary 修改密码
+	// @Description 已登录用户（管理员或App用户）修改密码，需提供当前密码，成功后其他会话全部失效
+	// @Tags auth
+	// @Accept json
+	// @Produce json
+	// @Param body body ChangePasswordRequest true "密码信息"
+	// @Success 200 {object} map[string]interface{}
+	// @Failure 401 {string} string "当前密码错误"
+	// @Router /api/password/change [post]
+	r.POST("/api/password/change", AuthMiddleware(authService), func(c *gin.Context) {
+		var req ChangePasswordRequest
+		if err := c.ShouldBindJSON(&req); err != nil {
+			errorResponse(c, http.StatusBadRequest, "参数错误")
+			return
+		}
+		err := passwordService.ChangePassword(c.Request.Context(), currentPrincipal(c), req.CurrentPassword, req.NewPassword)
+		if err != nil {
+			errorResponse(c, passwordErrorStatus(err), err.Error())
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"message": "密码已修改"})
+	})
+
+	for _, userType := range []string{models.UserTypeAdmin, models.UserTypeApp} {
+		userType := userType
+
+		// @Summary 申请密码重置验证码
+		// @Description 向账号绑定的邮箱或手机号发送验证码，账号不存在时同样返回成功；同一账号 15 分钟内至多申请 3 次
+		// @Tags auth
+		// @Accept json
+		// @Produce json
+		// @Param body body ForgotPasswordRequest true "用户名"
+		// @Success 200 {object} map[string]interface{}
+		// @Failure 429 {string} string "请求过于频繁"
+		// @Router /api/{user_type}/password/forgot [post]
+		r.POST("/api/"+userType+"/password/forgot", rateLimitByIP(authIPLimiter), func(c *gin.Context) {
+			var req ForgotPasswordRequest
+			if err := c.ShouldBindJSON(&req); err != nil {
+				errorResponse(c, http.StatusBadRequest, "参数错误")
+				return
+			}
+			if ok, retry := resetRequestLimiter.Allow(accountKey(userType, req.Username)); !ok {
+				abortRateLimited(c, retry)
+				return
+			}
+			if err := passwordService.RequestReset(c.Request.Context(), userType, req.Username); err != nil {
+				errorResponse(c, http.StatusInternalServerError, "验证码发送失败")
+				return
+			}
+			c.JSON(http.StatusOK, gin.H{"message": "如账号存在，验证码已发送"})
+		})
+
+		// @Summary 验证码重置密码
+		// @Description 使用单次有效的验证码重置密码，成功后该账号全部会话失效
+		// @Tags auth
+		// @Accept json
+		// @Produce json
+		// @Param body body ResetPasswordRequest true "重置信息"
+		// @Success 200 {object} map[string]interface{}
+		// @Failure 401 {string} string "验证码无效或已过期"
+		// @Failure 429 {string} string "请求过于频繁"
+		// @Router /api/{user_type}/password/reset [post]
+		r.POST("/api/"+userType+"/password/reset", rateLimitByIP(authIPLimiter), func(c *gin.Context) {
+			var req ResetPasswordRequest
+			if err := c.ShouldBindJSON(&req); err != nil {
+				errorResponse(c, http.StatusBadRequest, "参数错误")
+				return
+			}
+			if ok, retry := resetAttemptLimiter.Allow(accountKey(userType, req.Username)); !ok {
+				abortRateLimited(c, retry)
+				return
+			}
+			err := passwordService.ResetPassword(c.Request.Context(), userType, req.Username, req.Code, req.NewPassword)
+			if err != nil {
+				errorResponse(c, passwordErrorStatus(err), err.Error())
+				return
+			}
+			c.JSON(http.StatusOK, gin.H{"message": "密码已重置"})
+		})
+	}
 }
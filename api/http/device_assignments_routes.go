@@ -2,53 +2,113 @@
 package http
 
 import (
+	"errors"
 	"net/http"
 	"strconv"
-	"time"
 
 	"github.com/fire-disposal/health_DT_go/internal/models"
+	"github.com/fire-disposal/health_DT_go/internal/repository/postgres"
+	"github.com/fire-disposal/health_DT_go/internal/service"
 	"github.com/gin-gonic/gin"
 )
 
-var deviceAssignmentsStore = make(map[int]*models.DeviceAssignment)
-var nextAssignmentID int = 1
+var deviceAssignmentService *service.DeviceAssignmentService
 
-func RegisterDeviceAssignmentsRoutes(router gin.IRouter) {
-	group := router.Group("/device_assignments")
+// CreateDeviceAssignmentRequest 创建设备绑定请求
+type CreateDeviceAssignmentRequest struct {
+	DeviceID        int `json:"device_id" binding:"required"`
+	HealthProfileID int `json:"health_profile_id" binding:"required"`
+}
+
+func RegisterDeviceAssignmentsRoutes(router gin.IRouter, svc *service.DeviceAssignmentService, authService *service.AuthService) {
+	deviceAssignmentService = svc
+	group := router.Group("/device_assignments", AuthMiddleware(authService))
 	{
 		group.POST("", createDeviceAssignmentHandler())
 		group.GET("/:id", getDeviceAssignmentHandler())
 		group.GET("", listDeviceAssignmentsHandler())
 		group.PUT("/:id/unassign", unassignDeviceHandler())
-		group.DELETE("/:id", deleteDeviceAssignmentHandler())
+		// 硬删除会丢失历史，仅管理员可用于纠正误录；照护者解绑使用 unassign
+		group.DELETE("/:id", RequireRoles(models.AdminRolePlatformAdmin, models.AdminRoleSuperAdmin, models.AdminRoleAdmin),
+			deleteDeviceAssignmentHandler())
+	}
+}
+
+// assignmentErrorStatus 将设备绑定业务错误映射为 HTTP 状态码
+func assignmentErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, service.ErrAssignmentNotFound), errors.Is(err, postgres.ErrAssignmentDeviceNotFound),
+		errors.Is(err, postgres.ErrAssignmentProfileNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, service.ErrAssignmentEnded):
+		return http.StatusConflict
+	case errors.Is(err, service.ErrProfileUnauthenticated), errors.Is(err, service.ErrProfileForbidden):
+		return profileErrorStatus(err)
+	case errors.Is(err, postgres.ErrCrossOrgAssignment), errors.Is(err, service.ErrInvalidAssignment):
+		return http.StatusBadRequest
+	}
+	return http.StatusInternalServerError
+}
+
+// assignDevice 绑定设备到档案并记录审计：需具备目标档案的 caregiver 权限，
+// 设备已绑定到其他档案时还需具备原档案的 caregiver 权限（原绑定将被自动解除）；权限在绑定事务内校验
+func assignDevice(c *gin.Context, deviceID, profileID int) (*service.DeviceAssignmentResult, bool) {
+	ctx, principal := c.Request.Context(), currentPrincipal(c)
+	var current *models.DeviceAssignment
+	result, err := deviceAssignmentService.Assign(ctx, deviceID, profileID, func(active *models.DeviceAssignment) error {
+		current = active
+		if err := profileSharingService.Authorize(ctx, principal, profileID, models.ProfileRoleCaregiver); err != nil {
+			return err
+		}
+		if active != nil && active.HealthProfileID != profileID {
+			return profileSharingService.Authorize(ctx, principal, active.HealthProfileID, models.ProfileRoleCaregiver)
+		}
+		return nil
+	})
+	if err != nil {
+		c.JSON(assignmentErrorStatus(err), gin.H{"error": err.Error()})
+		return nil, false
+	}
+	if result.Replaced != nil {
+		recordAudit(c, models.AuditActionUpdate, models.AuditResourceDeviceAssignment, result.Replaced.ID, current, result.Replaced)
+	}
+	if result.Created {
+		recordAudit(c, models.AuditActionCreate, models.AuditResourceDeviceAssignment, result.Assignment.ID, nil, result.Assignment)
 	}
+	return result, true
 }
 
 // @Summary 创建设备绑定
-// @Description 新增设备绑定关系，需提交完整信息
+// @Description 将设备绑定到健康档案，设备与档案须存在且属于同一组织；设备已绑定其他档案时自动解除原绑定（end_reason 为 reassigned），已绑定到该档案时原样返回
 // @Tags DeviceAssignment
 // @Accept json
 // @Produce json
-// @Param body body models.DeviceAssignment true "设备绑定信息"
-// @Success 201 {object} models.DeviceAssignment "创建成功"
-// @Failure 400 {object} map[string]string "参数错误"
+// @Param body body CreateDeviceAssignmentRequest true "设备与档案ID"
+// @Success 201 {object} service.DeviceAssignmentResult "绑定成功"
+// @Success 200 {object} service.DeviceAssignmentResult "设备已绑定到该档案"
+// @Failure 400 {object} map[string]string "参数错误或跨组织绑定"
+// @Failure 404 {object} map[string]string "设备或档案不存在"
 func createDeviceAssignmentHandler() gin.HandlerFunc {
 	return func(c *gin.Context) {
-		var req models.DeviceAssignment
+		var req CreateDeviceAssignmentRequest
 		if err := c.ShouldBindJSON(&req); err != nil {
 			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 			return
 		}
-		req.ID = nextAssignmentID
-		req.AssignedAt = time.Now()
-		deviceAssignmentsStore[req.ID] = &req
-		nextAssignmentID++
-		c.JSON(http.StatusCreated, req)
+		result, ok := assignDevice(c, req.DeviceID, req.HealthProfileID)
+		if !ok {
+			return
+		}
+		status := http.StatusOK
+		if result.Created {
+			status = http.StatusCreated
+		}
+		c.JSON(status, result)
 	}
 }
 
 // @Summary 获取设备绑定详情
-// @Description 根据ID查询设备绑定信息
+// @Description 根据ID查询设备绑定信息（含已解除的历史绑定）
 // @Tags DeviceAssignment
 // @Produce json
 // @Param id path int true "设备绑定ID"
@@ -57,67 +117,115 @@ func createDeviceAssignmentHandler() gin.HandlerFunc {
 func getDeviceAssignmentHandler() gin.HandlerFunc {
 	return func(c *gin.Context) {
 		id, _ := strconv.Atoi(c.Param("id"))
-		assignment, ok := deviceAssignmentsStore[id]
-		if !ok {
-			c.JSON(http.StatusNotFound, gin.H{"error": "not found"})
+		assignment, err := deviceAssignmentService.Get(c.Request.Context(), id)
+		if err != nil {
+			c.JSON(assignmentErrorStatus(err), gin.H{"error": err.Error()})
+			return
+		}
+		if !authorizeProfile(c, assignment.HealthProfileID, models.ProfileRoleViewer) {
 			return
 		}
+		recordAudit(c, models.AuditActionView, models.AuditResourceDeviceAssignment, id, nil, nil)
 		c.JSON(http.StatusOK, assignment)
 	}
 }
 
 // @Summary 设备绑定列表
-// @Description 获取所有设备绑定信息
+// @Description 查询设备绑定记录（含历史），按绑定时间倒序；可按设备或档案查询绑定历史，仅返回有权访问的档案的绑定
 // @Tags DeviceAssignment
 // @Produce json
+// @Param device_id query int false "设备ID"
+// @Param profile_id query int false "健康档案ID"
+// @Param active query bool false "仅返回有效绑定"
+// @Param limit query int false "返回条数，默认200，最大1000"
 // @Success 200 {array} models.DeviceAssignment "列表成功"
 func listDeviceAssignmentsHandler() gin.HandlerFunc {
 	return func(c *gin.Context) {
-		var assignments []*models.DeviceAssignment
-		for _, a := range deviceAssignmentsStore {
-			assignments = append(assignments, a)
+		deviceID, _ := strconv.Atoi(c.Query("device_id"))
+		profileID, _ := strconv.Atoi(c.Query("profile_id"))
+		limit, _ := strconv.Atoi(c.Query("limit"))
+		activeOnly, _ := strconv.ParseBool(c.Query("active"))
+		query := service.DeviceAssignmentQuery{DeviceID: deviceID, ProfileID: profileID, ActiveOnly: activeOnly, Limit: limit}
+		if profileID > 0 {
+			if !authorizeProfile(c, profileID, models.ProfileRoleViewer) {
+				return
+			}
+		} else {
+			scope, err := profileSharingService.Scope(c.Request.Context(), currentPrincipal(c))
+			if err != nil {
+				c.JSON(profileErrorStatus(err), gin.H{"error": err.Error()})
+				return
+			}
+			if !scope.All && !scope.OrgWide {
+				query.ProfileIDs = scope.ProfileIDs
+				if query.ProfileIDs == nil {
+					query.ProfileIDs = []int{}
+				}
+			}
+		}
+		assignments, err := deviceAssignmentService.List(c.Request.Context(), query)
+		if err != nil {
+			c.JSON(assignmentErrorStatus(err), gin.H{"error": err.Error()})
+			return
 		}
+		recordAudit(c, models.AuditActionList, models.AuditResourceDeviceAssignment, nil, nil, nil)
 		c.JSON(http.StatusOK, assignments)
 	}
 }
 
 // @Summary 解绑设备
-// @Description 解绑指定设备，设置UnassignedAt时间
+// @Description 解除有效绑定，记录解绑时间（end_reason 为 unassigned），绑定记录保留为历史
 // @Tags DeviceAssignment
 // @Produce json
 // @Param id path int true "设备绑定ID"
 // @Success 200 {object} models.DeviceAssignment "解绑成功"
 // @Failure 404 {object} map[string]string "未找到"
+// @Failure 409 {object} map[string]string "绑定已解除"
 func unassignDeviceHandler() gin.HandlerFunc {
 	return func(c *gin.Context) {
 		id, _ := strconv.Atoi(c.Param("id"))
-		assignment, ok := deviceAssignmentsStore[id]
-		if !ok {
-			c.JSON(http.StatusNotFound, gin.H{"error": "not found"})
+		before, err := deviceAssignmentService.Get(c.Request.Context(), id)
+		if err != nil {
+			c.JSON(assignmentErrorStatus(err), gin.H{"error": err.Error()})
+			return
+		}
+		if !authorizeProfile(c, before.HealthProfileID, models.ProfileRoleCaregiver) {
 			return
 		}
-		now := time.Now()
-		assignment.UnassignedAt = &now
+		assignment, err := deviceAssignmentService.Unassign(c.Request.Context(), id)
+		if err != nil {
+			c.JSON(assignmentErrorStatus(err), gin.H{"error": err.Error()})
+			return
+		}
+		recordAudit(c, models.AuditActionUpdate, models.AuditResourceDeviceAssignment, id, before, assignment)
 		c.JSON(http.StatusOK, assignment)
 	}
 }
 
 // @Summary 删除设备绑定
-// @Description 根据ID删除设备绑定关系
+// @Description 根据ID删除设备绑定记录（仅管理员，用于纠正误录，会丢失历史；正常解绑请使用 unassign）
 // @Tags DeviceAssignment
 // @Produce json
 // @Param id path int true "设备绑定ID"
 // @Success 200 {object} map[string]interface{} "删除成功"
+// @Failure 403 {object} map[string]string "无权访问"
 // @Failure 404 {object} map[string]string "未找到"
 func deleteDeviceAssignmentHandler() gin.HandlerFunc {
 	return func(c *gin.Context) {
 		id, _ := strconv.Atoi(c.Param("id"))
-		_, ok := deviceAssignmentsStore[id]
-		if !ok {
-			c.JSON(http.StatusNotFound, gin.H{"error": "not found"})
+		before, err := deviceAssignmentService.Get(c.Request.Context(), id)
+		if err != nil {
+			c.JSON(assignmentErrorStatus(err), gin.H{"error": err.Error()})
+			return
+		}
+		if !authorizeProfile(c, before.HealthProfileID, models.ProfileRoleCaregiver) {
+			return
+		}
+		if err := deviceAssignmentService.Delete(c.Request.Context(), id); err != nil {
+			c.JSON(assignmentErrorStatus(err), gin.H{"error": err.Error()})
 			return
 		}
-		delete(deviceAssignmentsStore, id)
+		recordAudit(c, models.AuditActionDelete, models.AuditResourceDeviceAssignment, id, before, nil)
 		c.JSON(http.StatusOK, gin.H{"id": id, "message": "deleted"})
 	}
 }
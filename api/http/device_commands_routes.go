@@ -0,0 +1,140 @@
+// Package http 设备下行指令路由
+package http
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/fire-disposal/health_DT_go/internal/models"
+	"github.com/fire-disposal/health_DT_go/internal/service"
+	"github.com/gin-gonic/gin"
+)
+
+var deviceCommandService *service.DeviceCommandService
+
+// SendDeviceCommandRequest 下发设备指令请求
+type SendDeviceCommandRequest struct {
+	Name           string          `json:"name" binding:"required"` // set_sampling_interval / reboot / start_measurement / sync_clock
+	Params         json.RawMessage `json:"params" swaggertype:"object"`
+	TimeoutSeconds int             `json:"timeout_seconds"` // 等待设备确认的时限，默认 30，最长 600
+}
+
+// RegisterDeviceCommandRoutes 注册设备指令路由，权限与设备管理一致；svc 为 nil 时指令接口返回 503
+func RegisterDeviceCommandRoutes(router gin.IRouter, svc *service.DeviceCommandService, authService *service.AuthService) {
+	deviceCommandService = svc
+	group := router.Group("/devices/:id/commands", AuthMiddleware(authService),
+		RequireRoles(models.AdminRolePlatformAdmin, models.AdminRoleSuperAdmin, models.AdminRoleAdmin),
+		requireDeviceCommandService())
+	{
+		group.POST("", sendDeviceCommandHandler())
+		group.GET("", listDeviceCommandsHandler())
+		group.GET("/:command_id", getDeviceCommandHandler())
+	}
+}
+
+func requireDeviceCommandService() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if deviceCommandService == nil {
+			c.AbortWithStatusJSON(http.StatusServiceUnavailable, gin.H{"error": "设备下行通道未启用"})
+			return
+		}
+		c.Next()
+	}
+}
+
+// deviceCommandErrorStatus 将设备指令业务错误映射为 HTTP 状态码
+func deviceCommandErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, service.ErrDeviceUnknown), errors.Is(err, service.ErrDeviceCommandNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, service.ErrUnknownDeviceCommand), errors.Is(err, service.ErrInvalidDeviceCommandParams):
+		return http.StatusBadRequest
+	case errors.Is(err, service.ErrDeviceCommandPublish):
+		return http.StatusServiceUnavailable
+	}
+	return http.StatusInternalServerError
+}
+
+/*
+@Summary 下发设备指令
+@Description 经 MQTT 向 device/{sn}/cmd/{name} 下发指令，返回指令记录（status 为 sent）；设备通过 device/{sn}/ack 回执后变为 acked / failed，超时未确认变为 timed_out
+@Tags Device
+@Accept json
+@Produce json
+@Param id path int true "设备ID"
+@Param body body SendDeviceCommandRequest true "指令内容"
+@Success 202 {object} models.DeviceCommand "已下发"
+@Failure 400 {object} map[string]string "指令或参数错误"
+@Failure 404 {object} map[string]string "设备不存在或已停用"
+@Failure 503 {object} map[string]interface{} "下行通道不可用，指令记为 failed"
+*/
+func sendDeviceCommandHandler() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		deviceID, _ := strconv.Atoi(c.Param("id"))
+		var req SendDeviceCommandRequest
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		cmd, err := deviceCommandService.Send(c.Request.Context(), deviceID, currentPrincipal(c).UserID, service.SendDeviceCommandInput{
+			Name:           req.Name,
+			Params:         req.Params,
+			TimeoutSeconds: req.TimeoutSeconds,
+		})
+		if cmd != nil {
+			recordAudit(c, models.AuditActionCreate, models.AuditResourceDeviceCommand, cmd.ID, nil, cmd)
+		}
+		if err != nil {
+			c.JSON(deviceCommandErrorStatus(err), gin.H{"error": err.Error(), "command": cmd})
+			return
+		}
+		c.JSON(http.StatusAccepted, cmd)
+	}
+}
+
+/*
+@Summary 设备指令历史
+@Description 查询设备最近的下行指令及执行状态，按创建时间倒序
+@Tags Device
+@Produce json
+@Param id path int true "设备ID"
+@Param limit query int false "返回条数，默认 50，最大 200"
+@Success 200 {array} models.DeviceCommand "查询成功"
+*/
+func listDeviceCommandsHandler() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		deviceID, _ := strconv.Atoi(c.Param("id"))
+		limit, _ := strconv.Atoi(c.Query("limit"))
+		cmds, err := deviceCommandService.History(c.Request.Context(), deviceID, limit)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, cmds)
+	}
+}
+
+/*
+@Summary 获取设备指令详情
+@Description 根据ID查询指令状态与设备回执结果
+@Tags Device
+@Produce json
+@Param id path int true "设备ID"
+@Param command_id path int true "指令ID"
+@Success 200 {object} models.DeviceCommand "查询成功"
+@Failure 404 {object} map[string]string "指令不存在"
+*/
+func getDeviceCommandHandler() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		deviceID, _ := strconv.Atoi(c.Param("id"))
+		id, _ := strconv.ParseInt(c.Param("command_id"), 10, 64)
+		cmd, err := deviceCommandService.Get(c.Request.Context(), deviceID, id)
+		if err != nil {
+			c.JSON(deviceCommandErrorStatus(err), gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, cmd)
+	}
+}
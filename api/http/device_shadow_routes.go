@@ -0,0 +1,109 @@
+// Package http 设备影子路由
+package http
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/fire-disposal/health_DT_go/internal/models"
+	"github.com/fire-disposal/health_DT_go/internal/service"
+	"github.com/gin-gonic/gin"
+)
+
+var deviceShadowService *service.DeviceShadowService
+
+// UpdateDeviceShadowRequest 修改设备期望状态请求
+type UpdateDeviceShadowRequest struct {
+	State   json.RawMessage `json:"state" binding:"required" swaggertype:"object"` // 合并补丁，值为 null 删除该项
+	Version *int64          `json:"version"`                                       // 读取到的期望状态版本，不一致时返回 409；省略则基于当前版本修改
+}
+
+// RegisterDeviceShadowRoutes 注册设备影子路由，权限与设备管理一致；svc 为 nil 时返回 503
+func RegisterDeviceShadowRoutes(router gin.IRouter, svc *service.DeviceShadowService, authService *service.AuthService) {
+	deviceShadowService = svc
+	group := router.Group("/devices/:id/shadow", AuthMiddleware(authService),
+		RequireRoles(models.AdminRolePlatformAdmin, models.AdminRoleSuperAdmin, models.AdminRoleAdmin),
+		requireDeviceShadowService())
+	{
+		group.GET("", getDeviceShadowHandler())
+		group.PUT("/desired", updateDeviceShadowHandler())
+	}
+}
+
+func requireDeviceShadowService() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if deviceShadowService == nil {
+			c.AbortWithStatusJSON(http.StatusServiceUnavailable, gin.H{"error": "设备影子服务未启用"})
+			return
+		}
+		c.Next()
+	}
+}
+
+// deviceShadowErrorStatus 将设备影子业务错误映射为 HTTP 状态码
+func deviceShadowErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, service.ErrDeviceUnknown):
+		return http.StatusNotFound
+	case errors.Is(err, service.ErrInvalidDeviceShadowState):
+		return http.StatusBadRequest
+	case errors.Is(err, service.ErrDeviceShadowConflict):
+		return http.StatusConflict
+	}
+	return http.StatusInternalServerError
+}
+
+/*
+@Summary 获取设备影子
+@Description 查询设备期望状态（desired）、设备上报状态（reported）及二者差异（delta）
+@Tags Device
+@Produce json
+@Param id path int true "设备ID"
+@Success 200 {object} models.DeviceShadow "查询成功"
+@Failure 404 {object} map[string]string "设备不存在"
+*/
+func getDeviceShadowHandler() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id, _ := strconv.Atoi(c.Param("id"))
+		shadow, err := deviceShadowService.Get(c.Request.Context(), id)
+		if err != nil {
+			c.JSON(deviceShadowErrorStatus(err), gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, shadow)
+	}
+}
+
+/*
+@Summary 修改设备期望状态
+@Description 以合并补丁修改期望状态，版本加一，并经 MQTT 向 device/{sn}/shadow/delta 下发差异；携带的 version 与当前版本不一致时拒绝
+@Tags Device
+@Accept json
+@Produce json
+@Param id path int true "设备ID"
+@Param body body UpdateDeviceShadowRequest true "期望状态补丁"
+@Success 200 {object} models.DeviceShadow "修改成功"
+@Failure 400 {object} map[string]string "参数错误"
+@Failure 404 {object} map[string]string "设备不存在"
+@Failure 409 {object} map[string]string "版本冲突"
+*/
+func updateDeviceShadowHandler() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id, _ := strconv.Atoi(c.Param("id"))
+		var req UpdateDeviceShadowRequest
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		before, _ := deviceShadowService.Get(c.Request.Context(), id)
+		shadow, err := deviceShadowService.UpdateDesired(c.Request.Context(), id, req.State, req.Version)
+		if err != nil {
+			c.JSON(deviceShadowErrorStatus(err), gin.H{"error": err.Error()})
+			return
+		}
+		recordAudit(c, models.AuditActionUpdate, models.AuditResourceDeviceShadow, id, before, shadow)
+		c.JSON(http.StatusOK, shadow)
+	}
+}
@@ -0,0 +1,110 @@
+// Package http 设备电量与信号路由
+package http
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/fire-disposal/health_DT_go/internal/models"
+	"github.com/fire-disposal/health_DT_go/internal/service"
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+)
+
+const defaultTelemetryHours = 24
+
+var deviceTelemetryService *service.DeviceTelemetryService
+
+// DeviceTelemetryResponse 设备电量与信号查询结果
+type DeviceTelemetryResponse struct {
+	DeviceID          int                      `json:"device_id"`
+	Current           *models.DeviceTelemetry  `json:"current"`             // 最近一次采样，从未上报时为空
+	LowBatteryPercent int                      `json:"low_battery_percent"` // 该设备类型的低电量阈值
+	PoorSignalRSSI    int                      `json:"poor_signal_rssi"`    // 该设备类型的弱信号阈值（dBm）
+	History           []models.DeviceTelemetry `json:"history"`             // 按时间先后
+}
+
+// RegisterDeviceTelemetryRoutes 注册设备电量与信号路由，权限与设备管理一致；svc 为 nil 时返回 503，
+// 设备查询接口不返回电量与信号
+func RegisterDeviceTelemetryRoutes(router gin.IRouter, svc *service.DeviceTelemetryService, authService *service.AuthService) {
+	deviceTelemetryService = svc
+	router.GET("/devices/:id/telemetry", AuthMiddleware(authService),
+		RequireRoles(models.AdminRolePlatformAdmin, models.AdminRoleSuperAdmin, models.AdminRoleAdmin),
+		requireDeviceTelemetryService(), getDeviceTelemetryHandler())
+}
+
+func requireDeviceTelemetryService() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if deviceTelemetryService == nil {
+			c.AbortWithStatusJSON(http.StatusServiceUnavailable, gin.H{"error": "设备电量与信号监测未启用"})
+			return
+		}
+		c.Next()
+	}
+}
+
+// annotateTelemetry 填充设备最近一次电量与信号；查询失败仅记录日志，设备信息照常返回
+func annotateTelemetry(c *gin.Context, devices []models.Device) {
+	if deviceTelemetryService == nil {
+		return
+	}
+	if err := deviceTelemetryService.Annotate(c.Request.Context(), devices); err != nil {
+		zap.L().Warn("设备电量与信号查询失败", zap.Error(err))
+	}
+}
+
+/*
+@Summary 查询设备电量与信号
+@Description 返回设备最近一次电量、充电状态、RSSI 与 SNR，该设备类型的告警阈值，以及最近 hours 小时的采样历史
+@Description （默认 24 小时，不超过历史保留时长）
+@Tags Device
+@Produce json
+@Param id path int true "设备ID"
+@Param hours query int false "历史时长（小时）"
+@Success 200 {object} DeviceTelemetryResponse "查询成功"
+@Failure 400 {object} map[string]string "参数错误"
+@Failure 404 {object} map[string]string "设备不存在"
+*/
+func getDeviceTelemetryHandler() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id, _ := strconv.Atoi(c.Param("id"))
+		hours := defaultTelemetryHours
+		if v := c.Query("hours"); v != "" {
+			n, err := strconv.Atoi(v)
+			if err != nil || n <= 0 {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "hours 须为正整数"})
+				return
+			}
+			hours = n
+		}
+		window := time.Duration(hours) * time.Hour
+		if retention := deviceTelemetryService.Retention(); window > retention {
+			window = retention
+		}
+		device, err := devicesService.Get(c.Request.Context(), id)
+		if err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+			return
+		}
+		annotated := []models.Device{*device}
+		if err := deviceTelemetryService.Annotate(c.Request.Context(), annotated); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		history, err := deviceTelemetryService.History(c.Request.Context(), id, time.Now().Add(-window))
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		lowBattery, poorSignal := deviceTelemetryService.Thresholds(device.DeviceType)
+		recordAudit(c, models.AuditActionView, models.AuditResourceDevice, id, nil, nil)
+		c.JSON(http.StatusOK, DeviceTelemetryResponse{
+			DeviceID:          id,
+			Current:           annotated[0].Telemetry,
+			LowBatteryPercent: lowBattery,
+			PoorSignalRSSI:    poorSignal,
+			History:           history,
+		})
+	}
+}
@@ -0,0 +1,223 @@
+// Package http 设备类型目录路由
+package http
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/fire-disposal/health_DT_go/internal/models"
+	"github.com/fire-disposal/health_DT_go/internal/repository/postgres"
+	"github.com/fire-disposal/health_DT_go/internal/service"
+	"github.com/gin-gonic/gin"
+)
+
+var deviceTypeService *service.DeviceTypeService
+
+// DeviceTypeRequest 登记或修改设备类型请求（修改时整体替换，code 以路径为准）
+type DeviceTypeRequest struct {
+	Code                     string                `json:"code"` // 仅创建时使用，对应设备的 device_type
+	Name                     string                `json:"name" binding:"required"`
+	Description              string                `json:"description"`
+	ReportingIntervalSeconds int                   `json:"reporting_interval_seconds"` // 预期上报间隔，0 表示不固定
+	Metrics                  []models.DeviceMetric `json:"metrics"`
+	PayloadSchema            json.RawMessage       `json:"payload_schema" swaggertype:"object"` // 上报数据 JSON Schema，省略不校验
+}
+
+func (r DeviceTypeRequest) input() service.DeviceTypeInput {
+	return service.DeviceTypeInput{
+		Name:                     r.Name,
+		Description:              r.Description,
+		ReportingIntervalSeconds: r.ReportingIntervalSeconds,
+		Metrics:                  r.Metrics,
+		PayloadSchema:            r.PayloadSchema,
+	}
+}
+
+// RegisterDeviceTypeRoutes 注册设备类型目录路由：管理员可查询，仅平台管理员可登记、修改与删除；svc 为 nil 时返回 503
+func RegisterDeviceTypeRoutes(router gin.IRouter, svc *service.DeviceTypeService, authService *service.AuthService) {
+	deviceTypeService = svc
+	group := router.Group("/device_types", AuthMiddleware(authService),
+		RequireRoles(models.AdminRolePlatformAdmin, models.AdminRoleSuperAdmin, models.AdminRoleAdmin),
+		requireDeviceTypeService())
+	{
+		group.GET("", listDeviceTypesHandler())
+		group.GET("/:code", getDeviceTypeHandler())
+		group.POST("/:code/validate", validateDeviceTypePayloadHandler())
+		group.POST("", RequireRoles(models.AdminRolePlatformAdmin), createDeviceTypeHandler())
+		group.PUT("/:code", RequireRoles(models.AdminRolePlatformAdmin), updateDeviceTypeHandler())
+		group.DELETE("/:code", RequireRoles(models.AdminRolePlatformAdmin), deleteDeviceTypeHandler())
+	}
+}
+
+func requireDeviceTypeService() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if deviceTypeService == nil {
+			c.AbortWithStatusJSON(http.StatusServiceUnavailable, gin.H{"error": "设备类型目录未启用"})
+			return
+		}
+		c.Next()
+	}
+}
+
+// deviceTypeErrorStatus 将设备类型业务错误映射为 HTTP 状态码
+func deviceTypeErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, service.ErrDeviceTypeNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, postgres.ErrDeviceTypeExists), errors.Is(err, service.ErrDeviceTypeInUse):
+		return http.StatusConflict
+	case errors.Is(err, service.ErrInvalidDeviceType):
+		return http.StatusBadRequest
+	case errors.Is(err, service.ErrPayloadRejected):
+		return http.StatusUnprocessableEntity
+	}
+	return http.StatusInternalServerError
+}
+
+/*
+@Summary 设备类型列表
+@Description 查询设备类型目录：指标（字段名、单位、有效范围、图表类型）、预期上报间隔与上报数据 JSON Schema
+@Tags DeviceType
+@Produce json
+@Success 200 {array} models.DeviceType "查询成功"
+*/
+func listDeviceTypesHandler() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		list, err := deviceTypeService.List(c.Request.Context())
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, list)
+	}
+}
+
+/*
+@Summary 获取设备类型
+@Description 按编码查询设备类型
+@Tags DeviceType
+@Produce json
+@Param code path string true "设备类型编码"
+@Success 200 {object} models.DeviceType "查询成功"
+@Failure 404 {object} map[string]string "设备类型不存在"
+*/
+func getDeviceTypeHandler() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		t, err := deviceTypeService.Get(c.Request.Context(), c.Param("code"))
+		if err != nil {
+			c.JSON(deviceTypeErrorStatus(err), gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, t)
+	}
+}
+
+/*
+@Summary 登记设备类型
+@Description 新增设备类型（仅平台管理员），code 对应设备的 device_type；payload_schema 支持 JSON Schema 常用关键字，
+@Description 包含不支持的关键字时返回 400。登记后该类型设备的上报数据按 Schema 与指标范围校验，不符合的数据丢弃
+@Tags DeviceType
+@Accept json
+@Produce json
+@Param body body DeviceTypeRequest true "设备类型"
+@Success 201 {object} models.DeviceType "登记成功"
+@Failure 400 {object} map[string]string "参数错误"
+@Failure 409 {object} map[string]string "编码已存在"
+*/
+func createDeviceTypeHandler() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var req DeviceTypeRequest
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		t, err := deviceTypeService.Create(c.Request.Context(), req.Code, req.input())
+		if err != nil {
+			c.JSON(deviceTypeErrorStatus(err), gin.H{"error": err.Error()})
+			return
+		}
+		recordAudit(c, models.AuditActionCreate, models.AuditResourceDeviceType, t.Code, nil, t)
+		c.JSON(http.StatusCreated, t)
+	}
+}
+
+/*
+@Summary 修改设备类型
+@Description 整体替换设备类型定义（仅平台管理员），编码不可修改
+@Tags DeviceType
+@Accept json
+@Produce json
+@Param code path string true "设备类型编码"
+@Param body body DeviceTypeRequest true "设备类型"
+@Success 200 {object} models.DeviceType "修改成功"
+@Failure 400 {object} map[string]string "参数错误"
+@Failure 404 {object} map[string]string "设备类型不存在"
+*/
+func updateDeviceTypeHandler() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var req DeviceTypeRequest
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		code := c.Param("code")
+		before, _ := deviceTypeService.Get(c.Request.Context(), code)
+		t, err := deviceTypeService.Update(c.Request.Context(), code, req.input())
+		if err != nil {
+			c.JSON(deviceTypeErrorStatus(err), gin.H{"error": err.Error()})
+			return
+		}
+		recordAudit(c, models.AuditActionUpdate, models.AuditResourceDeviceType, code, before, t)
+		c.JSON(http.StatusOK, t)
+	}
+}
+
+/*
+@Summary 删除设备类型
+@Description 删除设备类型（仅平台管理员），仍有设备使用该类型时返回 409
+@Tags DeviceType
+@Param code path string true "设备类型编码"
+@Success 204 "删除成功"
+@Failure 404 {object} map[string]string "设备类型不存在"
+@Failure 409 {object} map[string]string "仍有设备使用"
+*/
+func deleteDeviceTypeHandler() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		code := c.Param("code")
+		before, _ := deviceTypeService.Get(c.Request.Context(), code)
+		if err := deviceTypeService.Delete(c.Request.Context(), code); err != nil {
+			c.JSON(deviceTypeErrorStatus(err), gin.H{"error": err.Error()})
+			return
+		}
+		recordAudit(c, models.AuditActionDelete, models.AuditResourceDeviceType, code, before, nil)
+		c.Status(http.StatusNoContent)
+	}
+}
+
+/*
+@Summary 校验示例数据
+@Description 按设备类型的 payload_schema 与指标范围校验一条示例上报数据（即 MQTT 消息的 data 字段），不符合时返回 422 及首个不符合项
+@Tags DeviceType
+@Accept json
+@Produce json
+@Param code path string true "设备类型编码"
+@Param body body object true "示例数据"
+@Success 200 {object} map[string]interface{} "校验通过"
+@Failure 404 {object} map[string]string "设备类型不存在"
+@Failure 422 {object} map[string]string "校验未通过"
+*/
+func validateDeviceTypePayloadHandler() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var payload map[string]interface{}
+		if err := c.ShouldBindJSON(&payload); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "请求体须为 JSON 对象"})
+			return
+		}
+		if err := deviceTypeService.Check(c.Request.Context(), c.Param("code"), payload); err != nil {
+			c.JSON(deviceTypeErrorStatus(err), gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"valid": true})
+	}
+}
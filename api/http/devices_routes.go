@@ -2,20 +2,34 @@
 package http
 
 import (
+	"errors"
 	"net/http"
 	"strconv"
 
 	"github.com/fire-disposal/health_DT_go/internal/models"
 	"github.com/fire-disposal/health_DT_go/internal/service"
 	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
 )
 
-var devicesService *service.DevicesService
+var (
+	devicesService    *service.DevicesService
+	deviceAuthService *service.DeviceAuthService
+	presenceService   *service.PresenceService
+)
 
-func RegisterDevicesRoutes(router gin.IRouter, svc *service.DevicesService) {
+func RegisterDevicesRoutes(router gin.IRouter, svc *service.DevicesService, deviceAuth *service.DeviceAuthService,
+	presence *service.PresenceService, authService *service.AuthService) {
 	devicesService = svc
-	devicesGroup := router.Group("/devices")
+	deviceAuthService = deviceAuth
+	presenceService = presence
+	// 设备管理仅限管理员，组织管理员只能看到本组织设备
+	devicesGroup := router.Group("/devices", AuthMiddleware(authService),
+		RequireRoles(models.AdminRolePlatformAdmin, models.AdminRoleSuperAdmin, models.AdminRoleAdmin))
 	{
+		devicesGroup.GET("/auth_stats", deviceAuthStatsHandler())
+		devicesGroup.POST("/:id/rotate_secret", rotateDeviceSecretHandler())
+
 		devicesGroup.POST("", createDeviceHandler())
 		devicesGroup.GET("/:id", getDeviceHandler())
 		devicesGroup.PUT("/:id", updateDeviceHandler())
@@ -27,12 +41,12 @@ func RegisterDevicesRoutes(router gin.IRouter, svc *service.DevicesService) {
 
 /*
 @Summary 创建设备
-@Description 新增设备，需提交设备信息
+@Description 新增设备，需提交设备信息；组织管理员创建的设备归属其所属组织，平台管理员可通过 org_id 指定
 @Tags Device
 @Accept json
 @Produce json
 @Param body body models.Device true "设备信息"
-@Success 201 {object} map[string]int "创建成功，返回设备ID"
+@Success 201 {object} map[string]interface{} "创建成功，返回设备ID与签名密钥（仅此一次）"
 @Failure 400 {object} map[string]string "参数错误"
 @Failure 500 {object} map[string]string "创建失败"
 */
@@ -48,13 +62,17 @@ func createDeviceHandler() gin.HandlerFunc {
 			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 			return
 		}
-		c.JSON(http.StatusCreated, gin.H{"id": id})
+		req.ID = id
+		// 清除该序列号的未注册缓存，设备无需等待缓存过期即可认证
+		deviceAuthService.Forget(req.SerialNumber)
+		recordAudit(c, models.AuditActionCreate, models.AuditResourceDevice, id, nil, &req)
+		c.JSON(http.StatusCreated, gin.H{"id": id, "device_secret": req.SecretKey})
 	}
 }
 
 /*
 @Summary 获取设备详情
-@Description 根据ID查询设备信息
+@Description 根据ID查询设备信息，含在线状态（presence）与位置
 @Tags Device
 @Produce json
 @Param id path int true "设备ID"
@@ -69,7 +87,12 @@ func getDeviceHandler() gin.HandlerFunc {
 			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
 			return
 		}
-		c.JSON(http.StatusOK, device)
+		annotated := []models.Device{*device}
+		annotatePresence(c, annotated)
+		annotateTelemetry(c, annotated)
+		annotateDeviceLocations(c, annotated)
+		recordAudit(c, models.AuditActionView, models.AuditResourceDevice, id, nil, nil)
+		c.JSON(http.StatusOK, annotated[0])
 	}
 }
 
@@ -83,6 +106,7 @@ func getDeviceHandler() gin.HandlerFunc {
 @Param body body models.Device true "设备信息"
 @Success 200 {object} map[string]interface{} "更新成功"
 @Failure 400 {object} map[string]string "参数错误"
+@Failure 404 {object} map[string]string "未找到"
 @Failure 500 {object} map[string]string "更新失败"
 */
 func updateDeviceHandler() gin.HandlerFunc {
@@ -94,10 +118,17 @@ func updateDeviceHandler() gin.HandlerFunc {
 			return
 		}
 		req.ID = id
+		before, _ := devicesService.Get(c.Request.Context(), id)
 		if err := devicesService.Update(c.Request.Context(), &req); err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			c.JSON(notFoundOr500(err), gin.H{"error": err.Error()})
 			return
 		}
+		// 序列号或激活状态可能已变更，使认证缓存立即失效
+		deviceAuthService.Forget(req.SerialNumber)
+		if before != nil {
+			deviceAuthService.Forget(before.SerialNumber)
+		}
+		recordAudit(c, models.AuditActionUpdate, models.AuditResourceDevice, id, before, &req)
 		c.JSON(http.StatusOK, gin.H{"id": id, "message": "updated"})
 	}
 }
@@ -109,41 +140,62 @@ func updateDeviceHandler() gin.HandlerFunc {
 @Produce json
 @Param id path int true "设备ID"
 @Success 200 {object} map[string]interface{} "删除成功"
+@Failure 404 {object} map[string]string "未找到"
 @Failure 500 {object} map[string]string "删除失败"
 */
 func deleteDeviceHandler() gin.HandlerFunc {
 	return func(c *gin.Context) {
 		id, _ := strconv.Atoi(c.Param("id"))
+		before, _ := devicesService.Get(c.Request.Context(), id)
 		if err := devicesService.Delete(c.Request.Context(), id); err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			c.JSON(notFoundOr500(err), gin.H{"error": err.Error()})
 			return
 		}
+		if before != nil {
+			deviceAuthService.Forget(before.SerialNumber)
+		}
+		recordAudit(c, models.AuditActionDelete, models.AuditResourceDevice, id, before, nil)
 		c.JSON(http.StatusOK, gin.H{"id": id, "message": "deleted"})
 	}
 }
 
 /*
 @Summary 设备列表
-@Description 获取所有设备信息
+@Description 获取所有设备信息，含在线状态（presence）与位置；指定 location_id 时仅返回放置在该位置及其下级位置的设备
 @Tags Device
 @Produce json
+@Param location_id query int false "位置ID"
 @Success 200 {array} models.Device "列表成功"
 @Failure 500 {object} map[string]string "获取失败"
 */
 func listDevicesHandler() gin.HandlerFunc {
 	return func(c *gin.Context) {
-		devices, err := devicesService.List(c.Request.Context())
+		locationID, ok := locationQuery(c)
+		if !ok {
+			return
+		}
+		var devices []models.Device
+		var err error
+		if locationID > 0 {
+			devices, err = devicesService.ListByLocation(c.Request.Context(), locationID)
+		} else {
+			devices, err = devicesService.List(c.Request.Context())
+		}
 		if err != nil {
 			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 			return
 		}
+		annotatePresence(c, devices)
+		annotateTelemetry(c, devices)
+		annotateDeviceLocations(c, devices)
+		recordAudit(c, models.AuditActionList, models.AuditResourceDevice, nil, nil, nil)
 		c.JSON(http.StatusOK, devices)
 	}
 }
 
 /*
 @Summary 设备绑定健康档案
-@Description 将设备绑定到指定健康档案
+@Description 将设备绑定到指定健康档案，设备已绑定其他档案时自动解除原绑定
 @Tags Device
 @Accept json
 @Produce json
@@ -151,7 +203,7 @@ func listDevicesHandler() gin.HandlerFunc {
 @Param body body object true "健康档案ID"
 @Success 200 {object} map[string]interface{} "绑定成功"
 @Failure 400 {object} map[string]string "参数错误"
-@Failure 500 {object} map[string]string "绑定失败"
+@Failure 404 {object} map[string]string "设备或档案不存在"
 */
 func bindDeviceToProfileHandler() gin.HandlerFunc {
 	return func(c *gin.Context) {
@@ -163,10 +215,61 @@ func bindDeviceToProfileHandler() gin.HandlerFunc {
 			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 			return
 		}
-		if err := devicesService.AssignDeviceToProfile(c.Request.Context(), deviceID, req.ProfileID); err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		result, ok := assignDevice(c, deviceID, req.ProfileID)
+		if !ok {
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"device_id": deviceID, "profile_id": req.ProfileID, "message": "bound",
+			"assignment": result.Assignment})
+	}
+}
+
+// annotatePresence 填充设备在线状态；Redis 不可用时仅记录日志，设备信息照常返回
+func annotatePresence(c *gin.Context, devices []models.Device) {
+	if presenceService == nil {
+		return
+	}
+	if err := presenceService.Annotate(c.Request.Context(), devices); err != nil {
+		zap.L().Warn("设备在线状态查询失败", zap.Error(err))
+	}
+}
+
+/*
+@Summary 轮换设备签名密钥
+@Description 生成新的设备签名密钥，旧密钥立即失效；新密钥仅在本次响应中返回
+@Tags Device
+@Produce json
+@Param id path int true "设备ID"
+@Success 200 {object} map[string]interface{} "轮换成功"
+@Failure 404 {object} map[string]string "设备不存在"
+@Failure 500 {object} map[string]string "轮换失败"
+*/
+func rotateDeviceSecretHandler() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id, _ := strconv.Atoi(c.Param("id"))
+		secret, err := deviceAuthService.RotateSecret(c.Request.Context(), id)
+		if err != nil {
+			status := http.StatusInternalServerError
+			if errors.Is(err, service.ErrDeviceUnknown) {
+				status = http.StatusNotFound
+			}
+			c.JSON(status, gin.H{"error": err.Error()})
 			return
 		}
-		c.JSON(http.StatusOK, gin.H{"device_id": deviceID, "profile_id": req.ProfileID, "message": "bound"})
+		recordAudit(c, "rotate_secret", models.AuditResourceDevice, id, nil, nil)
+		c.JSON(http.StatusOK, gin.H{"id": id, "device_secret": secret})
+	}
+}
+
+/*
+@Summary 设备认证统计
+@Description 查询设备消息签名校验的拒绝次数（按接入通道与原因统计）
+@Tags Device
+@Produce json
+@Success 200 {object} map[string]interface{} "统计结果"
+*/
+func deviceAuthStatsHandler() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.JSON(http.StatusOK, gin.H{"required": deviceAuthService.Required(), "rejected": deviceAuthService.Stats()})
 	}
 }
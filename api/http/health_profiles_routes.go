@@ -12,21 +12,27 @@ import (
 
 var healthProfilesService *service.HealthProfilesService
 
-func RegisterHealthProfilesRoutes(router gin.IRouter, svc *service.HealthProfilesService) {
+// RegisterHealthProfilesRoutes 注册健康档案路由；App 用户仅能访问其有效成员关系内的档案
+func RegisterHealthProfilesRoutes(router gin.IRouter, svc *service.HealthProfilesService, sharing *service.ProfileSharingService,
+	authService *service.AuthService) {
 	healthProfilesService = svc
+	profileSharingService = sharing
+	// 查询接口同时接受具备 read:health_profiles 授权范围的 API Key
+	auth := AuthMiddleware(authService)
+	readAuth := AuthMiddleware(authService, models.APIKeyScopeReadHealthProfiles)
 	profilesGroup := router.Group("/health_profiles")
 	{
-		profilesGroup.POST("", createHealthProfileHandler())
-		profilesGroup.GET("/:id", getHealthProfileHandler())
-		profilesGroup.PUT("/:id", updateHealthProfileHandler())
-		profilesGroup.DELETE("/:id", deleteHealthProfileHandler())
-		profilesGroup.GET("", listHealthProfilesHandler())
-		profilesGroup.POST("/:id/bind_device", bindProfileToDeviceHandler())
+		profilesGroup.POST("", auth, createHealthProfileHandler())
+		profilesGroup.GET("/:id", readAuth, getHealthProfileHandler())
+		profilesGroup.PUT("/:id", auth, updateHealthProfileHandler())
+		profilesGroup.DELETE("/:id", auth, deleteHealthProfileHandler())
+		profilesGroup.GET("", readAuth, listHealthProfilesHandler())
+		profilesGroup.POST("/:id/bind_device", auth, bindProfileToDeviceHandler())
 	}
 }
 
 // @Summary 创建健康档案
-// @Description 新增健康档案，需提交完整信息
+// @Description 新增健康档案，管理员创建的档案归属其组织；App 用户创建的为个人档案，不归属组织，创建者自动成为拥有者
 // @Tags HealthProfile
 // @Accept json
 // @Produce json
@@ -41,11 +47,21 @@ func createHealthProfileHandler() gin.HandlerFunc {
 			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 			return
 		}
-		id, err := healthProfilesService.Create(c.Request.Context(), &req)
+		var (
+			id  int
+			err error
+		)
+		if principal := currentPrincipal(c); principal.IsAdmin() {
+			id, err = healthProfilesService.Create(c.Request.Context(), &req)
+		} else {
+			id, err = healthProfilesService.CreatePersonal(c.Request.Context(), &req, int(principal.UserID))
+		}
 		if err != nil {
 			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 			return
 		}
+		req.ID = id
+		recordAudit(c, models.AuditActionCreate, models.AuditResourceHealthProfile, id, nil, &req)
 		c.JSON(http.StatusCreated, gin.H{"id": id})
 	}
 }
@@ -60,12 +76,18 @@ func createHealthProfileHandler() gin.HandlerFunc {
 func getHealthProfileHandler() gin.HandlerFunc {
 	return func(c *gin.Context) {
 		id, _ := strconv.Atoi(c.Param("id"))
+		if !authorizeProfile(c, id, models.ProfileRoleViewer) {
+			return
+		}
 		profile, err := healthProfilesService.Get(c.Request.Context(), id)
 		if err != nil {
 			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
 			return
 		}
-		c.JSON(http.StatusOK, profile)
+		annotated := []models.HealthProfile{*profile}
+		annotateProfileBeds(c, annotated)
+		recordAudit(c, models.AuditActionView, models.AuditResourceHealthProfile, id, nil, nil)
+		c.JSON(http.StatusOK, annotated[0])
 	}
 }
 
@@ -78,6 +100,7 @@ func getHealthProfileHandler() gin.HandlerFunc {
 // @Param body body models.HealthProfile true "健康档案信息"
 // @Success 200 {object} map[string]interface{} "更新成功"
 // @Failure 400 {object} map[string]string "参数错误"
+// @Failure 404 {object} map[string]string "未找到"
 // @Failure 500 {object} map[string]string "更新失败"
 func updateHealthProfileHandler() gin.HandlerFunc {
 	return func(c *gin.Context) {
@@ -88,10 +111,18 @@ func updateHealthProfileHandler() gin.HandlerFunc {
 			return
 		}
 		req.ID = id
+		if !authorizeProfile(c, id, models.ProfileRoleCaregiver) {
+			return
+		}
+		before, _ := healthProfilesService.Get(c.Request.Context(), id)
+		if before != nil && !currentPrincipal(c).IsAdmin() {
+			req.UserID = before.UserID // 归属关系通过成员管理维护，App 用户不可直接修改
+		}
 		if err := healthProfilesService.Update(c.Request.Context(), &req); err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			c.JSON(notFoundOr500(err), gin.H{"error": err.Error()})
 			return
 		}
+		recordAudit(c, models.AuditActionUpdate, models.AuditResourceHealthProfile, id, before, &req)
 		c.JSON(http.StatusOK, gin.H{"id": id, "message": "updated"})
 	}
 }
@@ -102,37 +133,55 @@ func updateHealthProfileHandler() gin.HandlerFunc {
 // @Produce json
 // @Param id path int true "健康档案ID"
 // @Success 200 {object} map[string]interface{} "删除成功"
+// @Failure 404 {object} map[string]string "未找到"
 // @Failure 500 {object} map[string]string "删除失败"
 func deleteHealthProfileHandler() gin.HandlerFunc {
 	return func(c *gin.Context) {
 		id, _ := strconv.Atoi(c.Param("id"))
+		if !authorizeProfile(c, id, models.ProfileRoleOwner) {
+			return
+		}
+		before, _ := healthProfilesService.Get(c.Request.Context(), id)
 		if err := healthProfilesService.Delete(c.Request.Context(), id); err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			c.JSON(notFoundOr500(err), gin.H{"error": err.Error()})
 			return
 		}
+		recordAudit(c, models.AuditActionDelete, models.AuditResourceHealthProfile, id, before, nil)
 		c.JSON(http.StatusOK, gin.H{"id": id, "message": "deleted"})
 	}
 }
 
 // @Summary 健康档案列表
-// @Description 获取所有健康档案信息
+// @Description 管理员获取全部档案，App 用户获取其有效成员关系内的档案
 // @Tags HealthProfile
 // @Produce json
 // @Success 200 {array} models.HealthProfile "列表成功"
 // @Failure 500 {object} map[string]string "获取失败"
 func listHealthProfilesHandler() gin.HandlerFunc {
 	return func(c *gin.Context) {
-		profiles, err := healthProfilesService.List(c.Request.Context())
+		scope, err := profileSharingService.Scope(c.Request.Context(), currentPrincipal(c))
+		if err != nil {
+			c.JSON(profileErrorStatus(err), gin.H{"error": err.Error()})
+			return
+		}
+		var profiles []models.HealthProfile
+		if scope.All || scope.OrgWide {
+			profiles, err = healthProfilesService.List(c.Request.Context())
+		} else {
+			profiles, err = healthProfilesService.ListByIDs(c.Request.Context(), scope.ProfileIDs)
+		}
 		if err != nil {
 			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 			return
 		}
+		annotateProfileBeds(c, profiles)
+		recordAudit(c, models.AuditActionList, models.AuditResourceHealthProfile, nil, nil, nil)
 		c.JSON(http.StatusOK, profiles)
 	}
 }
 
 // @Summary 健康档案绑定设备
-// @Description 将健康档案绑定到指定设备
+// @Description 将健康档案绑定到指定设备，设备已绑定其他档案时自动解除原绑定
 // @Tags HealthProfile
 // @Accept json
 // @Produce json
@@ -140,7 +189,7 @@ func listHealthProfilesHandler() gin.HandlerFunc {
 // @Param body body object true "设备ID"
 // @Success 200 {object} map[string]interface{} "绑定成功"
 // @Failure 400 {object} map[string]string "参数错误"
-// @Failure 500 {object} map[string]string "绑定失败"
+// @Failure 404 {object} map[string]string "设备或档案不存在"
 func bindProfileToDeviceHandler() gin.HandlerFunc {
 	return func(c *gin.Context) {
 		profileID, _ := strconv.Atoi(c.Param("id"))
@@ -151,10 +200,11 @@ func bindProfileToDeviceHandler() gin.HandlerFunc {
 			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 			return
 		}
-		if err := healthProfilesService.AssignProfileToDevice(c.Request.Context(), profileID, req.DeviceID); err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		result, ok := assignDevice(c, req.DeviceID, profileID)
+		if !ok {
 			return
 		}
-		c.JSON(http.StatusOK, gin.H{"profile_id": profileID, "device_id": req.DeviceID, "message": "bound"})
+		c.JSON(http.StatusOK, gin.H{"profile_id": profileID, "device_id": req.DeviceID, "message": "bound",
+			"assignment": result.Assignment})
 	}
 }
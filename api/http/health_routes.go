@@ -3,94 +3,167 @@ package http
 
 import (
 	"database/sql"
+	"errors"
 	"net/http"
 	"strconv"
+	"time"
 
 	"github.com/fire-disposal/health_DT_go/internal/models"
+	"github.com/fire-disposal/health_DT_go/internal/repository/postgres"
+	"github.com/fire-disposal/health_DT_go/internal/service"
 	"github.com/gin-gonic/gin"
 )
 
 // RegisterHealthDataRoutes 注册健康数据记录通用 CRUD 路由
-func RegisterHealthDataRoutes(router gin.IRouter, db *sql.DB) {
+func RegisterHealthDataRoutes(router gin.IRouter, db *sql.DB, authService *service.AuthService) {
+	healthDataRepo := postgres.NewHealthDataRepository(db)
+	auth := AuthMiddleware(authService)
 	healthGroup := router.Group("/health_data")
 	{
-		healthGroup.POST("", createHealthDataHandler())
-		healthGroup.GET("/:id", getHealthDataHandler())
-		healthGroup.PUT("/:id", updateHealthDataHandler())
-		healthGroup.DELETE("/:id", deleteHealthDataHandler())
+		// 写入接口同时接受具备 write:health_data 授权范围的 API Key（第三方系统推送手工录入数据）
+		healthGroup.POST("", AuthMiddleware(authService, models.APIKeyScopeWriteHealthData), createHealthDataHandler(healthDataRepo))
+		healthGroup.GET("/:id", auth, getHealthDataHandler(healthDataRepo))
+		healthGroup.PUT("/:id", auth, updateHealthDataHandler(healthDataRepo))
+		healthGroup.DELETE("/:id", auth, deleteHealthDataHandler(healthDataRepo))
 	}
 	// 注册告警和事件 RESTful 路由
-	RegisterAlertsRoutes(router, db)
+	RegisterAlertsRoutes(router, db, authService)
 }
 
 // @Summary 创建健康数据记录
-// @Description 新增一条健康数据
+// @Description 新增一条健康数据，需具备档案照护权限；recorded_at 为空时取当前时间
 // @Tags health_data
 // @Accept json
 // @Produce json
 // @Param data body models.HealthDataRecord true "健康数据内容"
-// @Success 201 {object} map[string]string
+// @Success 201 {object} map[string]interface{}
+// @Failure 403 {object} map[string]string "无权访问"
 // @Router /health_data [post]
-func createHealthDataHandler() gin.HandlerFunc {
+func createHealthDataHandler(repo *postgres.HealthDataRepository) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		var req models.HealthDataRecord
 		if err := c.ShouldBindJSON(&req); err != nil {
 			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 			return
 		}
-		// TODO: 仓储层保存 req
-		c.JSON(http.StatusCreated, gin.H{"message": "created"})
+		if req.HealthProfileID <= 0 || req.SchemaType == "" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "health_profile_id 与 schema_type 不能为空"})
+			return
+		}
+		if !authorizeProfile(c, req.HealthProfileID, models.ProfileRoleCaregiver) {
+			return
+		}
+		if req.RecordedAt.IsZero() {
+			req.RecordedAt = time.Now()
+		}
+		id, err := repo.Create(&req)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		req.ID = id
+		recordAudit(c, models.AuditActionCreate, models.AuditResourceHealthData, id, nil, req)
+		c.JSON(http.StatusCreated, gin.H{"id": id, "message": "created"})
 	}
 }
 
+// loadHealthData 查询健康数据记录并校验当前用户对所属档案的权限，失败时已写入响应
+func loadHealthData(c *gin.Context, repo *postgres.HealthDataRepository, minRole string) (*models.HealthDataRecord, bool) {
+	id, _ := strconv.ParseInt(c.Param("id"), 10, 64)
+	record, err := repo.Get(id)
+	if errors.Is(err, sql.ErrNoRows) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "健康数据不存在"})
+		return nil, false
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return nil, false
+	}
+	if !authorizeProfile(c, record.HealthProfileID, minRole) {
+		return nil, false
+	}
+	return record, true
+}
+
 // @Summary 查询健康数据记录
-// @Description 根据ID获取健康数据
+// @Description 根据ID获取健康数据，需具备所属档案的查看权限
 // @Tags health_data
 // @Produce json
 // @Param id path int true "健康数据ID"
-// @Success 200 {object} map[string]interface{}
+// @Success 200 {object} models.HealthDataRecord
+// @Failure 403 {object} map[string]string "无权访问"
+// @Failure 404 {object} map[string]string "未找到"
 // @Router /health_data/{id} [get]
-func getHealthDataHandler() gin.HandlerFunc {
+func getHealthDataHandler(repo *postgres.HealthDataRepository) gin.HandlerFunc {
 	return func(c *gin.Context) {
-		id, _ := strconv.ParseInt(c.Param("id"), 10, 64)
-		// TODO: 仓储层查询
-		c.JSON(http.StatusOK, gin.H{"id": id})
+		record, ok := loadHealthData(c, repo, models.ProfileRoleViewer)
+		if !ok {
+			return
+		}
+		recordAudit(c, models.AuditActionView, models.AuditResourceHealthData, record.ID, nil, nil)
+		c.JSON(http.StatusOK, record)
 	}
 }
 
 // @Summary 更新健康数据记录
-// @Description 根据ID更新健康数据
+// @Description 根据ID更新健康数据，需具备所属档案的照护权限；记录所属档案不可修改
 // @Tags health_data
 // @Accept json
 // @Produce json
 // @Param id path int true "健康数据ID"
 // @Param data body models.HealthDataRecord true "健康数据内容"
 // @Success 200 {object} map[string]interface{}
+// @Failure 403 {object} map[string]string "无权访问"
+// @Failure 404 {object} map[string]string "未找到"
 // @Router /health_data/{id} [put]
-func updateHealthDataHandler() gin.HandlerFunc {
+func updateHealthDataHandler(repo *postgres.HealthDataRepository) gin.HandlerFunc {
 	return func(c *gin.Context) {
-		id, _ := strconv.ParseInt(c.Param("id"), 10, 64)
 		var req models.HealthDataRecord
 		if err := c.ShouldBindJSON(&req); err != nil {
 			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 			return
 		}
-		// TODO: 仓储层更新
-		c.JSON(http.StatusOK, gin.H{"id": id, "message": "updated"})
+		before, ok := loadHealthData(c, repo, models.ProfileRoleCaregiver)
+		if !ok {
+			return
+		}
+		req.ID = before.ID
+		req.HealthProfileID = before.HealthProfileID
+		if req.SchemaType == "" {
+			req.SchemaType = before.SchemaType
+		}
+		if req.RecordedAt.IsZero() {
+			req.RecordedAt = before.RecordedAt
+		}
+		if err := repo.Update(int64(req.ID), &req); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		recordAudit(c, models.AuditActionUpdate, models.AuditResourceHealthData, req.ID, before, req)
+		c.JSON(http.StatusOK, gin.H{"id": req.ID, "message": "updated"})
 	}
 }
 
 // @Summary 删除健康数据记录
-// @Description 根据ID删除健康数据
+// @Description 根据ID删除健康数据，需具备所属档案的照护权限
 // @Tags health_data
 // @Produce json
 // @Param id path int true "健康数据ID"
 // @Success 200 {object} map[string]interface{}
+// @Failure 403 {object} map[string]string "无权访问"
+// @Failure 404 {object} map[string]string "未找到"
 // @Router /health_data/{id} [delete]
-func deleteHealthDataHandler() gin.HandlerFunc {
+func deleteHealthDataHandler(repo *postgres.HealthDataRepository) gin.HandlerFunc {
 	return func(c *gin.Context) {
-		id, _ := strconv.ParseInt(c.Param("id"), 10, 64)
-		// TODO: 仓储层删除
-		c.JSON(http.StatusOK, gin.H{"id": id, "message": "deleted"})
+		before, ok := loadHealthData(c, repo, models.ProfileRoleCaregiver)
+		if !ok {
+			return
+		}
+		if err := repo.Delete(int64(before.ID)); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		recordAudit(c, models.AuditActionDelete, models.AuditResourceHealthData, before.ID, before, nil)
+		c.JSON(http.StatusOK, gin.H{"id": before.ID, "message": "deleted"})
 	}
 }
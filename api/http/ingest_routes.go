@@ -0,0 +1,227 @@
+// Package http 设备 HTTP 数据上报路由
+package http
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/fire-disposal/health_DT_go/internal/service"
+	"github.com/gin-gonic/gin"
+	"github.com/vmihailenco/msgpack/v5"
+)
+
+const ingestMaxBodyBytes = 4 << 20 // 请求体（解压后）上限
+
+var ingestService *service.IngestService
+
+// 上报限流：按客户端 IP（仅信任配置的反向代理转发的地址）计请求数，网关批量上报时每个请求可含多条数据；
+// 按签名校验通过的设备序列号计数据条数，伪造的序列号无法消耗其他设备的额度
+var (
+	ingestIPLimiter     = newRateLimiter(600, time.Minute)
+	ingestDeviceLimiter = newRateLimiter(600, time.Minute)
+)
+
+var (
+	errIngestBodyTooLarge = fmt.Errorf("请求体超过 %d 字节", ingestMaxBodyBytes)
+	errIngestBodyInvalid  = errors.New("请求体须为单条数据、数据数组或 {\"readings\": [...]}")
+)
+
+// IngestReadingRequest 单条上报数据，格式同 MQTT 数据消息；sig 明文为 sn \n type \n ts \n data 原始字节
+type IngestReadingRequest struct {
+	SN   string          `json:"sn"`
+	Type string          `json:"type"` // 数据类型，对应 MQTT 主题 device/{sn}/data/{type}
+	TS   int64           `json:"ts"`
+	Data json.RawMessage `json:"data" swaggertype:"object"`
+	Sig  string          `json:"sig"`
+}
+
+// ingestMsgpackReading msgpack 正文中的单条数据，data 保留原始编码用于签名校验
+type ingestMsgpackReading struct {
+	SN   string             `msgpack:"sn"`
+	Type string             `msgpack:"type"`
+	TS   int64              `msgpack:"ts"`
+	Data msgpack.RawMessage `msgpack:"data"`
+	Sig  string             `msgpack:"sig"`
+}
+
+// IngestResponse 上报结果，results 与请求中的数据一一对应
+type IngestResponse struct {
+	Accepted int                    `json:"accepted"`
+	Rejected int                    `json:"rejected"`
+	Results  []service.IngestResult `json:"results"`
+}
+
+// RegisterIngestRoutes 注册设备 HTTP 数据上报路由，供只能发起 HTTPS 请求的网关使用，每条数据须携带有效的设备签名，
+// 按客户端 IP 与设备序列号限流；svc 为 nil 时返回 503
+func RegisterIngestRoutes(router gin.IRouter, svc *service.IngestService) {
+	ingestService = svc
+	router.POST("/ingest", rateLimitByIP(ingestIPLimiter), requireIngestService(), ingestHandler())
+}
+
+func requireIngestService() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if ingestService == nil {
+			c.AbortWithStatusJSON(http.StatusServiceUnavailable, gin.H{"error": "HTTP 数据上报未启用"})
+			return
+		}
+		c.Next()
+	}
+}
+
+/*
+@Summary 设备数据上报
+@Description 供网关调用：正文为单条数据、数据数组或 {"readings": [...]}，单次最多 500 条；Content-Type 为 application/json（默认）
+@Description 或 application/msgpack，Content-Encoding: gzip 时先解压，解压后不超过 4MB。
+@Description 每条数据按设备签名认证：sig = HEX(HMAC-SHA256(设备密钥, sn \n type \n ts \n data 原始字节))，
+@Description JSON 正文为 data 的原始 JSON 文本，msgpack 正文为 data 字段的 msgpack 编码；无论是否开启强制认证，未签名数据均被拒绝。按客户端 IP 每分钟至多 600 次请求，
+@Description 签名有效的数据按设备每分钟至多 600 条，超出的数据逐条拒绝。
+@Description 逐条校验并处理，results 标明每条是否被接受及拒绝原因（签名无效、格式错误、不符合设备类型定义、设备上报过于频繁）
+@Tags Ingest
+@Accept json
+@Accept application/msgpack
+@Produce json
+@Param body body []IngestReadingRequest true "上报数据"
+@Success 200 {object} IngestResponse "处理完成（含逐条结果）"
+@Failure 400 {object} map[string]string "正文无法解析或数据条数超限"
+@Failure 413 {object} map[string]string "请求体过大"
+@Failure 415 {object} map[string]string "不支持的内容类型或压缩方式"
+@Failure 429 {object} map[string]string "请求过于频繁"
+*/
+func ingestHandler() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		body, status, err := readIngestBody(c)
+		if err != nil {
+			c.JSON(status, gin.H{"error": err.Error()})
+			return
+		}
+		mediaType, _, _ := mime.ParseMediaType(c.GetHeader("Content-Type"))
+		var readings []service.IngestReading
+		switch mediaType {
+		case "", "application/json":
+			readings, err = decodeJSONReadings(body)
+		case "application/msgpack", "application/x-msgpack":
+			readings, err = decodeMsgpackReadings(body)
+		default:
+			c.JSON(http.StatusUnsupportedMediaType, gin.H{"error": "Content-Type 须为 application/json 或 application/msgpack"})
+			return
+		}
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		if len(readings) == 0 || len(readings) > service.IngestMaxBatch {
+			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("单次须上报 1-%d 条数据", service.IngestMaxBatch)})
+			return
+		}
+		resp := IngestResponse{Results: ingestService.Ingest(readings, func(sn string) bool {
+			ok, _ := ingestDeviceLimiter.Allow(sn)
+			return ok
+		})}
+		for _, r := range resp.Results {
+			if r.Accepted {
+				resp.Accepted++
+			} else {
+				resp.Rejected++
+			}
+		}
+		c.JSON(http.StatusOK, resp)
+	}
+}
+
+// readIngestBody 读取请求体，按 Content-Encoding 解压并限制解压后大小
+func readIngestBody(c *gin.Context) ([]byte, int, error) {
+	reader := io.Reader(http.MaxBytesReader(c.Writer, c.Request.Body, ingestMaxBodyBytes))
+	switch strings.ToLower(strings.TrimSpace(c.GetHeader("Content-Encoding"))) {
+	case "", "identity":
+	case "gzip":
+		gz, err := gzip.NewReader(reader)
+		if err != nil {
+			return nil, http.StatusBadRequest, fmt.Errorf("gzip 解压失败: %w", err)
+		}
+		defer gz.Close()
+		reader = gz
+	default:
+		return nil, http.StatusUnsupportedMediaType, errors.New("Content-Encoding 仅支持 gzip")
+	}
+	body, err := io.ReadAll(io.LimitReader(reader, ingestMaxBodyBytes+1))
+	var maxErr *http.MaxBytesError
+	switch {
+	case errors.As(err, &maxErr) || len(body) > ingestMaxBodyBytes:
+		return nil, http.StatusRequestEntityTooLarge, errIngestBodyTooLarge
+	case err != nil:
+		return nil, http.StatusBadRequest, fmt.Errorf("请求体读取失败: %w", err)
+	}
+	return body, http.StatusOK, nil
+}
+
+// decodeJSONReadings 解析 JSON 正文；单条数据解析失败记为该条的格式错误，不影响其他数据
+func decodeJSONReadings(body []byte) ([]service.IngestReading, error) {
+	var items []json.RawMessage
+	switch trimmed := bytes.TrimSpace(body); {
+	case len(trimmed) > 0 && trimmed[0] == '[':
+		if err := json.Unmarshal(trimmed, &items); err != nil {
+			return nil, errIngestBodyInvalid
+		}
+	case len(trimmed) > 0 && trimmed[0] == '{':
+		var batch struct {
+			Readings []json.RawMessage `json:"readings"`
+		}
+		if err := json.Unmarshal(trimmed, &batch); err != nil {
+			return nil, errIngestBodyInvalid
+		}
+		items = batch.Readings
+		if items == nil {
+			items = []json.RawMessage{trimmed}
+		}
+	default:
+		return nil, errIngestBodyInvalid
+	}
+	readings := make([]service.IngestReading, len(items))
+	for i, item := range items {
+		var req IngestReadingRequest
+		if err := json.Unmarshal(item, &req); err != nil {
+			readings[i].Err = err
+			continue
+		}
+		readings[i] = service.IngestReading{SN: req.SN, Type: req.Type, TS: req.TS, Sig: req.Sig, Data: req.Data}
+		_ = json.Unmarshal(req.Data, &readings[i].Fields)
+	}
+	return readings, nil
+}
+
+// decodeMsgpackReadings 解析 msgpack 正文，结构与 JSON 正文相同
+func decodeMsgpackReadings(body []byte) ([]service.IngestReading, error) {
+	var items []msgpack.RawMessage
+	if err := msgpack.Unmarshal(body, &items); err != nil {
+		var batch map[string]msgpack.RawMessage
+		if err := msgpack.Unmarshal(body, &batch); err != nil {
+			return nil, errIngestBodyInvalid
+		}
+		if raw, ok := batch["readings"]; ok {
+			if err := msgpack.Unmarshal(raw, &items); err != nil {
+				return nil, errIngestBodyInvalid
+			}
+		} else {
+			items = []msgpack.RawMessage{body}
+		}
+	}
+	readings := make([]service.IngestReading, len(items))
+	for i, item := range items {
+		var req ingestMsgpackReading
+		if err := msgpack.Unmarshal(item, &req); err != nil {
+			readings[i].Err = err
+			continue
+		}
+		readings[i] = service.IngestReading{SN: req.SN, Type: req.Type, TS: req.TS, Sig: req.Sig, Data: req.Data}
+		_ = msgpack.Unmarshal(req.Data, &readings[i].Fields)
+	}
+	return readings, nil
+}
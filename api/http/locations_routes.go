@@ -0,0 +1,445 @@
+// Package http 位置层级（楼栋/楼层/房间/床位）、设备放置、床位分配与看板路由
+package http
+
+import (
+	"database/sql"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/fire-disposal/health_DT_go/internal/models"
+	"github.com/fire-disposal/health_DT_go/internal/repository/postgres"
+	"github.com/fire-disposal/health_DT_go/internal/service"
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+)
+
+var locationService *service.LocationService
+
+// CreateLocationRequest 创建位置请求
+type CreateLocationRequest struct {
+	Kind     string `json:"kind" binding:"required"` // building / floor / room / bed
+	Name     string `json:"name" binding:"required"`
+	ParentID *int   `json:"parent_id"` // 楼栋为空，其余须指定上级
+	OrgID    int    `json:"org_id"`    // 平台管理员创建楼栋时可指定归属组织
+}
+
+// RenameLocationRequest 修改位置名称请求
+type RenameLocationRequest struct {
+	Name string `json:"name" binding:"required"`
+}
+
+// PlaceDeviceRequest 设备放置请求，location_id 为 null 时移出
+type PlaceDeviceRequest struct {
+	LocationID *int `json:"location_id"`
+}
+
+// AssignBedRequest 床位分配请求，bed_id 为 null 时退床
+type AssignBedRequest struct {
+	BedID *int `json:"bed_id"`
+}
+
+// DashboardSummary 看板汇总
+type DashboardSummary struct {
+	LocationID int            `json:"location_id,omitempty"`
+	Location   string         `json:"location,omitempty"`
+	Devices    map[string]int `json:"devices"`     // total / online / offline / unknown
+	OpenAlerts map[string]int `json:"open_alerts"` // 按级别统计的未解除告警
+	Beds       map[string]int `json:"beds"`        // total / occupied
+}
+
+// RegisterLocationRoutes 注册位置管理、设备放置、床位分配与看板路由，仅管理员可访问（组织管理员限本组织）
+func RegisterLocationRoutes(router gin.IRouter, svc *service.LocationService, db *sql.DB, authService *service.AuthService) {
+	locationService = svc
+	adminOnly := RequireRoles(models.AdminRolePlatformAdmin, models.AdminRoleSuperAdmin, models.AdminRoleAdmin)
+	group := router.Group("/locations", AuthMiddleware(authService), adminOnly)
+	{
+		group.POST("", createLocationHandler())
+		group.GET("", listLocationsHandler())
+		group.GET("/:id", getLocationHandler())
+		group.PUT("/:id", renameLocationHandler())
+		group.DELETE("/:id", deleteLocationHandler())
+	}
+	router.PUT("/devices/:id/location", AuthMiddleware(authService), adminOnly, placeDeviceHandler())
+	router.PUT("/health_profiles/:id/bed", AuthMiddleware(authService), adminOnly, assignBedHandler())
+	router.GET("/dashboard/summary", AuthMiddleware(authService), adminOnly, dashboardSummaryHandler(db))
+}
+
+// locationErrorStatus 将位置业务错误映射为 HTTP 状态码
+func locationErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, service.ErrLocationNotFound), errors.Is(err, service.ErrLocationTargetNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, service.ErrLocationInUse), errors.Is(err, postgres.ErrLocationNameExists),
+		errors.Is(err, postgres.ErrBedOccupied):
+		return http.StatusConflict
+	case errors.Is(err, service.ErrInvalidLocation):
+		return http.StatusBadRequest
+	}
+	return http.StatusInternalServerError
+}
+
+// locationQuery 解析 location_id 查询参数；指定的位置不存在（或不在本组织）时返回 404，未指定时返回 0
+func locationQuery(c *gin.Context) (int, bool) {
+	raw := c.Query("location_id")
+	if raw == "" {
+		return 0, true
+	}
+	id, err := strconv.Atoi(raw)
+	if err != nil || id <= 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "location_id 无效"})
+		return 0, false
+	}
+	if _, err := locationService.Get(c.Request.Context(), id); err != nil {
+		c.JSON(locationErrorStatus(err), gin.H{"error": err.Error()})
+		return 0, false
+	}
+	return id, true
+}
+
+// locationPaths 查询位置完整路径；查询失败仅记录日志，数据照常返回
+func locationPaths(c *gin.Context, ids []int) map[int]string {
+	if locationService == nil || len(ids) == 0 {
+		return nil
+	}
+	paths, err := locationService.Paths(c.Request.Context(), ids)
+	if err != nil {
+		zap.L().Warn("位置路径查询失败", zap.Error(err))
+	}
+	return paths
+}
+
+// annotateDeviceLocations 填充设备位置路径
+func annotateDeviceLocations(c *gin.Context, devices []models.Device) {
+	var ids []int
+	for _, d := range devices {
+		if d.LocationID != nil {
+			ids = append(ids, *d.LocationID)
+		}
+	}
+	paths := locationPaths(c, ids)
+	for i := range devices {
+		if devices[i].LocationID != nil {
+			devices[i].Location = paths[*devices[i].LocationID]
+		}
+	}
+}
+
+// annotateAlertLocations 填充告警位置路径
+func annotateAlertLocations(c *gin.Context, alerts []models.Alert) {
+	var ids []int
+	for _, a := range alerts {
+		if a.LocationID != nil {
+			ids = append(ids, *a.LocationID)
+		}
+	}
+	paths := locationPaths(c, ids)
+	for i := range alerts {
+		if alerts[i].LocationID != nil {
+			alerts[i].Location = paths[*alerts[i].LocationID]
+		}
+	}
+}
+
+// annotateProfileBeds 填充健康档案床位路径
+func annotateProfileBeds(c *gin.Context, profiles []models.HealthProfile) {
+	var ids []int
+	for _, p := range profiles {
+		if p.BedID != nil {
+			ids = append(ids, *p.BedID)
+		}
+	}
+	paths := locationPaths(c, ids)
+	for i := range profiles {
+		if profiles[i].BedID != nil {
+			profiles[i].Bed = paths[*profiles[i].BedID]
+		}
+	}
+}
+
+/*
+@Summary 创建位置
+@Description 按楼栋 building > 楼层 floor > 房间 room > 床位 bed 创建位置，楼栋为顶级，其余须指定对应类型的上级；同一上级下名称唯一
+@Tags Location
+@Accept json
+@Produce json
+@Param body body CreateLocationRequest true "位置信息"
+@Success 201 {object} models.Location "创建成功"
+@Failure 400 {object} map[string]string "参数错误或层级不符"
+@Failure 409 {object} map[string]string "同名位置已存在"
+*/
+func createLocationHandler() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var req CreateLocationRequest
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		loc, err := locationService.Create(c.Request.Context(), service.CreateLocationInput{
+			OrgID:    req.OrgID,
+			ParentID: req.ParentID,
+			Kind:     req.Kind,
+			Name:     req.Name,
+		})
+		if err != nil {
+			c.JSON(locationErrorStatus(err), gin.H{"error": err.Error()})
+			return
+		}
+		recordAudit(c, models.AuditActionCreate, models.AuditResourceLocation, loc.ID, nil, loc)
+		c.JSON(http.StatusCreated, loc)
+	}
+}
+
+/*
+@Summary 位置列表
+@Description 查询本组织位置（含完整路径）；指定 parent_id 时仅返回其直接下级，parent_id=0 返回顶级楼栋
+@Tags Location
+@Produce json
+@Param parent_id query int false "上级位置ID"
+@Success 200 {array} models.Location "查询成功"
+*/
+func listLocationsHandler() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var parentID *int
+		if raw := c.Query("parent_id"); raw != "" {
+			id, err := strconv.Atoi(raw)
+			if err != nil || id < 0 {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "parent_id 无效"})
+				return
+			}
+			parentID = &id
+		}
+		list, err := locationService.List(c.Request.Context(), parentID)
+		if err != nil {
+			c.JSON(locationErrorStatus(err), gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, list)
+	}
+}
+
+/*
+@Summary 获取位置详情
+@Description 根据ID查询位置（含完整路径）
+@Tags Location
+@Produce json
+@Param id path int true "位置ID"
+@Success 200 {object} models.Location "查询成功"
+@Failure 404 {object} map[string]string "位置不存在"
+*/
+func getLocationHandler() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id, _ := strconv.Atoi(c.Param("id"))
+		loc, err := locationService.Get(c.Request.Context(), id)
+		if err != nil {
+			c.JSON(locationErrorStatus(err), gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, loc)
+	}
+}
+
+/*
+@Summary 修改位置名称
+@Description 修改位置名称，层级关系创建后不可修改
+@Tags Location
+@Accept json
+@Produce json
+@Param id path int true "位置ID"
+@Param body body RenameLocationRequest true "新名称"
+@Success 200 {object} models.Location "修改成功"
+@Failure 404 {object} map[string]string "位置不存在"
+@Failure 409 {object} map[string]string "同名位置已存在"
+*/
+func renameLocationHandler() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id, _ := strconv.Atoi(c.Param("id"))
+		var req RenameLocationRequest
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		before, err := locationService.Get(c.Request.Context(), id)
+		if err != nil {
+			c.JSON(locationErrorStatus(err), gin.H{"error": err.Error()})
+			return
+		}
+		loc, err := locationService.Rename(c.Request.Context(), id, req.Name)
+		if err != nil {
+			c.JSON(locationErrorStatus(err), gin.H{"error": err.Error()})
+			return
+		}
+		recordAudit(c, models.AuditActionUpdate, models.AuditResourceLocation, id, before, loc)
+		c.JSON(http.StatusOK, loc)
+	}
+}
+
+/*
+@Summary 删除位置
+@Description 删除位置，有下级位置、放置的设备或分配的健康档案时拒绝
+@Tags Location
+@Produce json
+@Param id path int true "位置ID"
+@Success 200 {object} map[string]interface{} "删除成功"
+@Failure 404 {object} map[string]string "位置不存在"
+@Failure 409 {object} map[string]string "位置仍在使用"
+*/
+func deleteLocationHandler() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id, _ := strconv.Atoi(c.Param("id"))
+		before, err := locationService.Get(c.Request.Context(), id)
+		if err != nil {
+			c.JSON(locationErrorStatus(err), gin.H{"error": err.Error()})
+			return
+		}
+		if err := locationService.Delete(c.Request.Context(), id); err != nil {
+			c.JSON(locationErrorStatus(err), gin.H{"error": err.Error()})
+			return
+		}
+		recordAudit(c, models.AuditActionDelete, models.AuditResourceLocation, id, before, nil)
+		c.JSON(http.StatusOK, gin.H{"id": id, "message": "deleted"})
+	}
+}
+
+/*
+@Summary 设置设备位置
+@Description 将设备放置到任意层级的位置，location_id 为 null 时移出；位置须与设备属于同一组织
+@Tags Device
+@Accept json
+@Produce json
+@Param id path int true "设备ID"
+@Param body body PlaceDeviceRequest true "位置ID"
+@Success 200 {object} models.Device "设置成功"
+@Failure 404 {object} map[string]string "设备或位置不存在"
+*/
+func placeDeviceHandler() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id, _ := strconv.Atoi(c.Param("id"))
+		var req PlaceDeviceRequest
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		before, err := devicesService.Get(c.Request.Context(), id)
+		if err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+			return
+		}
+		if err := locationService.PlaceDevice(c.Request.Context(), id, req.LocationID); err != nil {
+			c.JSON(locationErrorStatus(err), gin.H{"error": err.Error()})
+			return
+		}
+		device, err := devicesService.Get(c.Request.Context(), id)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		recordAudit(c, models.AuditActionUpdate, models.AuditResourceDevice, id,
+			gin.H{"location_id": before.LocationID}, gin.H{"location_id": device.LocationID})
+		annotated := []models.Device{*device}
+		annotateDeviceLocations(c, annotated)
+		c.JSON(http.StatusOK, annotated[0])
+	}
+}
+
+/*
+@Summary 分配床位
+@Description 将健康档案分配到床位，bed_id 为 null 时退床；床位须与档案属于同一组织，每张床位至多一个档案
+@Tags HealthProfile
+@Accept json
+@Produce json
+@Param id path int true "健康档案ID"
+@Param body body AssignBedRequest true "床位ID"
+@Success 200 {object} models.HealthProfile "分配成功"
+@Failure 400 {object} map[string]string "目标不是床位"
+@Failure 404 {object} map[string]string "档案或床位不存在"
+@Failure 409 {object} map[string]string "床位已被占用"
+*/
+func assignBedHandler() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id, _ := strconv.Atoi(c.Param("id"))
+		var req AssignBedRequest
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		if !authorizeProfile(c, id, models.ProfileRoleCaregiver) {
+			return
+		}
+		before, err := healthProfilesService.Get(c.Request.Context(), id)
+		if err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+			return
+		}
+		if err := locationService.AssignBed(c.Request.Context(), id, req.BedID); err != nil {
+			c.JSON(locationErrorStatus(err), gin.H{"error": err.Error()})
+			return
+		}
+		profile, err := healthProfilesService.Get(c.Request.Context(), id)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		recordAudit(c, models.AuditActionUpdate, models.AuditResourceHealthProfile, id,
+			gin.H{"bed_id": before.BedID}, gin.H{"bed_id": profile.BedID})
+		annotated := []models.HealthProfile{*profile}
+		annotateProfileBeds(c, annotated)
+		c.JSON(http.StatusOK, annotated[0])
+	}
+}
+
+/*
+@Summary 看板汇总
+@Description 汇总设备数量与在线状态、按级别统计的未解除告警、床位占用；指定 location_id 时仅统计该位置及其下级位置
+@Tags Dashboard
+@Produce json
+@Param location_id query int false "位置ID"
+@Success 200 {object} DashboardSummary "查询成功"
+@Failure 404 {object} map[string]string "位置不存在"
+*/
+func dashboardSummaryHandler(db *sql.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		locationID, ok := locationQuery(c)
+		if !ok {
+			return
+		}
+		ctx := c.Request.Context()
+		var devices []models.Device
+		var err error
+		if locationID > 0 {
+			devices, err = devicesService.ListByLocation(ctx, locationID)
+		} else {
+			devices, err = devicesService.List(ctx)
+		}
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		annotatePresence(c, devices)
+		summary := DashboardSummary{
+			LocationID: locationID,
+			Devices:    map[string]int{"total": len(devices), models.DeviceOnline: 0, models.DeviceOffline: 0, models.DeviceUnknown: 0},
+		}
+		for _, d := range devices {
+			if d.Presence != nil {
+				summary.Devices[d.Presence.Status]++
+			} else {
+				summary.Devices[models.DeviceUnknown]++
+			}
+		}
+		if summary.OpenAlerts, err = postgres.NewAlertsRepository(db).CountOpenByLevel(ctx, locationID); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		beds, occupied, err := locationService.Occupancy(ctx, locationID)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		summary.Beds = map[string]int{"total": beds, "occupied": occupied}
+		if locationID > 0 {
+			summary.Location = locationPaths(c, []int{locationID})[locationID]
+		}
+		c.JSON(http.StatusOK, summary)
+	}
+}
@@ -0,0 +1,170 @@
+// Package http 组织（租户）管理路由
+package http
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/fire-disposal/health_DT_go/internal/models"
+	"github.com/fire-disposal/health_DT_go/internal/service"
+	"github.com/gin-gonic/gin"
+)
+
+var organizationService *service.OrganizationService
+
+// CreateOrganizationRequest 创建组织请求
+type CreateOrganizationRequest struct {
+	Code string `json:"code" binding:"required"`
+	Name string `json:"name" binding:"required"`
+}
+
+// UpdateOrganizationRequest 更新组织请求
+type UpdateOrganizationRequest struct {
+	Name string `json:"name" binding:"required"`
+}
+
+// RegisterOrganizationRoutes 注册组织管理路由，仅平台管理员可访问
+func RegisterOrganizationRoutes(router gin.IRouter, svc *service.OrganizationService, authService *service.AuthService) {
+	organizationService = svc
+	group := router.Group("/organizations", AuthMiddleware(authService), RequireRoles(models.AdminRolePlatformAdmin))
+	{
+		group.POST("", createOrganizationHandler())
+		group.GET("", listOrganizationsHandler())
+		group.GET("/:id", getOrganizationHandler())
+		group.PUT("/:id", updateOrganizationHandler())
+		group.DELETE("/:id", deleteOrganizationHandler())
+	}
+}
+
+// organizationErrorStatus 将组织业务错误映射为 HTTP 状态码
+func organizationErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, service.ErrOrganizationNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, service.ErrOrganizationCodeExists), errors.Is(err, service.ErrOrganizationInUse):
+		return http.StatusConflict
+	case errors.Is(err, service.ErrInvalidOrganization), errors.Is(err, service.ErrDefaultOrganization):
+		return http.StatusBadRequest
+	}
+	return http.StatusInternalServerError
+}
+
+/*
+@Summary 创建组织
+@Description 新增组织（养老机构），编码全局唯一且创建后不可修改
+@Tags Organization
+@Accept json
+@Produce json
+@Param body body CreateOrganizationRequest true "组织信息"
+@Success 201 {object} models.Organization "创建成功"
+@Failure 400 {object} map[string]string "参数错误"
+@Failure 409 {object} map[string]string "编码已存在"
+*/
+func createOrganizationHandler() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var req CreateOrganizationRequest
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		org, err := organizationService.Create(c.Request.Context(), req.Code, req.Name)
+		if err != nil {
+			c.JSON(organizationErrorStatus(err), gin.H{"error": err.Error()})
+			return
+		}
+		recordAudit(c, models.AuditActionCreate, models.AuditResourceOrganization, org.ID, nil, org)
+		c.JSON(http.StatusCreated, org)
+	}
+}
+
+/*
+@Summary 组织列表
+@Description 查询全部组织
+@Tags Organization
+@Produce json
+@Success 200 {array} models.Organization "查询成功"
+*/
+func listOrganizationsHandler() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		orgs, err := organizationService.List(c.Request.Context())
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, orgs)
+	}
+}
+
+/*
+@Summary 获取组织详情
+@Description 根据ID查询组织
+@Tags Organization
+@Produce json
+@Param id path int true "组织ID"
+@Success 200 {object} models.Organization "查询成功"
+@Failure 404 {object} map[string]string "组织不存在"
+*/
+func getOrganizationHandler() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id, _ := strconv.Atoi(c.Param("id"))
+		org, err := organizationService.Get(c.Request.Context(), id)
+		if err != nil {
+			c.JSON(organizationErrorStatus(err), gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, org)
+	}
+}
+
+/*
+@Summary 更新组织
+@Description 修改组织名称
+@Tags Organization
+@Accept json
+@Produce json
+@Param id path int true "组织ID"
+@Param body body UpdateOrganizationRequest true "组织信息"
+@Success 200 {object} models.Organization "更新成功"
+@Failure 404 {object} map[string]string "组织不存在"
+*/
+func updateOrganizationHandler() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id, _ := strconv.Atoi(c.Param("id"))
+		var req UpdateOrganizationRequest
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		before, _ := organizationService.Get(c.Request.Context(), id)
+		org, err := organizationService.Rename(c.Request.Context(), id, req.Name)
+		if err != nil {
+			c.JSON(organizationErrorStatus(err), gin.H{"error": err.Error()})
+			return
+		}
+		recordAudit(c, models.AuditActionUpdate, models.AuditResourceOrganization, id, before, org)
+		c.JSON(http.StatusOK, org)
+	}
+}
+
+/*
+@Summary 删除组织
+@Description 删除没有任何管理员、设备、健康档案与告警的组织，默认组织不可删除
+@Tags Organization
+@Produce json
+@Param id path int true "组织ID"
+@Success 200 {object} map[string]interface{} "删除成功"
+@Failure 409 {object} map[string]string "组织仍在使用"
+*/
+func deleteOrganizationHandler() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id, _ := strconv.Atoi(c.Param("id"))
+		before, _ := organizationService.Get(c.Request.Context(), id)
+		if err := organizationService.Delete(c.Request.Context(), id); err != nil {
+			c.JSON(organizationErrorStatus(err), gin.H{"error": err.Error()})
+			return
+		}
+		recordAudit(c, models.AuditActionDelete, models.AuditResourceOrganization, id, before, nil)
+		c.JSON(http.StatusOK, gin.H{"id": id, "message": "deleted"})
+	}
+}
@@ -0,0 +1,362 @@
+// Package http 固件升级（OTA）路由
+package http
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/fire-disposal/health_DT_go/internal/models"
+	"github.com/fire-disposal/health_DT_go/internal/service"
+	"github.com/gin-gonic/gin"
+)
+
+var otaService *service.OTAService
+
+// CreateOTACampaignRequest 创建升级活动请求
+type CreateOTACampaignRequest struct {
+	Name                    string   `json:"name" binding:"required"`
+	ArtifactID              int      `json:"artifact_id" binding:"required"`
+	FromVersions            []string `json:"from_versions"`             // 限定升级的当前固件版本，为空表示除目标版本外的全部版本
+	RolloutPercent          int      `json:"rollout_percent"`           // 初始放量比例 0-100
+	FailureThresholdPercent int      `json:"failure_threshold_percent"` // 失败率达到该比例时自动暂停，默认 20
+	MinSamples              int      `json:"min_samples"`               // 计算失败率所需的最少完成设备数，默认 5
+	OrgID                   int      `json:"org_id"`
+}
+
+// UpdateOTARolloutRequest 调整放量比例请求
+type UpdateOTARolloutRequest struct {
+	RolloutPercent int `json:"rollout_percent" binding:"required"` // 只能提高
+}
+
+// RegisterOTARoutes 注册固件升级路由：固件与活动管理权限与设备管理一致，固件下载供设备调用（签名校验）；
+// svc 为 nil 时返回 503
+func RegisterOTARoutes(router gin.IRouter, svc *service.OTAService, authService *service.AuthService) {
+	otaService = svc
+	admin := []gin.HandlerFunc{AuthMiddleware(authService),
+		RequireRoles(models.AdminRolePlatformAdmin, models.AdminRoleSuperAdmin, models.AdminRoleAdmin),
+		requireOTAService()}
+
+	firmware := router.Group("/firmware", admin...)
+	{
+		firmware.POST("", uploadFirmwareHandler())
+		firmware.GET("", listFirmwareHandler())
+		firmware.GET("/:id", getFirmwareHandler())
+	}
+
+	campaigns := router.Group("/ota/campaigns", admin...)
+	{
+		campaigns.POST("", createOTACampaignHandler())
+		campaigns.GET("", listOTACampaignsHandler())
+		campaigns.GET("/:id", getOTACampaignHandler())
+		campaigns.GET("/:id/devices", listOTACampaignDevicesHandler())
+		campaigns.POST("/:id/start", otaCampaignActionHandler((*service.OTAService).Start))
+		campaigns.POST("/:id/pause", otaCampaignActionHandler((*service.OTAService).Pause))
+		campaigns.POST("/:id/resume", otaCampaignActionHandler((*service.OTAService).Resume))
+		campaigns.POST("/:id/cancel", otaCampaignActionHandler((*service.OTAService).Cancel))
+		campaigns.PUT("/:id/rollout", updateOTARolloutHandler())
+	}
+
+	router.GET("/ota/firmware/:id/download", requireOTAService(), downloadFirmwareHandler())
+}
+
+func requireOTAService() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if otaService == nil {
+			c.AbortWithStatusJSON(http.StatusServiceUnavailable, gin.H{"error": "固件升级服务未启用"})
+			return
+		}
+		c.Next()
+	}
+}
+
+// otaErrorStatus 将固件升级业务错误映射为 HTTP 状态码
+func otaErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, service.ErrFirmwareNotFound), errors.Is(err, service.ErrOTACampaignNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, service.ErrInvalidFirmware), errors.Is(err, service.ErrInvalidOTACampaign),
+		errors.Is(err, service.ErrFirmwareChecksum):
+		return http.StatusBadRequest
+	case errors.Is(err, service.ErrFirmwareTooLarge):
+		return http.StatusRequestEntityTooLarge
+	case errors.Is(err, service.ErrFirmwareExists), errors.Is(err, service.ErrOTACampaignState):
+		return http.StatusConflict
+	case errors.Is(err, service.ErrOTADownloadForbidden):
+		return http.StatusForbidden
+	case errors.Is(err, service.ErrDeviceUnknown), errors.Is(err, service.ErrDeviceNoSecret),
+		errors.Is(err, service.ErrSignatureMissing), errors.Is(err, service.ErrSignatureInvalid),
+		errors.Is(err, service.ErrSignatureExpired):
+		return http.StatusUnauthorized
+	}
+	return http.StatusInternalServerError
+}
+
+/*
+@Summary 上传固件
+@Description 以 multipart/form-data 上传固件文件，服务端计算 SHA256 并存于本地目录；同一组织内设备类型与版本不可重复
+@Tags OTA
+@Accept multipart/form-data
+@Produce json
+@Param file formData file true "固件文件"
+@Param device_type formData string true "设备类型"
+@Param version formData string true "固件版本"
+@Param sha256 formData string false "文件 SHA256，提供时校验"
+@Param notes formData string false "说明"
+@Param org_id formData int false "所属组织（平台管理员可指定）"
+@Success 201 {object} models.FirmwareArtifact "上传成功"
+@Failure 400 {object} map[string]string "参数错误或校验不一致"
+@Failure 409 {object} map[string]string "版本已存在"
+@Failure 413 {object} map[string]string "文件过大"
+*/
+func uploadFirmwareHandler() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		fileHeader, err := c.FormFile("file")
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "缺少固件文件"})
+			return
+		}
+		file, err := fileHeader.Open()
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		defer file.Close()
+		orgID, _ := strconv.Atoi(c.PostForm("org_id"))
+		artifact, err := otaService.UploadFirmware(c.Request.Context(), currentPrincipal(c).UserID, service.UploadFirmwareInput{
+			OrgID:      orgID,
+			DeviceType: c.PostForm("device_type"),
+			Version:    c.PostForm("version"),
+			Notes:      c.PostForm("notes"),
+			FileName:   fileHeader.Filename,
+			SHA256:     c.PostForm("sha256"),
+			Content:    file,
+		})
+		if err != nil {
+			c.JSON(otaErrorStatus(err), gin.H{"error": err.Error()})
+			return
+		}
+		recordAudit(c, models.AuditActionCreate, models.AuditResourceFirmware, artifact.ID, nil, artifact)
+		c.JSON(http.StatusCreated, artifact)
+	}
+}
+
+/*
+@Summary 固件列表
+@Description 按创建时间倒序返回固件，可按设备类型过滤
+@Tags OTA
+@Produce json
+@Param device_type query string false "设备类型"
+@Success 200 {array} models.FirmwareArtifact "查询成功"
+*/
+func listFirmwareHandler() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		list, err := otaService.ListFirmware(c.Request.Context(), c.Query("device_type"))
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, list)
+	}
+}
+
+/*
+@Summary 获取固件
+@Tags OTA
+@Produce json
+@Param id path int true "固件ID"
+@Success 200 {object} models.FirmwareArtifact "查询成功"
+@Failure 404 {object} map[string]string "固件不存在"
+*/
+func getFirmwareHandler() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id, _ := strconv.Atoi(c.Param("id"))
+		artifact, err := otaService.GetFirmware(c.Request.Context(), id)
+		if err != nil {
+			c.JSON(otaErrorStatus(err), gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, artifact)
+	}
+}
+
+/*
+@Summary 设备下载固件
+@Description 供设备调用：sig = HEX(HMAC-SHA256(设备密钥, sn \n ota_download \n ts \n 固件ID))；设备须在使用该固件的进行中或已暂停升级活动内
+@Tags OTA
+@Produce octet-stream
+@Param id path int true "固件ID"
+@Param sn query string true "设备序列号"
+@Param ts query int true "Unix 时间戳（秒）"
+@Param sig query string false "签名"
+@Success 200 {file} file "固件文件"
+@Failure 401 {object} map[string]string "签名无效"
+@Failure 403 {object} map[string]string "设备不在升级活动内"
+*/
+func downloadFirmwareHandler() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id, _ := strconv.Atoi(c.Param("id"))
+		ts, _ := strconv.ParseInt(c.Query("ts"), 10, 64)
+		artifact, err := otaService.FirmwareForDevice(c.Request.Context(), c.Query("sn"), id, ts, c.Query("sig"))
+		if err != nil {
+			c.JSON(otaErrorStatus(err), gin.H{"error": err.Error()})
+			return
+		}
+		c.Header("X-Firmware-SHA256", artifact.SHA256)
+		c.FileAttachment(artifact.FilePath, artifact.FileName)
+	}
+}
+
+/*
+@Summary 创建升级活动
+@Description 创建草稿状态的升级活动，设备类型与目标版本取自固件；启动后按放量比例纳入设备
+@Tags OTA
+@Accept json
+@Produce json
+@Param body body CreateOTACampaignRequest true "活动参数"
+@Success 201 {object} models.OTACampaign "创建成功"
+@Failure 400 {object} map[string]string "参数错误"
+@Failure 404 {object} map[string]string "固件不存在"
+*/
+func createOTACampaignHandler() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var req CreateOTACampaignRequest
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		campaign, err := otaService.CreateCampaign(c.Request.Context(), currentPrincipal(c).UserID, service.CreateOTACampaignInput{
+			OrgID:                   req.OrgID,
+			Name:                    req.Name,
+			ArtifactID:              req.ArtifactID,
+			FromVersions:            req.FromVersions,
+			RolloutPercent:          req.RolloutPercent,
+			FailureThresholdPercent: req.FailureThresholdPercent,
+			MinSamples:              req.MinSamples,
+		})
+		if err != nil {
+			c.JSON(otaErrorStatus(err), gin.H{"error": err.Error()})
+			return
+		}
+		recordAudit(c, models.AuditActionCreate, models.AuditResourceOTACampaign, campaign.ID, nil, campaign)
+		c.JSON(http.StatusCreated, campaign)
+	}
+}
+
+/*
+@Summary 升级活动列表
+@Tags OTA
+@Produce json
+@Param status query string false "活动状态 draft / running / paused / completed / cancelled"
+@Success 200 {array} models.OTACampaign "查询成功"
+*/
+func listOTACampaignsHandler() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		list, err := otaService.ListCampaigns(c.Request.Context(), c.Query("status"))
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, list)
+	}
+}
+
+/*
+@Summary 获取升级活动
+@Description 返回活动详情及按设备状态统计的进度；自动暂停时 pause_reason 说明失败率
+@Tags OTA
+@Produce json
+@Param id path int true "活动ID"
+@Success 200 {object} models.OTACampaign "查询成功"
+@Failure 404 {object} map[string]string "活动不存在"
+*/
+func getOTACampaignHandler() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id, _ := strconv.Atoi(c.Param("id"))
+		campaign, err := otaService.GetCampaign(c.Request.Context(), id)
+		if err != nil {
+			c.JSON(otaErrorStatus(err), gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, campaign)
+	}
+}
+
+/*
+@Summary 升级活动设备列表
+@Description 按更新时间倒序返回活动中的设备及升级进度（最多 200 条）
+@Tags OTA
+@Produce json
+@Param id path int true "活动ID"
+@Param status query string false "设备升级状态 pending / sent / downloading / installing / succeeded / failed"
+@Success 200 {array} models.OTACampaignDevice "查询成功"
+@Failure 404 {object} map[string]string "活动不存在"
+*/
+func listOTACampaignDevicesHandler() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id, _ := strconv.Atoi(c.Param("id"))
+		list, err := otaService.CampaignDevices(c.Request.Context(), id, c.Query("status"))
+		if err != nil {
+			c.JSON(otaErrorStatus(err), gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, list)
+	}
+}
+
+/*
+@Summary 变更升级活动状态
+@Description start：启动草稿活动；pause：暂停进行中的活动；resume：恢复已暂停（含自动暂停）的活动；cancel：取消未结束的活动
+@Tags OTA
+@Produce json
+@Param id path int true "活动ID"
+@Success 200 {object} models.OTACampaign "操作成功"
+@Failure 404 {object} map[string]string "活动不存在"
+@Failure 409 {object} map[string]string "当前状态不允许该操作"
+*/
+func otaCampaignActionHandler(action func(*service.OTAService, context.Context, int) (*models.OTACampaign, error)) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id, _ := strconv.Atoi(c.Param("id"))
+		before, _ := otaService.GetCampaign(c.Request.Context(), id)
+		campaign, err := action(otaService, c.Request.Context(), id)
+		if err != nil {
+			c.JSON(otaErrorStatus(err), gin.H{"error": err.Error()})
+			return
+		}
+		recordAudit(c, models.AuditActionUpdate, models.AuditResourceOTACampaign, id, before, campaign)
+		c.JSON(http.StatusOK, campaign)
+	}
+}
+
+/*
+@Summary 提高放量比例
+@Description 放量比例只能提高；设备按活动内固定分桶纳入，进行中的活动立即下发新增批次
+@Tags OTA
+@Accept json
+@Produce json
+@Param id path int true "活动ID"
+@Param body body UpdateOTARolloutRequest true "放量比例"
+@Success 200 {object} models.OTACampaign "修改成功"
+@Failure 400 {object} map[string]string "参数错误"
+@Failure 404 {object} map[string]string "活动不存在"
+@Failure 409 {object} map[string]string "活动已结束"
+*/
+func updateOTARolloutHandler() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id, _ := strconv.Atoi(c.Param("id"))
+		var req UpdateOTARolloutRequest
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		before, _ := otaService.GetCampaign(c.Request.Context(), id)
+		campaign, err := otaService.SetRollout(c.Request.Context(), id, req.RolloutPercent)
+		if err != nil {
+			c.JSON(otaErrorStatus(err), gin.H{"error": err.Error()})
+			return
+		}
+		recordAudit(c, models.AuditActionUpdate, models.AuditResourceOTACampaign, id, before, campaign)
+		c.JSON(http.StatusOK, campaign)
+	}
+}
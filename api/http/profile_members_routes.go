@@ -0,0 +1,240 @@
+// Package http 健康档案共享（成员与邀请）路由
+package http
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/fire-disposal/health_DT_go/internal/models"
+	"github.com/fire-disposal/health_DT_go/internal/service"
+	"github.com/gin-gonic/gin"
+)
+
+var profileSharingService *service.ProfileSharingService
+
+// CreateProfileInvitationRequest 创建档案共享邀请请求
+type CreateProfileInvitationRequest struct {
+	Role           string `json:"role" binding:"required"` // caregiver / viewer
+	ExpiresInHours int    `json:"expires_in_hours"`        // 有效期（小时），默认72，最长720
+}
+
+// RedeemProfileInvitationRequest 使用邀请码请求
+type RedeemProfileInvitationRequest struct {
+	Code string `json:"code" binding:"required"`
+}
+
+// RegisterProfileMembersRoutes 注册档案成员与邀请路由
+func RegisterProfileMembersRoutes(router gin.IRouter, sharing *service.ProfileSharingService, authService *service.AuthService) {
+	profileSharingService = sharing
+	group := router.Group("/health_profiles/:id", AuthMiddleware(authService))
+	{
+		group.GET("/members", listProfileMembersHandler())
+		group.POST("/members/:memberId/approve", approveProfileMemberHandler())
+		group.DELETE("/members/:memberId", revokeProfileMemberHandler())
+		group.POST("/invitations", createProfileInvitationHandler())
+		group.GET("/invitations", listProfileInvitationsHandler())
+		group.DELETE("/invitations/:invitationId", revokeProfileInvitationHandler())
+	}
+	router.POST("/profile_invitations/redeem", AuthMiddleware(authService), redeemProfileInvitationHandler())
+}
+
+// profileErrorStatus 将档案共享业务错误映射为 HTTP 状态码
+func profileErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, service.ErrProfileUnauthenticated):
+		return http.StatusUnauthorized
+	case errors.Is(err, service.ErrProfileForbidden):
+		return http.StatusForbidden
+	case errors.Is(err, service.ErrProfileMemberNotFound), errors.Is(err, service.ErrProfileInvitationGone):
+		return http.StatusNotFound
+	case errors.Is(err, service.ErrAlreadyProfileMember):
+		return http.StatusConflict
+	case errors.Is(err, service.ErrInvalidProfileRole), errors.Is(err, service.ErrInvalidInvitation),
+		errors.Is(err, service.ErrCannotRevokeOwner), errors.Is(err, service.ErrMemberNotPending):
+		return http.StatusBadRequest
+	}
+	return http.StatusInternalServerError
+}
+
+// authorizeProfile 校验当前主体对档案的权限，失败时写入错误响应并返回 false
+func authorizeProfile(c *gin.Context, profileID int, minRole string) bool {
+	if err := profileSharingService.Authorize(c.Request.Context(), currentPrincipal(c), profileID, minRole); err != nil {
+		c.AbortWithStatusJSON(profileErrorStatus(err), gin.H{"error": err.Error()})
+		return false
+	}
+	return true
+}
+
+/*
+@Summary 档案成员列表
+@Description 查询档案的有效及待批准成员，任意有效成员可查看
+@Tags ProfileMember
+@Produce json
+@Param id path int true "健康档案ID"
+@Success 200 {array} models.ProfileMember "查询成功"
+@Failure 403 {object} map[string]string "无权访问"
+*/
+func listProfileMembersHandler() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		profileID, _ := strconv.Atoi(c.Param("id"))
+		members, err := profileSharingService.ListMembers(c.Request.Context(), currentPrincipal(c), profileID)
+		if err != nil {
+			c.JSON(profileErrorStatus(err), gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, members)
+	}
+}
+
+/*
+@Summary 批准档案成员
+@Description 档案拥有者批准凭邀请码申请加入的成员
+@Tags ProfileMember
+@Produce json
+@Param id path int true "健康档案ID"
+@Param memberId path int true "成员ID"
+@Success 200 {object} models.ProfileMember "批准成功"
+@Failure 400 {object} map[string]string "成员不处于待批准状态"
+@Failure 403 {object} map[string]string "仅拥有者可操作"
+*/
+func approveProfileMemberHandler() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		profileID, _ := strconv.Atoi(c.Param("id"))
+		memberID, _ := strconv.ParseInt(c.Param("memberId"), 10, 64)
+		member, err := profileSharingService.ApproveMember(c.Request.Context(), currentPrincipal(c), profileID, memberID)
+		if err != nil {
+			c.JSON(profileErrorStatus(err), gin.H{"error": err.Error()})
+			return
+		}
+		recordAudit(c, "approve_member", models.AuditResourceHealthProfile, profileID, nil, member)
+		c.JSON(http.StatusOK, member)
+	}
+}
+
+/*
+@Summary 移除档案成员
+@Description 拥有者移除成员或拒绝申请，成员本人也可主动退出；拥有者不可被移除
+@Tags ProfileMember
+@Produce json
+@Param id path int true "健康档案ID"
+@Param memberId path int true "成员ID"
+@Success 200 {object} map[string]interface{} "移除成功"
+@Failure 403 {object} map[string]string "无权操作"
+*/
+func revokeProfileMemberHandler() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		profileID, _ := strconv.Atoi(c.Param("id"))
+		memberID, _ := strconv.ParseInt(c.Param("memberId"), 10, 64)
+		if err := profileSharingService.RevokeMember(c.Request.Context(), currentPrincipal(c), profileID, memberID); err != nil {
+			c.JSON(profileErrorStatus(err), gin.H{"error": err.Error()})
+			return
+		}
+		recordAudit(c, "revoke_member", models.AuditResourceHealthProfile, profileID, gin.H{"member_id": memberID}, nil)
+		c.JSON(http.StatusOK, gin.H{"id": memberID, "message": "revoked"})
+	}
+}
+
+/*
+@Summary 创建档案共享邀请
+@Description 档案拥有者生成邀请码，邀请码仅在本次响应中返回；对方使用后需拥有者批准
+@Tags ProfileMember
+@Accept json
+@Produce json
+@Param id path int true "健康档案ID"
+@Param body body CreateProfileInvitationRequest true "邀请信息"
+@Success 201 {object} map[string]interface{} "创建成功"
+@Failure 400 {object} map[string]string "参数错误"
+@Failure 403 {object} map[string]string "仅拥有者可操作"
+*/
+func createProfileInvitationHandler() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		profileID, _ := strconv.Atoi(c.Param("id"))
+		var req CreateProfileInvitationRequest
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		ttl := time.Duration(req.ExpiresInHours) * time.Hour
+		code, inv, err := profileSharingService.CreateInvitation(c.Request.Context(), currentPrincipal(c), profileID, req.Role, ttl)
+		if err != nil {
+			c.JSON(profileErrorStatus(err), gin.H{"error": err.Error()})
+			return
+		}
+		recordAudit(c, "invite_member", models.AuditResourceHealthProfile, profileID, nil, inv)
+		c.JSON(http.StatusCreated, gin.H{"code": code, "invitation": inv})
+	}
+}
+
+/*
+@Summary 档案邀请列表
+@Description 档案拥有者查看邀请记录
+@Tags ProfileMember
+@Produce json
+@Param id path int true "健康档案ID"
+@Success 200 {array} models.ProfileInvitation "查询成功"
+@Failure 403 {object} map[string]string "仅拥有者可操作"
+*/
+func listProfileInvitationsHandler() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		profileID, _ := strconv.Atoi(c.Param("id"))
+		invitations, err := profileSharingService.ListInvitations(c.Request.Context(), currentPrincipal(c), profileID)
+		if err != nil {
+			c.JSON(profileErrorStatus(err), gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, invitations)
+	}
+}
+
+/*
+@Summary 撤销档案邀请
+@Description 档案拥有者撤销尚未使用的邀请
+@Tags ProfileMember
+@Produce json
+@Param id path int true "健康档案ID"
+@Param invitationId path int true "邀请ID"
+@Success 200 {object} map[string]interface{} "撤销成功"
+@Failure 404 {object} map[string]string "邀请不存在或已失效"
+*/
+func revokeProfileInvitationHandler() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		profileID, _ := strconv.Atoi(c.Param("id"))
+		invitationID, _ := strconv.ParseInt(c.Param("invitationId"), 10, 64)
+		if err := profileSharingService.RevokeInvitation(c.Request.Context(), currentPrincipal(c), profileID, invitationID); err != nil {
+			c.JSON(profileErrorStatus(err), gin.H{"error": err.Error()})
+			return
+		}
+		recordAudit(c, "revoke_invitation", models.AuditResourceHealthProfile, profileID, gin.H{"invitation_id": invitationID}, nil)
+		c.JSON(http.StatusOK, gin.H{"id": invitationID, "message": "revoked"})
+	}
+}
+
+/*
+@Summary 使用档案邀请码
+@Description App 用户凭邀请码申请加入档案，状态为 pending，拥有者批准后生效
+@Tags ProfileMember
+@Accept json
+@Produce json
+@Param body body RedeemProfileInvitationRequest true "邀请码"
+@Success 201 {object} models.ProfileMember "申请成功"
+@Failure 400 {object} map[string]string "邀请码无效或已失效"
+@Failure 409 {object} map[string]string "已是档案成员"
+*/
+func redeemProfileInvitationHandler() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var req RedeemProfileInvitationRequest
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		member, err := profileSharingService.RedeemInvitation(c.Request.Context(), currentPrincipal(c), req.Code)
+		if err != nil {
+			c.JSON(profileErrorStatus(err), gin.H{"error": err.Error()})
+			return
+		}
+		recordAudit(c, "redeem_invitation", models.AuditResourceHealthProfile, member.HealthProfileID, nil, member)
+		c.JSON(http.StatusCreated, member)
+	}
+}
@@ -0,0 +1,185 @@
+// Package http 设备自动注册路由（待注册设备、批量导入）
+package http
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/fire-disposal/health_DT_go/internal/models"
+	"github.com/fire-disposal/health_DT_go/internal/service"
+	"github.com/gin-gonic/gin"
+)
+
+var provisioningService *service.ProvisioningService
+
+// ApprovePendingDevicesRequest 批量批准待注册设备请求
+type ApprovePendingDevicesRequest struct {
+	Devices    []service.ApproveDeviceItem `json:"devices" binding:"required,dive"`
+	DeviceType string                      `json:"device_type"` // 未单独指定类型的设备使用该类型
+	OrgID      int                         `json:"org_id"`      // 平台管理员可指定归属组织
+}
+
+// DismissPendingDevicesRequest 移除待注册设备请求
+type DismissPendingDevicesRequest struct {
+	SerialNumbers []string `json:"serial_numbers" binding:"required"`
+}
+
+// RegisterProvisioningRoutes 注册待注册设备与批量导入路由；svc 为 nil 时返回 503。
+// 批量导入权限与设备管理一致；待注册列表为全局数据（序列号未注册前无法归属组织），仅平台管理员可查看与批准
+func RegisterProvisioningRoutes(router gin.IRouter, svc *service.ProvisioningService, authService *service.AuthService) {
+	provisioningService = svc
+	group := router.Group("/devices", AuthMiddleware(authService),
+		RequireRoles(models.AdminRolePlatformAdmin, models.AdminRoleSuperAdmin, models.AdminRoleAdmin),
+		requireProvisioningService())
+	{
+		group.POST("/import", importDevicesHandler())
+	}
+	pending := group.Group("/pending", RequireRoles(models.AdminRolePlatformAdmin))
+	{
+		pending.GET("", listPendingDevicesHandler())
+		pending.POST("/approve", approvePendingDevicesHandler())
+		pending.POST("/dismiss", dismissPendingDevicesHandler())
+	}
+}
+
+func requireProvisioningService() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if provisioningService == nil {
+			c.AbortWithStatusJSON(http.StatusServiceUnavailable, gin.H{"error": "设备自动注册服务未启用"})
+			return
+		}
+		c.Next()
+	}
+}
+
+// provisioningErrorStatus 将设备注册业务错误映射为 HTTP 状态码
+func provisioningErrorStatus(err error) int {
+	if errors.Is(err, service.ErrInvalidProvisioning) || errors.Is(err, service.ErrDeviceImportFormat) {
+		return http.StatusBadRequest
+	}
+	return http.StatusInternalServerError
+}
+
+// provisioningResponse 汇总批量注册结果，并为注册成功的设备记录审计（不含密钥）
+func provisioningResponse(c *gin.Context, source string, results []models.DeviceProvisionResult) {
+	created := 0
+	for _, r := range results {
+		if r.DeviceID == 0 {
+			continue
+		}
+		created++
+		recordAudit(c, models.AuditActionCreate, models.AuditResourceDevice, r.DeviceID, nil,
+			gin.H{"serial_number": r.SerialNumber, "source": source})
+	}
+	c.JSON(http.StatusOK, gin.H{"created": created, "failed": len(results) - created, "results": results})
+}
+
+/*
+@Summary 待注册设备列表
+@Description 未注册序列号在 MQTT / msgpack 上行时自动记入，返回首次与最近上行时间、接入通道（最近上行在前，最多 500 条）；仅平台管理员
+@Tags Device
+@Produce json
+@Success 200 {array} models.PendingDevice "查询成功"
+*/
+func listPendingDevicesHandler() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		list, err := provisioningService.Pending(c.Request.Context())
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, list)
+	}
+}
+
+/*
+@Summary 批量批准待注册设备
+@Description 将待注册设备注册到指定组织（org_id）并签发密钥（仅此一次返回），单台失败不影响其他设备；成功的设备移出待注册列表；仅平台管理员
+@Tags Device
+@Accept json
+@Produce json
+@Param body body ApprovePendingDevicesRequest true "批准的设备"
+@Success 200 {object} map[string]interface{} "逐台结果（results）及成功、失败数量"
+@Failure 400 {object} map[string]string "参数错误"
+*/
+func approvePendingDevicesHandler() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var req ApprovePendingDevicesRequest
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		results, err := provisioningService.Approve(c.Request.Context(), service.ApproveDevicesInput{
+			OrgID:      req.OrgID,
+			DeviceType: req.DeviceType,
+			Devices:    req.Devices,
+		})
+		if err != nil {
+			c.JSON(provisioningErrorStatus(err), gin.H{"error": err.Error()})
+			return
+		}
+		provisioningResponse(c, "pending_approve", results)
+	}
+}
+
+/*
+@Summary 移除待注册设备
+@Description 从待注册列表移除序列号；设备再次上行时会重新记录；仅平台管理员
+@Tags Device
+@Accept json
+@Produce json
+@Param body body DismissPendingDevicesRequest true "序列号"
+@Success 200 {object} map[string]interface{} "移除数量"
+@Failure 400 {object} map[string]string "参数错误"
+*/
+func dismissPendingDevicesHandler() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var req DismissPendingDevicesRequest
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		n, err := provisioningService.Dismiss(c.Request.Context(), req.SerialNumbers)
+		if err != nil {
+			c.JSON(provisioningErrorStatus(err), gin.H{"error": err.Error()})
+			return
+		}
+		recordAudit(c, models.AuditActionDelete, models.AuditResourcePendingDevice, nil, req.SerialNumbers, nil)
+		c.JSON(http.StatusOK, gin.H{"removed": n})
+	}
+}
+
+/*
+@Summary 从 CSV 批量导入设备
+@Description 上传 CSV 文件，每行 serial_number,device_type[,name]，首行为表头时跳过；逐行注册并签发密钥（仅此一次返回），单行失败不影响其他行
+@Tags Device
+@Accept multipart/form-data
+@Produce json
+@Param file formData file true "CSV 文件"
+@Param org_id formData int false "归属组织（平台管理员可指定）"
+@Success 200 {object} map[string]interface{} "逐行结果（results）及成功、失败数量"
+@Failure 400 {object} map[string]string "文件格式错误"
+*/
+func importDevicesHandler() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		fileHeader, err := c.FormFile("file")
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "缺少 CSV 文件"})
+			return
+		}
+		file, err := fileHeader.Open()
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		defer file.Close()
+		orgID, _ := strconv.Atoi(c.PostForm("org_id"))
+		results, err := provisioningService.Import(c.Request.Context(), orgID, file)
+		if err != nil {
+			c.JSON(provisioningErrorStatus(err), gin.H{"error": err.Error()})
+			return
+		}
+		provisioningResponse(c, "csv_import", results)
+	}
+}
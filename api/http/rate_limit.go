@@ -0,0 +1,127 @@
+// Package http 请求限流
+package http
+
+import (
+	"container/list"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// rateLimiterMaxKeys 单个限流器最多跟踪的键数，超出时先清理过期键，仍满则淘汰窗口最早开始的键，避免伪造来源撑大内存
+const rateLimiterMaxKeys = 100000
+
+// rateLimiter 进程内固定窗口限流，按键（客户端 IP、账号）计数；多实例部署时各实例分别计数。
+// order 按窗口开始时间排列，便于清理过期键与淘汰最早的键
+type rateLimiter struct {
+	mu      sync.Mutex
+	limit   int
+	window  time.Duration
+	windows map[string]*list.Element
+	order   *list.List
+}
+
+type rateWindow struct {
+	key   string
+	start time.Time
+	count int
+}
+
+func newRateLimiter(limit int, window time.Duration) *rateLimiter {
+	return &rateLimiter{limit: limit, window: window, windows: map[string]*list.Element{}, order: list.New()}
+}
+
+// Allow 记录一次请求，窗口内超出次数时返回 false 及距窗口结束的时长
+func (l *rateLimiter) Allow(key string) (bool, time.Duration) {
+	if l.Blocked(key) {
+		return false, l.retryAfter(key)
+	}
+	l.Hit(key)
+	return true, 0
+}
+
+// Blocked 键在当前窗口内是否已达上限（不计数）
+func (l *rateLimiter) Blocked(key string) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	w := l.get(key)
+	return w != nil && time.Since(w.start) < l.window && w.count >= l.limit
+}
+
+// Hit 为键计数一次
+func (l *rateLimiter) Hit(key string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	now := time.Now()
+	el := l.windows[key]
+	if el == nil || now.Sub(el.Value.(*rateWindow).start) >= l.window {
+		if el != nil {
+			l.evict(el)
+		}
+		l.prune(now)
+		for len(l.windows) >= rateLimiterMaxKeys {
+			l.evict(l.order.Front())
+		}
+		el = l.order.PushBack(&rateWindow{key: key, start: now})
+		l.windows[key] = el
+	}
+	el.Value.(*rateWindow).count++
+}
+
+func (l *rateLimiter) retryAfter(key string) time.Duration {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if w := l.get(key); w != nil {
+		return l.window - time.Since(w.start)
+	}
+	return 0
+}
+
+// get 返回键的窗口，调用方持有锁
+func (l *rateLimiter) get(key string) *rateWindow {
+	if el := l.windows[key]; el != nil {
+		return el.Value.(*rateWindow)
+	}
+	return nil
+}
+
+// prune 从最早的窗口起清理已过期的键，调用方持有锁
+func (l *rateLimiter) prune(now time.Time) {
+	for el := l.order.Front(); el != nil && now.Sub(el.Value.(*rateWindow).start) >= l.window; el = l.order.Front() {
+		l.evict(el)
+	}
+}
+
+// evict 移除一个窗口，调用方持有锁
+func (l *rateLimiter) evict(el *list.Element) {
+	delete(l.windows, el.Value.(*rateWindow).key)
+	l.order.Remove(el)
+}
+
+// rateLimitByIP 按客户端 IP 限流的中间件，超限返回 429
+func rateLimitByIP(l *rateLimiter) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if ok, retry := l.Allow(c.ClientIP()); !ok {
+			abortRateLimited(c, retry)
+			return
+		}
+		c.Next()
+	}
+}
+
+// abortRateLimited 返回 429 并设置 Retry-After
+func abortRateLimited(c *gin.Context, retry time.Duration) {
+	if seconds := int(retry.Seconds()) + 1; seconds > 0 {
+		c.Header("Retry-After", strconv.Itoa(seconds))
+	}
+	c.AbortWithStatusJSON(http.StatusTooManyRequests, gin.H{"error": "请求过于频繁，请稍后再试"})
+}
+
+// accountKey 账号限流键，用户名不区分大小写
+func accountKey(userType, username string) string {
+	return userType + ":" + strings.ToLower(strings.TrimSpace(username))
+}
@@ -0,0 +1,266 @@
+// Package http 管理员两步验证路由
+package http
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/fire-disposal/health_DT_go/internal/models"
+	"github.com/fire-disposal/health_DT_go/internal/service"
+	"github.com/gin-gonic/gin"
+)
+
+// TwoFactorLoginRequest 两步验证登录请求，code 与 recovery_code 二选一
+type TwoFactorLoginRequest struct {
+	ChallengeToken string `json:"challenge_token" binding:"required"`
+	Code           string `json:"code"`
+	RecoveryCode   string `json:"recovery_code"`
+}
+
+// ChallengeEnrollRequest 登录挑战中发起绑定请求
+type ChallengeEnrollRequest struct {
+	ChallengeToken string `json:"challenge_token" binding:"required"`
+}
+
+// TOTPCodeRequest TOTP 验证码请求
+type TOTPCodeRequest struct {
+	Code string `json:"code" binding:"required"`
+}
+
+// TwoFactorPolicyRequest 两步验证策略请求
+type TwoFactorPolicyRequest struct {
+	Required bool `json:"required"`
+}
+
+// twoFactorErrorStatus 将两步验证业务错误映射为 HTTP 状态码
+func twoFactorErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, service.ErrInvalid2FACode), errors.Is(err, service.ErrInvalidChallenge):
+		return http.StatusUnauthorized
+	case errors.Is(err, service.Err2FAAlreadyEnabled), errors.Is(err, service.Err2FANotEnabled),
+		errors.Is(err, service.Err2FARequiredByPolicy), errors.Is(err, service.ErrNoPendingEnrollment),
+		errors.Is(err, service.ErrEnrollmentInProgress):
+		return http.StatusBadRequest
+	}
+	return http.StatusInternalServerError
+}
+
+// twoFactorAccountKey 两步验证失败按管理员计数的限流键
+func twoFactorAccountKey(adminID int64) string {
+	return accountKey("admin_2fa", strconv.FormatInt(adminID, 10))
+}
+
+// challengeAccountLimited 解析挑战所属管理员并返回其限流键，挑战无效或账号已达失败上限时写入响应并返回 true
+func challengeAccountLimited(c *gin.Context, twoFactorService *service.TwoFactorService, token string) (string, bool) {
+	adminID, err := twoFactorService.ChallengeAdmin(c.Request.Context(), token)
+	if err != nil {
+		errorResponse(c, twoFactorErrorStatus(err), err.Error())
+		return "", true
+	}
+	key := twoFactorAccountKey(adminID)
+	return key, accountLimited(c, loginFailureLimiter, key)
+}
+
+// RegisterTwoFactorRoutes 注册两步验证相关路由
+func RegisterTwoFactorRoutes(r gin.IRouter, authService *service.AuthService, twoFactorService *service.TwoFactorService) {
+	// @Summary 两步验证登录
+	// @Description 使用登录挑战令牌 + TOTP 验证码（或恢复码）完成管理员登录；绑定流程中首次验证成功会返回恢复码
+	// @Tags auth
+	// @Accept json
+	// @Produce json
+	// @Param body body TwoFactorLoginRequest true "挑战令牌与验证码"
+	// @Success 200 {object} map[string]interface{}
+	// @Failure 401 {string} string "验证失败"
+	// @Failure 429 {string} string "请求过于频繁"
+	// @Router /api/admin/login/2fa [post]
+	r.POST("/api/admin/login/2fa", rateLimitByIP(authIPLimiter), func(c *gin.Context) {
+		var req TwoFactorLoginRequest
+		if err := c.ShouldBindJSON(&req); err != nil || (req.Code == "" && req.RecoveryCode == "") {
+			errorResponse(c, http.StatusBadRequest, "参数错误")
+			return
+		}
+		key, limited := challengeAccountLimited(c, twoFactorService, req.ChallengeToken)
+		if limited {
+			return
+		}
+		result, err := authService.CompleteTwoFactorLogin(c.Request.Context(), req.ChallengeToken, req.Code, req.RecoveryCode)
+		if err != nil {
+			if errors.Is(err, service.ErrInvalid2FACode) {
+				loginFailureLimiter.Hit(key)
+			}
+			errorResponse(c, twoFactorErrorStatus(err), err.Error())
+			return
+		}
+		resp := gin.H{"token": result.Token, "user_id": result.UserID, "role": result.Role}
+		if len(result.RecoveryCodes) > 0 {
+			resp["recovery_codes"] = result.RecoveryCodes
+		}
+		c.JSON(http.StatusOK, resp)
+	})
+
+	// @Summary 登录挑战中绑定两步验证
+	// @Description 系统强制两步验证而管理员尚未绑定时，凭挑战令牌获取 TOTP 密钥与 otpauth URI
+	// @Tags auth
+	// @Accept json
+	// @Produce json
+	// @Param body body ChallengeEnrollRequest true "挑战令牌"
+	// @Success 200 {object} service.TOTPEnrollment
+	// @Failure 429 {string} string "请求过于频繁"
+	// @Router /api/admin/login/2fa/enroll [post]
+	r.POST("/api/admin/login/2fa/enroll", rateLimitByIP(authIPLimiter), func(c *gin.Context) {
+		var req ChallengeEnrollRequest
+		if err := c.ShouldBindJSON(&req); err != nil {
+			errorResponse(c, http.StatusBadRequest, "参数错误")
+			return
+		}
+		if _, limited := challengeAccountLimited(c, twoFactorService, req.ChallengeToken); limited {
+			return
+		}
+		enrollment, err := twoFactorService.BeginChallengeEnrollment(c.Request.Context(), req.ChallengeToken)
+		if err != nil {
+			errorResponse(c, twoFactorErrorStatus(err), err.Error())
+			return
+		}
+		c.JSON(http.StatusOK, enrollment)
+	})
+
+	adminOnly := RequireRoles(models.AdminRolePlatformAdmin, models.AdminRoleSuperAdmin, models.AdminRoleAdmin)
+	group := r.Group("/api/admin/2fa", AuthMiddleware(authService), adminOnly)
+	{
+		group.GET("", twoFactorStatusHandler(twoFactorService))
+		group.POST("/enroll", twoFactorEnrollHandler(twoFactorService))
+		group.POST("/confirm", twoFactorConfirmHandler(twoFactorService))
+		group.POST("/disable", twoFactorDisableHandler(twoFactorService))
+		group.POST("/recovery_codes", twoFactorRecoveryCodesHandler(twoFactorService))
+		group.PUT("/policy", RequireRoles(models.AdminRolePlatformAdmin), twoFactorPolicyHandler(twoFactorService))
+	}
+}
+
+// @Summary 两步验证状态
+// @Description 查询当前管理员两步验证状态及剩余恢复码数量
+// @Tags auth
+// @Produce json
+// @Success 200 {object} service.TwoFactorStatus
+// @Router /api/admin/2fa [get]
+func twoFactorStatusHandler(svc *service.TwoFactorService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		status, err := svc.Status(c.Request.Context(), currentPrincipal(c).UserID)
+		if err != nil {
+			errorResponse(c, http.StatusInternalServerError, err.Error())
+			return
+		}
+		c.JSON(http.StatusOK, status)
+	}
+}
+
+// @Summary 发起两步验证绑定
+// @Description 生成 TOTP 密钥与 otpauth URI，需调用 confirm 接口验证后生效
+// @Tags auth
+// @Produce json
+// @Success 200 {object} service.TOTPEnrollment
+// @Router /api/admin/2fa/enroll [post]
+func twoFactorEnrollHandler(svc *service.TwoFactorService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		enrollment, err := svc.BeginEnrollment(c.Request.Context(), currentPrincipal(c).UserID)
+		if err != nil {
+			errorResponse(c, twoFactorErrorStatus(err), err.Error())
+			return
+		}
+		c.JSON(http.StatusOK, enrollment)
+	}
+}
+
+// @Summary 确认两步验证绑定
+// @Description 校验认证器生成的验证码，启用两步验证并返回恢复码（仅展示一次）
+// @Tags auth
+// @Accept json
+// @Produce json
+// @Param body body TOTPCodeRequest true "验证码"
+// @Success 200 {object} map[string]interface{}
+// @Router /api/admin/2fa/confirm [post]
+func twoFactorConfirmHandler(svc *service.TwoFactorService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var req TOTPCodeRequest
+		if err := c.ShouldBindJSON(&req); err != nil {
+			errorResponse(c, http.StatusBadRequest, "参数错误")
+			return
+		}
+		codes, err := svc.ConfirmEnrollment(c.Request.Context(), currentPrincipal(c).UserID, req.Code)
+		if err != nil {
+			errorResponse(c, twoFactorErrorStatus(err), err.Error())
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"enabled": true, "recovery_codes": codes})
+	}
+}
+
+// @Summary 关闭两步验证
+// @Description 需提供当前验证码；系统强制启用时不可关闭
+// @Tags auth
+// @Accept json
+// @Produce json
+// @Param body body TOTPCodeRequest true "验证码"
+// @Success 200 {object} map[string]interface{}
+// @Router /api/admin/2fa/disable [post]
+func twoFactorDisableHandler(svc *service.TwoFactorService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var req TOTPCodeRequest
+		if err := c.ShouldBindJSON(&req); err != nil {
+			errorResponse(c, http.StatusBadRequest, "参数错误")
+			return
+		}
+		if err := svc.Disable(c.Request.Context(), currentPrincipal(c).UserID, req.Code); err != nil {
+			errorResponse(c, twoFactorErrorStatus(err), err.Error())
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"enabled": false})
+	}
+}
+
+// @Summary 重新生成恢复码
+// @Description 需提供当前验证码，旧恢复码全部作废
+// @Tags auth
+// @Accept json
+// @Produce json
+// @Param body body TOTPCodeRequest true "验证码"
+// @Success 200 {object} map[string]interface{}
+// @Router /api/admin/2fa/recovery_codes [post]
+func twoFactorRecoveryCodesHandler(svc *service.TwoFactorService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var req TOTPCodeRequest
+		if err := c.ShouldBindJSON(&req); err != nil {
+			errorResponse(c, http.StatusBadRequest, "参数错误")
+			return
+		}
+		codes, err := svc.RegenerateRecoveryCodes(c.Request.Context(), currentPrincipal(c).UserID, req.Code)
+		if err != nil {
+			errorResponse(c, twoFactorErrorStatus(err), err.Error())
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"recovery_codes": codes})
+	}
+}
+
+// @Summary 设置两步验证策略
+// @Description 平台管理员设置是否强制所有管理员启用两步验证
+// @Tags auth
+// @Accept json
+// @Produce json
+// @Param body body TwoFactorPolicyRequest true "策略"
+// @Success 200 {object} map[string]interface{}
+// @Router /api/admin/2fa/policy [put]
+func twoFactorPolicyHandler(svc *service.TwoFactorService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var req TwoFactorPolicyRequest
+		if err := c.ShouldBindJSON(&req); err != nil {
+			errorResponse(c, http.StatusBadRequest, "参数错误")
+			return
+		}
+		if err := svc.SetRequired(c.Request.Context(), req.Required, currentPrincipal(c).UserID); err != nil {
+			errorResponse(c, http.StatusInternalServerError, err.Error())
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"required": req.Required})
+	}
+}
@@ -3,26 +3,115 @@ package api
 
 import (
 	"database/sql"
+	"time"
 
 	healthapi "github.com/fire-disposal/health_DT_go/api/http"
+	"github.com/fire-disposal/health_DT_go/config"
+	"github.com/fire-disposal/health_DT_go/internal/fieldcrypt"
+	"github.com/fire-disposal/health_DT_go/internal/notifier"
+	"github.com/fire-disposal/health_DT_go/internal/repository/postgres"
+	"github.com/fire-disposal/health_DT_go/internal/service"
+	"github.com/fire-disposal/health_DT_go/internal/wechat"
 	"github.com/gin-gonic/gin"
 	swaggerFiles "github.com/swaggo/files"
 	ginSwagger "github.com/swaggo/gin-swagger"
+	"go.uber.org/zap"
 )
 
+// Dependencies 路由层依赖，由 main 统一构造后注入，便于与 MQTT/Msgpack 接入层共享服务实例
+type Dependencies struct {
+	DB         *sql.DB
+	Config     *config.Config
+	DeviceAuth *service.DeviceAuthService
+	Presence   *service.PresenceService        // 可为 nil，此时设备接口不返回在线状态
+	Commands   *service.DeviceCommandService   // 可为 nil，此时指令接口返回 503
+	Shadows    *service.DeviceShadowService    // 可为 nil，此时影子接口返回 503
+	OTA        *service.OTAService             // 可为 nil，此时固件升级接口返回 503
+	Provision  *service.ProvisioningService    // 待注册设备与批量导入
+	Telemetry  *service.DeviceTelemetryService // 可为 nil，此时电量与信号接口返回 503
+	DevTypes   *service.DeviceTypeService      // 设备类型目录，与接入层共享缓存
+	Ingest     *service.IngestService          // 可为 nil，此时 HTTP 数据上报接口返回 503
+	Audit      *service.AuditService           // 审计日志，读取类日志由 main 启动的写入协程批量写入
+}
+
 // SetupRoutes 挂载所有业务路由和Swagger UI
-func SetupRoutes(r *gin.Engine, db *sql.DB) {
+func SetupRoutes(r *gin.Engine, deps Dependencies) error {
+	db, cfg := deps.DB, deps.Config
+
 	// 统一API前缀
 	apiV1 := r.Group("/api/v1")
 
-	// 挂载各模块路由
-	healthapi.RegisterAuthRoutes(apiV1, db)
-	healthapi.RegisterAdminUsersRoutes(apiV1)
-	healthapi.RegisterDevicesRoutes(apiV1, nil)
-	healthapi.RegisterDeviceAssignmentsRoutes(apiV1)
-	healthapi.RegisterHealthProfilesRoutes(apiV1, nil)
-	healthapi.RegisterHealthDataRoutes(apiV1, db)
+	// 个人标识字段加密密钥环
+	keys, err := fieldcrypt.New(fieldcrypt.Config{
+		ActiveKeyID: cfg.FieldEncryption.ActiveKeyID,
+		Keys:        cfg.FieldEncryption.Keys,
+		IndexKey:    cfg.FieldEncryption.IndexKey,
+	})
+	if err != nil {
+		return err
+	}
+	if !keys.Enabled() {
+		zap.L().Warn("未配置字段加密主密钥，个人标识字段将以明文存储")
+	}
+
+	// 构造服务
+	adminUserRepo := postgres.NewAdminUserRepository(db)
+	twoFactorService := service.NewTwoFactorService(postgres.NewTwoFactorRepository(db),
+		postgres.NewSettingsRepository(db), adminUserRepo)
+	wx, err := wechat.New(wechat.Config{
+		Mode:      cfg.Wechat.Mode,
+		AllowFake: cfg.Wechat.AllowFake && gin.Mode() != gin.ReleaseMode,
+		AppID:     cfg.Wechat.AppID,
+		Secret:    cfg.Wechat.Secret,
+		BaseURL:   cfg.Wechat.BaseURL,
+		Timeout:   time.Duration(cfg.Wechat.TimeoutSeconds) * time.Second,
+	})
+	if err != nil {
+		return err
+	}
+	if cfg.Wechat.Mode == "fake" {
+		zap.L().Warn("微信登录使用本地替身，任意授权码均可登录，仅限开发环境")
+	}
+	apiKeyService := service.NewAPIKeyService(postgres.NewAPIKeyRepository(db))
+	authService := service.NewAuthService(postgres.NewAuthRepository(db, keys), adminUserRepo, twoFactorService, wx, apiKeyService)
+	adminUsersService := service.NewAdminUsersService(adminUserRepo)
+	notify, err := notifier.New(cfg.Notifier.Type, cfg.Notifier.FilePath, zap.L())
+	if err != nil {
+		return err
+	}
+	passwordService := service.NewPasswordService(postgres.NewAuthRepository(db, keys), adminUserRepo,
+		postgres.NewPasswordResetRepository(db), notify)
+	devicesService := service.NewDevicesService(postgres.NewDevicesRepository(db))
+	healthProfilesRepo := postgres.NewHealthProfilesRepository(db, keys)
+	healthProfilesService := service.NewHealthProfilesService(healthProfilesRepo)
+	profileSharingService := service.NewProfileSharingService(postgres.NewProfileMemberRepository(db), healthProfilesRepo)
+	organizationService := service.NewOrganizationService(postgres.NewOrganizationRepository(db))
+	deviceAssignmentService := service.NewDeviceAssignmentService(postgres.NewDeviceAssignmentRepository(db))
+	locationService := service.NewLocationService(postgres.NewLocationRepository(db))
+
+	// 挂载各模块路由（审计路由优先注册，启用各业务路由的审计记录）
+	healthapi.RegisterAuditLogRoutes(apiV1, deps.Audit, authService)
+	healthapi.RegisterAuthRoutes(apiV1, authService)
+	healthapi.RegisterPasswordRoutes(apiV1, passwordService, authService)
+	healthapi.RegisterTwoFactorRoutes(apiV1, authService, twoFactorService)
+	healthapi.RegisterOrganizationRoutes(apiV1, organizationService, authService)
+	healthapi.RegisterAdminUsersRoutes(apiV1, adminUsersService, authService)
+	healthapi.RegisterAPIKeyRoutes(apiV1, apiKeyService, authService)
+	healthapi.RegisterDevicesRoutes(apiV1, devicesService, deps.DeviceAuth, deps.Presence, authService)
+	healthapi.RegisterProvisioningRoutes(apiV1, deps.Provision, authService)
+	healthapi.RegisterDeviceCommandRoutes(apiV1, deps.Commands, authService)
+	healthapi.RegisterDeviceShadowRoutes(apiV1, deps.Shadows, authService)
+	healthapi.RegisterOTARoutes(apiV1, deps.OTA, authService)
+	healthapi.RegisterDeviceTelemetryRoutes(apiV1, deps.Telemetry, authService)
+	healthapi.RegisterDeviceTypeRoutes(apiV1, deps.DevTypes, authService)
+	healthapi.RegisterIngestRoutes(apiV1, deps.Ingest)
+	healthapi.RegisterDeviceAssignmentsRoutes(apiV1, deviceAssignmentService, authService)
+	healthapi.RegisterHealthProfilesRoutes(apiV1, healthProfilesService, profileSharingService, authService)
+	healthapi.RegisterLocationRoutes(apiV1, locationService, db, authService)
+	healthapi.RegisterProfileMembersRoutes(apiV1, profileSharingService, authService)
+	healthapi.RegisterHealthDataRoutes(apiV1, db, authService)
 
 	// Swagger UI 挂载到 /api/v1/swagger
 	r.GET("/api/v1/swagger/*any", ginSwagger.WrapHandler(swaggerFiles.Handler))
+	return nil
 }
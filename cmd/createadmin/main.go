@@ -0,0 +1,93 @@
+// createadmin 初始化命令：创建首个平台管理员，或为新组织创建首个超级管理员
+//
+// 用法：
+//
+//	go run ./cmd/createadmin -username root -email root@example.com
+//	go run ./cmd/createadmin -username acme -role superadmin -org 2
+//
+// 密码优先读取 -password 参数，未提供时读取环境变量 ADMIN_PASSWORD。
+// 已存在同角色的激活管理员时拒绝执行（超级管理员按组织判断），后续管理员请通过 /admin_users 接口创建。
+package main
+
+import (
+	"context"
+	"database/sql"
+	"flag"
+	"fmt"
+	"os"
+	"time"
+
+	_ "github.com/lib/pq"
+
+	"github.com/fire-disposal/health_DT_go/config"
+	"github.com/fire-disposal/health_DT_go/internal/models"
+	"github.com/fire-disposal/health_DT_go/internal/repository/postgres"
+	"github.com/fire-disposal/health_DT_go/internal/service"
+	"github.com/fire-disposal/health_DT_go/internal/tenant"
+)
+
+func main() {
+	username := flag.String("username", "admin", "管理员用户名")
+	password := flag.String("password", "", "管理员密码（默认读取 ADMIN_PASSWORD）")
+	email := flag.String("email", "", "邮箱")
+	phone := flag.String("phone", "", "手机号")
+	role := flag.String("role", models.AdminRolePlatformAdmin, "角色：platform_admin / superadmin")
+	orgID := flag.Int("org", tenant.DefaultOrgID, "所属组织ID")
+	flag.Parse()
+
+	if *password == "" {
+		*password = os.Getenv("ADMIN_PASSWORD")
+	}
+	in := service.CreateAdminUserInput{
+		Username: *username,
+		Email:    *email,
+		Phone:    *phone,
+		Password: *password,
+		Role:     *role,
+		OrgID:    *orgID,
+	}
+	if err := run(in); err != nil {
+		fmt.Fprintf(os.Stderr, "创建管理员失败: %v\n", err)
+		os.Exit(1)
+	}
+}
+
+func run(in service.CreateAdminUserInput) error {
+	if in.Role != models.AdminRolePlatformAdmin && in.Role != models.AdminRoleSuperAdmin {
+		return fmt.Errorf("-role 仅支持 %s 或 %s", models.AdminRolePlatformAdmin, models.AdminRoleSuperAdmin)
+	}
+	cfg, err := config.Load()
+	if err != nil {
+		return fmt.Errorf("配置加载失败: %w", err)
+	}
+	db, err := sql.Open("postgres", cfg.Postgres.DSN())
+	if err != nil {
+		return fmt.Errorf("数据库连接创建失败: %w", err)
+	}
+	defer db.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	if err := db.PingContext(ctx); err != nil {
+		return fmt.Errorf("数据库连接测试失败: %w", err)
+	}
+
+	svc := service.NewAdminUsersService(postgres.NewAdminUserRepository(db))
+	checkCtx := ctx
+	if in.Role == models.AdminRoleSuperAdmin {
+		checkCtx = tenant.WithScope(ctx, tenant.Scope{OrgID: in.OrgID})
+	}
+	exists, err := svc.HasActiveRole(checkCtx, in.Role)
+	if err != nil {
+		return err
+	}
+	if exists {
+		return fmt.Errorf("已存在激活的 %s，请登录后通过接口创建新管理员", in.Role)
+	}
+	user, err := svc.Create(ctx, in)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("管理员创建成功: id=%d username=%s role=%s org=%d\n", user.ID, user.Username, user.Role, user.OrgID)
+	return nil
+}
@@ -0,0 +1,96 @@
+// reencrypt 个人标识字段重加密任务：将历史明文及旧主密钥密文重新加密到当前主密钥，并补齐盲索引
+//
+// 用法：
+//
+//	go run ./cmd/reencrypt
+//	go run ./cmd/reencrypt -batch 500
+//
+// 执行时机：首次启用字段加密、轮换主密钥（新增密钥并切换 active_key_id 后）或更换盲索引密钥后。
+// 可在服务运行期间重复执行；全部完成后方可从配置中移除旧主密钥。
+package main
+
+import (
+	"context"
+	"database/sql"
+	"flag"
+	"fmt"
+	"os"
+	"time"
+
+	_ "github.com/lib/pq"
+
+	"github.com/fire-disposal/health_DT_go/config"
+	"github.com/fire-disposal/health_DT_go/internal/fieldcrypt"
+	"github.com/fire-disposal/health_DT_go/internal/repository/postgres"
+)
+
+func main() {
+	batchSize := flag.Int("batch", 200, "每批处理行数")
+	flag.Parse()
+
+	if err := run(*batchSize); err != nil {
+		fmt.Fprintf(os.Stderr, "重加密失败: %v\n", err)
+		os.Exit(1)
+	}
+}
+
+func run(batchSize int) error {
+	if batchSize <= 0 {
+		return fmt.Errorf("-batch 需大于 0")
+	}
+	cfg, err := config.Load()
+	if err != nil {
+		return fmt.Errorf("配置加载失败: %w", err)
+	}
+	keys, err := fieldcrypt.New(fieldcrypt.Config{
+		ActiveKeyID: cfg.FieldEncryption.ActiveKeyID,
+		Keys:        cfg.FieldEncryption.Keys,
+		IndexKey:    cfg.FieldEncryption.IndexKey,
+	})
+	if err != nil {
+		return err
+	}
+	if !keys.Enabled() {
+		fmt.Println("未配置字段加密主密钥，仅补齐盲索引")
+	}
+	db, err := sql.Open("postgres", cfg.Postgres.DSN())
+	if err != nil {
+		return fmt.Errorf("数据库连接创建失败: %w", err)
+	}
+	defer db.Close()
+
+	ctx := context.Background()
+	pingCtx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+	if err := db.PingContext(pingCtx); err != nil {
+		return fmt.Errorf("数据库连接测试失败: %w", err)
+	}
+
+	repo := postgres.NewFieldEncryptionRepository(db, keys)
+	tables := []struct {
+		name string
+		fn   func(context.Context, int64, int) (postgres.ReencryptBatch, error)
+	}{
+		{"app_users", repo.ReencryptAppUsers},
+		{"health_profiles", repo.ReencryptHealthProfiles},
+	}
+	for _, t := range tables {
+		var lastID int64
+		var scanned, updated int
+		for {
+			batch, err := t.fn(ctx, lastID, batchSize)
+			if err != nil {
+				return fmt.Errorf("%s（id > %d）: %w", t.name, lastID, err)
+			}
+			scanned += batch.Scanned
+			updated += batch.Updated
+			lastID = batch.LastID
+			if batch.Scanned < batchSize {
+				break
+			}
+		}
+		fmt.Printf("%s: 扫描 %d 行，更新 %d 行\n", t.name, scanned, updated)
+	}
+	fmt.Printf("重加密完成，当前主密钥: %s\n", keys.ActiveKeyID())
+	return nil
+}
@@ -9,6 +9,7 @@ package main
 import (
 	"context"
 	"database/sql"
+	"encoding/json"
 	"fmt"
 	"net/http"
 	"os"
@@ -16,6 +17,7 @@ import (
 	"syscall"
 	"time"
 
+	paho "github.com/eclipse/paho.mqtt.golang"
 	"github.com/gin-gonic/gin"
 	_ "github.com/lib/pq"
 	"go.uber.org/zap"
@@ -27,8 +29,12 @@ import (
 	"github.com/fire-disposal/health_DT_go/internal/app/eventbus"
 	"github.com/fire-disposal/health_DT_go/internal/app/handlers"
 	"github.com/fire-disposal/health_DT_go/internal/app/handlers/health"
+	"github.com/fire-disposal/health_DT_go/internal/models"
 	"github.com/fire-disposal/health_DT_go/internal/mqtt"
 	"github.com/fire-disposal/health_DT_go/internal/msgpack"
+	"github.com/fire-disposal/health_DT_go/internal/repository/postgres"
+	redisrepo "github.com/fire-disposal/health_DT_go/internal/repository/redis"
+	"github.com/fire-disposal/health_DT_go/internal/service"
 )
 
 // Application 应用程序结构体，统一管理所有组件
@@ -40,7 +46,20 @@ type Application struct {
 	server     *http.Server
 	pipeline   *app.Pipeline
 	mqttClient *mqtt.MQTTClient
+	eventBus   *eventbus.EventBus
+	events     *postgres.EventsRepository
 	msgpackSrv *msgpack.MsgpackServer
+	deviceAuth *service.DeviceAuthService
+	presence   *service.PresenceService
+	commands   *service.DeviceCommandService
+	shadows    *service.DeviceShadowService
+	ota        *service.OTAService
+	provision  *service.ProvisioningService
+	telemetry  *service.DeviceTelemetryService
+	devTypes   *service.DeviceTypeService
+	ingest     *service.IngestService
+	audit      *service.AuditService
+	auditDone  chan struct{} // 审计日志写入协程退出后关闭
 
 	// 用于优雅关闭的context
 	ctx    context.Context
@@ -95,20 +114,69 @@ func NewApplication() (*Application, error) {
 	eventBus := eventbus.NewEventBus()
 	pipeline := app.NewPipeline(eventBus)
 	registerHealthProcessors(pipeline, logger)
+	pipeline.SetLocator(deviceLocator(postgres.NewLocationRepository(db), logger))
+
+	// 设备凭证服务，HTTP 路由与 MQTT/Msgpack 接入层共享
+	deviceAuth := service.NewDeviceAuthService(postgres.NewDevicesRepository(db),
+		cfg.DeviceAuth.Required, time.Duration(cfg.DeviceAuth.MaxSkewSeconds)*time.Second)
+
+	// 初始化Redis（设备在线状态、健康数据缓存）
+	redisClient := redisrepo.InitRedisClient(&cfg.Redis)
+	pingCtx, pingCancel := context.WithTimeout(context.Background(), 3*time.Second)
+	if err := redisrepo.PingRedis(pingCtx); err != nil {
+		logger.Warn("Redis连接测试失败，设备在线状态暂不可用", zap.String("addr", cfg.Redis.Addr), zap.Error(err))
+	}
+	pingCancel()
+
+	// 设备在线状态服务，接入层记录上行，巡检任务判定离线
+	presence := service.NewPresenceService(redisrepo.NewPresenceRepository(redisClient),
+		postgres.NewDevicesRepository(db), postgres.NewEventsRepository(db), postgres.NewAlertsRepository(db),
+		postgres.NewLocationRepository(db), eventBus, presenceConfig(cfg.Presence))
 
 	// 创建应用实例
 	ctx, cancel := context.WithCancel(context.Background())
 	app := &Application{
-		logger:   logger,
-		config:   cfg,
-		db:       db,
-		pipeline: pipeline,
-		ctx:      ctx,
-		cancel:   cancel,
+		logger:     logger,
+		config:     cfg,
+		db:         db,
+		pipeline:   pipeline,
+		deviceAuth: deviceAuth,
+		presence:   presence,
+		eventBus:   eventBus,
+		events:     postgres.NewEventsRepository(db),
+		ctx:        ctx,
+		cancel:     cancel,
+	}
+
+	// MQTT客户端在启动前创建，健康检查可随时读取连接状态
+	if app.mqttClient, err = app.newMQTTClient(); err != nil {
+		logger.Error("MQTT客户端创建失败", zap.Error(err))
+		return nil, err
 	}
 
+	// 设备下行指令与设备影子服务，经MQTT客户端下发，回执与上报由接入层处理
+	app.commands = service.NewDeviceCommandService(postgres.NewDeviceCommandRepository(db),
+		postgres.NewDevicesRepository(db), deviceAuth, app.mqttClient)
+	app.shadows = service.NewDeviceShadowService(postgres.NewDeviceShadowRepository(db), deviceAuth, app.mqttClient)
+	app.provision = service.NewProvisioningService(postgres.NewPendingDeviceRepository(db),
+		postgres.NewDevicesRepository(db), deviceAuth)
+	app.ota = service.NewOTAService(postgres.NewOTARepository(db), deviceAuth, app.mqttClient,
+		cfg.OTA.StorageDir, int64(cfg.OTA.MaxUploadMB)<<20, cfg.OTA.DownloadBaseURL,
+		time.Duration(cfg.OTA.DeviceTimeoutMinutes)*time.Minute)
+	// 设备类型目录：接入层校验上报数据，在线状态按目录上报间隔推算静默时长
+	app.devTypes = service.NewDeviceTypeService(postgres.NewDeviceTypeRepository(db), postgres.NewDevicesRepository(db))
+	presence.SetReportingIntervals(app.devTypes.ReportingInterval)
+	app.telemetry = service.NewDeviceTelemetryService(postgres.NewDeviceTelemetryRepository(db),
+		postgres.NewDevicesRepository(db), postgres.NewAlertsRepository(db), telemetryConfig(cfg.Telemetry))
+	// HTTP 数据上报与 MQTT 共用签名校验、设备类型校验与处理管道
+	app.audit = service.NewAuditService(postgres.NewAuditLogRepository(db))
+	app.ingest = service.NewIngestService(pipeline, deviceAuth, presence, app.provision, app.telemetry, app.devTypes)
+
 	// 初始化HTTP路由
-	app.initRouter()
+	if err := app.initRouter(); err != nil {
+		logger.Error("路由初始化失败", zap.Error(err))
+		return nil, fmt.Errorf("路由初始化失败: %w", err)
+	}
 
 	// 初始化HTTP服务器
 	app.server = &http.Server{
@@ -177,36 +245,66 @@ func initLogger() *zap.Logger {
 	if err != nil {
 		panic(fmt.Sprintf("无法初始化logger: %v", err))
 	}
+	// 替换全局logger，使各模块 zap.L() 输出生效
+	zap.ReplaceGlobals(logger)
 
 	return logger
 }
 
-func (app *Application) initRouter() {
+func (app *Application) initRouter() error {
 	// 根据环境设置Gin模式
 	if getEnv("ENV", "development") == "production" {
 		gin.SetMode(gin.ReleaseMode)
 	}
 
 	r := gin.New()
+	// 仅信任配置的反向代理转发的客户端 IP，未配置时 ClientIP 取连接对端地址，防止伪造 X-Forwarded-For 绕过按 IP 限流与审计
+	if err := r.SetTrustedProxies(app.config.Server.TrustedProxies); err != nil {
+		return fmt.Errorf("可信代理配置无效: %w", err)
+	}
 
 	// 中间件
 	r.Use(ginLoggerMiddleware(app.logger))
 	r.Use(gin.Recovery())
 	r.Use(corsMiddleware())
 
-	// 健康检查端点
+	// 健康检查端点，MQTT 未连接时 status 为 degraded 并返回 503，便于负载均衡与探针摘除
 	r.GET("/ping", func(c *gin.Context) {
-		c.JSON(http.StatusOK, gin.H{
+		mqttStatus := app.mqttClient.Status()
+		status, code := "ok", http.StatusOK
+		if mqttStatus.State != mqtt.StateConnected {
+			status, code = "degraded", http.StatusServiceUnavailable
+		}
+		c.JSON(code, gin.H{
 			"message":   "pong",
+			"status":    status,
+			"mqtt":      mqttStatus,
+			"msgpack":   app.msgpackStats(),
 			"timestamp": time.Now().Unix(),
 			"version":   "1.0",
 		})
 	})
 
 	// 统一挂载所有业务路由和Swagger UI
-	api.SetupRoutes(r, app.db)
+	if err := api.SetupRoutes(r, api.Dependencies{
+		DB:         app.db,
+		Config:     app.config,
+		DeviceAuth: app.deviceAuth,
+		Presence:   app.presence,
+		Commands:   app.commands,
+		Shadows:    app.shadows,
+		OTA:        app.ota,
+		Provision:  app.provision,
+		Telemetry:  app.telemetry,
+		DevTypes:   app.devTypes,
+		Ingest:     app.ingest,
+		Audit:      app.audit,
+	}); err != nil {
+		return err
+	}
 
 	app.router = r
+	return nil
 }
 
 // Run 启动应用
@@ -216,8 +314,27 @@ func (app *Application) Run() error {
 	// 启动MQTT监听（异步）
 	go app.startMQTT()
 
-	// 启动Msgpack监听（异步）
-	go app.startMsgpack()
+	// 启动Msgpack监听（后台接受连接，app.ctx 取消时排空连接）
+	app.startMsgpack()
+
+	// 启动设备在线状态巡检（异步）
+	go app.presence.Run(app.ctx)
+
+	// 启动设备指令超时处理（异步）
+	go app.commands.Run(app.ctx)
+
+	// 启动固件升级活动推进（异步）
+	go app.ota.Run(app.ctx)
+
+	// 启动设备电量与信号历史清理（异步）
+	go app.telemetry.Run(app.ctx)
+
+	// 启动审计日志批量写入（异步），app.ctx 取消时写完队列后退出
+	app.auditDone = make(chan struct{})
+	go func() {
+		defer close(app.auditDone)
+		app.audit.Run(app.ctx)
+	}()
 
 	// 启动HTTP服务器（异步）
 	go func() {
@@ -257,9 +374,27 @@ func (app *Application) gracefulShutdown() error {
 	shutdownCtx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
 	defer cancel()
 
-	// 关闭HTTP服务器
-	if err := app.server.Shutdown(shutdownCtx); err != nil {
+	// 关闭HTTP服务器；失败时仍继续关闭其余接入层，错误在最后返回
+	err := app.server.Shutdown(shutdownCtx)
+	if err != nil {
 		app.logger.Error("HTTP服务器关闭失败", zap.Error(err))
+	}
+
+	// 停止接受Msgpack连接，等待已收数据处理完毕后再关闭数据库
+	if app.msgpackSrv != nil {
+		if err := app.msgpackSrv.Shutdown(shutdownCtx); err != nil {
+			app.logger.Warn("Msgpack服务器关闭超时", zap.Error(err))
+		}
+	}
+
+	// 断开MQTT，不再接收新消息，再等待已接收数据的处理完成
+	if app.mqttClient != nil {
+		app.mqttClient.Disconnect(1000)
+	}
+	if err := app.pipeline.Wait(shutdownCtx); err != nil {
+		app.logger.Warn("健康数据处理未在关闭超时内完成", zap.Error(err))
+	}
+	if err != nil {
 		return err
 	}
 
@@ -277,8 +412,22 @@ func (app *Application) Close() {
 		app.mqttClient.Disconnect(1000)
 	}
 
-	if app.msgpackSrv != nil {
-		// MsgpackServer 没有 Stop 方法，无法优雅关闭
+	// 未经优雅关闭时（如启动失败）也等待处理中的数据，避免处理器使用已关闭的数据库
+	if app.pipeline != nil {
+		waitCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		if err := app.pipeline.Wait(waitCtx); err != nil {
+			app.logger.Warn("健康数据处理未在关闭超时内完成", zap.Error(err))
+		}
+		cancel()
+	}
+
+	// 等待审计日志写完队列
+	if app.auditDone != nil {
+		select {
+		case <-app.auditDone:
+		case <-time.After(10 * time.Second):
+			app.logger.Warn("审计日志未在关闭超时内写完")
+		}
 	}
 
 	if app.db != nil {
@@ -295,10 +444,7 @@ func initDB(cfg *config.Config, logger *zap.Logger) (*sql.DB, error) {
 	pg := cfg.Postgres
 
 	// 构建DSN，明确指定编码
-	dsn := fmt.Sprintf(
-		"host=%s port=%d user=%s password=%s dbname=%s sslmode=%s client_encoding=UTF8 connect_timeout=10",
-		pg.Host, pg.Port, pg.User, pg.Password, pg.DBName, pg.SSLMode,
-	)
+	dsn := pg.DSN()
 
 	logger.Debug("正在连接数据库",
 		zap.String("host", pg.Host),
@@ -357,49 +503,213 @@ func registerHealthProcessors(pipeline *app.Pipeline, logger *zap.Logger) {
 	logger.Info("健康数据处理器注册完成", zap.Int("count", 4))
 }
 
-// startMQTT 启动MQTT监听
+// deviceLocator 按序列号查询设备所在位置，供处理管道附加到健康数据事件；查询失败仅记录日志
+func deviceLocator(repo *postgres.LocationRepository, logger *zap.Logger) func(sn string) *models.Location {
+	return func(sn string) *models.Location {
+		ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+		defer cancel()
+		loc, err := repo.SerialLocation(ctx, sn)
+		if err != nil {
+			logger.Warn("设备位置查询失败", zap.String("sn", sn), zap.Error(err))
+			return nil
+		}
+		return loc
+	}
+}
+
+// presenceConfig 将配置中的秒数转换为在线状态参数
+func presenceConfig(cfg config.PresenceConfig) service.PresenceConfig {
+	timeouts := make(map[string]time.Duration, len(cfg.Timeouts))
+	for deviceType, seconds := range cfg.Timeouts {
+		timeouts[deviceType] = time.Duration(seconds) * time.Second
+	}
+	return service.PresenceConfig{
+		SweepInterval:  time.Duration(cfg.SweepIntervalSeconds) * time.Second,
+		DefaultTimeout: time.Duration(cfg.DefaultTimeoutSeconds) * time.Second,
+		Timeouts:       timeouts,
+	}
+}
+
+// telemetryConfig 将配置中的秒数、小时数转换为电量与信号监测参数
+func telemetryConfig(cfg config.TelemetryConfig) service.DeviceTelemetryConfig {
+	return service.DeviceTelemetryConfig{
+		LowBattery:       cfg.LowBatteryPercent,
+		PoorSignal:       cfg.PoorSignalRSSI,
+		LowBatteryByType: cfg.LowBattery,
+		PoorSignalByType: cfg.PoorSignal,
+		RecordInterval:   time.Duration(cfg.RecordIntervalSeconds) * time.Second,
+		Retention:        time.Duration(cfg.RetentionHours) * time.Hour,
+	}
+}
+
+// msgpackLimits 将配置中的秒数、KB 转换为 Msgpack 连接限制，0 使用默认值
+func msgpackLimits(cfg config.MsgpackConfig) msgpack.Limits {
+	return msgpack.Limits{
+		MaxConnections:      cfg.MaxConnections,
+		MaxConnectionsPerIP: cfg.MaxConnectionsPerIP,
+		IdleTimeout:         time.Duration(cfg.IdleTimeoutSeconds) * time.Second,
+		MaxBufferBytes:      cfg.MaxBufferKB * 1024,
+		DrainTimeout:        time.Duration(cfg.DrainTimeoutSeconds) * time.Second,
+	}
+}
+
+// newMQTTClient 创建MQTT客户端，服务自身状态主题默认 server/{client_id}/status
+func (app *Application) newMQTTClient() (*mqtt.MQTTClient, error) {
+	cfg := app.config.MQTT
+	if cfg.InsecureSkipVerify {
+		app.logger.Warn("MQTT 已跳过 Broker 证书校验（MQTT_INSECURE_SKIP_VERIFY），连接可被中间人劫持，仅限本地开发使用")
+	}
+	statusTopic := cfg.StatusTopic
+	if statusTopic == "" {
+		statusTopic = fmt.Sprintf("server/%s/status", cfg.ClientID)
+	}
+	client, err := mqtt.NewMQTTClient(mqtt.ClientConfig{
+		Broker:             cfg.Broker,
+		ClientID:           cfg.ClientID,
+		Username:           cfg.Username,
+		Password:           cfg.Password,
+		StatusTopic:        statusTopic,
+		CAFile:             cfg.CAFile,
+		CertFile:           cfg.CertFile,
+		KeyFile:            cfg.KeyFile,
+		InsecureSkipVerify: cfg.InsecureSkipVerify,
+	})
+	if err != nil {
+		return nil, err
+	}
+	client.SetStateHandler(app.onMQTTState)
+	return client, nil
+}
+
+// onMQTTState 记录MQTT连接状态变化：写日志、落库为系统事件并发布到事件总线；
+// 在 paho 回调中执行，落库与发布放到独立协程，避免数据库慢时阻塞重连与恢复订阅
+func (app *Application) onMQTTState(state string, err error) {
+	var eventType string
+	switch state {
+	case mqtt.StateConnected:
+		if err != nil {
+			app.logger.Error("MQTT重连后恢复订阅失败", zap.Error(err))
+		}
+		app.logger.Info("MQTT已连接", zap.String("broker", app.config.MQTT.Broker))
+		eventType = models.EventMQTTConnected
+	case mqtt.StateDisconnected:
+		app.logger.Warn("MQTT连接丢失，自动重连中", zap.Error(err))
+		eventType = models.EventMQTTDisconnected
+	default:
+		return
+	}
+
+	detail := map[string]interface{}{
+		"broker":     app.config.MQTT.Broker,
+		"client_id":  app.config.MQTT.ClientID,
+		"reconnects": app.mqttClient.Status().Reconnects,
+	}
+	if err != nil {
+		detail["error"] = err.Error()
+	}
+	data, _ := json.Marshal(detail)
+	now := time.Now()
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		id, dbErr := app.events.CreateSystemEvent(ctx, eventType, now, data)
+		if dbErr != nil {
+			app.logger.Error("MQTT连接事件记录失败", zap.String("event_type", eventType), zap.Error(dbErr))
+		}
+		app.eventBus.Publish(eventType, models.Event{ID: id, EventType: eventType, Timestamp: now, Data: data})
+	}()
+}
+
+// startMQTT 启动MQTT监听：先登记订阅，连接（含每次重连）成功后自动订阅；Broker 不可达时持续重试
 func (app *Application) startMQTT() {
 	cfg := app.config.MQTT
 	app.logger.Info("正在启动MQTT客户端...")
 
-	app.mqttClient = mqtt.NewMQTTClient(mqtt.ClientConfig{
-		Broker:   cfg.Broker,
-		ClientID: cfg.ClientID,
-		Username: cfg.Username,
-		Password: cfg.Password,
-	})
+	subscriptions := []struct {
+		topic   string
+		qos     byte
+		handler paho.MessageHandler
+	}{
+		{"device/+/data/+", 0, handlers.HandleMQTTMessage(app.pipeline, app.deviceAuth, app.presence, app.provision, app.telemetry, app.devTypes)},
+		{"device/+/heartbeat", 0, handlers.HandleMQTTHeartbeat(app.deviceAuth, app.presence, app.provision, app.telemetry)},
+		{"device/+/status", 0, handlers.HandleMQTTDeviceStatus(app.pipeline, app.deviceAuth, app.presence, app.shadows)},
+		{"device/+/shadow/+", 1, handlers.HandleMQTTShadow(app.pipeline, app.deviceAuth, app.shadows, app.presence, app.telemetry)},
+		{"device/+/ack", 1, handlers.HandleMQTTAck(app.deviceAuth, app.commands, app.presence)},
+		{"device/+/ota/status", 1, handlers.HandleMQTTOTAStatus(app.deviceAuth, app.ota, app.presence)},
+	}
+	for _, sub := range subscriptions {
+		if err := app.mqttClient.Subscribe(sub.topic, sub.qos, sub.handler); err != nil {
+			app.logger.Error("MQTT订阅失败", zap.String("topic", sub.topic), zap.Error(err))
+			return
+		}
+	}
 
 	if err := app.mqttClient.Connect(); err != nil {
 		app.logger.Error("MQTT连接失败", zap.Error(err))
 		return
 	}
 
-	if err := app.mqttClient.Subscribe("device/+/data/+", 0, handlers.HandleMQTTMessage(app.pipeline)); err != nil {
-		app.logger.Error("MQTT订阅失败", zap.Error(err))
-		return
-	}
-
 	app.logger.Info("MQTT客户端启动成功",
 		zap.String("broker", cfg.Broker),
 		zap.String("client_id", cfg.ClientID))
 }
 
-// startMsgpack 启动Msgpack监听
+// startMsgpack 启动Msgpack监听，端口不可用时仅记录错误，不影响其他接入
 func (app *Application) startMsgpack() {
 	port := app.config.Server.MsgListenerPort
 	app.logger.Info("正在启动Msgpack服务器...")
 
-	app.msgpackSrv = msgpack.NewMsgpackServer(
-		handlers.HandleMsgpackPayload(app.pipeline),
+	srv := msgpack.NewMsgpackServer(
+		handlers.HandleMsgpackPayload(app.pipeline, app.presence, app.telemetry, app.devTypes, app.commands),
 		port,
 	)
+	srv.SetAuthenticator(app.deviceAuth)
+	srv.SetObserver(func(sn, remoteAddr string) {
+		app.provision.Observe("msgpack", sn, remoteAddr)
+	})
+	srv.SetLimits(msgpackLimits(app.config.Msgpack))
+	// 设备经长连接上线后补发影子差异
+	srv.SetConnectHandler(func(sn string) {
+		ctx, cancel := context.WithTimeout(app.ctx, 30*time.Second)
+		defer cancel()
+		if err := app.shadows.SyncDevice(ctx, sn); err != nil {
+			app.logger.Warn("设备影子同步失败", zap.String("sn", sn), zap.Error(err))
+		}
+	})
+	if tlsCfg := app.config.Msgpack.TLS; tlsCfg.Enabled {
+		serverTLS, err := msgpack.ServerTLSConfig(msgpack.TLSOptions{
+			CertFile:     tlsCfg.CertFile,
+			KeyFile:      tlsCfg.KeyFile,
+			ClientCAFile: tlsCfg.ClientCAFile,
+			ClientAuth:   tlsCfg.ClientAuth,
+		})
+		if err != nil {
+			// 不回退为明文监听，避免健康数据在预期加密的端口上明文传输
+			app.logger.Error("Msgpack TLS配置无效，服务器未启动", zap.Error(err))
+			return
+		}
+		srv.SetTLS(serverTLS)
+	}
+
+	// 设备有长连接时，指令与影子差异经该连接下发；监听失败时不会有连接，仍经 MQTT 下发
+	app.commands.SetDirectDownlink(srv)
+	app.shadows.SetDirectDownlink(srv)
 
-	if err := app.msgpackSrv.Start(); err != nil {
+	if err := srv.Start(app.ctx); err != nil {
 		app.logger.Error("Msgpack服务器启动失败", zap.Error(err))
 		return
 	}
+	app.msgpackSrv = srv
 
-	app.logger.Info("Msgpack服务器启动成功", zap.Int("port", port))
+	app.logger.Info("Msgpack服务器启动成功", zap.Int("port", port), zap.Bool("tls", app.config.Msgpack.TLS.Enabled))
+}
+
+// msgpackStats Msgpack连接统计，服务器未启动时为 nil
+func (app *Application) msgpackStats() interface{} {
+	if app.msgpackSrv == nil {
+		return nil
+	}
+	return app.msgpackSrv.Stats()
 }
 
 // ginLoggerMiddleware Gin日志中间件
@@ -4,13 +4,15 @@ import (
 	"fmt"
 	"os"
 	"strconv"
+	"strings"
 
 	"github.com/spf13/viper"
 )
 
 type ServerConfig struct {
-	Port            int `mapstructure:"port"`
-	MsgListenerPort int `mapstructure:"msglistener_port"`
+	Port            int      `mapstructure:"port"`
+	MsgListenerPort int      `mapstructure:"msglistener_port"`
+	TrustedProxies  []string `mapstructure:"trusted_proxies"` // 可信反向代理 IP / CIDR，仅信任其 X-Forwarded-For；默认不信任任何代理
 }
 
 type PostgresConfig struct {
@@ -22,6 +24,14 @@ type PostgresConfig struct {
 	SSLMode  string `mapstructure:"sslmode"`
 }
 
+// DSN 构建 PostgreSQL 连接串，明确指定编码
+func (p PostgresConfig) DSN() string {
+	return fmt.Sprintf(
+		"host=%s port=%d user=%s password=%s dbname=%s sslmode=%s client_encoding=UTF8 connect_timeout=10",
+		p.Host, p.Port, p.User, p.Password, p.DBName, p.SSLMode,
+	)
+}
+
 type RedisConfig struct {
 	Addr     string `mapstructure:"addr"`
 	Password string `mapstructure:"password"`
@@ -33,6 +43,13 @@ type MQTTConfig struct {
 	ClientID string `mapstructure:"client_id"`
 	Username string `mapstructure:"username"`
 	Password string `mapstructure:"password"`
+	// StatusTopic 服务自身在线状态主题（retained，断线时由 Broker 发布遗嘱 offline），默认 server/{client_id}/status
+	StatusTopic string `mapstructure:"status_topic"`
+	// TLS 选项，Broker 地址为 ssl:// / tls:// / mqtts:// / wss:// 时生效
+	CAFile             string `mapstructure:"ca_file"`              // Broker 证书 CA，为空使用系统根证书
+	CertFile           string `mapstructure:"cert_file"`            // 客户端证书（mTLS）
+	KeyFile            string `mapstructure:"key_file"`             // 客户端私钥
+	InsecureSkipVerify bool   `mapstructure:"insecure_skip_verify"` // 跳过 Broker 证书校验，仅限本地开发
 }
 
 type WebSocketConfig struct {
@@ -41,19 +58,101 @@ type WebSocketConfig struct {
 	Path string `mapstructure:"path"`
 }
 
+// WechatConfig 微信登录配置，mode 支持 http（请求微信接口）/ fake（本地替身，不访问网络）；
+// fake 需同时设置 allow_fake，且 release 模式下拒绝启动
 type WechatConfig struct {
-	AppID  string `mapstructure:"appid"`
-	Secret string `mapstructure:"secret"`
+	Mode           string `mapstructure:"mode"`
+	AllowFake      bool   `mapstructure:"allow_fake"`
+	AppID          string `mapstructure:"appid"`
+	Secret         string `mapstructure:"secret"`
+	BaseURL        string `mapstructure:"base_url"`        // 默认 https://api.weixin.qq.com
+	TimeoutSeconds int    `mapstructure:"timeout_seconds"` // 默认 5 秒
+}
+
+// NotifierConfig 通知通道配置，type 支持 log / file
+type NotifierConfig struct {
+	Type     string `mapstructure:"type"`
+	FilePath string `mapstructure:"file_path"`
+}
+
+// DeviceAuthConfig 设备消息签名认证配置
+type DeviceAuthConfig struct {
+	Required       bool `mapstructure:"required"`         // 是否拒绝未签名消息
+	MaxSkewSeconds int  `mapstructure:"max_skew_seconds"` // 允许的时间戳偏差（秒）
+}
+
+// FieldEncryptionConfig 个人标识字段加密配置；keys 为 "id:base64,..."，每个主密钥 32 字节，
+// 未配置 keys 时不加密（仅限本地开发）
+type FieldEncryptionConfig struct {
+	ActiveKeyID string `mapstructure:"active_key_id"`
+	Keys        string `mapstructure:"keys"`
+	IndexKey    string `mapstructure:"index_key"` // 盲索引 HMAC 密钥（base64）
+}
+
+// PresenceConfig 设备在线状态配置：超过静默时长未收到数据或心跳即判定离线，
+// timeouts 按 device_type 覆盖默认时长（环境变量格式 "type:秒,..."）
+type PresenceConfig struct {
+	SweepIntervalSeconds  int            `mapstructure:"sweep_interval_seconds"`  // 巡检间隔，默认 30 秒
+	DefaultTimeoutSeconds int            `mapstructure:"default_timeout_seconds"` // 默认静默时长，默认 300 秒
+	Timeouts              map[string]int `mapstructure:"timeouts"`
+}
+
+// OTAConfig 固件升级配置
+type OTAConfig struct {
+	StorageDir           string `mapstructure:"storage_dir"`            // 固件文件存储目录，默认 ./data/firmware
+	MaxUploadMB          int    `mapstructure:"max_upload_mb"`          // 单个固件大小上限，默认 64MB
+	DownloadBaseURL      string `mapstructure:"download_base_url"`      // 设备下载固件使用的服务地址，如 https://iot.example.com
+	DeviceTimeoutMinutes int    `mapstructure:"device_timeout_minutes"` // 已下发设备无进度上报超过该时长判为失败，默认 60 分钟
+}
+
+// TelemetryConfig 设备电量与信号监测配置：电量低于阈值（未充电）或 RSSI 低于阈值时创建告警，
+// low_battery / poor_signal 按 device_type 覆盖默认阈值（环境变量格式 "type:值,..."）
+type TelemetryConfig struct {
+	LowBatteryPercent     int            `mapstructure:"low_battery_percent"`     // 默认低电量阈值，默认 20（%）
+	PoorSignalRSSI        int            `mapstructure:"poor_signal_rssi"`        // 默认弱信号阈值，默认 -100（dBm）
+	LowBattery            map[string]int `mapstructure:"low_battery"`             // 按设备类型覆盖低电量阈值
+	PoorSignal            map[string]int `mapstructure:"poor_signal"`             // 按设备类型覆盖弱信号阈值
+	RecordIntervalSeconds int            `mapstructure:"record_interval_seconds"` // 同一设备采样记录间隔，默认 60 秒
+	RetentionHours        int            `mapstructure:"retention_hours"`         // 历史保留时长，默认 72 小时
+}
+
+// MsgpackConfig Msgpack TCP 接入连接限制，0 表示使用默认值
+type MsgpackConfig struct {
+	MaxConnections      int `mapstructure:"max_connections"`        // 最大并发连接数，默认 1000
+	MaxConnectionsPerIP int `mapstructure:"max_connections_per_ip"` // 单个对端 IP 最大并发连接数，默认 50
+	IdleTimeoutSeconds  int `mapstructure:"idle_timeout_seconds"`   // 连接空闲超时，默认 300 秒
+	MaxBufferKB         int `mapstructure:"max_buffer_kb"`          // 单连接未解析数据上限，默认 128KB
+	DrainTimeoutSeconds int `mapstructure:"drain_timeout_seconds"`  // 关闭时等待连接处理完已收数据的时长，默认 10 秒
+
+	TLS MsgpackTLSConfig `mapstructure:"tls"`
+}
+
+// MsgpackTLSConfig Msgpack 监听 TLS 配置；client_auth 支持 none / optional（校验提供的客户端证书）/ require，
+// 客户端证书 CN 为设备序列号，校验通过即视为该设备已认证
+type MsgpackTLSConfig struct {
+	Enabled      bool   `mapstructure:"enabled"`
+	CertFile     string `mapstructure:"cert_file"`      // 服务端证书
+	KeyFile      string `mapstructure:"key_file"`       // 服务端私钥
+	ClientCAFile string `mapstructure:"client_ca_file"` // 签发设备证书的 CA，client_auth 非 none 时必填
+	ClientAuth   string `mapstructure:"client_auth"`    // 默认 none
 }
 
 type Config struct {
-	Server    ServerConfig    `mapstructure:"server"`
-	Postgres  PostgresConfig  `mapstructure:"postgres"`
-	Redis     RedisConfig     `mapstructure:"redis"`
-	MQTT      MQTTConfig      `mapstructure:"mqtt"`
-	WebSocket WebSocketConfig `mapstructure:"websocket"`
-	JWTSecret string          `mapstructure:"jwt_secret"`
-	Wechat    WechatConfig    `mapstructure:"wechat"`
+	Server     ServerConfig     `mapstructure:"server"`
+	Postgres   PostgresConfig   `mapstructure:"postgres"`
+	Redis      RedisConfig      `mapstructure:"redis"`
+	MQTT       MQTTConfig       `mapstructure:"mqtt"`
+	WebSocket  WebSocketConfig  `mapstructure:"websocket"`
+	JWTSecret  string           `mapstructure:"jwt_secret"`
+	Wechat     WechatConfig     `mapstructure:"wechat"`
+	Notifier   NotifierConfig   `mapstructure:"notifier"`
+	DeviceAuth DeviceAuthConfig `mapstructure:"device_auth"`
+
+	FieldEncryption FieldEncryptionConfig `mapstructure:"field_encryption"`
+	Presence        PresenceConfig        `mapstructure:"presence"`
+	OTA             OTAConfig             `mapstructure:"ota"`
+	Telemetry       TelemetryConfig       `mapstructure:"telemetry"`
+	Msgpack         MsgpackConfig         `mapstructure:"msgpack"`
 }
 
 func Load() (*Config, error) {
@@ -77,6 +176,7 @@ func Load() (*Config, error) {
 		Server: ServerConfig{
 			Port:            getenvInt("PORT", 8002),
 			MsgListenerPort: getenvInt("MSGLISTENER_PORT", 5858),
+			TrustedProxies:  getenvList("TRUSTED_PROXIES"),
 		},
 		Postgres: PostgresConfig{
 			Host:     getenv("POSTGRES_HOST", "localhost"),
@@ -96,6 +196,13 @@ func Load() (*Config, error) {
 			ClientID: getenv("MQTT_CLIENT_ID", "health_dt_client"),
 			Username: getenv("MQTT_USERNAME", ""),
 			Password: getenv("MQTT_PASSWORD", ""),
+
+			StatusTopic: getenv("MQTT_STATUS_TOPIC", ""),
+
+			CAFile:             getenv("MQTT_CA_FILE", ""),
+			CertFile:           getenv("MQTT_CERT_FILE", ""),
+			KeyFile:            getenv("MQTT_KEY_FILE", ""),
+			InsecureSkipVerify: getenvBool("MQTT_INSECURE_SKIP_VERIFY", false),
 		},
 		WebSocket: WebSocketConfig{
 			Host: getenv("WS_HOST", "0.0.0.0"),
@@ -104,8 +211,58 @@ func Load() (*Config, error) {
 		},
 		JWTSecret: getenv("JWT_SECRET", "your-secret-key"),
 		Wechat: WechatConfig{
-			AppID:  getenv("WECHAT_APPID", ""),
-			Secret: getenv("WECHAT_SECRET", ""),
+			Mode:           getenv("WECHAT_MODE", "http"),
+			AllowFake:      getenvBool("WECHAT_ALLOW_FAKE", false),
+			AppID:          getenv("WECHAT_APPID", ""),
+			Secret:         getenv("WECHAT_SECRET", ""),
+			BaseURL:        getenv("WECHAT_BASE_URL", ""),
+			TimeoutSeconds: getenvInt("WECHAT_TIMEOUT_SECONDS", 5),
+		},
+		Notifier: NotifierConfig{
+			Type:     getenv("NOTIFIER_TYPE", "log"),
+			FilePath: getenv("NOTIFIER_FILE_PATH", ""),
+		},
+		DeviceAuth: DeviceAuthConfig{
+			Required:       getenvBool("DEVICE_AUTH_REQUIRED", false),
+			MaxSkewSeconds: getenvInt("DEVICE_AUTH_MAX_SKEW_SECONDS", 300),
+		},
+		FieldEncryption: FieldEncryptionConfig{
+			ActiveKeyID: getenv("FIELD_ENCRYPTION_ACTIVE_KEY_ID", ""),
+			Keys:        getenv("FIELD_ENCRYPTION_KEYS", ""),
+			IndexKey:    getenv("FIELD_ENCRYPTION_INDEX_KEY", ""),
+		},
+		Presence: PresenceConfig{
+			SweepIntervalSeconds:  getenvInt("PRESENCE_SWEEP_INTERVAL_SECONDS", 30),
+			DefaultTimeoutSeconds: getenvInt("PRESENCE_DEFAULT_TIMEOUT_SECONDS", 300),
+			Timeouts:              getenvIntMap("PRESENCE_TIMEOUTS"),
+		},
+		OTA: OTAConfig{
+			StorageDir:           getenv("OTA_STORAGE_DIR", "./data/firmware"),
+			MaxUploadMB:          getenvInt("OTA_MAX_UPLOAD_MB", 64),
+			DownloadBaseURL:      getenv("OTA_DOWNLOAD_BASE_URL", ""),
+			DeviceTimeoutMinutes: getenvInt("OTA_DEVICE_TIMEOUT_MINUTES", 60),
+		},
+		Telemetry: TelemetryConfig{
+			LowBatteryPercent:     getenvInt("TELEMETRY_LOW_BATTERY_PERCENT", 20),
+			PoorSignalRSSI:        getenvInt("TELEMETRY_POOR_SIGNAL_RSSI", -100),
+			LowBattery:            getenvIntMap("TELEMETRY_LOW_BATTERY"),
+			PoorSignal:            getenvIntMap("TELEMETRY_POOR_SIGNAL"),
+			RecordIntervalSeconds: getenvInt("TELEMETRY_RECORD_INTERVAL_SECONDS", 60),
+			RetentionHours:        getenvInt("TELEMETRY_RETENTION_HOURS", 72),
+		},
+		Msgpack: MsgpackConfig{
+			MaxConnections:      getenvInt("MSGPACK_MAX_CONNECTIONS", 1000),
+			MaxConnectionsPerIP: getenvInt("MSGPACK_MAX_CONNECTIONS_PER_IP", 50),
+			IdleTimeoutSeconds:  getenvInt("MSGPACK_IDLE_TIMEOUT_SECONDS", 300),
+			MaxBufferKB:         getenvInt("MSGPACK_MAX_BUFFER_KB", 128),
+			DrainTimeoutSeconds: getenvInt("MSGPACK_DRAIN_TIMEOUT_SECONDS", 10),
+			TLS: MsgpackTLSConfig{
+				Enabled:      getenvBool("MSGPACK_TLS_ENABLED", false),
+				CertFile:     getenv("MSGPACK_TLS_CERT_FILE", ""),
+				KeyFile:      getenv("MSGPACK_TLS_KEY_FILE", ""),
+				ClientCAFile: getenv("MSGPACK_TLS_CLIENT_CA_FILE", ""),
+				ClientAuth:   getenv("MSGPACK_TLS_CLIENT_AUTH", "none"),
+			},
 		},
 	}
 	return &c, nil
@@ -130,3 +287,41 @@ func getenvInt(key string, def int) int {
 	}
 	return i
 }
+
+func getenvBool(key string, def bool) bool {
+	val := os.Getenv(key)
+	if val == "" {
+		return def
+	}
+	b, err := strconv.ParseBool(val)
+	if err != nil {
+		return def
+	}
+	return b
+}
+
+// getenvList 解析逗号分隔列表，空条目忽略
+func getenvList(key string) []string {
+	var out []string
+	for _, entry := range strings.Split(os.Getenv(key), ",") {
+		if entry = strings.TrimSpace(entry); entry != "" {
+			out = append(out, entry)
+		}
+	}
+	return out
+}
+
+// getenvIntMap 解析 "key:int,key:int" 格式，无效条目忽略
+func getenvIntMap(key string) map[string]int {
+	out := map[string]int{}
+	for _, entry := range strings.Split(os.Getenv(key), ",") {
+		k, v, ok := strings.Cut(strings.TrimSpace(entry), ":")
+		if !ok || k == "" {
+			continue
+		}
+		if i, err := strconv.Atoi(v); err == nil {
+			out[k] = i
+		}
+	}
+	return out
+}
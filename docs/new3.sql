@@ -1,63 +1,244 @@
+-- ================================================
+-- 组织（租户）：管理员、设备、健康档案与告警均归属组织
+-- 存量数据库升级见 migrations/0007_organizations.sql
+-- ================================================
+
+CREATE TABLE organizations (
+    id SERIAL PRIMARY KEY,
+    code VARCHAR(64) NOT NULL UNIQUE,
+    name VARCHAR(128) NOT NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+-- 默认组织（id = 1）
+INSERT INTO organizations (id, code, name) VALUES (1, 'default', '默认组织');
+SELECT setval('organizations_id_seq', (SELECT MAX(id) FROM organizations));
+
 -- ================================================
 -- 用户与登录相关（admin_users表新增role字段）
 -- ================================================
 
 CREATE TABLE admin_users (
     id SERIAL PRIMARY KEY,
+    org_id INT NOT NULL DEFAULT 1 REFERENCES organizations(id), -- platform_admin 可跨组织
     username VARCHAR(64) NOT NULL UNIQUE,
     email VARCHAR(128),
     phone VARCHAR(32),
     password_hash VARCHAR(256) NOT NULL,
-    role VARCHAR(32), -- 新增角色字段
+    role VARCHAR(32), -- platform_admin / superadmin / admin
     is_active BOOLEAN DEFAULT TRUE,
     last_login TIMESTAMP,
     created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
     updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
 );
+CREATE INDEX idx_admin_users_org ON admin_users(org_id);
 
+-- email / phone / wechat_openid 为应用层加密密文（enc:v1:...），*_bidx 为查找用 HMAC 盲索引
 CREATE TABLE app_users (
     id SERIAL PRIMARY KEY,
     username VARCHAR(64) NOT NULL UNIQUE,
-    email VARCHAR(128),
-    phone VARCHAR(32),
+    email TEXT,
+    email_bidx CHAR(64),
+    phone TEXT,
+    phone_bidx CHAR(64),
     password_hash VARCHAR(256) NOT NULL,
     is_active BOOLEAN DEFAULT TRUE,
     last_login TIMESTAMP,
-    wechat_openid VARCHAR(128),
+    wechat_openid TEXT,
+    wechat_openid_bidx CHAR(64),
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+CREATE INDEX idx_app_users_email_bidx ON app_users(email_bidx);
+CREATE INDEX idx_app_users_phone_bidx ON app_users(phone_bidx);
+-- 一个微信 openid 只能绑定一个账号；明文行（未配置盲索引密钥或尚未重加密）由明文唯一索引约束
+CREATE UNIQUE INDEX uq_app_users_wechat_openid_bidx ON app_users(wechat_openid_bidx) WHERE wechat_openid_bidx IS NOT NULL;
+CREATE UNIQUE INDEX uq_app_users_wechat_openid ON app_users(wechat_openid) WHERE wechat_openid IS NOT NULL;
+CREATE INDEX idx_app_users_phone ON app_users(phone);
+
+-- 登录Token表，user_type 区分管理员与App用户（两者ID空间独立）
+CREATE TABLE auth (
+    id SERIAL PRIMARY KEY,
+    user_id INT NOT NULL,
+    user_type VARCHAR(16) NOT NULL, -- admin / app
+    token VARCHAR(128) NOT NULL UNIQUE,
+    expires_at TIMESTAMP NOT NULL,
     created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
     updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
 );
+CREATE INDEX idx_auth_user ON auth(user_type, user_id);
+
+-- 密码重置验证码表，仅保存验证码哈希，单次有效
+CREATE TABLE password_reset_codes (
+    id SERIAL PRIMARY KEY,
+    user_type VARCHAR(16) NOT NULL,
+    user_id INT NOT NULL,
+    code_hash VARCHAR(64) NOT NULL,
+    attempts INT NOT NULL DEFAULT 0,
+    expires_at TIMESTAMP NOT NULL,
+    used_at TIMESTAMP,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+CREATE INDEX idx_password_reset_user ON password_reset_codes(user_type, user_id);
+
+-- 管理员 TOTP 两步验证
+CREATE TABLE admin_totp (
+    admin_id INT PRIMARY KEY REFERENCES admin_users(id) ON DELETE CASCADE,
+    secret VARCHAR(64),          -- 已启用密钥（Base32）
+    pending_secret VARCHAR(64),  -- 绑定中、待验证的密钥
+    enabled BOOLEAN NOT NULL DEFAULT FALSE,
+    last_step BIGINT NOT NULL DEFAULT 0, -- 最近使用的时间步，防重放
+    enabled_at TIMESTAMP,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+-- 两步验证恢复码（仅存哈希，单次有效）
+CREATE TABLE admin_recovery_codes (
+    id SERIAL PRIMARY KEY,
+    admin_id INT NOT NULL REFERENCES admin_users(id) ON DELETE CASCADE,
+    code_hash VARCHAR(64) NOT NULL,
+    used_at TIMESTAMP,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+CREATE INDEX idx_admin_recovery_codes_admin ON admin_recovery_codes(admin_id);
+
+-- 管理员登录挑战（密码通过、等待两步验证）
+CREATE TABLE login_challenges (
+    id SERIAL PRIMARY KEY,
+    token_hash VARCHAR(64) NOT NULL UNIQUE,
+    admin_id INT NOT NULL REFERENCES admin_users(id) ON DELETE CASCADE,
+    attempts INT NOT NULL DEFAULT 0,
+    expires_at TIMESTAMP NOT NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+-- 第三方系统 API Key（组织级，仅存储 SHA256 哈希，前缀用于展示与查找）
+CREATE TABLE api_keys (
+    id BIGSERIAL PRIMARY KEY,
+    org_id INT NOT NULL REFERENCES organizations(id),
+    name VARCHAR(64) NOT NULL,
+    prefix VARCHAR(16) NOT NULL UNIQUE,           -- hdk_<8位标识>
+    key_hash CHAR(64) NOT NULL,
+    scopes TEXT[] NOT NULL,                       -- read:alerts / read:health_profiles / write:health_data
+    created_by INT REFERENCES admin_users(id) ON DELETE SET NULL,
+    expires_at TIMESTAMPTZ NOT NULL,
+    last_used_at TIMESTAMPTZ,
+    rotated_at TIMESTAMPTZ,
+    revoked_at TIMESTAMPTZ,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+CREATE INDEX idx_api_keys_org ON api_keys(org_id);
+
+-- 系统设置（键值）
+CREATE TABLE system_settings (
+    key VARCHAR(64) PRIMARY KEY,
+    value TEXT NOT NULL,
+    updated_by INT,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
 
 -- ================================================
 -- 核心业务表
 -- ================================================
 
--- 健康档案表（HealthProfile） 保留原结构
+-- 位置层级（楼栋 building > 楼层 floor > 房间 room > 床位 bed）
+CREATE TABLE locations (
+    id SERIAL PRIMARY KEY,
+    org_id INT NOT NULL REFERENCES organizations(id),
+    parent_id INT REFERENCES locations(id),       -- 顶级楼栋为空；有下级时不可删除
+    kind VARCHAR(16) NOT NULL,                    -- building / floor / room / bed
+    name VARCHAR(64) NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+CREATE UNIQUE INDEX uq_locations_name ON locations(org_id, COALESCE(parent_id, 0), name); -- 同一上级下名称唯一
+CREATE INDEX idx_locations_parent ON locations(parent_id);
+
+-- 健康档案表（HealthProfile），name / birth_date / metadata 为应用层加密密文
 CREATE TABLE health_profiles (
     id SERIAL PRIMARY KEY,
+    org_id INT REFERENCES organizations(id), -- 为空表示 App 用户创建的个人档案，仅档案成员可访问
     user_id INT REFERENCES app_users(id) ON DELETE SET NULL,
-    name VARCHAR(128) NOT NULL,
+    name TEXT NOT NULL,
     gender VARCHAR(16),
-    birth_date DATE,
-    metadata JSONB,  -- 保留灵活字段
+    birth_date TEXT,  -- 加密的 YYYY-MM-DD
+    metadata TEXT,    -- 加密的 JSON 文本
+    bed_id INT REFERENCES locations(id) ON DELETE SET NULL, -- 分配的床位
     created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
     updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
 );
 CREATE INDEX idx_health_profiles_user ON health_profiles(user_id);
+CREATE INDEX idx_health_profiles_org ON health_profiles(org_id);
+CREATE UNIQUE INDEX uq_health_profiles_bed ON health_profiles(bed_id) WHERE bed_id IS NOT NULL; -- 每张床位至多一个档案
+
+-- 健康档案共享邀请（邀请码仅存哈希，单次有效）
+CREATE TABLE profile_invitations (
+    id BIGSERIAL PRIMARY KEY,
+    health_profile_id INT NOT NULL REFERENCES health_profiles(id) ON DELETE CASCADE,
+    code_hash CHAR(64) NOT NULL UNIQUE,
+    role VARCHAR(16) NOT NULL,                   -- caregiver / viewer
+    status VARCHAR(16) NOT NULL DEFAULT 'pending', -- pending / redeemed / revoked
+    created_by INT NOT NULL REFERENCES app_users(id) ON DELETE CASCADE,
+    redeemed_by INT REFERENCES app_users(id) ON DELETE SET NULL,
+    redeemed_at TIMESTAMP,
+    expires_at TIMESTAMP NOT NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+CREATE INDEX idx_profile_invitations_profile ON profile_invitations(health_profile_id, status);
+
+-- 健康档案成员（owner / caregiver / viewer），取代 health_profiles.user_id 的单一归属
+CREATE TABLE profile_members (
+    id BIGSERIAL PRIMARY KEY,
+    health_profile_id INT NOT NULL REFERENCES health_profiles(id) ON DELETE CASCADE,
+    user_id INT NOT NULL REFERENCES app_users(id) ON DELETE CASCADE,
+    role VARCHAR(16) NOT NULL,
+    status VARCHAR(16) NOT NULL,                 -- pending / active / revoked
+    invitation_id BIGINT REFERENCES profile_invitations(id) ON DELETE SET NULL,
+    approved_by INT REFERENCES app_users(id) ON DELETE SET NULL,
+    approved_at TIMESTAMP,
+    revoked_at TIMESTAMP,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+-- 同一用户在同一档案下最多一条有效成员关系
+CREATE UNIQUE INDEX uq_profile_members_live ON profile_members(health_profile_id, user_id) WHERE status <> 'revoked';
+CREATE INDEX idx_profile_members_user ON profile_members(user_id, status);
+
+-- 存量数据：health_profiles.user_id 迁移为拥有者成员
+INSERT INTO profile_members (health_profile_id, user_id, role, status, approved_at)
+SELECT id, user_id, 'owner', 'active', CURRENT_TIMESTAMP FROM health_profiles WHERE user_id IS NOT NULL
+ON CONFLICT DO NOTHING;
 
 -- ----------------------------
 -- 设备表（devices） 极简化
 -- ----------------------------
 CREATE TABLE devices (
     id SERIAL PRIMARY KEY,
+    org_id INT NOT NULL DEFAULT 1 REFERENCES organizations(id),
     serial_number VARCHAR(64) UNIQUE NOT NULL,  -- 新增唯一标识
     name VARCHAR(128),                          -- 保留友好名
     device_type VARCHAR(64),                    -- 类型区分
     is_active BOOLEAN DEFAULT TRUE,             -- 激活状态
+    secret_key VARCHAR(128),                    -- 设备签名密钥（HMAC-SHA256）
+    location_id INT REFERENCES locations(id) ON DELETE SET NULL, -- 放置位置
     created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
     updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
 );
 CREATE INDEX idx_devices_type ON devices(device_type);
+CREATE INDEX idx_devices_org ON devices(org_id);
+CREATE INDEX idx_devices_location ON devices(location_id);
+
+-- ----------------------------
+-- 待注册设备表（未注册序列号上行时记录，批准后删除）
+-- ----------------------------
+CREATE TABLE pending_devices (
+    serial_number VARCHAR(64) PRIMARY KEY,
+    source VARCHAR(16) NOT NULL,                  -- mqtt / msgpack
+    detail VARCHAR(128),                          -- MQTT 主题类型或 msgpack 对端地址
+    first_seen_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    last_seen_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    seen_count INT NOT NULL DEFAULT 1
+);
+CREATE INDEX idx_pending_devices_last_seen ON pending_devices(last_seen_at DESC);
 
 -- ----------------------------
 -- 设备与健康档案绑定表（新增）
@@ -67,10 +248,128 @@ CREATE TABLE device_assignments (
     device_id INT REFERENCES devices(id) ON DELETE CASCADE,
     health_profile_id INT REFERENCES health_profiles(id) ON DELETE CASCADE,
     assigned_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
-    unassigned_at TIMESTAMP
+    unassigned_at TIMESTAMP,
+    end_reason VARCHAR(16)                      -- unassigned / reassigned
 );
 CREATE INDEX idx_device_assignments_profile ON device_assignments(health_profile_id);
 CREATE INDEX idx_device_assignments_device ON device_assignments(device_id);
+CREATE UNIQUE INDEX uq_device_assignments_active ON device_assignments(device_id) WHERE unassigned_at IS NULL; -- 每台设备仅一条有效绑定
+
+-- ----------------------------
+-- 设备下行指令表（device/{sn}/cmd/{name} 下发，device/{sn}/ack 按 request_id 回执）
+-- ----------------------------
+CREATE TABLE device_commands (
+    id BIGSERIAL PRIMARY KEY,
+    org_id INT NOT NULL REFERENCES organizations(id),
+    device_id INT NOT NULL REFERENCES devices(id) ON DELETE CASCADE,
+    request_id VARCHAR(32) NOT NULL UNIQUE,
+    name VARCHAR(64) NOT NULL,
+    params JSONB,
+    status VARCHAR(16) NOT NULL DEFAULT 'pending', -- pending / sent / acked / failed / timed_out
+    result JSONB,
+    error TEXT,
+    created_by INT REFERENCES admin_users(id) ON DELETE SET NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    sent_at TIMESTAMPTZ,
+    acked_at TIMESTAMPTZ,
+    expires_at TIMESTAMPTZ NOT NULL
+);
+CREATE INDEX idx_device_commands_device ON device_commands(device_id, created_at DESC);
+CREATE INDEX idx_device_commands_open ON device_commands(expires_at) WHERE status IN ('pending', 'sent');
+
+-- ----------------------------
+-- 设备影子表（期望配置与设备上报状态）
+-- ----------------------------
+CREATE TABLE device_shadows (
+    device_id INT PRIMARY KEY REFERENCES devices(id) ON DELETE CASCADE,
+    org_id INT NOT NULL REFERENCES organizations(id),
+    desired JSONB NOT NULL DEFAULT '{}',
+    reported JSONB NOT NULL DEFAULT '{}',
+    version BIGINT NOT NULL DEFAULT 0,            -- 期望状态版本，每次修改加一
+    reported_version BIGINT NOT NULL DEFAULT 0,   -- 设备上报序号，只接受更大的值
+    desired_updated_at TIMESTAMPTZ,
+    reported_updated_at TIMESTAMPTZ
+);
+
+-- ----------------------------
+-- 设备电量与信号采样（按保留时长清理）
+-- ----------------------------
+CREATE TABLE device_telemetry (
+    id BIGSERIAL PRIMARY KEY,
+    device_id INT NOT NULL REFERENCES devices(id) ON DELETE CASCADE,
+    battery SMALLINT,                             -- 电量百分比 0-100，未上报为空
+    charging BOOLEAN,                             -- 是否充电中，未上报为空
+    rssi SMALLINT,                                -- 信号强度（dBm）
+    snr REAL,                                     -- 信噪比（dB）
+    recorded_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+CREATE INDEX idx_device_telemetry_device ON device_telemetry(device_id, recorded_at DESC);
+CREATE INDEX idx_device_telemetry_recorded ON device_telemetry(recorded_at);
+
+-- ----------------------------
+-- 设备类型目录（平台级，新增传感器型号无需改代码）
+-- ----------------------------
+CREATE TABLE device_types (
+    code VARCHAR(64) PRIMARY KEY,                 -- 对应 devices.device_type
+    name VARCHAR(64) NOT NULL,
+    description TEXT NOT NULL DEFAULT '',
+    reporting_interval_seconds INT NOT NULL DEFAULT 0,  -- 预期上报间隔，0 表示不固定
+    metrics JSONB NOT NULL DEFAULT '[]',          -- [{"key", "name", "unit", "min", "max", "chart"}]
+    payload_schema JSONB,                         -- 上报数据 JSON Schema，为空不校验
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+-- ----------------------------
+-- 固件升级（OTA）
+-- ----------------------------
+-- 固件文件（存于本地磁盘，记录 SHA256）
+CREATE TABLE firmware_artifacts (
+    id SERIAL PRIMARY KEY,
+    org_id INT NOT NULL REFERENCES organizations(id),
+    device_type VARCHAR(64) NOT NULL,
+    version VARCHAR(64) NOT NULL,
+    file_name VARCHAR(255) NOT NULL,
+    file_path VARCHAR(512) NOT NULL,
+    size BIGINT NOT NULL,
+    sha256 CHAR(64) NOT NULL,
+    notes TEXT,
+    created_by BIGINT,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    UNIQUE (org_id, device_type, version)
+);
+
+-- 升级活动
+CREATE TABLE ota_campaigns (
+    id SERIAL PRIMARY KEY,
+    org_id INT NOT NULL REFERENCES organizations(id),
+    name VARCHAR(128) NOT NULL,
+    artifact_id INT NOT NULL REFERENCES firmware_artifacts(id),
+    from_versions TEXT[] NOT NULL DEFAULT '{}',        -- 为空表示除目标版本外的全部版本
+    rollout_percent INT NOT NULL DEFAULT 0,             -- 放量比例（0-100），只增不减
+    failure_threshold_percent INT NOT NULL DEFAULT 20,  -- 失败率达到该比例时自动暂停
+    min_samples INT NOT NULL DEFAULT 5,                 -- 计算失败率所需的最少完成设备数
+    status VARCHAR(16) NOT NULL DEFAULT 'draft',        -- draft / running / paused / completed / cancelled
+    pause_reason TEXT,
+    created_by BIGINT,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+CREATE INDEX idx_ota_campaigns_org ON ota_campaigns(org_id, created_at DESC);
+
+-- 升级活动中的设备
+CREATE TABLE ota_campaign_devices (
+    campaign_id INT NOT NULL REFERENCES ota_campaigns(id) ON DELETE CASCADE,
+    device_id INT NOT NULL REFERENCES devices(id) ON DELETE CASCADE,
+    from_version VARCHAR(64),
+    status VARCHAR(16) NOT NULL DEFAULT 'pending',      -- pending / sent / downloading / installing / succeeded / failed
+    progress INT NOT NULL DEFAULT 0,
+    error TEXT,
+    sent_at TIMESTAMPTZ,
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (campaign_id, device_id)
+);
+CREATE INDEX idx_ota_campaign_devices_device ON ota_campaign_devices(device_id);
 
 -- ----------------------------
 -- 健康数据记录表（health_data_records） 保留
@@ -112,6 +411,7 @@ CREATE INDEX idx_events_device_time ON events(device_id, timestamp);
 -- ----------------------------
 CREATE TABLE alerts (
     id SERIAL PRIMARY KEY,
+    org_id INT NOT NULL DEFAULT 1 REFERENCES organizations(id),
     health_profile_id INT REFERENCES health_profiles(id) ON DELETE SET NULL,
     device_id INT REFERENCES devices(id) ON DELETE SET NULL,
     source_event_id INT REFERENCES events(id) ON DELETE SET NULL,
@@ -126,4 +426,51 @@ CREATE TABLE alerts (
     resolved_at TIMESTAMP
 );
 CREATE INDEX idx_alerts_device_status ON alerts(device_id, status);
-CREATE INDEX idx_alerts_profile_rule_status ON alerts(health_profile_id, rule_name, status);
\ No newline at end of file
+CREATE INDEX idx_alerts_profile_rule_status ON alerts(health_profile_id, rule_name, status);
+CREATE INDEX idx_alerts_org ON alerts(org_id);
+
+-- 告警由规则引擎写入，组织继承自设备（无设备时取健康档案）
+CREATE OR REPLACE FUNCTION alerts_inherit_org() RETURNS TRIGGER AS $$
+BEGIN
+    SELECT org_id INTO NEW.org_id FROM devices WHERE id = NEW.device_id;
+    IF NEW.org_id IS NULL THEN
+        SELECT org_id INTO NEW.org_id FROM health_profiles WHERE id = NEW.health_profile_id;
+    END IF;
+    NEW.org_id := COALESCE(NEW.org_id, 1);
+    RETURN NEW;
+END;
+$$ LANGUAGE plpgsql;
+CREATE TRIGGER trg_alerts_inherit_org
+    BEFORE INSERT ON alerts
+    FOR EACH ROW EXECUTE FUNCTION alerts_inherit_org();
+-- ----------------------------
+-- 审计日志表（audit_logs） 仅追加，hash 链防篡改
+-- ----------------------------
+CREATE TABLE audit_logs (
+    id BIGSERIAL PRIMARY KEY,
+    org_id INT REFERENCES organizations(id),     -- 操作所属组织，平台级及 App 用户操作为空
+    actor_type VARCHAR(16) NOT NULL,             -- admin / app / api_key / anonymous
+    actor_id BIGINT,
+    action VARCHAR(32) NOT NULL,                 -- view / list / create / update / delete ...
+    resource_type VARCHAR(64) NOT NULL,
+    resource_id VARCHAR(64),
+    changes JSONB,                               -- 变更字段：{"字段": {"before": .., "after": ..}}
+    ip VARCHAR(64),
+    created_at TIMESTAMPTZ NOT NULL,
+    prev_hash CHAR(64) NOT NULL,
+    hash CHAR(64) NOT NULL UNIQUE
+);
+CREATE INDEX idx_audit_logs_resource ON audit_logs(resource_type, resource_id, created_at);
+CREATE INDEX idx_audit_logs_actor ON audit_logs(actor_type, actor_id, created_at);
+CREATE INDEX idx_audit_logs_time ON audit_logs(created_at);
+CREATE INDEX idx_audit_logs_org ON audit_logs(org_id, created_at);
+
+-- 禁止修改与删除审计日志
+CREATE OR REPLACE FUNCTION audit_logs_append_only() RETURNS TRIGGER AS $$
+BEGIN
+    RAISE EXCEPTION 'audit_logs 为只追加表，禁止 %', TG_OP;
+END;
+$$ LANGUAGE plpgsql;
+CREATE TRIGGER trg_audit_logs_append_only
+    BEFORE UPDATE OR DELETE ON audit_logs
+    FOR EACH ROW EXECUTE FUNCTION audit_logs_append_only();
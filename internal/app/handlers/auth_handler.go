@@ -6,6 +6,7 @@ import (
 	"net/http"
 	"time"
 
+	"github.com/fire-disposal/health_DT_go/internal/models"
 	"github.com/fire-disposal/health_DT_go/internal/service"
 )
 
@@ -29,7 +30,7 @@ func (h *AuthHandler) Login(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "invalid request", http.StatusBadRequest)
 		return
 	}
-	token, err := h.AuthService.GenerateToken(req.UserID, 24*time.Hour)
+	token, err := h.AuthService.GenerateToken(req.UserID, models.UserTypeApp, 24*time.Hour)
 	if err != nil {
 		http.Error(w, "failed to generate token", http.StatusInternalServerError)
 		return
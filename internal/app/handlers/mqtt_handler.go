@@ -2,15 +2,31 @@
 package handlers
 
 import (
+	"context"
 	"encoding/json"
 	"strings"
+	"time"
 
 	mqtt "github.com/eclipse/paho.mqtt.golang"
 	"github.com/fire-disposal/health_DT_go/internal/app"
+	"github.com/fire-disposal/health_DT_go/internal/models"
+	"github.com/fire-disposal/health_DT_go/internal/service"
+	"go.uber.org/zap"
 )
 
-// HandleMQTTMessage 解析 MQTT 消息并分发到 Pipeline
-func HandleMQTTMessage(pipeline *app.Pipeline) mqtt.MessageHandler {
+// mqttDataMessage MQTT 上行数据格式，data 保留原始字节用于签名校验
+type mqttDataMessage struct {
+	TS   int64           `json:"ts"`
+	Data json.RawMessage `json:"data"`
+	Sig  string          `json:"sig"`
+}
+
+// HandleMQTTMessage 解析 MQTT 消息并分发到 Pipeline；deviceAuth 非 nil 时校验设备签名，
+// presence 非 nil 时记录设备最近上行时间，provisioning 非 nil 时将未注册序列号记入待注册列表，
+// telemetry 非 nil 时提取电量与信号，deviceTypes 非 nil 时按设备类型目录校验 data，不符合的消息丢弃
+func HandleMQTTMessage(pipeline *app.Pipeline, deviceAuth *service.DeviceAuthService, presence *service.PresenceService,
+	provisioning *service.ProvisioningService, telemetry *service.DeviceTelemetryService,
+	deviceTypes *service.DeviceTypeService) mqtt.MessageHandler {
 	return func(client mqtt.Client, msg mqtt.Message) {
 		topic := msg.Topic()
 		payload := msg.Payload()
@@ -24,20 +40,262 @@ func HandleMQTTMessage(pipeline *app.Pipeline) mqtt.MessageHandler {
 		if messageType != "data" {
 			return
 		}
-		var raw map[string]interface{}
+		if provisioning != nil {
+			provisioning.Observe("mqtt", deviceID, "data/"+dataType)
+		}
+		var raw mqttDataMessage
 		if err := json.Unmarshal(payload, &raw); err != nil {
 			return
 		}
-		dataField, ok := raw["data"].(map[string]interface{})
-		if !ok {
+		if deviceAuth != nil {
+			if err := deviceAuth.VerifyMessage(deviceID, dataType, raw.TS, raw.Data, raw.Sig); err != nil {
+				return
+			}
+		}
+		if presence != nil {
+			presence.Touch(deviceID)
+		}
+		var dataField map[string]interface{}
+		if err := json.Unmarshal(raw.Data, &dataField); err != nil || dataField == nil {
 			return
 		}
+		if deviceTypes != nil {
+			if err := deviceTypes.Validate(deviceID, dataField); err != nil {
+				zap.L().Warn("上报数据校验未通过", zap.String("sn", deviceID), zap.String("type", dataType), zap.Error(err))
+				return
+			}
+		}
+		if telemetry != nil {
+			telemetry.Observe(deviceID, dataField)
+		}
 		event := app.HealthEvent{
 			DeviceID:  deviceID,
 			EventType: dataType,
 			Payload:   dataField,
 			Source:    "mqtt",
 		}
-		go pipeline.ReceiveEvent(event)
+		pipeline.ReceiveEventAsync(event)
+	}
+}
+
+// HandleMQTTHeartbeat 处理 device/{sn}/heartbeat 心跳：格式同数据消息（data 可省略），
+// 签名明文的类型字段为 "heartbeat"；未开启强制认证时允许空消息体。provisioning 非 nil 时将未注册序列号记入待注册列表，
+// telemetry 非 nil 时提取 data 中的电量与信号（如 {"battery": 80, "charging": false, "rssi": -70}）
+func HandleMQTTHeartbeat(deviceAuth *service.DeviceAuthService, presence *service.PresenceService,
+	provisioning *service.ProvisioningService, telemetry *service.DeviceTelemetryService) mqtt.MessageHandler {
+	return func(client mqtt.Client, msg mqtt.Message) {
+		parts := strings.Split(msg.Topic(), "/")
+		if len(parts) != 3 || parts[0] != "device" || parts[2] != "heartbeat" || parts[1] == "" {
+			return
+		}
+		deviceID := parts[1]
+		if provisioning != nil {
+			provisioning.Observe("mqtt", deviceID, "heartbeat")
+		}
+		var raw mqttDataMessage
+		if payload := msg.Payload(); len(payload) > 0 {
+			if err := json.Unmarshal(payload, &raw); err != nil {
+				return
+			}
+		}
+		if deviceAuth != nil {
+			if err := deviceAuth.VerifyMessage(deviceID, "heartbeat", raw.TS, raw.Data, raw.Sig); err != nil {
+				return
+			}
+		}
+		if presence != nil {
+			presence.Touch(deviceID)
+		}
+		if telemetry != nil && len(raw.Data) > 0 {
+			var dataField map[string]interface{}
+			if err := json.Unmarshal(raw.Data, &dataField); err == nil {
+				telemetry.Observe(deviceID, dataField)
+			}
+		}
+	}
+}
+
+// HandleMQTTDeviceStatus 处理 device/{sn}/status 连接状态：设备连接时发布 online，并将 offline 设为遗嘱，
+// 异常断线时由 Broker 代发。消息体为签名格式 {"ts": .., "data": {"status": "online"}, "sig": ..}（签名类型字段为 "status"），
+// 未开启强制认证时也接受未签名的 online / offline 或 {"status": "..."}。遗嘱内容在连接时即已固定，无法携带有效的时间戳签名：
+// 强制认证时未签名的 offline 被拒绝，设备离线改由静默超时判定。保留消息（服务重启时 Broker 补发的历史状态）忽略。
+// shadows 非 nil 时设备上线即下发影子差异；下发需等待发布确认，经 pipeline.Go 在回调外执行，不阻塞 MQTT 消息分发
+func HandleMQTTDeviceStatus(pipeline *app.Pipeline, deviceAuth *service.DeviceAuthService, presence *service.PresenceService,
+	shadows *service.DeviceShadowService) mqtt.MessageHandler {
+	return func(client mqtt.Client, msg mqtt.Message) {
+		parts := strings.Split(msg.Topic(), "/")
+		if len(parts) != 3 || parts[0] != "device" || parts[2] != "status" || parts[1] == "" {
+			return
+		}
+		if msg.Retained() {
+			return
+		}
+		status := strings.TrimSpace(string(msg.Payload()))
+		var raw mqttDataMessage
+		if strings.HasPrefix(status, "{") {
+			if err := json.Unmarshal(msg.Payload(), &raw); err != nil {
+				return
+			}
+			body := raw.Data
+			if len(body) == 0 {
+				body = msg.Payload() // 未签名的 {"status": "..."}
+			}
+			var st struct {
+				Status string `json:"status"`
+			}
+			if err := json.Unmarshal(body, &st); err != nil {
+				return
+			}
+			status = st.Status
+		}
+		if deviceAuth != nil {
+			if err := deviceAuth.VerifyMessage(parts[1], "status", raw.TS, raw.Data, raw.Sig); err != nil {
+				return
+			}
+		}
+		switch status {
+		case models.DeviceOnline:
+			if presence != nil {
+				presence.Touch(parts[1])
+			}
+			if shadows != nil {
+				sn := parts[1]
+				pipeline.Go(func() {
+					ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+					defer cancel()
+					if err := shadows.SyncDevice(ctx, sn); err != nil {
+						zap.L().Warn("设备影子同步失败", zap.String("sn", sn), zap.Error(err))
+					}
+				})
+			}
+		case models.DeviceOffline:
+			if presence != nil {
+				presence.Disconnect(parts[1])
+			}
+		}
+	}
+}
+
+// HandleMQTTAck 处理 device/{sn}/ack 指令回执：格式同数据消息，签名类型字段为 "ack"，
+// data 为 {"request_id": "...", "status": "ok" | "error", "result": {...}, "error": "..."}
+func HandleMQTTAck(deviceAuth *service.DeviceAuthService, commands *service.DeviceCommandService, presence *service.PresenceService) mqtt.MessageHandler {
+	return func(client mqtt.Client, msg mqtt.Message) {
+		parts := strings.Split(msg.Topic(), "/")
+		if len(parts) != 3 || parts[0] != "device" || parts[2] != "ack" || parts[1] == "" {
+			return
+		}
+		deviceID := parts[1]
+		var raw mqttDataMessage
+		if err := json.Unmarshal(msg.Payload(), &raw); err != nil {
+			return
+		}
+		if deviceAuth != nil {
+			if err := deviceAuth.VerifyMessage(deviceID, "ack", raw.TS, raw.Data, raw.Sig); err != nil {
+				return
+			}
+		}
+		if presence != nil {
+			presence.Touch(deviceID)
+		}
+		var ack service.DeviceAck
+		if err := json.Unmarshal(raw.Data, &ack); err != nil || commands == nil {
+			return
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		if err := commands.HandleAck(ctx, deviceID, ack); err != nil {
+			zap.L().Error("设备指令回执处理失败", zap.String("sn", deviceID), zap.Error(err))
+		}
+	}
+}
+
+// HandleMQTTShadow 处理设备影子上行，格式同数据消息：
+//   - device/{sn}/shadow/reported：签名类型字段为 "shadow_reported"，data 为 {"version": 序号, "state": {...}}
+//   - device/{sn}/shadow/get：签名类型字段为 "shadow_get"，data 可省略；服务端回发当前差异（无差异不回发）
+//
+// telemetry 非 nil 时从上报状态中提取电量与信号。影子处理可能等待下行发布确认，经 pipeline.Go 在回调外执行
+func HandleMQTTShadow(pipeline *app.Pipeline, deviceAuth *service.DeviceAuthService, shadows *service.DeviceShadowService, presence *service.PresenceService,
+	telemetry *service.DeviceTelemetryService) mqtt.MessageHandler {
+	return func(client mqtt.Client, msg mqtt.Message) {
+		parts := strings.Split(msg.Topic(), "/")
+		if len(parts) != 4 || parts[0] != "device" || parts[2] != "shadow" || parts[1] == "" {
+			return
+		}
+		deviceID, action := parts[1], parts[3]
+		if action != "reported" && action != "get" {
+			return
+		}
+		var raw mqttDataMessage
+		if payload := msg.Payload(); len(payload) > 0 {
+			if err := json.Unmarshal(payload, &raw); err != nil {
+				return
+			}
+		}
+		if deviceAuth != nil {
+			if err := deviceAuth.VerifyMessage(deviceID, "shadow_"+action, raw.TS, raw.Data, raw.Sig); err != nil {
+				return
+			}
+		}
+		if presence != nil {
+			presence.Touch(deviceID)
+		}
+		if shadows == nil {
+			return
+		}
+		pipeline.Go(func() {
+			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+			var err error
+			if action == "get" {
+				err = shadows.SyncDevice(ctx, deviceID)
+			} else {
+				var report service.DeviceShadowReport
+				if err = json.Unmarshal(raw.Data, &report); err == nil {
+					err = shadows.HandleReport(ctx, deviceID, report)
+				}
+				if err == nil && telemetry != nil {
+					var state map[string]interface{}
+					if json.Unmarshal(report.State, &state) == nil {
+						telemetry.Observe(deviceID, state)
+					}
+				}
+			}
+			if err != nil {
+				zap.L().Warn("设备影子处理失败", zap.String("sn", deviceID), zap.String("action", action), zap.Error(err))
+			}
+		})
+	}
+}
+
+// HandleMQTTOTAStatus 处理 device/{sn}/ota/status 固件升级进度：格式同数据消息，签名类型字段为 "ota_status"，
+// data 为 {"campaign_id": 1, "status": "downloading" | "installing" | "succeeded" | "failed", "progress": 0-100, "error": "..."}
+func HandleMQTTOTAStatus(deviceAuth *service.DeviceAuthService, ota *service.OTAService, presence *service.PresenceService) mqtt.MessageHandler {
+	return func(client mqtt.Client, msg mqtt.Message) {
+		parts := strings.Split(msg.Topic(), "/")
+		if len(parts) != 4 || parts[0] != "device" || parts[2] != "ota" || parts[3] != "status" || parts[1] == "" {
+			return
+		}
+		deviceID := parts[1]
+		var raw mqttDataMessage
+		if err := json.Unmarshal(msg.Payload(), &raw); err != nil {
+			return
+		}
+		if deviceAuth != nil {
+			if err := deviceAuth.VerifyMessage(deviceID, "ota_status", raw.TS, raw.Data, raw.Sig); err != nil {
+				return
+			}
+		}
+		if presence != nil {
+			presence.Touch(deviceID)
+		}
+		var report service.OTAStatusReport
+		if err := json.Unmarshal(raw.Data, &report); err != nil || ota == nil {
+			return
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		if err := ota.HandleStatus(ctx, deviceID, report); err != nil {
+			zap.L().Warn("固件升级状态处理失败", zap.String("sn", deviceID), zap.Error(err))
+		}
 	}
 }
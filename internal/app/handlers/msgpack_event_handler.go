@@ -2,15 +2,63 @@
 package handlers
 
 import (
+	"context"
+	"encoding/json"
+	"errors"
+	"time"
+
 	"github.com/fire-disposal/health_DT_go/internal/app"
+	"github.com/fire-disposal/health_DT_go/internal/service"
+	"go.uber.org/zap"
 )
 
-func HandleMsgpackPayload(pipeline *app.Pipeline) func(payload map[string]interface{}) {
-	return func(payload map[string]interface{}) {
+var errMissingSN = errors.New("数据帧缺少 sn")
+
+// msgpackEnvelopeKeys 数据帧的信封字段，不属于设备上报数据
+var msgpackEnvelopeKeys = map[string]bool{"sn": true, "type": true, "ts": true, "seq": true, "sig": true, "nonce": true}
+
+// msgpackData 取数据帧中的上报数据：含 data 子 map 时为该 map，否则为去掉信封字段后的帧，
+// 与 MQTT 消息的 data 字段对应，用于设备类型校验与电量信号提取
+func msgpackData(payload map[string]interface{}) map[string]interface{} {
+	if data, ok := payload["data"].(map[string]interface{}); ok {
+		return data
+	}
+	data := make(map[string]interface{}, len(payload))
+	for k, v := range payload {
+		if !msgpackEnvelopeKeys[k] {
+			data[k] = v
+		}
+	}
+	return data
+}
+
+// HandleMsgpackPayload 将 msgpack 数据帧分发到 Pipeline；presence 非 nil 时记录设备最近上行时间，
+// telemetry 非 nil 时提取电量与信号，deviceTypes 非 nil 时按设备类型目录校验上报数据（见 msgpackData），不符合的帧丢弃。
+// type 为 "ack" 的帧为下行指令回执（字段同 MQTT 回执），交给 commands 处理。
+// 数据帧在返回前同步交给 Pipeline 处理，v2 帧的 ACK 在返回后发送；返回错误时 v2 帧回复 NAK
+func HandleMsgpackPayload(pipeline *app.Pipeline, presence *service.PresenceService,
+	telemetry *service.DeviceTelemetryService, deviceTypes *service.DeviceTypeService,
+	commands *service.DeviceCommandService) func(payload map[string]interface{}) error {
+	return func(payload map[string]interface{}) error {
 		deviceSN, ok := payload["sn"].(string)
 		if !ok || deviceSN == "" {
-			// 可加日志
-			return
+			return errMissingSN
+		}
+		if presence != nil {
+			presence.Touch(deviceSN)
+		}
+		if frameType, _ := payload["type"].(string); frameType == "ack" {
+			return handleMsgpackAck(commands, deviceSN, payload)
+		}
+		data := msgpackData(payload)
+		if deviceTypes != nil {
+			if err := deviceTypes.Validate(deviceSN, data); err != nil {
+				zap.L().Warn("上报数据校验未通过", zap.String("sn", deviceSN), zap.Error(err))
+				return err
+			}
+		}
+		if telemetry != nil {
+			telemetry.Observe(deviceSN, data)
 		}
 		event := app.HealthEvent{
 			DeviceID:  deviceSN,
@@ -18,6 +66,32 @@ func HandleMsgpackPayload(pipeline *app.Pipeline) func(payload map[string]interf
 			Payload:   payload,
 			Source:    "msgpack",
 		}
-		go pipeline.ReceiveEvent(event)
+		pipeline.ReceiveEvent(event)
+		return nil
+	}
+}
+
+// handleMsgpackAck 处理经长连接上报的指令回执 {"type":"ack","sn":..,"request_id":..,"status":"ok","result":{..},"error":..}
+func handleMsgpackAck(commands *service.DeviceCommandService, deviceSN string, payload map[string]interface{}) error {
+	if commands == nil {
+		return nil
+	}
+	ack := service.DeviceAck{}
+	ack.RequestID, _ = payload["request_id"].(string)
+	ack.Status, _ = payload["status"].(string)
+	ack.Error, _ = payload["error"].(string)
+	if result, ok := payload["result"]; ok && result != nil {
+		raw, err := json.Marshal(result)
+		if err != nil {
+			return err
+		}
+		ack.Result = raw
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := commands.HandleAck(ctx, deviceSN, ack); err != nil {
+		zap.L().Error("设备指令回执处理失败", zap.String("sn", deviceSN), zap.Error(err))
+		return err
 	}
+	return nil
 }
@@ -2,15 +2,21 @@
 package app
 
 import (
+	"context"
+	"sync"
+
 	"github.com/fire-disposal/health_DT_go/internal/app/eventbus"
+	"github.com/fire-disposal/health_DT_go/internal/models"
 )
 
 // HealthEvent 统一健康数据事件结构体
 type HealthEvent struct {
-	DeviceID  string      // 设备ID或模拟标识
-	EventType string      // 事件类型：heart_rate, blood_pressure, spo2, temperature
-	Payload   interface{} // 具体数据载体
-	Source    string      // 来源标识（设备/模拟）
+	DeviceID   string      // 设备ID或模拟标识
+	EventType  string      // 事件类型：heart_rate, blood_pressure, spo2, temperature
+	Payload    interface{} // 具体数据载体
+	Source     string      // 来源标识（设备/模拟）
+	LocationID *int        // 设备所在位置ID，设备无位置时为 nil
+	Location   string      // 设备所在位置完整路径，如 "1号楼 / 3层 / 301 / 1床"
 }
 
 // HealthDataProcessor 健康数据处理器接口，便于扩展
@@ -22,6 +28,8 @@ type HealthDataProcessor interface {
 type Pipeline struct {
 	processors map[string][]HealthDataProcessor // 按事件类型分组
 	eventBus   *eventbus.EventBus
+	locate     func(sn string) *models.Location
+	inflight   sync.WaitGroup // ReceiveEventAsync 启动的处理
 }
 
 // NewPipeline 创建主流程实例
@@ -37,8 +45,19 @@ func (p *Pipeline) RegisterProcessor(eventType string, processor HealthDataProce
 	p.processors[eventType] = append(p.processors[eventType], processor)
 }
 
+// SetLocator 设置设备位置查询，设置后事件分发前附加设备所在位置
+func (p *Pipeline) SetLocator(locate func(sn string) *models.Location) {
+	p.locate = locate
+}
+
 // ReceiveEvent 统一接收事件并分发
 func (p *Pipeline) ReceiveEvent(event HealthEvent) {
+	if p.locate != nil && event.LocationID == nil {
+		if loc := p.locate(event.DeviceID); loc != nil {
+			event.LocationID = &loc.ID
+			event.Location = loc.Path
+		}
+	}
 	// 分发至 eventbus
 	if p.eventBus != nil {
 		p.eventBus.Publish(event.EventType, event)
@@ -48,3 +67,32 @@ func (p *Pipeline) ReceiveEvent(event HealthEvent) {
 		processor.Handle(event)
 	}
 }
+
+// ReceiveEventAsync 在新协程中处理事件，供不能阻塞的接入层回调使用；关闭时由 Wait 等待处理完毕
+func (p *Pipeline) ReceiveEventAsync(event HealthEvent) {
+	p.Go(func() { p.ReceiveEvent(event) })
+}
+
+// Go 在新协程中执行接入层回调中的耗时处理（如影子同步需等待下行发布确认），关闭时由 Wait 等待执行完毕
+func (p *Pipeline) Go(fn func()) {
+	p.inflight.Add(1)
+	go func() {
+		defer p.inflight.Done()
+		fn()
+	}()
+}
+
+// Wait 等待 ReceiveEventAsync 与 Go 启动的处理全部完成，ctx 到期时返回其错误
+func (p *Pipeline) Wait(ctx context.Context) error {
+	done := make(chan struct{})
+	go func() {
+		p.inflight.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
@@ -0,0 +1,212 @@
+// Package fieldcrypt 个人标识字段的应用层信封加密与盲索引
+//
+// 每个字段值使用随机数据密钥（DEK）以 AES-256-GCM 加密，DEK 再由密钥环中的主密钥（KEK）加密，
+// 密文格式为 enc:v1:<主密钥ID>:<base64(加密的DEK)>:<base64(加密的值)>。
+// 主密钥可轮换：新增密钥并设为当前密钥后，旧密钥仍用于解密，重加密任务完成后即可移除。
+// 需要按值查找的列（手机号、openid 等）另存 HMAC-SHA256 盲索引，查询时比较索引而非明文。
+package fieldcrypt
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+const (
+	// Prefix 密文前缀，不带前缀的值视为尚未加密的历史明文
+	Prefix = "enc:v1:"
+
+	keySize = 32
+)
+
+var (
+	ErrUnknownKey  = errors.New("字段加密主密钥不存在")
+	ErrCiphertext  = errors.New("字段密文格式错误或已被篡改")
+	ErrInvalidKeys = errors.New("字段加密密钥配置错误")
+)
+
+var b64 = base64.RawStdEncoding
+
+// Config 密钥环配置
+type Config struct {
+	ActiveKeyID string // 加密使用的主密钥ID
+	Keys        string // 主密钥列表 "id1:base64,id2:base64"，每个密钥 32 字节
+	IndexKey    string // 盲索引 HMAC 密钥（base64，至少 32 字节），轮换后须重建全部盲索引
+}
+
+// Keyring 字段加密密钥环；未配置主密钥时不加密（仅用于本地开发）。
+// 未配置盲索引密钥时不生成盲索引（字段以明文存储，查找回退明文比较），不会以空密钥计算 HMAC
+type Keyring struct {
+	activeID string
+	keys     map[string][]byte
+	indexKey []byte
+}
+
+// New 按配置构造密钥环
+func New(cfg Config) (*Keyring, error) {
+	k := &Keyring{activeID: strings.TrimSpace(cfg.ActiveKeyID), keys: map[string][]byte{}}
+	for _, entry := range strings.Split(cfg.Keys, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		id, encoded, ok := strings.Cut(entry, ":")
+		if !ok || id == "" || strings.Contains(id, ":") {
+			return nil, fmt.Errorf("%w: 条目需为 id:base64", ErrInvalidKeys)
+		}
+		key, err := base64.StdEncoding.DecodeString(encoded)
+		if err != nil || len(key) != keySize {
+			return nil, fmt.Errorf("%w: 密钥 %s 需为 %d 字节 base64", ErrInvalidKeys, id, keySize)
+		}
+		if _, dup := k.keys[id]; dup {
+			return nil, fmt.Errorf("%w: 密钥ID %s 重复", ErrInvalidKeys, id)
+		}
+		k.keys[id] = key
+	}
+	if strings.TrimSpace(cfg.IndexKey) != "" {
+		indexKey, err := base64.StdEncoding.DecodeString(strings.TrimSpace(cfg.IndexKey))
+		if err != nil || len(indexKey) < keySize {
+			return nil, fmt.Errorf("%w: 盲索引密钥需为至少 %d 字节 base64", ErrInvalidKeys, keySize)
+		}
+		k.indexKey = indexKey
+	}
+	if len(k.keys) == 0 {
+		if k.activeID != "" {
+			return nil, fmt.Errorf("%w: 未提供密钥 %s", ErrInvalidKeys, k.activeID)
+		}
+		return k, nil
+	}
+	if _, ok := k.keys[k.activeID]; !ok {
+		return nil, fmt.Errorf("%w: 当前密钥 %q 不在密钥列表中", ErrInvalidKeys, k.activeID)
+	}
+	if k.indexKey == nil {
+		return nil, fmt.Errorf("%w: 启用加密时必须配置盲索引密钥", ErrInvalidKeys)
+	}
+	return k, nil
+}
+
+// Enabled 是否启用加密
+func (k *Keyring) Enabled() bool {
+	return len(k.keys) > 0
+}
+
+// ActiveKeyID 当前加密使用的主密钥ID
+func (k *Keyring) ActiveKeyID() string {
+	return k.activeID
+}
+
+// Encrypt 加密字段值；空值保持为空，未启用加密时原样返回
+func (k *Keyring) Encrypt(plaintext string) (string, error) {
+	if plaintext == "" || !k.Enabled() {
+		return plaintext, nil
+	}
+	dek := make([]byte, keySize)
+	if _, err := rand.Read(dek); err != nil {
+		return "", err
+	}
+	wrapped, err := seal(k.keys[k.activeID], dek)
+	if err != nil {
+		return "", err
+	}
+	sealed, err := seal(dek, []byte(plaintext))
+	if err != nil {
+		return "", err
+	}
+	return Prefix + k.activeID + ":" + b64.EncodeToString(wrapped) + ":" + b64.EncodeToString(sealed), nil
+}
+
+// Decrypt 解密字段值；不带密文前缀的历史明文原样返回
+func (k *Keyring) Decrypt(value string) (string, error) {
+	if !strings.HasPrefix(value, Prefix) {
+		return value, nil
+	}
+	parts := strings.Split(strings.TrimPrefix(value, Prefix), ":")
+	if len(parts) != 3 {
+		return "", ErrCiphertext
+	}
+	kek, ok := k.keys[parts[0]]
+	if !ok {
+		return "", fmt.Errorf("%w: %s", ErrUnknownKey, parts[0])
+	}
+	wrapped, err1 := b64.DecodeString(parts[1])
+	sealed, err2 := b64.DecodeString(parts[2])
+	if err1 != nil || err2 != nil {
+		return "", ErrCiphertext
+	}
+	dek, err := open(kek, wrapped)
+	if err != nil {
+		return "", err
+	}
+	plaintext, err := open(dek, sealed)
+	if err != nil {
+		return "", err
+	}
+	return string(plaintext), nil
+}
+
+// NeedsReencrypt 值是否需要（重新）加密：历史明文，或由非当前主密钥加密
+func (k *Keyring) NeedsReencrypt(value string) bool {
+	if value == "" || !k.Enabled() {
+		return false
+	}
+	if !strings.HasPrefix(value, Prefix) {
+		return true
+	}
+	return !strings.HasPrefix(value, Prefix+k.activeID+":")
+}
+
+// BlindIndex 计算查找用盲索引；domain 区分不同列，避免跨列比对。空值或未配置盲索引密钥时返回空字符串
+func (k *Keyring) BlindIndex(domain, value string) string {
+	value = strings.TrimSpace(value)
+	if value == "" || k.indexKey == nil {
+		return ""
+	}
+	mac := hmac.New(sha256.New, k.indexKey)
+	mac.Write([]byte(domain))
+	mac.Write([]byte{0})
+	mac.Write([]byte(value))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// seal AES-256-GCM 加密，输出 nonce|密文
+func seal(key, plaintext []byte) ([]byte, error) {
+	gcm, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	return gcm.Seal(nonce, nonce, plaintext, nil), nil
+}
+
+func open(key, sealed []byte) ([]byte, error) {
+	gcm, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+	if len(sealed) < gcm.NonceSize() {
+		return nil, ErrCiphertext
+	}
+	plaintext, err := gcm.Open(nil, sealed[:gcm.NonceSize()], sealed[gcm.NonceSize():], nil)
+	if err != nil {
+		return nil, ErrCiphertext
+	}
+	return plaintext, nil
+}
+
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
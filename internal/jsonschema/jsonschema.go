@@ -0,0 +1,535 @@
+// Package jsonschema 设备上报数据的 JSON Schema 校验
+//
+// 支持 JSON Schema 的常用子集：type、enum、const、properties、required、additionalProperties、
+// minProperties / maxProperties、items、minItems / maxItems、minimum / maximum、exclusiveMinimum / exclusiveMaximum、
+// multipleOf、minLength / maxLength、pattern、allOf、anyOf、oneOf、not。
+// title、description 等注解关键字忽略，其余关键字在编译时报错，避免规则被静默跳过。
+// 待校验的值可来自 JSON（float64）或 msgpack（各类整数、float32）解码结果。
+package jsonschema
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"reflect"
+	"regexp"
+	"sort"
+	"strings"
+	"unicode/utf8"
+)
+
+var (
+	ErrInvalidSchema = errors.New("JSON Schema 格式错误")
+	ErrInvalidValue  = errors.New("数据不符合 JSON Schema")
+)
+
+// 注解关键字，不参与校验
+var annotationKeywords = map[string]bool{
+	"$schema": true, "$id": true, "$comment": true, "title": true, "description": true,
+	"default": true, "examples": true, "format": true, "deprecated": true, "readOnly": true, "writeOnly": true,
+}
+
+var validTypes = map[string]bool{
+	"object": true, "array": true, "string": true, "number": true, "integer": true, "boolean": true, "null": true,
+}
+
+// Schema 编译后的 JSON Schema
+type Schema struct {
+	types                []string
+	enum                 []interface{}
+	constValue           interface{}
+	hasConst             bool
+	properties           map[string]*Schema
+	required             []string
+	additionalProperties *Schema // 为 nil 时不限制
+	noAdditional         bool    // additionalProperties: false
+	minProperties        *int
+	maxProperties        *int
+	items                *Schema
+	minItems             *int
+	maxItems             *int
+	minimum              *float64
+	maximum              *float64
+	exclusiveMinimum     *float64
+	exclusiveMaximum     *float64
+	multipleOf           *float64
+	minLength            *int
+	maxLength            *int
+	pattern              *regexp.Regexp
+	allOf                []*Schema
+	anyOf                []*Schema
+	oneOf                []*Schema
+	not                  *Schema
+	alwaysFalse          bool // schema 为 false
+}
+
+// Compile 解析 JSON Schema，格式错误或包含不支持的关键字时返回 ErrInvalidSchema
+func Compile(raw []byte) (*Schema, error) {
+	var doc interface{}
+	dec := json.NewDecoder(bytes.NewReader(raw))
+	dec.UseNumber()
+	if err := dec.Decode(&doc); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidSchema, err)
+	}
+	return compile(doc, "")
+}
+
+func compile(doc interface{}, path string) (*Schema, error) {
+	if b, ok := doc.(bool); ok {
+		return &Schema{alwaysFalse: !b}, nil
+	}
+	obj, ok := doc.(map[string]interface{})
+	if !ok {
+		return nil, schemaError(path, "须为对象或布尔值")
+	}
+	s := &Schema{}
+	keys := make([]string, 0, len(obj))
+	for k := range obj {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		v := obj[key]
+		p := joinPath(path, key)
+		var err error
+		switch key {
+		case "type":
+			s.types, err = compileTypes(v, p)
+		case "enum":
+			list, ok := v.([]interface{})
+			if !ok || len(list) == 0 {
+				return nil, schemaError(p, "须为非空数组")
+			}
+			s.enum = normalizeAll(list)
+		case "const":
+			s.constValue, s.hasConst = normalize(v), true
+		case "properties":
+			props, ok := v.(map[string]interface{})
+			if !ok {
+				return nil, schemaError(p, "须为对象")
+			}
+			s.properties = make(map[string]*Schema, len(props))
+			for name, sub := range props {
+				if s.properties[name], err = compile(sub, joinPath(p, name)); err != nil {
+					return nil, err
+				}
+			}
+		case "required":
+			s.required, err = compileStrings(v, p)
+		case "additionalProperties":
+			if b, ok := v.(bool); ok {
+				s.noAdditional = !b
+			} else {
+				s.additionalProperties, err = compile(v, p)
+			}
+		case "items":
+			s.items, err = compile(v, p)
+		case "minProperties":
+			s.minProperties, err = compileCount(v, p)
+		case "maxProperties":
+			s.maxProperties, err = compileCount(v, p)
+		case "minItems":
+			s.minItems, err = compileCount(v, p)
+		case "maxItems":
+			s.maxItems, err = compileCount(v, p)
+		case "minLength":
+			s.minLength, err = compileCount(v, p)
+		case "maxLength":
+			s.maxLength, err = compileCount(v, p)
+		case "minimum":
+			s.minimum, err = compileNumber(v, p)
+		case "maximum":
+			s.maximum, err = compileNumber(v, p)
+		case "exclusiveMinimum":
+			s.exclusiveMinimum, err = compileNumber(v, p)
+		case "exclusiveMaximum":
+			s.exclusiveMaximum, err = compileNumber(v, p)
+		case "multipleOf":
+			if s.multipleOf, err = compileNumber(v, p); err == nil && *s.multipleOf <= 0 {
+				err = schemaError(p, "须大于 0")
+			}
+		case "pattern":
+			str, ok := v.(string)
+			if !ok {
+				return nil, schemaError(p, "须为字符串")
+			}
+			if s.pattern, err = regexp.Compile(str); err != nil {
+				err = schemaError(p, "正则表达式无效")
+			}
+		case "allOf":
+			s.allOf, err = compileList(v, p)
+		case "anyOf":
+			s.anyOf, err = compileList(v, p)
+		case "oneOf":
+			s.oneOf, err = compileList(v, p)
+		case "not":
+			s.not, err = compile(v, p)
+		default:
+			if !annotationKeywords[key] {
+				return nil, schemaError(p, "不支持的关键字")
+			}
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	return s, nil
+}
+
+func compileTypes(v interface{}, path string) ([]string, error) {
+	var types []string
+	switch t := v.(type) {
+	case string:
+		types = []string{t}
+	case []interface{}:
+		for _, item := range t {
+			str, ok := item.(string)
+			if !ok {
+				return nil, schemaError(path, "须为字符串或字符串数组")
+			}
+			types = append(types, str)
+		}
+	default:
+		return nil, schemaError(path, "须为字符串或字符串数组")
+	}
+	for _, t := range types {
+		if !validTypes[t] {
+			return nil, schemaError(path, fmt.Sprintf("未知类型 %q", t))
+		}
+	}
+	return types, nil
+}
+
+func compileStrings(v interface{}, path string) ([]string, error) {
+	list, ok := v.([]interface{})
+	if !ok {
+		return nil, schemaError(path, "须为字符串数组")
+	}
+	out := make([]string, 0, len(list))
+	for _, item := range list {
+		str, ok := item.(string)
+		if !ok {
+			return nil, schemaError(path, "须为字符串数组")
+		}
+		out = append(out, str)
+	}
+	return out, nil
+}
+
+func compileNumber(v interface{}, path string) (*float64, error) {
+	n, ok := v.(json.Number)
+	if !ok {
+		return nil, schemaError(path, "须为数值")
+	}
+	f, err := n.Float64()
+	if err != nil {
+		return nil, schemaError(path, "须为数值")
+	}
+	return &f, nil
+}
+
+func compileCount(v interface{}, path string) (*int, error) {
+	f, err := compileNumber(v, path)
+	if err != nil || *f < 0 || *f != math.Trunc(*f) {
+		return nil, schemaError(path, "须为非负整数")
+	}
+	n := int(*f)
+	return &n, nil
+}
+
+func compileList(v interface{}, path string) ([]*Schema, error) {
+	list, ok := v.([]interface{})
+	if !ok || len(list) == 0 {
+		return nil, schemaError(path, "须为非空数组")
+	}
+	out := make([]*Schema, len(list))
+	for i, item := range list {
+		s, err := compile(item, fmt.Sprintf("%s[%d]", path, i))
+		if err != nil {
+			return nil, err
+		}
+		out[i] = s
+	}
+	return out, nil
+}
+
+// Validate 校验数据，返回第一处不符合项（含字段路径），符合时返回 nil
+func (s *Schema) Validate(v interface{}) error {
+	return s.validate(normalize(v), "")
+}
+
+func (s *Schema) validate(v interface{}, path string) error {
+	if s.alwaysFalse {
+		return valueError(path, "不允许出现")
+	}
+	if len(s.types) > 0 && !matchesAnyType(v, s.types) {
+		return valueError(path, fmt.Sprintf("类型应为 %s", strings.Join(s.types, " / ")))
+	}
+	if s.hasConst && !reflect.DeepEqual(v, s.constValue) {
+		return valueError(path, fmt.Sprintf("须为 %v", s.constValue))
+	}
+	if s.enum != nil && !containsValue(s.enum, v) {
+		return valueError(path, "不在允许的取值范围内")
+	}
+	switch val := v.(type) {
+	case map[string]interface{}:
+		if err := s.validateObject(val, path); err != nil {
+			return err
+		}
+	case []interface{}:
+		if err := s.validateArray(val, path); err != nil {
+			return err
+		}
+	case float64:
+		if err := s.validateNumber(val, path); err != nil {
+			return err
+		}
+	case string:
+		if err := s.validateString(val, path); err != nil {
+			return err
+		}
+	}
+	for _, sub := range s.allOf {
+		if err := sub.validate(v, path); err != nil {
+			return err
+		}
+	}
+	if len(s.anyOf) > 0 {
+		matched := false
+		for _, sub := range s.anyOf {
+			if sub.validate(v, path) == nil {
+				matched = true
+				break
+			}
+		}
+		if !matched {
+			return valueError(path, "不符合 anyOf 中的任一规则")
+		}
+	}
+	if len(s.oneOf) > 0 {
+		matched := 0
+		for _, sub := range s.oneOf {
+			if sub.validate(v, path) == nil {
+				matched++
+			}
+		}
+		if matched != 1 {
+			return valueError(path, fmt.Sprintf("须恰好符合 oneOf 中的一条规则（符合 %d 条）", matched))
+		}
+	}
+	if s.not != nil && s.not.validate(v, path) == nil {
+		return valueError(path, "不应符合 not 规则")
+	}
+	return nil
+}
+
+func (s *Schema) validateObject(obj map[string]interface{}, path string) error {
+	for _, name := range s.required {
+		if _, ok := obj[name]; !ok {
+			return valueError(joinPath(path, name), "缺少必填字段")
+		}
+	}
+	if s.minProperties != nil && len(obj) < *s.minProperties {
+		return valueError(path, fmt.Sprintf("字段数不能少于 %d", *s.minProperties))
+	}
+	if s.maxProperties != nil && len(obj) > *s.maxProperties {
+		return valueError(path, fmt.Sprintf("字段数不能多于 %d", *s.maxProperties))
+	}
+	names := make([]string, 0, len(obj))
+	for name := range obj {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		p := joinPath(path, name)
+		if sub, ok := s.properties[name]; ok {
+			if err := sub.validate(obj[name], p); err != nil {
+				return err
+			}
+			continue
+		}
+		if s.noAdditional {
+			return valueError(p, "不允许的字段")
+		}
+		if s.additionalProperties != nil {
+			if err := s.additionalProperties.validate(obj[name], p); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func (s *Schema) validateArray(list []interface{}, path string) error {
+	if s.minItems != nil && len(list) < *s.minItems {
+		return valueError(path, fmt.Sprintf("元素数不能少于 %d", *s.minItems))
+	}
+	if s.maxItems != nil && len(list) > *s.maxItems {
+		return valueError(path, fmt.Sprintf("元素数不能多于 %d", *s.maxItems))
+	}
+	if s.items != nil {
+		for i, item := range list {
+			if err := s.items.validate(item, fmt.Sprintf("%s[%d]", path, i)); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func (s *Schema) validateNumber(n float64, path string) error {
+	switch {
+	case s.minimum != nil && n < *s.minimum:
+		return valueError(path, fmt.Sprintf("不能小于 %v", *s.minimum))
+	case s.maximum != nil && n > *s.maximum:
+		return valueError(path, fmt.Sprintf("不能大于 %v", *s.maximum))
+	case s.exclusiveMinimum != nil && n <= *s.exclusiveMinimum:
+		return valueError(path, fmt.Sprintf("须大于 %v", *s.exclusiveMinimum))
+	case s.exclusiveMaximum != nil && n >= *s.exclusiveMaximum:
+		return valueError(path, fmt.Sprintf("须小于 %v", *s.exclusiveMaximum))
+	case s.multipleOf != nil && !isMultiple(n, *s.multipleOf):
+		return valueError(path, fmt.Sprintf("须为 %v 的整数倍", *s.multipleOf))
+	}
+	return nil
+}
+
+func (s *Schema) validateString(str, path string) error {
+	length := utf8.RuneCountInString(str)
+	switch {
+	case s.minLength != nil && length < *s.minLength:
+		return valueError(path, fmt.Sprintf("长度不能小于 %d", *s.minLength))
+	case s.maxLength != nil && length > *s.maxLength:
+		return valueError(path, fmt.Sprintf("长度不能大于 %d", *s.maxLength))
+	case s.pattern != nil && !s.pattern.MatchString(str):
+		return valueError(path, "格式不符合 pattern")
+	}
+	return nil
+}
+
+func matchesAnyType(v interface{}, types []string) bool {
+	for _, t := range types {
+		if matchesType(v, t) {
+			return true
+		}
+	}
+	return false
+}
+
+func matchesType(v interface{}, t string) bool {
+	switch t {
+	case "object":
+		_, ok := v.(map[string]interface{})
+		return ok
+	case "array":
+		_, ok := v.([]interface{})
+		return ok
+	case "string":
+		_, ok := v.(string)
+		return ok
+	case "number":
+		_, ok := v.(float64)
+		return ok
+	case "integer":
+		f, ok := v.(float64)
+		return ok && f == math.Trunc(f) && !math.IsInf(f, 0)
+	case "boolean":
+		_, ok := v.(bool)
+		return ok
+	case "null":
+		return v == nil
+	}
+	return false
+}
+
+func isMultiple(n, of float64) bool {
+	q := n / of
+	return math.Abs(q-math.Round(q)) < 1e-9
+}
+
+func containsValue(list []interface{}, v interface{}) bool {
+	for _, item := range list {
+		if reflect.DeepEqual(item, v) {
+			return true
+		}
+	}
+	return false
+}
+
+// normalize 将数值统一为 float64、字节串转为字符串，map 与数组逐层转换，便于比较与类型判断
+func normalize(v interface{}) interface{} {
+	switch val := v.(type) {
+	case json.Number:
+		f, _ := val.Float64()
+		return f
+	case float32:
+		return float64(val)
+	case int:
+		return float64(val)
+	case int8:
+		return float64(val)
+	case int16:
+		return float64(val)
+	case int32:
+		return float64(val)
+	case int64:
+		return float64(val)
+	case uint:
+		return float64(val)
+	case uint8:
+		return float64(val)
+	case uint16:
+		return float64(val)
+	case uint32:
+		return float64(val)
+	case uint64:
+		return float64(val)
+	case []byte:
+		return string(val)
+	case []interface{}:
+		return normalizeAll(val)
+	case map[string]interface{}:
+		out := make(map[string]interface{}, len(val))
+		for k, item := range val {
+			out[k] = normalize(item)
+		}
+		return out
+	case map[interface{}]interface{}:
+		out := make(map[string]interface{}, len(val))
+		for k, item := range val {
+			out[fmt.Sprint(k)] = normalize(item)
+		}
+		return out
+	}
+	return v
+}
+
+func normalizeAll(list []interface{}) []interface{} {
+	out := make([]interface{}, len(list))
+	for i, item := range list {
+		out[i] = normalize(item)
+	}
+	return out
+}
+
+func joinPath(path, name string) string {
+	if path == "" {
+		return name
+	}
+	return path + "." + name
+}
+
+func schemaError(path, msg string) error {
+	if path == "" {
+		return fmt.Errorf("%w: %s", ErrInvalidSchema, msg)
+	}
+	return fmt.Errorf("%w: %s %s", ErrInvalidSchema, path, msg)
+}
+
+func valueError(path, msg string) error {
+	if path == "" {
+		return fmt.Errorf("%w: %s", ErrInvalidValue, msg)
+	}
+	return fmt.Errorf("%w: %s %s", ErrInvalidValue, path, msg)
+}
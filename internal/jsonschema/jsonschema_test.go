@@ -0,0 +1,189 @@
+package jsonschema
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+)
+
+func mustCompile(t *testing.T, raw string) *Schema {
+	t.Helper()
+	s, err := Compile([]byte(raw))
+	if err != nil {
+		t.Fatalf("Compile(%s): %v", raw, err)
+	}
+	return s
+}
+
+func jsonValue(t *testing.T, raw string) interface{} {
+	t.Helper()
+	var v interface{}
+	if err := json.Unmarshal([]byte(raw), &v); err != nil {
+		t.Fatalf("json.Unmarshal(%s): %v", raw, err)
+	}
+	return v
+}
+
+func TestCompileInvalid(t *testing.T) {
+	tests := []struct {
+		name   string
+		schema string
+	}{
+		{name: "非 JSON", schema: `{`},
+		{name: "非对象", schema: `"object"`},
+		{name: "不支持的关键字", schema: `{"type": "object", "patternProperties": {}}`},
+		{name: "未知类型", schema: `{"type": "decimal"}`},
+		{name: "空 enum", schema: `{"enum": []}`},
+		{name: "required 非字符串", schema: `{"required": [1]}`},
+		{name: "minimum 非数值", schema: `{"minimum": "1"}`},
+		{name: "minLength 为负", schema: `{"minLength": -1}`},
+		{name: "multipleOf 为 0", schema: `{"multipleOf": 0}`},
+		{name: "pattern 非法", schema: `{"pattern": "("}`},
+		{name: "嵌套错误", schema: `{"properties": {"hr": {"type": 1}}}`},
+		{name: "anyOf 非数组", schema: `{"anyOf": {}}`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := Compile([]byte(tt.schema)); !errors.Is(err, ErrInvalidSchema) {
+				t.Fatalf("err = %v, want ErrInvalidSchema", err)
+			}
+		})
+	}
+}
+
+func TestCompileIgnoresAnnotations(t *testing.T) {
+	mustCompile(t, `{"$schema": "https://json-schema.org/draft/2020-12/schema", "title": "心率",
+		"description": "每分钟心跳", "default": 60, "examples": [72], "format": "int32", "type": "integer"}`)
+}
+
+func TestValidateKeywords(t *testing.T) {
+	tests := []struct {
+		name   string
+		schema string
+		value  string
+		valid  bool
+	}{
+		{name: "type 符合", schema: `{"type": "string"}`, value: `"ok"`, valid: true},
+		{name: "type 不符", schema: `{"type": "string"}`, value: `1`},
+		{name: "type 列表", schema: `{"type": ["number", "null"]}`, value: `null`, valid: true},
+		{name: "integer 接受整数值", schema: `{"type": "integer"}`, value: `3.0`, valid: true},
+		{name: "integer 拒绝小数", schema: `{"type": "integer"}`, value: `3.5`},
+		{name: "enum 命中", schema: `{"enum": ["on", "off"]}`, value: `"on"`, valid: true},
+		{name: "enum 未命中", schema: `{"enum": ["on", "off"]}`, value: `"idle"`},
+		{name: "const 命中", schema: `{"const": 2}`, value: `2`, valid: true},
+		{name: "const 未命中", schema: `{"const": 2}`, value: `3`},
+		{name: "required 缺失", schema: `{"required": ["hr"]}`, value: `{"spo2": 98}`},
+		{name: "properties 校验子字段", schema: `{"properties": {"hr": {"type": "number"}}}`, value: `{"hr": "x"}`},
+		{name: "additionalProperties false", schema: `{"properties": {"hr": {}}, "additionalProperties": false}`,
+			value: `{"hr": 60, "x": 1}`},
+		{name: "additionalProperties schema", schema: `{"additionalProperties": {"type": "number"}}`,
+			value: `{"a": 1, "b": 2}`, valid: true},
+		{name: "minProperties", schema: `{"minProperties": 2}`, value: `{"a": 1}`},
+		{name: "maxProperties", schema: `{"maxProperties": 1}`, value: `{"a": 1, "b": 2}`},
+		{name: "items", schema: `{"items": {"type": "number"}}`, value: `[1, "2"]`},
+		{name: "minItems", schema: `{"minItems": 2}`, value: `[1]`},
+		{name: "maxItems", schema: `{"maxItems": 1}`, value: `[1, 2]`},
+		{name: "minimum 边界", schema: `{"minimum": 30}`, value: `30`, valid: true},
+		{name: "minimum", schema: `{"minimum": 30}`, value: `29.9`},
+		{name: "maximum", schema: `{"maximum": 250}`, value: `251`},
+		{name: "exclusiveMinimum 边界", schema: `{"exclusiveMinimum": 0}`, value: `0`},
+		{name: "exclusiveMaximum 边界", schema: `{"exclusiveMaximum": 100}`, value: `100`},
+		{name: "multipleOf 小数", schema: `{"multipleOf": 0.1}`, value: `36.7`, valid: true},
+		{name: "multipleOf 不整除", schema: `{"multipleOf": 5}`, value: `12`},
+		{name: "minLength 按字符计", schema: `{"minLength": 2}`, value: `"心率"`, valid: true},
+		{name: "maxLength 按字符计", schema: `{"maxLength": 1}`, value: `"心率"`},
+		{name: "pattern", schema: `{"pattern": "^[A-Z]{2}[0-9]+$"}`, value: `"sn01"`},
+		{name: "allOf 全部符合", schema: `{"allOf": [{"minimum": 1}, {"maximum": 3}]}`, value: `2`, valid: true},
+		{name: "allOf 部分符合", schema: `{"allOf": [{"minimum": 1}, {"maximum": 3}]}`, value: `4`},
+		{name: "anyOf", schema: `{"anyOf": [{"type": "string"}, {"type": "boolean"}]}`, value: `1`},
+		{name: "oneOf 恰好一条", schema: `{"oneOf": [{"minimum": 10}, {"maximum": 5}]}`, value: `12`, valid: true},
+		{name: "oneOf 多条符合", schema: `{"oneOf": [{"minimum": 1}, {"maximum": 5}]}`, value: `3`},
+		{name: "not", schema: `{"not": {"type": "null"}}`, value: `null`},
+		{name: "false schema", schema: `{"properties": {"debug": false}}`, value: `{"debug": 1}`},
+		{name: "true schema", schema: `{"properties": {"debug": true}}`, value: `{"debug": 1}`, valid: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := mustCompile(t, tt.schema).Validate(jsonValue(t, tt.value))
+			if tt.valid && err != nil {
+				t.Fatalf("Validate(%s) = %v, want nil", tt.value, err)
+			}
+			if !tt.valid && !errors.Is(err, ErrInvalidValue) {
+				t.Fatalf("Validate(%s) = %v, want ErrInvalidValue", tt.value, err)
+			}
+		})
+	}
+}
+
+func TestValidateErrorPath(t *testing.T) {
+	s := mustCompile(t, `{"properties": {"vitals": {"properties": {"hr": {"maximum": 250}}}, "list": {"items": {"type": "number"}}}}`)
+	tests := []struct {
+		value string
+		want  string
+	}{
+		{value: `{"vitals": {"hr": 300}}`, want: "数据不符合 JSON Schema: vitals.hr 不能大于 250"},
+		{value: `{"list": [1, "x"]}`, want: "数据不符合 JSON Schema: list[1] 类型应为 number"},
+	}
+	for _, tt := range tests {
+		if err := s.Validate(jsonValue(t, tt.value)); err == nil || err.Error() != tt.want {
+			t.Errorf("Validate(%s) = %v, want %q", tt.value, err, tt.want)
+		}
+	}
+}
+
+// msgpack 解码结果中的各类整数、float32、字节串与 map[interface{}]interface{} 按 JSON 等价值校验
+func TestValidateNormalizesMsgpackValues(t *testing.T) {
+	s := mustCompile(t, `{
+		"type": "object",
+		"required": ["hr", "spo2", "temp", "mode", "seq", "signal"],
+		"properties": {
+			"hr": {"type": "integer", "minimum": 30, "maximum": 250},
+			"spo2": {"type": "integer", "enum": [95, 96, 97, 98, 99, 100]},
+			"temp": {"type": "number", "multipleOf": 0.5},
+			"mode": {"type": "string", "const": "sleep"},
+			"seq": {"type": "integer", "minimum": 0},
+			"signal": {"type": "object", "properties": {"rssi": {"type": "integer", "maximum": 0}}}
+		}
+	}`)
+	tests := []struct {
+		name  string
+		value map[string]interface{}
+		valid bool
+	}{
+		{name: "各类整数与 float32", valid: true, value: map[string]interface{}{
+			"hr": int8(72), "spo2": uint8(98), "temp": float32(36.5), "mode": []byte("sleep"), "seq": uint64(7),
+			"signal": map[interface{}]interface{}{"rssi": int16(-80)},
+		}},
+		{name: "int64 与 uint32", valid: true, value: map[string]interface{}{
+			"hr": int64(60), "spo2": uint32(100), "temp": int(37), "mode": "sleep", "seq": uint16(0),
+			"signal": map[string]interface{}{"rssi": int32(-60)},
+		}},
+		{name: "整数超出范围", value: map[string]interface{}{
+			"hr": uint16(300), "spo2": uint8(98), "temp": float32(36.5), "mode": "sleep", "seq": 1,
+			"signal": map[string]interface{}{},
+		}},
+		{name: "enum 按数值比较", value: map[string]interface{}{
+			"hr": 72, "spo2": int64(90), "temp": float32(36.5), "mode": "sleep", "seq": 1,
+			"signal": map[string]interface{}{},
+		}},
+		{name: "嵌套 map[interface{}]interface{}", value: map[string]interface{}{
+			"hr": 72, "spo2": 98, "temp": 36.0, "mode": "sleep", "seq": 1,
+			"signal": map[interface{}]interface{}{"rssi": uint8(10)},
+		}},
+		{name: "float32 非整数倍", value: map[string]interface{}{
+			"hr": 72, "spo2": 98, "temp": float32(36.3), "mode": "sleep", "seq": 1,
+			"signal": map[string]interface{}{},
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := s.Validate(tt.value)
+			if tt.valid && err != nil {
+				t.Fatalf("Validate = %v, want nil", err)
+			}
+			if !tt.valid && !errors.Is(err, ErrInvalidValue) {
+				t.Fatalf("Validate = %v, want ErrInvalidValue", err)
+			}
+		})
+	}
+}
@@ -5,17 +5,40 @@ import (
 	"time"
 )
 
+// 管理员角色
+const (
+	AdminRolePlatformAdmin = "platform_admin" // 平台超级管理员，可跨组织管理
+	AdminRoleSuperAdmin    = "superadmin"     // 组织超级管理员，可管理本组织管理员
+	AdminRoleAdmin         = "admin"          // 普通管理员
+)
+
+// 登录主体类型，对应 auth 表的 user_type 字段
+const (
+	UserTypeAdmin = "admin"
+	UserTypeApp   = "app"
+)
+
+// IsValidAdminRole 判断是否为合法的管理员角色
+func IsValidAdminRole(role string) bool {
+	switch role {
+	case AdminRolePlatformAdmin, AdminRoleSuperAdmin, AdminRoleAdmin:
+		return true
+	}
+	return false
+}
+
 // AdminUser 管理员用户模型，便于扩展，可兼容 Ent 或标准 struct
 // swagger:model AdminUser
 type AdminUser struct {
-	ID           int64     `json:"id"`            // 管理员ID
-	Username     string    `json:"username"`      // 用户名
-	Email        string    `json:"email"`         // 邮箱
-	Phone        string    `json:"phone"`         // 手机号
-	PasswordHash string    `json:"password_hash"` // 密码哈希
-	Role         string    `json:"role"`          // 角色（如：superadmin, admin）
-	IsActive     bool      `json:"is_active"`     // 激活状态
-	LastLogin    time.Time `json:"last_login"`    // 最后登录时间
-	CreatedAt    time.Time `json:"created_at"`    // 创建时间
-	UpdatedAt    time.Time `json:"updated_at"`    // 更新时间
+	ID           int64      `json:"id"`         // 管理员ID
+	OrgID        int        `json:"org_id"`     // 所属组织
+	Username     string     `json:"username"`   // 用户名
+	Email        string     `json:"email"`      // 邮箱
+	Phone        string     `json:"phone"`      // 手机号
+	PasswordHash string     `json:"-"`          // 密码哈希，不对外序列化
+	Role         string     `json:"role"`       // 角色（platform_admin, superadmin, admin）
+	IsActive     bool       `json:"is_active"`  // 激活状态
+	LastLogin    *time.Time `json:"last_login"` // 最后登录时间
+	CreatedAt    time.Time  `json:"created_at"` // 创建时间
+	UpdatedAt    time.Time  `json:"updated_at"` // 更新时间
 }
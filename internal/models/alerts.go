@@ -5,10 +5,26 @@ import (
 	"time"
 )
 
+// 告警状态
+const (
+	AlertStatusOpen     = "open"
+	AlertStatusResolved = "resolved"
+)
+
+// AlertRuleDeviceOffline 设备离线告警规则名，设备恢复在线时自动解除
+const AlertRuleDeviceOffline = "device_offline"
+
+// 设备电量与信号告警规则名，恢复到阈值以上（低电量时开始充电）自动解除
+const (
+	AlertRuleLowBattery = "low_battery"
+	AlertRulePoorSignal = "poor_signal"
+)
+
 // Alert 告警模型
 // swagger:model Alert
 type Alert struct {
 	ID              int             `json:"id"`
+	OrgID           int             `json:"org_id"` // 所属组织
 	HealthProfileID *int            `json:"health_profile_id"`
 	DeviceID        *int            `json:"device_id"`
 	SourceEventID   *int            `json:"source_event_id"`
@@ -21,4 +37,6 @@ type Alert struct {
 	Status          string          `json:"status"`
 	CreatedAt       time.Time       `json:"created_at"`
 	ResolvedAt      *time.Time      `json:"resolved_at"`
+	LocationID      *int            `json:"location_id"`        // 设备放置位置，设备未放置时为档案床位
+	Location        string          `json:"location,omitempty"` // 位置完整路径
 }
@@ -0,0 +1,51 @@
+package models
+
+import (
+	"time"
+)
+
+// UserTypeAPIKey 第三方系统通过 API Key 访问时的主体类型
+const UserTypeAPIKey = "api_key"
+
+// API Key 授权范围
+const (
+	APIKeyScopeReadAlerts         = "read:alerts"          // 查询本组织告警
+	APIKeyScopeReadHealthProfiles = "read:health_profiles" // 查询本组织健康档案
+	APIKeyScopeWriteHealthData    = "write:health_data"    // 上报人工录入的健康数据
+)
+
+// IsValidAPIKeyScope 判断是否为支持的授权范围
+func IsValidAPIKeyScope(scope string) bool {
+	switch scope {
+	case APIKeyScopeReadAlerts, APIKeyScopeReadHealthProfiles, APIKeyScopeWriteHealthData:
+		return true
+	}
+	return false
+}
+
+// APIKey 组织级 API Key，明文仅在创建/轮换时返回一次，库中只保存 SHA256 哈希
+// swagger:model APIKey
+type APIKey struct {
+	ID         int64      `json:"id"`
+	OrgID      int        `json:"org_id"`
+	Name       string     `json:"name"`
+	Prefix     string     `json:"prefix"` // 明文前缀，用于识别与展示
+	KeyHash    string     `json:"-"`
+	Scopes     []string   `json:"scopes"`
+	CreatedBy  int64      `json:"created_by"`
+	ExpiresAt  time.Time  `json:"expires_at"`
+	LastUsedAt *time.Time `json:"last_used_at"`
+	RotatedAt  *time.Time `json:"rotated_at"`
+	RevokedAt  *time.Time `json:"revoked_at"`
+	CreatedAt  time.Time  `json:"created_at"`
+}
+
+// HasScope 是否包含指定授权范围
+func (k *APIKey) HasScope(scope string) bool {
+	for _, s := range k.Scopes {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
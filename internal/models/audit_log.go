@@ -0,0 +1,66 @@
+package models
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// 审计动作
+const (
+	AuditActionView   = "view"
+	AuditActionList   = "list"
+	AuditActionCreate = "create"
+	AuditActionUpdate = "update"
+	AuditActionDelete = "delete"
+)
+
+// 审计资源类型
+const (
+	AuditResourceHealthProfile    = "health_profile"
+	AuditResourceDevice           = "device"
+	AuditResourceDeviceAssignment = "device_assignment"
+	AuditResourceAlert            = "alert"
+	AuditResourceAdminUser        = "admin_user"
+	AuditResourceOrganization     = "organization"
+	AuditResourceAPIKey           = "api_key"
+	AuditResourceHealthData       = "health_data"
+	AuditResourceDeviceCommand    = "device_command"
+	AuditResourceDeviceShadow     = "device_shadow"
+	AuditResourceFirmware         = "firmware"
+	AuditResourceOTACampaign      = "ota_campaign"
+	AuditResourcePendingDevice    = "pending_device"
+	AuditResourceLocation         = "location"
+	AuditResourceDeviceType       = "device_type"
+)
+
+// AuditActorAnonymous 未登录请求的审计主体类型
+const AuditActorAnonymous = "anonymous"
+
+// AuditLog 审计日志，只追加；Hash = SHA256(PrevHash + 记录内容)，形成防篡改链
+type AuditLog struct {
+	ID           int64           `json:"id"`
+	OrgID        int             `json:"org_id"` // 操作所属组织，平台级及 App 用户操作为 0
+	ActorType    string          `json:"actor_type"`
+	ActorID      int64           `json:"actor_id"`
+	Action       string          `json:"action"`
+	ResourceType string          `json:"resource_type"`
+	ResourceID   string          `json:"resource_id"`
+	Changes      json.RawMessage `json:"changes,omitempty" swaggertype:"object"`
+	IP           string          `json:"ip"`
+	CreatedAt    time.Time       `json:"created_at"`
+	PrevHash     string          `json:"prev_hash"`
+	Hash         string          `json:"hash"`
+}
+
+// AuditLogFilter 审计日志查询条件，零值字段不参与过滤
+type AuditLogFilter struct {
+	ActorType    string
+	ActorID      int64
+	Action       string
+	ResourceType string
+	ResourceID   string
+	From         *time.Time
+	To           *time.Time
+	Limit        int
+	Offset       int
+}
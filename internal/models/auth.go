@@ -10,6 +10,7 @@ import (
 type Auth struct {
 	ID        int64     `json:"id"`         // 认证ID
 	UserID    int64     `json:"user_id"`    // 用户ID
+	UserType  string    `json:"user_type"`  // 用户类型（admin/app）
 	Token     string    `json:"token"`      // 认证Token
 	ExpiresAt time.Time `json:"expires_at"` // Token过期时间
 	CreatedAt time.Time `json:"created_at"` // 创建时间
@@ -4,7 +4,13 @@ import (
 	"time"
 )
 
-// DeviceAssignment 设备与健康档案绑定模型
+// 设备绑定结束原因
+const (
+	AssignmentEndUnassigned = "unassigned" // 手动解绑
+	AssignmentEndReassigned = "reassigned" // 设备绑定到其他档案时自动解绑
+)
+
+// DeviceAssignment 设备与健康档案绑定模型；unassigned_at 为空表示有效绑定，每台设备同时至多一条
 // swagger:model DeviceAssignment
 type DeviceAssignment struct {
 	ID              int        `json:"id"`
@@ -12,4 +18,5 @@ type DeviceAssignment struct {
 	HealthProfileID int        `json:"health_profile_id"`
 	AssignedAt      time.Time  `json:"assigned_at"`
 	UnassignedAt    *time.Time `json:"unassigned_at"`
+	EndReason       string     `json:"end_reason,omitempty"`
 }
@@ -0,0 +1,52 @@
+package models
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// 设备下行指令名称，下发主题为 device/{sn}/cmd/{name}
+const (
+	DeviceCommandSetSamplingInterval = "set_sampling_interval" // 设置采样间隔，params: {"interval_seconds": 1-86400}
+	DeviceCommandReboot              = "reboot"                // 重启设备
+	DeviceCommandStartMeasurement    = "start_measurement"     // 立即开始一次测量，params 由设备类型约定
+	DeviceCommandSyncClock           = "sync_clock"            // 校时，params 由服务端填入 server_time（毫秒）
+)
+
+// IsValidDeviceCommand 判断是否为支持的下行指令
+func IsValidDeviceCommand(name string) bool {
+	switch name {
+	case DeviceCommandSetSamplingInterval, DeviceCommandReboot, DeviceCommandStartMeasurement, DeviceCommandSyncClock:
+		return true
+	}
+	return false
+}
+
+// 下行指令状态：pending 已创建未发布；sent 已发布待设备确认；acked 设备执行成功；
+// failed 发布失败或设备返回错误；timed_out 超时未收到确认
+const (
+	DeviceCommandPending  = "pending"
+	DeviceCommandSent     = "sent"
+	DeviceCommandAcked    = "acked"
+	DeviceCommandFailed   = "failed"
+	DeviceCommandTimedOut = "timed_out"
+)
+
+// DeviceCommand 设备下行指令记录，设备通过 device/{sn}/ack 按 request_id 回执
+// swagger:model DeviceCommand
+type DeviceCommand struct {
+	ID        int64           `json:"id"`
+	OrgID     int             `json:"org_id"`
+	DeviceID  int             `json:"device_id"`
+	RequestID string          `json:"request_id"`
+	Name      string          `json:"name"`
+	Params    json.RawMessage `json:"params,omitempty"`
+	Status    string          `json:"status"`
+	Result    json.RawMessage `json:"result,omitempty"` // 设备回执中的执行结果
+	Error     string          `json:"error,omitempty"`
+	CreatedBy int64           `json:"created_by"`
+	CreatedAt time.Time       `json:"created_at"`
+	SentAt    *time.Time      `json:"sent_at"`
+	AckedAt   *time.Time      `json:"acked_at"`
+	ExpiresAt time.Time       `json:"expires_at"` // 超过该时间未确认即标记 timed_out
+}
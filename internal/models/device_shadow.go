@@ -0,0 +1,23 @@
+package models
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// DeviceShadow 设备影子：desired 为平台期望配置（接口设置），reported 为设备上报的实际状态
+// （固件版本、电量、设置等），delta 为 desired 中与 reported 不一致的部分，设备重连后下发以恢复配置。
+// version 为期望状态版本，每次修改加一，用于拒绝基于旧版本的修改；reported_version 为设备上报序号，只增不减
+// swagger:model DeviceShadow
+type DeviceShadow struct {
+	DeviceID          int             `json:"device_id"`
+	SerialNumber      string          `json:"serial_number"`
+	OrgID             int             `json:"org_id"`
+	Desired           json.RawMessage `json:"desired" swaggertype:"object"`
+	Reported          json.RawMessage `json:"reported" swaggertype:"object"`
+	Delta             json.RawMessage `json:"delta" swaggertype:"object"`
+	Version           int64           `json:"version"`
+	ReportedVersion   int64           `json:"reported_version"`
+	DesiredUpdatedAt  *time.Time      `json:"desired_updated_at"`
+	ReportedUpdatedAt *time.Time      `json:"reported_updated_at"`
+}
@@ -0,0 +1,13 @@
+package models
+
+import "time"
+
+// DeviceTelemetry 设备电量与信号采样，设备未上报的字段为空
+// swagger:model DeviceTelemetry
+type DeviceTelemetry struct {
+	Battery    *int      `json:"battery"`  // 电量百分比 0-100
+	Charging   *bool     `json:"charging"` // 是否充电中
+	RSSI       *int      `json:"rssi"`     // 信号强度（dBm）
+	SNR        *float64  `json:"snr"`      // 信噪比（dB）
+	RecordedAt time.Time `json:"recorded_at"`
+}
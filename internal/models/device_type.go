@@ -0,0 +1,37 @@
+package models
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// 指标展示方式
+const (
+	DeviceMetricChartLine = "line" // 折线图（默认）
+	DeviceMetricChartBar  = "bar"  // 柱状图
+	DeviceMetricChartNone = "none" // 不绘图，仅显示数值
+)
+
+// DeviceType 设备类型目录：声明设备类型产生的指标、预期上报间隔与上报数据的 JSON Schema，
+// 接入层按 payload_schema 与指标取值范围校验上报数据，前端按 metrics 决定展示的图表；code 对应 Device.DeviceType
+// swagger:model DeviceType
+type DeviceType struct {
+	Code                     string          `json:"code"`
+	Name                     string          `json:"name"`
+	Description              string          `json:"description"`
+	ReportingIntervalSeconds int             `json:"reporting_interval_seconds"` // 预期上报间隔，0 表示不固定（按需测量）
+	Metrics                  []DeviceMetric  `json:"metrics"`
+	PayloadSchema            json.RawMessage `json:"payload_schema,omitempty" swaggertype:"object"` // 上报数据（data 字段）的 JSON Schema，为空不校验
+	CreatedAt                time.Time       `json:"created_at"`
+	UpdatedAt                time.Time       `json:"updated_at"`
+}
+
+// DeviceMetric 设备类型产生的指标
+type DeviceMetric struct {
+	Key   string   `json:"key"`   // 上报数据中的字段名
+	Name  string   `json:"name"`  // 显示名称，如 "心率"
+	Unit  string   `json:"unit"`  // 单位，如 "bpm"
+	Min   *float64 `json:"min"`   // 有效取值下限，超出范围的上报视为无效数据
+	Max   *float64 `json:"max"`   // 有效取值上限
+	Chart string   `json:"chart"` // line / bar / none
+}
@@ -8,10 +8,38 @@ import (
 // swagger:model Device
 type Device struct {
 	ID           int       `json:"id"`
+	OrgID        int       `json:"org_id"` // 所属组织
 	SerialNumber string    `json:"serial_number"`
 	Name         string    `json:"name"`
 	DeviceType   string    `json:"device_type"`
 	IsActive     bool      `json:"is_active"`
+	SecretKey    string    `json:"-"`           // 设备 HMAC 密钥，仅在注册/轮换时返回一次
+	LocationID   *int      `json:"location_id"` // 放置位置，通过 PUT /devices/:id/location 修改
 	CreatedAt    time.Time `json:"created_at"`
 	UpdatedAt    time.Time `json:"updated_at"`
+
+	Location  string           `json:"location,omitempty"`  // 位置完整路径，仅查询时返回
+	Presence  *DevicePresence  `json:"presence,omitempty"`  // 在线状态，仅查询时返回
+	Telemetry *DeviceTelemetry `json:"telemetry,omitempty"` // 最近一次电量与信号，仅查询时返回
+}
+
+// 设备在线状态
+const (
+	DeviceOnline  = "online"
+	DeviceOffline = "offline"
+	DeviceUnknown = "unknown" // 从未上报数据或心跳
+)
+
+// 设备在线状态事件类型
+const (
+	EventDeviceOnline  = "device_online"
+	EventDeviceOffline = "device_offline"
+)
+
+// DevicePresence 设备在线状态：最近一次上行（数据或心跳）超过该设备类型的静默时长，
+// 或之后收到设备遗嘱（device/{sn}/status 为 offline）即视为离线
+type DevicePresence struct {
+	Status         string     `json:"status"`
+	LastSeenAt     *time.Time `json:"last_seen_at"`
+	DisconnectedAt *time.Time `json:"disconnected_at,omitempty"` // 设备声明离线的时间
 }
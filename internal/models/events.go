@@ -19,3 +19,9 @@ type Event struct {
 	CreatedAt       time.Time       `json:"created_at"`
 	UpdatedAt       time.Time       `json:"updated_at"`
 }
+
+// MQTT 接入连接状态事件类型（系统事件，不关联设备与档案）
+const (
+	EventMQTTConnected    = "mqtt_connected"
+	EventMQTTDisconnected = "mqtt_disconnected"
+)
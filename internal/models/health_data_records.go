@@ -5,7 +5,7 @@ import (
 	"time"
 )
 
-// HealthDataRecord 健康数据记录模型
+// HealthDataRecord 健康数据记录模型；健康数据内容不进入审计日志
 // swagger:model HealthDataRecord
 type HealthDataRecord struct {
 	ID              int             `json:"id"`
@@ -13,7 +13,7 @@ type HealthDataRecord struct {
 	DeviceID        *int            `json:"device_id"`
 	SchemaType      string          `json:"schema_type"`
 	RecordedAt      time.Time       `json:"recorded_at"`
-	Payload         json.RawMessage `json:"payload"` // JSONB
+	Payload         json.RawMessage `json:"payload" audit:"redact"` // JSONB
 	CreatedAt       time.Time       `json:"created_at"`
 	UpdatedAt       time.Time       `json:"updated_at"`
 }
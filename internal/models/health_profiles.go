@@ -5,15 +5,18 @@ import (
 	"time"
 )
 
-// HealthProfile 健康档案模型
+// HealthProfile 健康档案模型；标记 audit:"redact" 的字段为加密存储的个人信息，审计日志只记录是否变更
 // swagger:model HealthProfile
 type HealthProfile struct {
 	ID        int             `json:"id"`
+	OrgID     int             `json:"org_id"`  // 所属组织；0 表示 App 用户创建的个人档案，不归属组织，仅档案成员可访问
 	UserID    *int            `json:"user_id"` // 外键 app_users(id)
-	Name      string          `json:"name"`
+	Name      string          `json:"name" audit:"redact"`
 	Gender    string          `json:"gender"`
-	BirthDate *time.Time      `json:"birth_date"`
-	Metadata  json.RawMessage `json:"metadata"` // JSONB 灵活字段
+	BirthDate *time.Time      `json:"birth_date" audit:"redact"`
+	Metadata  json.RawMessage `json:"metadata" audit:"redact"` // JSONB 灵活字段
+	BedID     *int            `json:"bed_id"`                  // 分配的床位，通过 PUT /health_profiles/:id/bed 修改
+	Bed       string          `json:"bed,omitempty"`           // 床位完整路径，仅查询时返回
 	CreatedAt time.Time       `json:"created_at"`
 	UpdatedAt time.Time       `json:"updated_at"`
 }
@@ -0,0 +1,34 @@
+package models
+
+import (
+	"time"
+)
+
+// 位置层级：楼栋 > 楼层 > 房间 > 床位
+const (
+	LocationKindBuilding = "building"
+	LocationKindFloor    = "floor"
+	LocationKindRoom     = "room"
+	LocationKindBed      = "bed"
+)
+
+// LocationParentKind 各层级位置要求的上级类型，楼栋为顶级（空字符串）；不在表中的类型无效
+var LocationParentKind = map[string]string{
+	LocationKindBuilding: "",
+	LocationKindFloor:    LocationKindBuilding,
+	LocationKindRoom:     LocationKindFloor,
+	LocationKindBed:      LocationKindRoom,
+}
+
+// Location 机构内位置（楼栋/楼层/房间/床位），设备可放置在任意层级，健康档案分配到床位
+// swagger:model Location
+type Location struct {
+	ID        int       `json:"id"`
+	OrgID     int       `json:"org_id"` // 所属组织
+	ParentID  *int      `json:"parent_id"`
+	Kind      string    `json:"kind"` // building / floor / room / bed
+	Name      string    `json:"name"`
+	Path      string    `json:"path"` // 完整路径，如 "1号楼 / 3层 / 301 / 1床"，仅查询时返回
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
@@ -0,0 +1,15 @@
+package models
+
+import (
+	"time"
+)
+
+// Organization 组织（养老机构），多租户隔离边界
+// swagger:model Organization
+type Organization struct {
+	ID        int       `json:"id"`
+	Code      string    `json:"code"` // 唯一编码
+	Name      string    `json:"name"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
@@ -0,0 +1,91 @@
+package models
+
+import (
+	"time"
+)
+
+// FirmwareArtifact 固件文件，按组织与设备类型管理，文件存于本地磁盘并记录 SHA256
+// swagger:model FirmwareArtifact
+type FirmwareArtifact struct {
+	ID         int       `json:"id"`
+	OrgID      int       `json:"org_id"`
+	DeviceType string    `json:"device_type"`
+	Version    string    `json:"version"`
+	FileName   string    `json:"file_name"`
+	FilePath   string    `json:"-"`
+	Size       int64     `json:"size"`
+	SHA256     string    `json:"sha256"`
+	Notes      string    `json:"notes"`
+	CreatedBy  int64     `json:"created_by"`
+	CreatedAt  time.Time `json:"created_at"`
+}
+
+// OTA 升级活动状态
+const (
+	OTACampaignDraft     = "draft"
+	OTACampaignRunning   = "running"
+	OTACampaignPaused    = "paused" // 手动暂停或失败率超过阈值自动暂停
+	OTACampaignCompleted = "completed"
+	OTACampaignCancelled = "cancelled"
+)
+
+// OTA 单台设备升级状态，downloading / installing / succeeded / failed 由设备经 MQTT 上报
+const (
+	OTADevicePending     = "pending" // 已纳入批次，尚未下发
+	OTADeviceSent        = "sent"
+	OTADeviceDownloading = "downloading"
+	OTADeviceInstalling  = "installing"
+	OTADeviceSucceeded   = "succeeded"
+	OTADeviceFailed      = "failed"
+)
+
+// IsOTADeviceReportStatus 是否为设备可上报的升级状态
+func IsOTADeviceReportStatus(status string) bool {
+	switch status {
+	case OTADeviceDownloading, OTADeviceInstalling, OTADeviceSucceeded, OTADeviceFailed:
+		return true
+	}
+	return false
+}
+
+// OTACampaign 固件升级活动：面向指定设备类型、当前固件版本在 from_versions 内（为空则为全部非目标版本）的设备，
+// 按 rollout_percent 分批放量；已完成设备中失败比例达到 failure_threshold_percent（且完成数不少于 min_samples）时自动暂停
+// swagger:model OTACampaign
+type OTACampaign struct {
+	ID                      int               `json:"id"`
+	OrgID                   int               `json:"org_id"`
+	Name                    string            `json:"name"`
+	ArtifactID              int               `json:"artifact_id"`
+	DeviceType              string            `json:"device_type"`
+	TargetVersion           string            `json:"target_version"`
+	FromVersions            []string          `json:"from_versions"`
+	RolloutPercent          int               `json:"rollout_percent"`
+	FailureThresholdPercent int               `json:"failure_threshold_percent"`
+	MinSamples              int               `json:"min_samples"`
+	Status                  string            `json:"status"`
+	PauseReason             string            `json:"pause_reason,omitempty"`
+	CreatedBy               int64             `json:"created_by"`
+	CreatedAt               time.Time         `json:"created_at"`
+	UpdatedAt               time.Time         `json:"updated_at"`
+	Progress                *OTACampaignStats `json:"progress,omitempty"`
+}
+
+// OTACampaignStats 升级活动进度，按设备升级状态计数
+type OTACampaignStats struct {
+	Enrolled int            `json:"enrolled"`
+	ByStatus map[string]int `json:"by_status"`
+}
+
+// OTACampaignDevice 升级活动中单台设备的状态
+// swagger:model OTACampaignDevice
+type OTACampaignDevice struct {
+	CampaignID   int        `json:"campaign_id"`
+	DeviceID     int        `json:"device_id"`
+	SerialNumber string     `json:"serial_number"`
+	FromVersion  string     `json:"from_version"`
+	Status       string     `json:"status"`
+	Progress     int        `json:"progress"`
+	Error        string     `json:"error,omitempty"`
+	SentAt       *time.Time `json:"sent_at"`
+	UpdatedAt    time.Time  `json:"updated_at"`
+}
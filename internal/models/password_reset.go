@@ -0,0 +1,17 @@
+package models
+
+import (
+	"time"
+)
+
+// PasswordResetCode 密码重置验证码，仅保存哈希，单次有效
+type PasswordResetCode struct {
+	ID        int64      `json:"id"`
+	UserType  string     `json:"user_type"` // admin / app
+	UserID    int64      `json:"user_id"`
+	CodeHash  string     `json:"-"`
+	Attempts  int        `json:"attempts"` // 错误尝试次数
+	ExpiresAt time.Time  `json:"expires_at"`
+	UsedAt    *time.Time `json:"used_at"`
+	CreatedAt time.Time  `json:"created_at"`
+}
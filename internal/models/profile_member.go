@@ -0,0 +1,67 @@
+package models
+
+import (
+	"time"
+)
+
+// 档案成员角色：owner 拥有者 / caregiver 照护者（可维护档案）/ viewer 查看者
+const (
+	ProfileRoleOwner     = "owner"
+	ProfileRoleCaregiver = "caregiver"
+	ProfileRoleViewer    = "viewer"
+)
+
+// 档案成员状态
+const (
+	ProfileMemberPending = "pending" // 已凭邀请码申请，待拥有者批准
+	ProfileMemberActive  = "active"
+	ProfileMemberRevoked = "revoked"
+)
+
+// 邀请状态
+const (
+	ProfileInvitationPending  = "pending"
+	ProfileInvitationRedeemed = "redeemed"
+	ProfileInvitationRevoked  = "revoked"
+)
+
+// ProfileRoleRank 角色权限等级，数值越大权限越高；未知角色返回 0
+func ProfileRoleRank(role string) int {
+	switch role {
+	case ProfileRoleOwner:
+		return 3
+	case ProfileRoleCaregiver:
+		return 2
+	case ProfileRoleViewer:
+		return 1
+	}
+	return 0
+}
+
+// ProfileMember 健康档案成员（App 用户与档案的授权关系）
+type ProfileMember struct {
+	ID              int64      `json:"id"`
+	HealthProfileID int        `json:"health_profile_id"`
+	UserID          int64      `json:"user_id"` // app_users(id)
+	Role            string     `json:"role"`
+	Status          string     `json:"status"`
+	InvitationID    *int64     `json:"invitation_id"`
+	ApprovedBy      *int64     `json:"approved_by"`
+	ApprovedAt      *time.Time `json:"approved_at"`
+	RevokedAt       *time.Time `json:"revoked_at"`
+	CreatedAt       time.Time  `json:"created_at"`
+}
+
+// ProfileInvitation 档案共享邀请，邀请码仅保存哈希，单次有效
+type ProfileInvitation struct {
+	ID              int64      `json:"id"`
+	HealthProfileID int        `json:"health_profile_id"`
+	CodeHash        string     `json:"-"`
+	Role            string     `json:"role"`
+	Status          string     `json:"status"`
+	CreatedBy       int64      `json:"created_by"`
+	RedeemedBy      *int64     `json:"redeemed_by"`
+	RedeemedAt      *time.Time `json:"redeemed_at"`
+	ExpiresAt       time.Time  `json:"expires_at"`
+	CreatedAt       time.Time  `json:"created_at"`
+}
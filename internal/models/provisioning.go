@@ -0,0 +1,25 @@
+package models
+
+import (
+	"time"
+)
+
+// PendingDevice 待注册设备：未注册序列号在 MQTT / msgpack 上行时记录，由管理员批准后注册
+// swagger:model PendingDevice
+type PendingDevice struct {
+	SerialNumber string    `json:"serial_number"`
+	Source       string    `json:"source"` // 最近一次上行的接入通道 mqtt / msgpack / http
+	Detail       string    `json:"detail"` // MQTT 为主题类型（如 data/heart_rate），msgpack 为对端地址，http 为 ingest/数据类型
+	FirstSeenAt  time.Time `json:"first_seen_at"`
+	LastSeenAt   time.Time `json:"last_seen_at"`
+	SeenCount    int       `json:"seen_count"` // 记录次数，同一序列号每分钟至多记录一次
+}
+
+// DeviceProvisionResult 批量注册（批准或导入）中单台设备的结果；成功时返回设备ID与密钥（仅此一次）
+type DeviceProvisionResult struct {
+	Line         int    `json:"line,omitempty"` // CSV 导入时的行号
+	SerialNumber string `json:"serial_number"`
+	DeviceID     int    `json:"device_id,omitempty"`
+	DeviceSecret string `json:"device_secret,omitempty"`
+	Error        string `json:"error,omitempty"`
+}
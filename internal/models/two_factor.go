@@ -0,0 +1,31 @@
+package models
+
+import (
+	"time"
+)
+
+// AdminTOTP 管理员 TOTP 两步验证配置
+type AdminTOTP struct {
+	AdminID       int64      `json:"admin_id"`
+	Secret        string     `json:"-"` // 已启用的密钥
+	PendingSecret string     `json:"-"` // 绑定中、尚未验证的密钥
+	Enabled       bool       `json:"enabled"`
+	LastStep      int64      `json:"-"` // 最近一次使用的时间步，防止验证码重放
+	EnabledAt     *time.Time `json:"enabled_at"`
+	UpdatedAt     time.Time  `json:"updated_at"`
+}
+
+// LoginChallenge 密码校验通过后等待两步验证的登录挑战
+type LoginChallenge struct {
+	ID        int64     `json:"id"`
+	TokenHash string    `json:"-"`
+	AdminID   int64     `json:"admin_id"`
+	Attempts  int       `json:"attempts"`
+	ExpiresAt time.Time `json:"expires_at"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// 系统设置键
+const (
+	SettingRequireAdmin2FA = "require_admin_2fa" // 是否强制所有管理员启用两步验证
+)
@@ -2,44 +2,171 @@
 package mqtt
 
 import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
 	"fmt"
+	"os"
+	"strings"
+	"sync"
 	"time"
 
 	mqtt "github.com/eclipse/paho.mqtt.golang"
 )
 
+// 连接状态
+const (
+	StateConnecting   = "connecting"
+	StateConnected    = "connected"
+	StateDisconnected = "disconnected" // 连接丢失，自动重连中
+	StateClosed       = "closed"       // 主动断开
+)
+
+const publishTimeout = 5 * time.Second
+
+// ErrNotConnected 未连接到 Broker
+var ErrNotConnected = errors.New("MQTT 未连接")
+
+// 服务自身在线状态消息（发布到 StatusTopic，retained）
+const (
+	StatusOnline  = "online"
+	StatusOffline = "offline"
+)
+
 // ClientConfig 配置结构体，便于后续扩展
 type ClientConfig struct {
 	Broker   string
 	ClientID string
 	Username string
 	Password string
+	// StatusTopic 服务自身状态主题：连接成功发布 online，连接异常断开时由 Broker 发布遗嘱 offline，
+	// 主动断开前发布 offline；为空则不发布
+	StatusTopic string
+
+	// TLS 选项，仅在 Broker 地址为 ssl:// / tls:// / mqtts:// / wss:// 时生效
+	CAFile             string // 校验 Broker 证书的 CA，为空使用系统根证书
+	CertFile           string // 客户端证书（mTLS），与 KeyFile 同时配置
+	KeyFile            string
+	InsecureSkipVerify bool // 跳过 Broker 证书校验，仅限本地开发
+}
+
+// tlsSchemes paho 以 TLS 连接的 Broker 地址协议
+var tlsSchemes = []string{"ssl://", "tls://", "mqtts://", "wss://"}
+
+// usesTLS Broker 地址是否为 TLS 连接
+func (c ClientConfig) usesTLS() bool {
+	for _, scheme := range tlsSchemes {
+		if strings.HasPrefix(c.Broker, scheme) {
+			return true
+		}
+	}
+	return false
+}
+
+// tlsConfig 按配置构造 TLS 参数；配置了证书但 Broker 地址为明文协议时返回错误，避免误以为已加密
+func (c ClientConfig) tlsConfig() (*tls.Config, error) {
+	configured := c.CAFile != "" || c.CertFile != "" || c.KeyFile != "" || c.InsecureSkipVerify
+	if !c.usesTLS() {
+		if configured {
+			return nil, fmt.Errorf("已配置 TLS 选项，但 Broker 地址 %q 不是 ssl:// / tls:// / mqtts:// / wss://", c.Broker)
+		}
+		return nil, nil
+	}
+	cfg := &tls.Config{MinVersion: tls.VersionTLS12, InsecureSkipVerify: c.InsecureSkipVerify}
+	if c.CAFile != "" {
+		pem, err := os.ReadFile(c.CAFile)
+		if err != nil {
+			return nil, fmt.Errorf("读取 CA 证书失败: %w", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("CA 证书 %s 中没有有效的 PEM 证书", c.CAFile)
+		}
+		cfg.RootCAs = pool
+	}
+	if c.CertFile != "" || c.KeyFile != "" {
+		cert, err := tls.LoadX509KeyPair(c.CertFile, c.KeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("加载客户端证书失败: %w", err)
+		}
+		cfg.Certificates = []tls.Certificate{cert}
+	}
+	return cfg, nil
+}
+
+// Status 连接状态快照，供健康检查使用
+type Status struct {
+	State      string    `json:"state"`
+	Since      time.Time `json:"since"`
+	LastError  string    `json:"last_error,omitempty"`
+	Reconnects int       `json:"reconnects"` // 首次连接后的重连成功次数
+}
+
+// StateHandler 连接状态变化回调，err 为连接丢失原因
+type StateHandler func(state string, err error)
+
+type subscription struct {
+	qos     byte
+	handler mqtt.MessageHandler
 }
 
 // MQTTClient 基础客户端结构体
 type MQTTClient struct {
 	client mqtt.Client
 	config ClientConfig
+
+	mu            sync.Mutex
+	subscriptions map[string]subscription // 已登记的订阅，重连后自动恢复
+	status        Status
+	connectedOnce bool
+	onState       StateHandler
 }
 
-// NewMQTTClient 创建并初始化 MQTTClient
-func NewMQTTClient(cfg ClientConfig) *MQTTClient {
+// NewMQTTClient 创建并初始化 MQTTClient，TLS 配置无效时返回错误
+func NewMQTTClient(cfg ClientConfig) (*MQTTClient, error) {
+	tlsCfg, err := cfg.tlsConfig()
+	if err != nil {
+		return nil, fmt.Errorf("MQTT TLS 配置无效: %w", err)
+	}
+	mc := &MQTTClient{
+		config:        cfg,
+		subscriptions: make(map[string]subscription),
+		status:        Status{State: StateConnecting, Since: time.Now()},
+	}
 	opts := mqtt.NewClientOptions().
 		AddBroker(cfg.Broker).
 		SetClientID(cfg.ClientID).
 		SetUsername(cfg.Username).
 		SetPassword(cfg.Password).
 		SetAutoReconnect(true).
-		SetConnectTimeout(5 * time.Second)
-
-	client := mqtt.NewClient(opts)
-	return &MQTTClient{
-		client: client,
-		config: cfg,
+		SetConnectRetry(true).
+		SetConnectRetryInterval(5 * time.Second).
+		SetMaxReconnectInterval(time.Minute).
+		SetConnectTimeout(5 * time.Second).
+		SetOnConnectHandler(mc.onConnect).
+		SetConnectionLostHandler(mc.onConnectionLost).
+		SetReconnectingHandler(func(mqtt.Client, *mqtt.ClientOptions) {
+			mc.setState(StateConnecting, nil)
+		})
+	if cfg.StatusTopic != "" {
+		opts.SetWill(cfg.StatusTopic, StatusOffline, 1, true)
+	}
+	if tlsCfg != nil {
+		opts.SetTLSConfig(tlsCfg)
 	}
+
+	mc.client = mqtt.NewClient(opts)
+	return mc, nil
+}
+
+// SetStateHandler 设置连接状态变化回调，需在 Connect 前调用；回调在 MQTT 客户端协程中执行，不应阻塞
+func (mc *MQTTClient) SetStateHandler(h StateHandler) {
+	mc.mu.Lock()
+	defer mc.mu.Unlock()
+	mc.onState = h
 }
 
-// Connect 连接到 MQTT Broker
+// Connect 连接到 MQTT Broker；Broker 不可达时持续重试，直到连接成功或 Disconnect
 func (mc *MQTTClient) Connect() error {
 	token := mc.client.Connect()
 	if token.Wait() && token.Error() != nil {
@@ -48,8 +175,14 @@ func (mc *MQTTClient) Connect() error {
 	return nil
 }
 
-// Subscribe 订阅主题
+// Subscribe 订阅主题并登记，重连后自动恢复；尚未连接时仅登记，连接成功后订阅
 func (mc *MQTTClient) Subscribe(topic string, qos byte, handler mqtt.MessageHandler) error {
+	mc.mu.Lock()
+	mc.subscriptions[topic] = subscription{qos: qos, handler: handler}
+	mc.mu.Unlock()
+	if !mc.client.IsConnectionOpen() {
+		return nil
+	}
 	token := mc.client.Subscribe(topic, qos, handler)
 	if token.Wait() && token.Error() != nil {
 		return fmt.Errorf("MQTT subscribe error: %w", token.Error())
@@ -57,16 +190,92 @@ func (mc *MQTTClient) Subscribe(topic string, qos byte, handler mqtt.MessageHand
 	return nil
 }
 
-// Publish 发布消息
+// Publish 发布消息；未连接时直接返回错误，不在重连期间排队等待
 func (mc *MQTTClient) Publish(topic string, qos byte, retained bool, payload interface{}) error {
+	if !mc.client.IsConnectionOpen() {
+		return ErrNotConnected
+	}
 	token := mc.client.Publish(topic, qos, retained, payload)
-	if token.Wait() && token.Error() != nil {
+	if !token.WaitTimeout(publishTimeout) {
+		return fmt.Errorf("MQTT publish error: 等待 Broker 确认超时")
+	}
+	if token.Error() != nil {
 		return fmt.Errorf("MQTT publish error: %w", token.Error())
 	}
 	return nil
 }
 
-// Disconnect 断开连接
+// Status 当前连接状态
+func (mc *MQTTClient) Status() Status {
+	mc.mu.Lock()
+	defer mc.mu.Unlock()
+	return mc.status
+}
+
+// Disconnect 断开连接，断开前发布服务离线状态
 func (mc *MQTTClient) Disconnect(quiesce uint) {
+	if mc.config.StatusTopic != "" && mc.client.IsConnectionOpen() {
+		token := mc.client.Publish(mc.config.StatusTopic, 1, true, StatusOffline)
+		token.WaitTimeout(time.Duration(quiesce) * time.Millisecond)
+	}
 	mc.client.Disconnect(quiesce)
+	mc.setState(StateClosed, nil)
+}
+
+// onConnect 首次连接与每次重连成功后恢复订阅并发布在线状态。
+// 未使用持久会话，Broker 在断线后不保留订阅，须由客户端重新订阅
+func (mc *MQTTClient) onConnect(client mqtt.Client) {
+	mc.mu.Lock()
+	topics := make([]string, 0, len(mc.subscriptions))
+	subs := make([]subscription, 0, len(mc.subscriptions))
+	for topic, s := range mc.subscriptions {
+		topics = append(topics, topic)
+		subs = append(subs, s)
+	}
+	if mc.connectedOnce {
+		mc.status.Reconnects++
+	}
+	mc.connectedOnce = true
+	mc.mu.Unlock()
+
+	// paho 在独立协程中调用 OnConnect，可在此等待订阅结果
+	var errs []error
+	for i, s := range subs {
+		if token := client.Subscribe(topics[i], s.qos, s.handler); token.Wait() && token.Error() != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", topics[i], token.Error()))
+		}
+	}
+	if mc.config.StatusTopic != "" {
+		if token := client.Publish(mc.config.StatusTopic, 1, true, StatusOnline); token.Wait() && token.Error() != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", mc.config.StatusTopic, token.Error()))
+		}
+	}
+	var err error
+	if len(errs) > 0 {
+		err = fmt.Errorf("MQTT resubscribe error: %v", errs)
+	}
+	mc.setState(StateConnected, err)
+}
+
+func (mc *MQTTClient) onConnectionLost(_ mqtt.Client, err error) {
+	mc.setState(StateDisconnected, err)
+}
+
+// setState 更新状态快照并通知回调；状态未变化且无错误时不重复通知
+func (mc *MQTTClient) setState(state string, err error) {
+	mc.mu.Lock()
+	if mc.status.State == state && err == nil {
+		mc.mu.Unlock()
+		return
+	}
+	mc.status.State = state
+	mc.status.Since = time.Now()
+	if err != nil {
+		mc.status.LastError = err.Error()
+	}
+	h := mc.onState
+	mc.mu.Unlock()
+	if h != nil {
+		h(state, err)
+	}
 }
@@ -0,0 +1,233 @@
+// Package msgpack 长连接下行：按设备序列号登记在线连接，经 v2 DATA 帧下发并等待设备 ACK
+//
+// 服务端下行帧与设备上行帧各自维护序号。设备处理下行帧后回复同序号的 ACK，拒绝时回复 NAK（负载为原因码）；
+// 超时未确认时以原序号重发，设备应对近期已处理的序号直接回复 ACK。
+package msgpack
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"time"
+
+	"github.com/vmihailenco/msgpack/v5"
+	"go.uber.org/zap"
+)
+
+const (
+	downlinkAckTimeout = 3 * time.Second // 单次等待设备确认的时长
+	downlinkAttempts   = 3               // 含首次发送在内的最多发送次数
+)
+
+var (
+	// ErrNotConnected 设备当前没有 msgpack 连接
+	ErrNotConnected = errors.New("设备未通过 msgpack 连接")
+	// ErrDownlinkUnsupported 设备连接仅使用 v1 帧，无法确认下行
+	ErrDownlinkUnsupported = errors.New("设备连接未使用 v2 帧，不支持下行")
+	// ErrDownlinkTimeout 重发后仍未收到设备确认
+	ErrDownlinkTimeout = errors.New("设备未确认下行帧")
+)
+
+// DownlinkNakError 设备以 NAK 拒绝下行帧
+type DownlinkNakError struct {
+	Code byte
+}
+
+func (e *DownlinkNakError) Error() string {
+	return fmt.Sprintf("设备拒绝下行帧（原因码 %d）", e.Code)
+}
+
+// ConnectHandler 连接与设备序列号绑定后的回调（认证成功，或未启用认证时首个有效数据帧），在独立协程中执行
+type ConnectHandler func(sn string)
+
+// SetConnectHandler 设置连接绑定回调，需在 Start 前调用，可用于设备上线后补发配置
+func (s *MsgpackServer) SetConnectHandler(h ConnectHandler) {
+	s.onConnect = h
+}
+
+// Connected 设备是否有可下行的连接（已绑定序列号且使用 v2 帧）
+func (s *MsgpackServer) Connected(sn string) bool {
+	s.mu.Lock()
+	sess := s.bySN[sn]
+	s.mu.Unlock()
+	return sess != nil && sess.isV2()
+}
+
+// Send 向设备下发一帧 msgpack map，收到设备 ACK 后返回 nil；
+// 设备 NAK 返回 *DownlinkNakError，多次重发仍未确认返回 ErrDownlinkTimeout，发送期间断开返回 ErrNotConnected
+func (s *MsgpackServer) Send(ctx context.Context, sn string, payload map[string]interface{}) error {
+	s.mu.Lock()
+	sess := s.bySN[sn]
+	s.mu.Unlock()
+	if sess == nil {
+		return ErrNotConnected
+	}
+	if !sess.isV2() {
+		return ErrDownlinkUnsupported
+	}
+	data, err := msgpack.Marshal(payload)
+	if err != nil {
+		return err
+	}
+	if len(data) > math.MaxUint16 {
+		return fmt.Errorf("下行帧负载 %d 字节，超过 %d 字节上限", len(data), math.MaxUint16)
+	}
+	seq, ch, ok := sess.expect()
+	if !ok {
+		return ErrNotConnected
+	}
+	defer sess.forget(seq)
+
+	s.downlinks.Add(1)
+	frame := EncodeFrameV2(FrameData, seq, data)
+	for attempt := 0; attempt < downlinkAttempts; attempt++ {
+		if err := sess.write(frame); err != nil {
+			s.downlinkFailed.Add(1)
+			return fmt.Errorf("%w: %v", ErrNotConnected, err)
+		}
+		timer := time.NewTimer(downlinkAckTimeout)
+		select {
+		case code, open := <-ch:
+			timer.Stop()
+			switch {
+			case !open:
+				s.downlinkFailed.Add(1)
+				return ErrNotConnected
+			case code != 0:
+				s.downlinkFailed.Add(1)
+				return &DownlinkNakError{Code: code}
+			}
+			return nil
+		case <-ctx.Done():
+			timer.Stop()
+			s.downlinkFailed.Add(1)
+			return ctx.Err()
+		case <-timer.C:
+		}
+	}
+	s.downlinkFailed.Add(1)
+	return ErrDownlinkTimeout
+}
+
+// bind 将连接登记为设备的下行连接；同一设备的新连接替换旧连接，
+// 但未认证该序列号的连接不能替换已认证的登记，避免伪造序列号劫持下行
+func (s *MsgpackServer) bind(sess *connSession, sn string) {
+	if sn == "" {
+		return
+	}
+	authed := sess.authedSN == sn
+	s.mu.Lock()
+	if sess.boundSN == sn && sess.boundAuth == authed {
+		s.mu.Unlock()
+		return
+	}
+	if cur := s.bySN[sn]; cur != nil && cur != sess && cur.boundAuth && !authed {
+		s.mu.Unlock()
+		return
+	}
+	if s.bySN[sess.boundSN] == sess {
+		delete(s.bySN, sess.boundSN)
+	}
+	s.bySN[sn] = sess
+	sess.boundAuth = authed
+	s.mu.Unlock()
+	sess.boundSN = sn
+	if s.onConnect != nil {
+		// 回调可能调用 Send，而设备 ACK 由当前连接协程读取，不能同步执行
+		go s.onConnect(sn)
+	}
+}
+
+// unbind 注销连接的下行登记，等待中的下行以 ErrNotConnected 结束
+func (s *MsgpackServer) unbind(sess *connSession) {
+	s.mu.Lock()
+	if s.bySN[sess.boundSN] == sess {
+		delete(s.bySN, sess.boundSN)
+	}
+	s.mu.Unlock()
+	sess.closePending()
+}
+
+// confirm 处理设备对下行帧的 ACK / NAK，未知序号忽略
+func (s *MsgpackServer) confirm(sess *connSession, f *frame) {
+	code := byte(0)
+	if f.kind == FrameNak {
+		code = NakRejected
+		if len(f.payload) > 0 {
+			code = f.payload[0]
+		}
+	}
+	if !sess.resolve(f.seq, code) {
+		zap.L().Debug("Msgpack下行确认未匹配", zap.String("sn", sess.boundSN), zap.Uint16("seq", f.seq))
+	}
+}
+
+// isV2 连接是否收到过 v2 帧
+func (c *connSession) isV2() bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.v2
+}
+
+func (c *connSession) markV2() {
+	c.mu.Lock()
+	c.v2 = true
+	c.mu.Unlock()
+}
+
+// expect 分配下行序号并登记等待确认；连接已关闭时返回 false
+func (c *connSession) expect() (uint16, chan byte, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.closed {
+		return 0, nil, false
+	}
+	if c.pending == nil {
+		c.pending = map[uint16]chan byte{}
+	}
+	seq := c.nextSeq
+	c.nextSeq++
+	ch := make(chan byte, 1)
+	c.pending[seq] = ch
+	return seq, ch, true
+}
+
+// allocSeq 分配不等待确认的下行序号（如认证挑战），与 expect 共用序号空间
+func (c *connSession) allocSeq() uint16 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	seq := c.nextSeq
+	c.nextSeq++
+	return seq
+}
+
+func (c *connSession) forget(seq uint16) {
+	c.mu.Lock()
+	delete(c.pending, seq)
+	c.mu.Unlock()
+}
+
+// resolve 将确认结果交给等待中的 Send，返回序号是否在等待中
+func (c *connSession) resolve(seq uint16, code byte) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	ch, ok := c.pending[seq]
+	if ok {
+		select {
+		case ch <- code:
+		default: // 重发导致的重复确认
+		}
+	}
+	return ok
+}
+
+func (c *connSession) closePending() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.closed = true
+	for seq, ch := range c.pending {
+		close(ch)
+		delete(c.pending, seq)
+	}
+}
@@ -0,0 +1,182 @@
+// Package msgpack 帧格式编解码
+//
+// v1：MAGIC(0xAB 0xCD) | 长度(1) | CRC8(1) | 负载，负载最长 255 字节，服务端不应答。
+//
+// v2：MAGIC2(0xAB 0xCE) | 版本(1)=0x02 | 类型(1) | 序号(2) | 长度(2) | 负载 | CRC16(2)
+// 多字节字段为大端序，负载最长 65535 字节；CRC16 为 CRC-16/CCITT-FALSE（多项式 0x1021，初值 0xFFFF），
+// 覆盖版本字节至负载末尾。设备发送 DATA 帧，序号逐帧递增（65535 后回到 0），服务端对每个 DATA 帧
+// 回复同序号的 ACK（已通过校验并由业务处理函数处理完毕）或 NAK（负载为 1 字节原因码）；设备未收到 ACK 时可用原序号重发，
+// 服务端对同一连接内近期已处理的序号直接回复 ACK，不重复处理。服务端下行帧的确认方式相同，见 downlink.go。
+package msgpack
+
+import (
+	"bytes"
+	"encoding/binary"
+)
+
+// MAGIC2 v2 帧头
+const MAGIC2 = "\xab\xce"
+
+// FrameVersion2 v2 帧版本号
+const FrameVersion2 byte = 0x02
+
+// v2 帧类型
+const (
+	FrameData byte = 0x01 // 数据帧：设备上行（含认证帧）或服务端下行
+	FrameAck  byte = 0x02 // 接收方确认
+	FrameNak  byte = 0x03 // 接收方拒绝，负载为原因码
+)
+
+// NAK 原因码
+const (
+	NakCRC          byte = iota + 1 // CRC 校验失败
+	NakDecode                       // 负载不是合法的 msgpack map
+	NakUnauthorized                 // 未认证、认证失败或与认证序列号不一致
+	NakRejected                     // 业务层拒绝（如缺少 sn、不符合设备类型定义）
+	NakUnsupported                  // 不支持的版本或帧类型
+)
+
+const (
+	v1HeaderLen = 4
+	v2HeaderLen = 8
+	v2CRCLen    = 2
+)
+
+// frame 解析出的一帧
+type frame struct {
+	version byte
+	kind    byte
+	seq     uint16
+	payload []byte
+}
+
+// parseResult 帧解析结果：consumed 为 0 表示数据不足需继续读取；frame 为 nil 时丢弃 consumed 字节，
+// nak 非 0 时应以 seq 回复 NAK
+type parseResult struct {
+	frame    *frame
+	consumed int
+	nak      byte
+	seq      uint16
+}
+
+// parseFrame 从缓冲区头部解析下一帧，跳过帧头之前的无效字节
+func parseFrame(buf []byte) parseResult {
+	idx := indexMagic(buf)
+	if idx < 0 {
+		// 末尾可能是被拆开的帧头首字节，保留到下次读取
+		if n := len(buf); n > 0 && buf[n-1] == MAGIC[0] {
+			return parseResult{consumed: n - 1}
+		}
+		return parseResult{consumed: len(buf)}
+	}
+	if idx > 0 {
+		return parseResult{consumed: idx}
+	}
+	if bytes.HasPrefix(buf, []byte(MAGIC)) {
+		return parseV1(buf)
+	}
+	return parseV2(buf)
+}
+
+// indexMagic 查找最早出现的 v1 或 v2 帧头
+func indexMagic(buf []byte) int {
+	i1 := bytes.Index(buf, []byte(MAGIC))
+	i2 := bytes.Index(buf, []byte(MAGIC2))
+	switch {
+	case i1 < 0:
+		return i2
+	case i2 < 0 || i1 < i2:
+		return i1
+	}
+	return i2
+}
+
+func parseV1(buf []byte) parseResult {
+	if len(buf) < v1HeaderLen {
+		return parseResult{}
+	}
+	length := int(buf[2])
+	if length < 1 {
+		return parseResult{consumed: v1HeaderLen}
+	}
+	total := v1HeaderLen + length
+	if len(buf) < total {
+		return parseResult{}
+	}
+	data := buf[v1HeaderLen:total]
+	if crc8(data) != buf[3] {
+		// 长度字段可能已损坏，仅跳过帧头后重新查找，避免吞掉紧随其后的有效帧
+		return parseResult{consumed: len(MAGIC)}
+	}
+	return parseResult{frame: &frame{version: 1, kind: FrameData, payload: data}, consumed: total}
+}
+
+func parseV2(buf []byte) parseResult {
+	if len(buf) < v2HeaderLen {
+		return parseResult{}
+	}
+	if buf[2] != FrameVersion2 {
+		// 版本字节无效时仅跳过帧头，长度字段不可信
+		return parseResult{consumed: len(MAGIC2)}
+	}
+	kind := buf[3]
+	seq := binary.BigEndian.Uint16(buf[4:6])
+	length := int(binary.BigEndian.Uint16(buf[6:8]))
+	total := v2HeaderLen + length + v2CRCLen
+	if len(buf) < total {
+		return parseResult{}
+	}
+	if crc16(buf[2:v2HeaderLen+length]) != binary.BigEndian.Uint16(buf[total-v2CRCLen:total]) {
+		// 长度字段可能已损坏，仅跳过帧头后重新查找，避免吞掉紧随其后的有效帧
+		return parseResult{consumed: len(MAGIC2), nak: NakCRC, seq: seq}
+	}
+	if kind != FrameData && kind != FrameAck && kind != FrameNak {
+		return parseResult{consumed: total, nak: NakUnsupported, seq: seq}
+	}
+	payload := buf[v2HeaderLen : v2HeaderLen+length]
+	return parseResult{frame: &frame{version: FrameVersion2, kind: kind, seq: seq, payload: payload}, consumed: total}
+}
+
+// EncodeFrameV2 编码 v2 帧，负载不能超过 65535 字节，由调用方保证
+func EncodeFrameV2(kind byte, seq uint16, payload []byte) []byte {
+	out := make([]byte, v2HeaderLen, v2HeaderLen+len(payload)+v2CRCLen)
+	copy(out, MAGIC2)
+	out[2] = FrameVersion2
+	out[3] = kind
+	binary.BigEndian.PutUint16(out[4:6], seq)
+	binary.BigEndian.PutUint16(out[6:8], uint16(len(payload)))
+	out = append(out, payload...)
+	return binary.BigEndian.AppendUint16(out, crc16(out[2:]))
+}
+
+// crc8 v1 帧校验（多项式 0x31）
+func crc8(data []byte) byte {
+	var crc byte = 0
+	for _, b := range data {
+		crc ^= b
+		for i := 0; i < 8; i++ {
+			if crc&0x80 != 0 {
+				crc = (crc << 1) ^ 0x31
+			} else {
+				crc <<= 1
+			}
+		}
+	}
+	return crc
+}
+
+// crc16 v2 帧校验，CRC-16/CCITT-FALSE
+func crc16(data []byte) uint16 {
+	crc := uint16(0xFFFF)
+	for _, b := range data {
+		crc ^= uint16(b) << 8
+		for i := 0; i < 8; i++ {
+			if crc&0x8000 != 0 {
+				crc = (crc << 1) ^ 0x1021
+			} else {
+				crc <<= 1
+			}
+		}
+	}
+	return crc
+}
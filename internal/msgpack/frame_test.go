@@ -0,0 +1,197 @@
+package msgpack
+
+import (
+	"bytes"
+	"testing"
+)
+
+// encodeFrameV1 测试用 v1 帧编码
+func encodeFrameV1(payload []byte) []byte {
+	out := append([]byte(MAGIC), byte(len(payload)), crc8(payload))
+	return append(out, payload...)
+}
+
+// parseAll 依次解析缓冲区内的全部帧，返回帧与 NAK 原因码，直到数据不足
+func parseAll(t *testing.T, buf []byte) ([]*frame, []byte) {
+	t.Helper()
+	var frames []*frame
+	var naks []byte
+	for len(buf) > 0 {
+		res := parseFrame(buf)
+		if res.consumed == 0 {
+			break
+		}
+		buf = buf[res.consumed:]
+		if res.nak != 0 {
+			naks = append(naks, res.nak)
+		}
+		if res.frame != nil {
+			frames = append(frames, res.frame)
+		}
+	}
+	return frames, naks
+}
+
+func TestCRC16(t *testing.T) {
+	tests := []struct {
+		data string
+		want uint16
+	}{
+		{data: "", want: 0xFFFF},
+		{data: "123456789", want: 0x29B1}, // CRC-16/CCITT-FALSE 标准校验值
+		{data: "A", want: 0xB915},
+	}
+	for _, tt := range tests {
+		if got := crc16([]byte(tt.data)); got != tt.want {
+			t.Errorf("crc16(%q) = %#04x, want %#04x", tt.data, got, tt.want)
+		}
+	}
+}
+
+func TestCRC8(t *testing.T) {
+	if got := crc8([]byte("123456789")); got != 0xA2 {
+		t.Fatalf("crc8 = %#02x, want 0xa2", got)
+	}
+}
+
+func TestParseFrameV2RoundTrip(t *testing.T) {
+	payload := []byte{0x81, 0xa2, 's', 'n', 0xa3, 'a', 'b', 'c'}
+	buf := EncodeFrameV2(FrameData, 513, payload)
+	res := parseFrame(buf)
+	if res.frame == nil || res.consumed != len(buf) {
+		t.Fatalf("parseFrame = %+v, want one frame of %d bytes", res, len(buf))
+	}
+	if res.frame.version != FrameVersion2 || res.frame.kind != FrameData || res.frame.seq != 513 ||
+		!bytes.Equal(res.frame.payload, payload) {
+		t.Fatalf("frame = %+v", res.frame)
+	}
+}
+
+func TestParseFrameIncomplete(t *testing.T) {
+	full := EncodeFrameV2(FrameData, 1, []byte("payload"))
+	for n := 1; n < len(full); n++ {
+		if res := parseFrame(full[:n]); res.consumed != 0 || res.frame != nil {
+			t.Fatalf("前 %d 字节: %+v, want 等待更多数据", n, res)
+		}
+	}
+	v1 := encodeFrameV1([]byte("payload"))
+	if res := parseFrame(v1[:len(v1)-1]); res.consumed != 0 {
+		t.Fatalf("不完整 v1 帧: %+v, want 等待更多数据", res)
+	}
+}
+
+func TestParseFrameSkipsGarbage(t *testing.T) {
+	good := EncodeFrameV2(FrameData, 7, []byte("x"))
+	buf := append([]byte{0x00, 0x11, 0xab, 0x22}, good...)
+	frames, naks := parseAll(t, buf)
+	if len(frames) != 1 || frames[0].seq != 7 || len(naks) != 0 {
+		t.Fatalf("frames = %d, naks = %v", len(frames), naks)
+	}
+	// 末尾的帧头首字节保留，等待后续数据
+	if res := parseFrame([]byte{0x00, 0x01, 0xab}); res.consumed != 2 {
+		t.Fatalf("consumed = %d, want 2", res.consumed)
+	}
+}
+
+// CRC 错误的帧仅跳过帧头，其长度字段覆盖的后续有效帧仍能被解析
+func TestParseFrameResyncAfterCRCError(t *testing.T) {
+	tests := []struct {
+		name    string
+		corrupt []byte
+		naks    int
+	}{
+		{
+			name: "v2 长度字段损坏",
+			corrupt: func() []byte {
+				b := EncodeFrameV2(FrameData, 1, []byte("abc"))
+				b[7] = 0x20 // 声明 32 字节负载，覆盖后续帧
+				return b
+			}(),
+			naks: 1,
+		},
+		{
+			name: "v2 负载损坏",
+			corrupt: func() []byte {
+				b := EncodeFrameV2(FrameData, 1, []byte("abc"))
+				b[v2HeaderLen] ^= 0xff
+				return b
+			}(),
+			naks: 1,
+		},
+		{
+			name: "v1 长度字段损坏",
+			corrupt: func() []byte {
+				b := encodeFrameV1([]byte("abc"))
+				b[2] = 0x20
+				return b
+			}(),
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			buf := append(append([]byte{}, tt.corrupt...), EncodeFrameV2(FrameData, 2, []byte("next"))...)
+			buf = append(buf, encodeFrameV1([]byte("v1"))...)
+			buf = append(buf, EncodeFrameV2(FrameData, 3, []byte("last"))...)
+			frames, naks := parseAll(t, buf)
+			if len(naks) != tt.naks || (tt.naks > 0 && naks[0] != NakCRC) {
+				t.Fatalf("naks = %v, want %d 个 NakCRC", naks, tt.naks)
+			}
+			var got []string
+			for _, f := range frames {
+				got = append(got, string(f.payload))
+			}
+			if len(got) != 3 || got[0] != "next" || got[1] != "v1" || got[2] != "last" {
+				t.Fatalf("payloads = %q, want [next v1 last]", got)
+			}
+		})
+	}
+}
+
+func TestParseFrameMixedVersions(t *testing.T) {
+	var buf []byte
+	buf = append(buf, encodeFrameV1([]byte("a"))...)
+	buf = append(buf, EncodeFrameV2(FrameData, 10, []byte("b"))...)
+	buf = append(buf, EncodeFrameV2(FrameAck, 11, nil)...)
+	buf = append(buf, encodeFrameV1([]byte("c"))...)
+	buf = append(buf, EncodeFrameV2(FrameNak, 12, []byte{NakRejected})...)
+
+	frames, naks := parseAll(t, buf)
+	if len(naks) != 0 {
+		t.Fatalf("naks = %v", naks)
+	}
+	want := []struct {
+		version byte
+		kind    byte
+		seq     uint16
+		payload string
+	}{
+		{1, FrameData, 0, "a"},
+		{FrameVersion2, FrameData, 10, "b"},
+		{FrameVersion2, FrameAck, 11, ""},
+		{1, FrameData, 0, "c"},
+		{FrameVersion2, FrameNak, 12, string([]byte{NakRejected})},
+	}
+	if len(frames) != len(want) {
+		t.Fatalf("frames = %d, want %d", len(frames), len(want))
+	}
+	for i, w := range want {
+		f := frames[i]
+		if f.version != w.version || f.kind != w.kind || f.seq != w.seq || string(f.payload) != w.payload {
+			t.Errorf("frame %d = %+v, want %+v", i, f, w)
+		}
+	}
+}
+
+func TestParseFrameV2Rejects(t *testing.T) {
+	unsupported := EncodeFrameV2(0x09, 4, []byte("x"))
+	res := parseFrame(unsupported)
+	if res.frame != nil || res.nak != NakUnsupported || res.seq != 4 || res.consumed != len(unsupported) {
+		t.Fatalf("不支持的帧类型: %+v", res)
+	}
+	badVersion := EncodeFrameV2(FrameData, 5, []byte("x"))
+	badVersion[2] = 0x03
+	res = parseFrame(badVersion)
+	if res.frame != nil || res.nak != 0 || res.consumed != len(MAGIC2) {
+		t.Fatalf("无效版本: %+v", res)
+	}
+}
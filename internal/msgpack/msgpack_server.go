@@ -2,10 +2,16 @@
 package msgpack
 
 import (
-	"bytes"
+	"context"
+	"crypto/rand"
+	"crypto/tls"
+	"encoding/hex"
+	"errors"
 	"fmt"
 	"io"
 	"net"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/vmihailenco/msgpack/v5"
@@ -18,100 +24,590 @@ const (
 	MAGIC   = "\xab\xcd"
 )
 
-// CRC 校验
-func crc8(data []byte) byte {
-	var crc byte = 0
-	for _, b := range data {
-		crc ^= b
-		for i := 0; i < 8; i++ {
-			if crc&0x80 != 0 {
-				crc = (crc << 1) ^ 0x31
-			} else {
-				crc <<= 1
-			}
-		}
+const (
+	replyWriteTimeout = 5 * time.Second
+	recentSeqWindow   = 16 // 每个连接记住的近期已处理序号数，用于识别重发
+	readChunkSize     = 4096
+	acceptRetryDelay  = time.Second
+)
+
+// 连接限制默认值
+const (
+	DefaultMaxConnections      = 1000
+	DefaultMaxConnectionsPerIP = 50
+	DefaultIdleTimeout         = 5 * time.Minute
+	DefaultMaxBufferBytes      = 128 * 1024
+	DefaultDrainTimeout        = 10 * time.Second
+)
+
+// Limits 连接限制，零值字段使用默认值
+type Limits struct {
+	MaxConnections      int           // 最大并发连接数
+	MaxConnectionsPerIP int           // 单个对端 IP 最大并发连接数
+	IdleTimeout         time.Duration // 连接空闲超时，期间未收到任何数据即断开
+	MaxBufferBytes      int           // 单连接未解析数据上限，超过即断开；小于 v2 最大帧长时大帧无法接收
+	DrainTimeout        time.Duration // 关闭时等待连接处理完已收数据的最长时间
+}
+
+func (l Limits) withDefaults() Limits {
+	if l.MaxConnections <= 0 {
+		l.MaxConnections = DefaultMaxConnections
+	}
+	if l.MaxConnectionsPerIP <= 0 {
+		l.MaxConnectionsPerIP = DefaultMaxConnectionsPerIP
+	}
+	if l.IdleTimeout <= 0 {
+		l.IdleTimeout = DefaultIdleTimeout
+	}
+	if l.MaxBufferBytes <= 0 {
+		l.MaxBufferBytes = DefaultMaxBufferBytes
 	}
-	return crc
+	if l.DrainTimeout <= 0 {
+		l.DrainTimeout = DefaultDrainTimeout
+	}
+	return l
+}
+
+// Stats 连接统计快照，供健康检查使用
+type Stats struct {
+	Listening  bool  `json:"listening"`
+	TLS        bool  `json:"tls"`
+	Active     int   `json:"active"`      // 当前连接数
+	Accepted   int64 `json:"accepted"`    // 累计接受的连接数
+	Rejected   int64 `json:"rejected"`    // 超过连接数限制被拒绝的连接数
+	IdleClosed int64 `json:"idle_closed"` // 空闲超时断开的连接数
+	Oversized  int64 `json:"oversized"`   // 未解析数据超过上限被断开的连接数
+	Frames     int64 `json:"frames"`      // 累计收到的有效帧数
+	Naks       int64 `json:"naks"`        // 累计回复的 NAK 数
+	TLSFailed  int64 `json:"tls_failed"`  // TLS 握手失败（含客户端证书无效）的连接数
+	Devices    int   `json:"devices"`     // 已绑定设备序列号的连接数
+	Downlinks  int64 `json:"downlinks"`   // 累计下行帧数
+	DownFailed int64 `json:"down_failed"` // 设备拒绝、未确认或发送中断开的下行帧数
+}
+
+// PayloadHandler 业务处理回调，返回错误时 v2 帧回复 NAK（NakRejected）
+type PayloadHandler func(payload map[string]interface{}) error
+
+// Authenticator 设备认证接口，由业务层实现
+//
+// 连接建立后服务端先下发 v2 挑战帧 {"type":"challenge","nonce":..}，设备发送认证帧
+// {"type":"auth","sn":..,"ts":..,"nonce":..,"sig":..}，签名覆盖该连接的 nonce，认证帧无法在其他连接上重放；
+// 认证通过后该连接只接受同一 sn 的数据帧。启用客户端证书时，证书 CN 须经 VerifyCertificate 确认为已注册且启用的设备。
+type Authenticator interface {
+	Required() bool
+	VerifyHandshake(sn string, ts int64, nonce, sig string) error
+	VerifyCertificate(sn string) error
+	CountRejected(source, sn string, err error)
 }
 
-// PayloadHandler 业务处理回调
-type PayloadHandler func(payload map[string]interface{})
+// Observer 设备上行观察回调，收到携带 sn 的帧（含认证帧）时在认证前调用，用于登记未注册设备
+type Observer func(sn, remoteAddr string)
+
+var (
+	errNotAuthenticated = errors.New("连接未认证")
+	errSNMismatch       = errors.New("数据帧序列号与认证序列号不一致")
+	errNonceMismatch    = errors.New("认证帧 nonce 与连接挑战不一致")
+)
 
 // MsgpackServer 结构体
 type MsgpackServer struct {
-	handler PayloadHandler
-	port    int
+	handler   PayloadHandler
+	port      int
+	auth      Authenticator
+	observer  Observer
+	onConnect ConnectHandler
+	limits    Limits
+	tls       *tls.Config
+
+	mu      sync.Mutex
+	ln      net.Listener
+	conns   map[*connSession]struct{}
+	perIP   map[string]int
+	bySN    map[string]*connSession // 设备序列号 -> 下行连接
+	closing bool
+	wg      sync.WaitGroup
+
+	accepted, rejected, idleClosed, oversized, frames, naks, tlsFailed atomic.Int64
+	downlinks, downlinkFailed                                          atomic.Int64
 }
 
 // NewMsgpackServer 构造
 func NewMsgpackServer(handler PayloadHandler, port int) *MsgpackServer {
-	return &MsgpackServer{handler: handler, port: port}
+	return &MsgpackServer{
+		handler: handler,
+		port:    port,
+		limits:  Limits{}.withDefaults(),
+		conns:   map[*connSession]struct{}{},
+		perIP:   map[string]int{},
+		bySN:    map[string]*connSession{},
+	}
+}
+
+// SetLimits 设置连接限制，需在 Start 前调用
+func (s *MsgpackServer) SetLimits(limits Limits) {
+	s.limits = limits.withDefaults()
 }
 
-// Start 启动监听
-func (s *MsgpackServer) Start() error {
+// SetAuthenticator 设置设备认证器，需在 Start 前调用
+func (s *MsgpackServer) SetAuthenticator(auth Authenticator) {
+	s.auth = auth
+}
+
+// SetObserver 设置设备上行观察回调，需在 Start 前调用
+func (s *MsgpackServer) SetObserver(observer Observer) {
+	s.observer = observer
+}
+
+// SetTLS 启用 TLS 监听，需在 Start 前调用；校验通过的客户端证书 CN 视为已认证的设备序列号
+func (s *MsgpackServer) SetTLS(cfg *tls.Config) {
+	s.tls = cfg
+}
+
+// Start 开始监听并在后台接受连接，端口不可用时返回错误；ctx 取消后停止接受新连接并按 Shutdown 排空现有连接
+func (s *MsgpackServer) Start(ctx context.Context) error {
 	ln, err := net.Listen("tcp", fmt.Sprintf("0.0.0.0:%d", s.port))
 	if err != nil {
 		return err
 	}
+	if s.tls != nil {
+		ln = tls.NewListener(ln, s.tls)
+	}
+	s.mu.Lock()
+	if s.closing {
+		s.mu.Unlock()
+		ln.Close()
+		return errors.New("Msgpack服务器已关闭")
+	}
+	s.ln = ln
+	s.mu.Unlock()
+
+	go s.acceptLoop(ctx, ln)
+	go func() {
+		<-ctx.Done()
+		_ = s.Shutdown(context.Background())
+	}()
+	return nil
+}
+
+// acceptLoop 接受连接，超过连接数限制的连接立即关闭
+func (s *MsgpackServer) acceptLoop(ctx context.Context, ln net.Listener) {
 	for {
 		conn, err := ln.Accept()
 		if err != nil {
-			time.Sleep(time.Second)
+			if s.isClosing() {
+				return
+			}
+			zap.L().Warn("Msgpack接受连接失败", zap.Error(err))
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(acceptRetryDelay):
+			}
 			continue
 		}
-		go s.handleConn(conn)
+		sess := &connSession{conn: conn, remoteAddr: conn.RemoteAddr().String()}
+		if !s.admit(sess) {
+			conn.Close()
+			continue
+		}
+		go s.handleConn(sess)
 	}
 }
 
-// handleConn 处理单连接
-func (s *MsgpackServer) handleConn(conn net.Conn) {
-	defer conn.Close()
-	buffer := make([]byte, 0)
-	tmp := make([]byte, 1024)
-	for {
-		n, err := conn.Read(tmp)
+// Shutdown 停止接受新连接，通知现有连接处理完已收到的数据后断开；
+// 等待全部连接结束，超过 DrainTimeout 或 ctx 取消时强制关闭剩余连接。可重复调用
+func (s *MsgpackServer) Shutdown(ctx context.Context) error {
+	s.mu.Lock()
+	s.closing = true
+	if s.ln != nil {
+		s.ln.Close()
+		s.ln = nil
+	}
+	for sess := range s.conns {
+		// 中断阻塞中的读取，handleConn 在处理完缓冲区后退出
+		_ = sess.conn.SetReadDeadline(time.Now())
+	}
+	s.mu.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		s.wg.Wait()
+		close(done)
+	}()
+	timer := time.NewTimer(s.limits.DrainTimeout)
+	defer timer.Stop()
+	var err error
+	select {
+	case <-done:
+		return nil
+	case <-timer.C:
+		err = errors.New("Msgpack连接排空超时")
+	case <-ctx.Done():
+		err = ctx.Err()
+	}
+	s.mu.Lock()
+	remaining := len(s.conns)
+	for sess := range s.conns {
+		sess.conn.Close()
+	}
+	s.mu.Unlock()
+	zap.L().Warn("Msgpack连接未在限期内处理完毕，已强制关闭", zap.Int("connections", remaining))
+	return err
+}
+
+// Stats 返回连接统计快照
+func (s *MsgpackServer) Stats() Stats {
+	s.mu.Lock()
+	listening, active, devices := s.ln != nil, len(s.conns), len(s.bySN)
+	s.mu.Unlock()
+	return Stats{
+		Listening:  listening,
+		TLS:        s.tls != nil,
+		Active:     active,
+		Accepted:   s.accepted.Load(),
+		Rejected:   s.rejected.Load(),
+		IdleClosed: s.idleClosed.Load(),
+		Oversized:  s.oversized.Load(),
+		Frames:     s.frames.Load(),
+		Naks:       s.naks.Load(),
+		TLSFailed:  s.tlsFailed.Load(),
+		Devices:    devices,
+		Downlinks:  s.downlinks.Load(),
+		DownFailed: s.downlinkFailed.Load(),
+	}
+}
+
+func (s *MsgpackServer) isClosing() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.closing
+}
+
+// admit 登记新连接，关闭中或超过总连接数、单 IP 连接数限制时返回 false
+func (s *MsgpackServer) admit(sess *connSession) bool {
+	sess.ip = remoteIP(sess.conn.RemoteAddr())
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closing {
+		return false
+	}
+	if len(s.conns) >= s.limits.MaxConnections || s.perIP[sess.ip] >= s.limits.MaxConnectionsPerIP {
+		s.rejected.Add(1)
+		zap.L().Warn("Msgpack连接数超过限制，拒绝连接",
+			zap.String("remote", sess.remoteAddr), zap.Int("active", len(s.conns)), zap.Int("ip_active", s.perIP[sess.ip]))
+		return false
+	}
+	s.conns[sess] = struct{}{}
+	s.perIP[sess.ip]++
+	s.accepted.Add(1)
+	s.wg.Add(1)
+	return true
+}
+
+// release 注销连接
+func (s *MsgpackServer) release(sess *connSession) {
+	s.mu.Lock()
+	delete(s.conns, sess)
+	if s.perIP[sess.ip]--; s.perIP[sess.ip] <= 0 {
+		delete(s.perIP, sess.ip)
+	}
+	s.mu.Unlock()
+	s.wg.Done()
+}
+
+// armReadDeadline 为下一次读取设置空闲超时；关闭中返回 false。与 Shutdown 共用锁，避免覆盖其中断读取的截止时间
+func (s *MsgpackServer) armReadDeadline(sess *connSession) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closing {
+		return false
+	}
+	_ = sess.conn.SetReadDeadline(time.Now().Add(s.limits.IdleTimeout))
+	return true
+}
+
+func remoteIP(addr net.Addr) string {
+	if tcp, ok := addr.(*net.TCPAddr); ok {
+		return tcp.IP.String()
+	}
+	host, _, err := net.SplitHostPort(addr.String())
+	if err != nil {
+		return addr.String()
+	}
+	return host
+}
+
+// connSession 单连接状态
+type connSession struct {
+	conn       net.Conn
+	remoteAddr string
+	ip         string
+	authedSN   string // 已通过认证的设备序列号
+	certSN     string // 客户端证书 CN，非空时连接已由证书认证
+	nonce      string // 下发的认证挑战，认证成功后清空，每个连接只能认证一次
+	boundSN    string // 登记为下行连接的设备序列号
+	boundAuth  bool   // 登记时连接已认证该序列号，由 MsgpackServer.mu 保护
+	recent     [recentSeqWindow]uint16
+	recentN    int // 已记录的序号总数
+
+	writeMu sync.Mutex // 应答与下行帧共用连接写入
+
+	mu      sync.Mutex // 保护以下下行状态
+	v2      bool
+	closed  bool
+	nextSeq uint16
+	pending map[uint16]chan byte // 等待设备确认的下行序号
+}
+
+// seen 序号是否为近期已处理的帧（设备未收到 ACK 后的重发）
+func (c *connSession) seen(seq uint16) bool {
+	n := c.recentN
+	if n > recentSeqWindow {
+		n = recentSeqWindow
+	}
+	for i := 0; i < n; i++ {
+		if c.recent[i] == seq {
+			return true
+		}
+	}
+	return false
+}
+
+func (c *connSession) remember(seq uint16) {
+	c.recent[c.recentN%recentSeqWindow] = seq
+	c.recentN++
+}
+
+// write 写入一帧，应答与下行帧串行写入
+func (c *connSession) write(b []byte) error {
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+	_ = c.conn.SetWriteDeadline(time.Now().Add(replyWriteTimeout))
+	_, err := c.conn.Write(b)
+	return err
+}
+
+// reply 回复 v2 ACK / NAK，写入失败时由读取侧发现连接断开
+func (s *MsgpackServer) reply(sess *connSession, kind byte, seq uint16, reason byte) {
+	var payload []byte
+	if kind == FrameNak {
+		payload = []byte{reason}
+		s.naks.Add(1)
+	}
+	if err := sess.write(EncodeFrameV2(kind, seq, payload)); err != nil {
+		zap.L().Debug("Msgpack应答发送失败", zap.String("remote", sess.remoteAddr), zap.Error(err))
+	}
+}
+
+// handleConn 处理单连接，同一连接可混用 v1 与 v2 帧。
+// 空闲超时、未解析数据超过上限或服务关闭时断开；关闭时先处理完已读取的数据
+func (s *MsgpackServer) handleConn(sess *connSession) {
+	defer s.release(sess)
+	defer sess.conn.Close()
+	defer s.unbind(sess)
+	certSN, err := handshake(sess)
+	if err != nil {
+		s.tlsFailed.Add(1)
+		zap.L().Warn("Msgpack TLS握手失败", zap.String("remote", sess.remoteAddr), zap.Error(err))
+		return
+	}
+	if certSN != "" && s.auth != nil {
+		// 证书只证明由设备 CA 签发，设备是否仍注册且启用以设备表为准
+		if err := s.auth.VerifyCertificate(certSN); err != nil {
+			zap.L().Warn("Msgpack客户端证书对应设备不可用，已断开", zap.String("remote", sess.remoteAddr),
+				zap.String("sn", certSN), zap.Error(err))
+			return
+		}
+	}
+	sess.certSN, sess.authedSN = certSN, certSN
+	s.bind(sess, certSN)
+	if s.auth != nil && certSN == "" {
+		if err := s.challenge(sess); err != nil {
+			zap.L().Debug("Msgpack认证挑战发送失败", zap.String("remote", sess.remoteAddr), zap.Error(err))
+			return
+		}
+	}
+	buffer := make([]byte, 0, readChunkSize)
+	tmp := make([]byte, readChunkSize)
+	for s.armReadDeadline(sess) {
+		n, err := sess.conn.Read(tmp)
 		if err != nil {
-			if err != io.EOF {
+			var netErr net.Error
+			switch {
+			case err == io.EOF, s.isClosing():
+			case errors.As(err, &netErr) && netErr.Timeout():
+				s.idleClosed.Add(1)
+				zap.L().Info("Msgpack连接空闲超时，已断开", zap.String("remote", sess.remoteAddr))
+			default:
 				zap.L().Error("TCP连接读取异常", zap.Error(err))
 			}
-			break
+			return
 		}
 		buffer = append(buffer, tmp[:n]...)
-		for len(buffer) >= 4 {
-			if !bytes.HasPrefix(buffer, []byte(MAGIC)) {
-				idx := bytes.Index(buffer, []byte(MAGIC))
-				if idx == -1 {
-					buffer = buffer[:0]
-					break
-				}
-				buffer = buffer[idx:]
-				if len(buffer) < 4 {
-					break
-				}
-			}
-			length := buffer[2]
-			crcVal := buffer[3]
-			if length < 1 {
-				buffer = buffer[4:]
-				continue
-			}
-			if len(buffer) < int(4+length) {
+		for len(buffer) > 0 {
+			res := parseFrame(buffer)
+			if res.consumed == 0 {
 				break
 			}
-			data := buffer[4 : 4+length]
-			if crc8(data) != crcVal {
-				buffer = buffer[4+length:]
+			buffer = buffer[res.consumed:]
+			if res.frame == nil {
+				if res.nak != 0 {
+					s.reply(sess, FrameNak, res.seq, res.nak)
+				}
 				continue
 			}
-			// 业务解包交由 handler
-			if s.handler != nil {
-				var unpacked map[string]interface{}
-				if err := msgpack.Unmarshal(data, &unpacked); err == nil {
-					s.handler(unpacked)
+			if !s.handleFrame(sess, res.frame) {
+				return
+			}
+		}
+		if len(buffer) > s.limits.MaxBufferBytes {
+			s.oversized.Add(1)
+			zap.L().Warn("Msgpack连接未解析数据超过上限，已断开",
+				zap.String("remote", sess.remoteAddr), zap.Int("bytes", len(buffer)))
+			return
+		}
+		// 剩余数据移到缓冲区头部，避免底层数组随连接时长增长
+		buffer = append(buffer[:0], buffer...)
+	}
+}
+
+// handleFrame 解包并处理一帧，v2 帧回复 ACK / NAK；返回 false 表示应断开连接
+func (s *MsgpackServer) handleFrame(sess *connSession, f *frame) bool {
+	s.frames.Add(1)
+	v2 := f.version == FrameVersion2
+	if v2 {
+		sess.markV2()
+		if f.kind == FrameAck || f.kind == FrameNak {
+			s.confirm(sess, f)
+			return true
+		}
+	}
+	var unpacked map[string]interface{}
+	if err := msgpack.Unmarshal(f.payload, &unpacked); err != nil || unpacked == nil {
+		if v2 {
+			s.reply(sess, FrameNak, f.seq, NakDecode)
+		}
+		return true
+	}
+	if v2 && sess.seen(f.seq) {
+		s.reply(sess, FrameAck, f.seq, 0)
+		return true
+	}
+	nak, keep := s.dispatch(sess, unpacked)
+	if v2 {
+		if nak == 0 {
+			sess.remember(f.seq)
+			s.reply(sess, FrameAck, f.seq, 0)
+		} else {
+			s.reply(sess, FrameNak, f.seq, nak)
+		}
+	}
+	return keep
+}
+
+// dispatch 处理认证帧或数据帧，返回 NAK 原因码（0 表示已处理）及是否保持连接
+func (s *MsgpackServer) dispatch(sess *connSession, payload map[string]interface{}) (byte, bool) {
+	sn, _ := payload["sn"].(string)
+	if s.observer != nil && sn != "" {
+		s.observer(sn, sess.remoteAddr)
+	}
+	if frameType, _ := payload["type"].(string); frameType == "auth" {
+		if sess.certSN != "" {
+			// 证书已确定设备身份，认证帧只能声明同一序列号
+			if sn != sess.certSN {
+				if s.auth != nil {
+					s.auth.CountRejected("msgpack", sn, errSNMismatch)
 				}
+				return NakUnauthorized, false
 			}
-			buffer = buffer[4+length:]
+			return 0, true
 		}
+		if s.auth == nil {
+			s.bind(sess, sn)
+			return 0, true
+		}
+		nonce, _ := payload["nonce"].(string)
+		if sess.nonce == "" || nonce != sess.nonce {
+			s.auth.CountRejected("msgpack", sn, errNonceMismatch)
+			return NakUnauthorized, false
+		}
+		sig, _ := payload["sig"].(string)
+		if err := s.auth.VerifyHandshake(sn, toInt64(payload["ts"]), nonce, sig); err != nil {
+			return NakUnauthorized, false
+		}
+		sess.nonce = ""
+		sess.authedSN = sn
+		s.bind(sess, sn)
+		return 0, true
+	}
+	if sess.certSN != "" && sn != sess.certSN {
+		// 证书连接只接受证书序列号的数据帧，与是否配置认证器无关
+		if s.auth != nil {
+			s.auth.CountRejected("msgpack", sn, errSNMismatch)
+		}
+		return NakUnauthorized, true
+	}
+	if s.auth != nil {
+		switch {
+		case sess.authedSN != "" && sn != sess.authedSN:
+			s.auth.CountRejected("msgpack", sn, errSNMismatch)
+			return NakUnauthorized, true
+		case sess.authedSN == "" && s.auth.Required():
+			s.auth.CountRejected("msgpack", sn, errNotAuthenticated)
+			return NakUnauthorized, true
+		}
+	}
+	if s.handler != nil {
+		if err := s.handler(payload); err != nil {
+			return NakRejected, true
+		}
+	}
+	// 已认证连接登记认证序列号；仅未配置认证器时才以有效数据帧的序列号登记
+	if sess.authedSN != "" {
+		s.bind(sess, sess.authedSN)
+	} else if s.auth == nil {
+		s.bind(sess, sn)
+	}
+	return 0, true
+}
+
+// challenge 生成连接的认证 nonce 并以 v2 数据帧下发，不等待设备确认
+func (s *MsgpackServer) challenge(sess *connSession) error {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return err
+	}
+	sess.nonce = hex.EncodeToString(b)
+	data, err := msgpack.Marshal(map[string]interface{}{"type": "challenge", "nonce": sess.nonce})
+	if err != nil {
+		return err
+	}
+	return sess.write(EncodeFrameV2(FrameData, sess.allocSeq(), data))
+}
+
+// toInt64 兼容 msgpack 解码出的各类整数类型
+func toInt64(v interface{}) int64 {
+	switch n := v.(type) {
+	case int8:
+		return int64(n)
+	case int16:
+		return int64(n)
+	case int32:
+		return int64(n)
+	case int64:
+		return n
+	case int:
+		return int64(n)
+	case uint8:
+		return int64(n)
+	case uint16:
+		return int64(n)
+	case uint32:
+		return int64(n)
+	case uint64:
+		return int64(n)
+	case float64:
+		return int64(n)
 	}
+	return 0
 }
@@ -0,0 +1,82 @@
+// Package msgpack 监听 TLS 配置与设备证书识别
+package msgpack
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"os"
+	"time"
+)
+
+// 客户端证书校验方式
+const (
+	ClientAuthNone     = "none"     // 不要求客户端证书
+	ClientAuthOptional = "optional" // 设备提供证书时校验，未提供仍可用认证帧认证
+	ClientAuthRequire  = "require"  // 必须提供有效证书
+)
+
+// tlsHandshakeTimeout TLS 握手超时，避免未完成握手的连接长期占用名额
+const tlsHandshakeTimeout = 10 * time.Second
+
+// TLSOptions 监听 TLS 选项；设备证书的 Subject CN 为设备序列号
+type TLSOptions struct {
+	CertFile     string
+	KeyFile      string
+	ClientCAFile string // 签发设备证书的 CA，ClientAuth 非 none 时必填
+	ClientAuth   string // none / optional / require，默认 none
+}
+
+// ServerTLSConfig 按选项构造监听 TLS 参数
+func ServerTLSConfig(opts TLSOptions) (*tls.Config, error) {
+	if opts.CertFile == "" || opts.KeyFile == "" {
+		return nil, errors.New("未配置服务端证书或私钥")
+	}
+	cert, err := tls.LoadX509KeyPair(opts.CertFile, opts.KeyFile)
+	if err != nil {
+		return nil, fmt.Errorf("加载服务端证书失败: %w", err)
+	}
+	cfg := &tls.Config{MinVersion: tls.VersionTLS12, Certificates: []tls.Certificate{cert}}
+	switch opts.ClientAuth {
+	case "", ClientAuthNone:
+		return cfg, nil
+	case ClientAuthOptional:
+		cfg.ClientAuth = tls.VerifyClientCertIfGiven
+	case ClientAuthRequire:
+		cfg.ClientAuth = tls.RequireAndVerifyClientCert
+	default:
+		return nil, fmt.Errorf("不支持的客户端证书校验方式 %q", opts.ClientAuth)
+	}
+	if opts.ClientCAFile == "" {
+		return nil, errors.New("校验客户端证书需要配置设备 CA")
+	}
+	pem, err := os.ReadFile(opts.ClientCAFile)
+	if err != nil {
+		return nil, fmt.Errorf("读取设备 CA 证书失败: %w", err)
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(pem) {
+		return nil, fmt.Errorf("设备 CA 证书 %s 中没有有效的 PEM 证书", opts.ClientCAFile)
+	}
+	cfg.ClientCAs = pool
+	return cfg, nil
+}
+
+// handshake 完成 TLS 握手并返回已校验客户端证书的 CN（设备序列号）；非 TLS 连接或未提供证书时返回空串
+func handshake(sess *connSession) (string, error) {
+	tc, ok := sess.conn.(*tls.Conn)
+	if !ok {
+		return "", nil
+	}
+	_ = tc.SetDeadline(time.Now().Add(tlsHandshakeTimeout))
+	if err := tc.Handshake(); err != nil {
+		return "", err
+	}
+	_ = tc.SetDeadline(time.Time{})
+	// 握手阶段已按 ClientCAs 校验证书链，PeerCertificates 非空即为可信证书
+	if certs := tc.ConnectionState().PeerCertificates; len(certs) > 0 {
+		return certs[0].Subject.CommonName, nil
+	}
+	return "", nil
+}
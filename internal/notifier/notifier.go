@@ -0,0 +1,92 @@
+// Package notifier 定义可插拔的消息通知接口（验证码、告警等），便于替换短信/邮件等实际通道。
+package notifier
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// Message 通知消息
+type Message struct {
+	To      string    `json:"to"`      // 接收方（邮箱/手机号）
+	Subject string    `json:"subject"` // 标题
+	Body    string    `json:"body"`    // 正文
+	SentAt  time.Time `json:"sent_at"` // 发送时间
+}
+
+// Notifier 通知发送接口
+type Notifier interface {
+	Send(ctx context.Context, msg Message) error
+}
+
+// LogNotifier 将消息输出到日志，仅用于本地开发调试
+type LogNotifier struct {
+	logger *zap.Logger
+}
+
+// NewLogNotifier 构造日志通知器
+func NewLogNotifier(logger *zap.Logger) *LogNotifier {
+	return &LogNotifier{logger: logger}
+}
+
+// Send 输出消息到日志
+func (n *LogNotifier) Send(ctx context.Context, msg Message) error {
+	n.logger.Info("通知消息",
+		zap.String("to", msg.To),
+		zap.String("subject", msg.Subject),
+		zap.String("body", msg.Body),
+	)
+	return nil
+}
+
+// FileNotifier 将消息以 JSON 行追加写入文件，便于本地测试读取验证码
+type FileNotifier struct {
+	mu   sync.Mutex
+	path string
+}
+
+// NewFileNotifier 构造文件通知器
+func NewFileNotifier(path string) *FileNotifier {
+	return &FileNotifier{path: path}
+}
+
+// Send 追加写入一行 JSON
+func (n *FileNotifier) Send(ctx context.Context, msg Message) error {
+	if msg.SentAt.IsZero() {
+		msg.SentAt = time.Now()
+	}
+	line, err := json.Marshal(msg)
+	if err != nil {
+		return err
+	}
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	f, err := os.OpenFile(n.path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o600)
+	if err != nil {
+		return fmt.Errorf("打开通知文件失败: %w", err)
+	}
+	defer f.Close()
+	_, err = f.Write(append(line, '\n'))
+	return err
+}
+
+// New 按类型创建通知器：log（默认）或 file
+func New(kind, filePath string, logger *zap.Logger) (Notifier, error) {
+	switch kind {
+	case "", "log":
+		return NewLogNotifier(logger), nil
+	case "file":
+		if filePath == "" {
+			return nil, fmt.Errorf("file 通知器需要配置 file_path")
+		}
+		return NewFileNotifier(filePath), nil
+	default:
+		return nil, fmt.Errorf("未知通知器类型: %s", kind)
+	}
+}
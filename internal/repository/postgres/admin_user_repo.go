@@ -0,0 +1,147 @@
+// Package postgres 管理员用户数据仓储实现
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/fire-disposal/health_DT_go/internal/models"
+)
+
+// AdminUserRepository 定义管理员用户数据仓储接口；除 GetByUsername（登录）外均按 context 租户范围过滤
+type AdminUserRepository interface {
+	Create(ctx context.Context, user *models.AdminUser) (int64, error)
+	GetByID(ctx context.Context, id int64) (*models.AdminUser, error)
+	GetByUsername(ctx context.Context, username string) (*models.AdminUser, error)
+	List(ctx context.Context) ([]*models.AdminUser, error)
+	Update(ctx context.Context, user *models.AdminUser) error
+	UpdatePasswordHash(ctx context.Context, id int64, hash string) error
+	SetActive(ctx context.Context, id int64, active bool) error
+	UpdateLastLogin(ctx context.Context, id int64, at time.Time) error
+	Delete(ctx context.Context, id int64) error
+	// CountActiveByRole 统计指定角色的激活管理员数量（受租户范围限制）
+	CountActiveByRole(ctx context.Context, role string) (int, error)
+}
+
+// adminUserRepo 实现 AdminUserRepository
+type adminUserRepo struct {
+	db *sql.DB
+}
+
+// NewAdminUserRepository 创建管理员用户仓储实例
+func NewAdminUserRepository(db *sql.DB) AdminUserRepository {
+	return &adminUserRepo{db: db}
+}
+
+const adminUserColumns = "id, org_id, username, email, phone, password_hash, role, is_active, last_login, created_at, updated_at"
+
+// rowScanner 兼容 *sql.Row 与 *sql.Rows
+type rowScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+// scanAdminUser 扫描一行管理员数据，处理可空字段
+func scanAdminUser(row rowScanner) (*models.AdminUser, error) {
+	var (
+		admin     models.AdminUser
+		email     sql.NullString
+		phone     sql.NullString
+		role      sql.NullString
+		lastLogin sql.NullTime
+	)
+	err := row.Scan(&admin.ID, &admin.OrgID, &admin.Username, &email, &phone, &admin.PasswordHash, &role,
+		&admin.IsActive, &lastLogin, &admin.CreatedAt, &admin.UpdatedAt)
+	if err != nil {
+		return nil, err
+	}
+	admin.Email = email.String
+	admin.Phone = phone.String
+	admin.Role = role.String
+	if lastLogin.Valid {
+		t := lastLogin.Time
+		admin.LastLogin = &t
+	}
+	return &admin, nil
+}
+
+func (r *adminUserRepo) Create(ctx context.Context, user *models.AdminUser) (int64, error) {
+	query := `INSERT INTO admin_users (org_id, username, email, phone, password_hash, role, is_active, created_at, updated_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, NOW(), NOW()) RETURNING id`
+	var id int64
+	err := r.db.QueryRowContext(ctx, query, user.OrgID, user.Username, user.Email, user.Phone, user.PasswordHash,
+		user.Role, user.IsActive).Scan(&id)
+	return id, err
+}
+
+func (r *adminUserRepo) GetByID(ctx context.Context, id int64) (*models.AdminUser, error) {
+	cond, args := orgClause(ctx, "org_id", []interface{}{id})
+	row := r.db.QueryRowContext(ctx, "SELECT "+adminUserColumns+" FROM admin_users WHERE id = $1"+cond, args...)
+	admin, err := scanAdminUser(row)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	return admin, err
+}
+
+func (r *adminUserRepo) GetByUsername(ctx context.Context, username string) (*models.AdminUser, error) {
+	row := r.db.QueryRowContext(ctx, "SELECT "+adminUserColumns+" FROM admin_users WHERE username = $1", username)
+	admin, err := scanAdminUser(row)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	return admin, err
+}
+
+func (r *adminUserRepo) List(ctx context.Context) ([]*models.AdminUser, error) {
+	cond, args := orgClause(ctx, "org_id", nil)
+	rows, err := r.db.QueryContext(ctx, "SELECT "+adminUserColumns+" FROM admin_users WHERE TRUE"+cond+" ORDER BY id", args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var users []*models.AdminUser
+	for rows.Next() {
+		admin, err := scanAdminUser(rows)
+		if err != nil {
+			return nil, err
+		}
+		users = append(users, admin)
+	}
+	return users, rows.Err()
+}
+
+// Update 更新基础信息（不含密码）
+func (r *adminUserRepo) Update(ctx context.Context, user *models.AdminUser) error {
+	cond, args := orgClause(ctx, "org_id", []interface{}{user.Email, user.Phone, user.Role, user.IsActive, user.ID})
+	query := `UPDATE admin_users SET email = $1, phone = $2, role = $3, is_active = $4, updated_at = NOW() WHERE id = $5` + cond
+	return affectedOne(r.db.ExecContext(ctx, query, args...))
+}
+
+func (r *adminUserRepo) UpdatePasswordHash(ctx context.Context, id int64, hash string) error {
+	_, err := r.db.ExecContext(ctx, `UPDATE admin_users SET password_hash = $1, updated_at = NOW() WHERE id = $2`, hash, id)
+	return err
+}
+
+func (r *adminUserRepo) SetActive(ctx context.Context, id int64, active bool) error {
+	cond, args := orgClause(ctx, "org_id", []interface{}{active, id})
+	return affectedOne(r.db.ExecContext(ctx, `UPDATE admin_users SET is_active = $1, updated_at = NOW() WHERE id = $2`+cond, args...))
+}
+
+func (r *adminUserRepo) UpdateLastLogin(ctx context.Context, id int64, at time.Time) error {
+	_, err := r.db.ExecContext(ctx, `UPDATE admin_users SET last_login = $1 WHERE id = $2`, at, id)
+	return err
+}
+
+func (r *adminUserRepo) Delete(ctx context.Context, id int64) error {
+	cond, args := orgClause(ctx, "org_id", []interface{}{id})
+	return affectedOne(r.db.ExecContext(ctx, `DELETE FROM admin_users WHERE id = $1`+cond, args...))
+}
+
+func (r *adminUserRepo) CountActiveByRole(ctx context.Context, role string) (int, error) {
+	var count int
+	cond, args := orgClause(ctx, "org_id", []interface{}{role})
+	err := r.db.QueryRowContext(ctx, `SELECT COUNT(1) FROM admin_users WHERE role = $1 AND is_active = TRUE`+cond, args...).Scan(&count)
+	return count, err
+}
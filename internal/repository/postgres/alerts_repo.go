@@ -1,12 +1,21 @@
 package postgres
 
 import (
+	"context"
 	"database/sql"
+	"fmt"
 
 	"github.com/fire-disposal/health_DT_go/internal/models"
+	"github.com/lib/pq"
 )
 
-// AlertsRepository 告警数据仓储
+const alertColumns = `a.id, a.org_id, a.health_profile_id, a.device_id, a.rule_name, a.level, a.message, a.status, a.created_at,
+	a.resolved_at, COALESCE(d.location_id, p.bed_id)`
+
+// alertSource 告警及其关联设备、档案，用于取告警位置（设备放置位置优先，其次档案床位）
+const alertSource = ` FROM alerts a LEFT JOIN devices d ON d.id = a.device_id LEFT JOIN health_profiles p ON p.id = a.health_profile_id`
+
+// AlertsRepository 告警数据仓储，按 context 租户范围过滤
 type AlertsRepository struct {
 	db *sql.DB
 }
@@ -15,9 +24,54 @@ func NewAlertsRepository(db *sql.DB) *AlertsRepository {
 	return &AlertsRepository{db: db}
 }
 
-// FindAll 查询全部告警（可扩展分页/筛选）
-func (r *AlertsRepository) FindAll() ([]models.Alert, error) {
-	rows, err := r.db.Query("SELECT id, health_profile_id, device_id, rule_name, level, message, status, created_at, resolved_at FROM alerts LIMIT 100")
+// FindAll 查询全部告警（可扩展分页/筛选）；locationID 大于 0 时仅返回该位置及其下级位置的告警
+func (r *AlertsRepository) FindAll(ctx context.Context, locationID int) ([]models.Alert, error) {
+	query, args := alertLocationFilter("SELECT "+alertColumns+alertSource+" WHERE TRUE", nil, locationID)
+	cond, args := orgClause(ctx, "a.org_id", args)
+	return r.query(ctx, query+cond+" ORDER BY a.created_at DESC LIMIT 100", args...)
+}
+
+// FindByProfileIDs 查询指定健康档案的告警；locationID 大于 0 时仅返回该位置及其下级位置的告警
+func (r *AlertsRepository) FindByProfileIDs(ctx context.Context, profileIDs []int, locationID int) ([]models.Alert, error) {
+	query, args := alertLocationFilter("SELECT "+alertColumns+alertSource+" WHERE a.health_profile_id = ANY($1)",
+		[]interface{}{pq.Array(profileIDs)}, locationID)
+	cond, args := orgClause(ctx, "a.org_id", args)
+	return r.query(ctx, query+cond+" ORDER BY a.created_at DESC LIMIT 100", args...)
+}
+
+// CountOpenByLevel 按级别统计未解除告警；locationID 大于 0 时仅统计该位置及其下级位置的告警
+func (r *AlertsRepository) CountOpenByLevel(ctx context.Context, locationID int) (map[string]int, error) {
+	query, args := alertLocationFilter("SELECT a.level, COUNT(*)"+alertSource+" WHERE a.status = $1",
+		[]interface{}{models.AlertStatusOpen}, locationID)
+	cond, args := orgClause(ctx, "a.org_id", args)
+	rows, err := r.db.QueryContext(ctx, query+cond+" GROUP BY a.level", args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	counts := make(map[string]int)
+	for rows.Next() {
+		var level string
+		var n int
+		if err := rows.Scan(&level, &n); err != nil {
+			return nil, err
+		}
+		counts[level] = n
+	}
+	return counts, rows.Err()
+}
+
+// alertLocationFilter 追加按位置子树过滤的条件
+func alertLocationFilter(query string, args []interface{}, locationID int) (string, []interface{}) {
+	if locationID <= 0 {
+		return query, args
+	}
+	args = append(args, locationID)
+	return query + " AND COALESCE(d.location_id, p.bed_id) IN " + fmt.Sprintf(locationSubtree, len(args)), args
+}
+
+func (r *AlertsRepository) query(ctx context.Context, query string, args ...interface{}) ([]models.Alert, error) {
+	rows, err := r.db.QueryContext(ctx, query, args...)
 	if err != nil {
 		return nil, err
 	}
@@ -27,7 +81,8 @@ func (r *AlertsRepository) FindAll() ([]models.Alert, error) {
 	for rows.Next() {
 		var a models.Alert
 		// 只映射部分字段，完整字段可补充
-		err := rows.Scan(&a.ID, &a.HealthProfileID, &a.DeviceID, &a.RuleName, &a.Level, &a.Message, &a.Status, &a.CreatedAt, &a.ResolvedAt)
+		err := rows.Scan(&a.ID, &a.OrgID, &a.HealthProfileID, &a.DeviceID, &a.RuleName, &a.Level, &a.Message, &a.Status,
+			&a.CreatedAt, &a.ResolvedAt, &a.LocationID)
 		if err != nil {
 			return nil, err
 		}
@@ -35,3 +90,39 @@ func (r *AlertsRepository) FindAll() ([]models.Alert, error) {
 	}
 	return alerts, nil
 }
+
+// deviceLocationPath 设备所在位置完整路径的子查询（放置位置优先，其次绑定档案的床位），无位置时为 NULL；%d 为设备ID参数序号
+const deviceLocationPath = `(WITH RECURSIVE chain AS (
+	SELECT l.parent_id, l.name, 0 AS depth FROM locations l
+	WHERE l.id = (SELECT COALESCE(d.location_id, p.bed_id) FROM devices d
+		LEFT JOIN health_profiles p ON p.id = ` + activeProfileOfDevice + ` WHERE d.id = $%[1]d)
+	UNION ALL
+	SELECT l.parent_id, l.name, c.depth + 1 FROM locations l JOIN chain c ON l.id = c.parent_id
+) SELECT string_agg(name, ' / ' ORDER BY depth DESC) FROM chain)`
+
+// OpenDeviceAlert 为设备创建告警，同一设备同一规则已有未解除告警时不重复创建；组织由触发器继承自设备，
+// 设备有位置时在告警内容末尾附加位置路径
+func (r *AlertsRepository) OpenDeviceAlert(ctx context.Context, deviceID int, sourceEventID *int, ruleName, level, message string) (bool, error) {
+	res, err := r.db.ExecContext(ctx,
+		`INSERT INTO alerts (health_profile_id, device_id, source_event_id, rule_name, level, message, event_type, status, created_at)
+		 SELECT `+fmt.Sprintf(activeProfileOfDevice, 1)+`, $1, $2, $3, $4,
+		 	$5::TEXT || COALESCE('（位置：' || `+fmt.Sprintf(deviceLocationPath, 1)+` || '）', ''), $6, $7, NOW()
+		 WHERE NOT EXISTS (SELECT 1 FROM alerts WHERE device_id = $1 AND rule_name = $8 AND status = $9)`,
+		deviceID, sourceEventID, ruleName, level, message, ruleName, models.AlertStatusOpen, ruleName, models.AlertStatusOpen)
+	if err != nil {
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	return n > 0, err
+}
+
+// ResolveDeviceAlerts 解除设备指定规则的全部未解除告警
+func (r *AlertsRepository) ResolveDeviceAlerts(ctx context.Context, deviceID int, ruleName string) (int64, error) {
+	res, err := r.db.ExecContext(ctx,
+		`UPDATE alerts SET status = $3, resolved_at = NOW() WHERE device_id = $1 AND rule_name = $2 AND status = $4`,
+		deviceID, ruleName, models.AlertStatusResolved, models.AlertStatusOpen)
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
@@ -0,0 +1,126 @@
+// Package postgres API Key 数据仓储
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+
+	"github.com/fire-disposal/health_DT_go/internal/models"
+	"github.com/lib/pq"
+)
+
+const apiKeyColumns = `id, org_id, name, prefix, key_hash, scopes, COALESCE(created_by, 0), expires_at,
+	last_used_at, rotated_at, revoked_at, created_at`
+
+// APIKeyRepository API Key 仓储接口；除认证使用的 GetByPrefix 外均按 context 租户范围过滤
+type APIKeyRepository interface {
+	Create(ctx context.Context, key *models.APIKey) error
+	// GetByPrefix 按前缀查询（认证用），不存在返回 nil
+	GetByPrefix(ctx context.Context, prefix string) (*models.APIKey, error)
+	// Get 查询 API Key，不存在返回 nil
+	Get(ctx context.Context, id int64) (*models.APIKey, error)
+	List(ctx context.Context) ([]models.APIKey, error)
+	// Rotate 替换未撤销 Key 的前缀与哈希，旧 Key 立即失效
+	Rotate(ctx context.Context, id int64, prefix, keyHash string) (bool, error)
+	Revoke(ctx context.Context, id int64) (bool, error)
+	// TouchLastUsed 更新最近使用时间，一分钟内重复调用不写库
+	TouchLastUsed(ctx context.Context, id int64) error
+}
+
+type apiKeyRepo struct {
+	db *sql.DB
+}
+
+// NewAPIKeyRepository 创建 API Key 仓储实例
+func NewAPIKeyRepository(db *sql.DB) APIKeyRepository {
+	return &apiKeyRepo{db: db}
+}
+
+func scanAPIKey(row rowScanner) (*models.APIKey, error) {
+	var k models.APIKey
+	var lastUsedAt, rotatedAt, revokedAt sql.NullTime
+	if err := row.Scan(&k.ID, &k.OrgID, &k.Name, &k.Prefix, &k.KeyHash, pq.Array(&k.Scopes), &k.CreatedBy,
+		&k.ExpiresAt, &lastUsedAt, &rotatedAt, &revokedAt, &k.CreatedAt); err != nil {
+		return nil, err
+	}
+	if lastUsedAt.Valid {
+		k.LastUsedAt = &lastUsedAt.Time
+	}
+	if rotatedAt.Valid {
+		k.RotatedAt = &rotatedAt.Time
+	}
+	if revokedAt.Valid {
+		k.RevokedAt = &revokedAt.Time
+	}
+	return &k, nil
+}
+
+func (r *apiKeyRepo) Create(ctx context.Context, k *models.APIKey) error {
+	query := `INSERT INTO api_keys (org_id, name, prefix, key_hash, scopes, created_by, expires_at, created_at)
+		VALUES ($1, $2, $3, $4, $5, NULLIF($6, 0), $7, NOW()) RETURNING id, created_at`
+	return r.db.QueryRowContext(ctx, query, k.OrgID, k.Name, k.Prefix, k.KeyHash, pq.Array(k.Scopes), k.CreatedBy,
+		k.ExpiresAt).Scan(&k.ID, &k.CreatedAt)
+}
+
+func (r *apiKeyRepo) GetByPrefix(ctx context.Context, prefix string) (*models.APIKey, error) {
+	k, err := scanAPIKey(r.db.QueryRowContext(ctx, `SELECT `+apiKeyColumns+` FROM api_keys WHERE prefix = $1`, prefix))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	return k, err
+}
+
+func (r *apiKeyRepo) Get(ctx context.Context, id int64) (*models.APIKey, error) {
+	cond, args := orgClause(ctx, "org_id", []interface{}{id})
+	k, err := scanAPIKey(r.db.QueryRowContext(ctx, `SELECT `+apiKeyColumns+` FROM api_keys WHERE id = $1`+cond, args...))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	return k, err
+}
+
+func (r *apiKeyRepo) List(ctx context.Context) ([]models.APIKey, error) {
+	cond, args := orgClause(ctx, "org_id", nil)
+	rows, err := r.db.QueryContext(ctx, `SELECT `+apiKeyColumns+` FROM api_keys WHERE TRUE`+cond+` ORDER BY id DESC`, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var keys []models.APIKey
+	for rows.Next() {
+		k, err := scanAPIKey(rows)
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, *k)
+	}
+	return keys, rows.Err()
+}
+
+func (r *apiKeyRepo) Rotate(ctx context.Context, id int64, prefix, keyHash string) (bool, error) {
+	cond, args := orgClause(ctx, "org_id", []interface{}{id, prefix, keyHash})
+	res, err := r.db.ExecContext(ctx, `UPDATE api_keys SET prefix = $2, key_hash = $3, rotated_at = NOW()
+		WHERE id = $1 AND revoked_at IS NULL`+cond, args...)
+	if err != nil {
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	return n > 0, err
+}
+
+func (r *apiKeyRepo) Revoke(ctx context.Context, id int64) (bool, error) {
+	cond, args := orgClause(ctx, "org_id", []interface{}{id})
+	res, err := r.db.ExecContext(ctx, `UPDATE api_keys SET revoked_at = NOW() WHERE id = $1 AND revoked_at IS NULL`+cond, args...)
+	if err != nil {
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	return n > 0, err
+}
+
+func (r *apiKeyRepo) TouchLastUsed(ctx context.Context, id int64) error {
+	_, err := r.db.ExecContext(ctx, `UPDATE api_keys SET last_used_at = NOW()
+		WHERE id = $1 AND (last_used_at IS NULL OR last_used_at < NOW() - INTERVAL '1 minute')`, id)
+	return err
+}
@@ -0,0 +1,148 @@
+// Package postgres 审计日志数据仓储
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/fire-disposal/health_DT_go/internal/models"
+	"github.com/fire-disposal/health_DT_go/internal/tenant"
+)
+
+// auditChainLockKey 审计链事务锁，保证并发写入时 prev_hash 串行衔接
+const auditChainLockKey = 0x61756469
+
+const auditLogColumns = `id, COALESCE(org_id, 0), actor_type, COALESCE(actor_id, 0), action, resource_type, COALESCE(resource_id, ''),
+	changes, COALESCE(ip, ''), created_at, prev_hash, hash`
+
+// AuditLogRepository 审计日志仓储接口（只追加）
+type AuditLogRepository interface {
+	// Append 在一个事务内按顺序将日志追加到链尾；seal 根据上一条日志的 hash 计算本条 hash
+	Append(ctx context.Context, entries []*models.AuditLog, seal func(prevHash string, e *models.AuditLog) string) error
+	// Search 按条件分页查询，受 context 租户范围限制
+	Search(ctx context.Context, filter models.AuditLogFilter) ([]models.AuditLog, int, error)
+	// ListAfter 按 ID 顺序读取 afterID 之后的日志，用于校验 hash 链
+	ListAfter(ctx context.Context, afterID int64, limit int) ([]models.AuditLog, error)
+}
+
+type auditLogRepo struct {
+	db *sql.DB
+}
+
+// NewAuditLogRepository 创建审计日志仓储实例
+func NewAuditLogRepository(db *sql.DB) AuditLogRepository {
+	return &auditLogRepo{db: db}
+}
+
+func (r *auditLogRepo) Append(ctx context.Context, entries []*models.AuditLog, seal func(prevHash string, e *models.AuditLog) string) error {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx, `SELECT pg_advisory_xact_lock($1)`, auditChainLockKey); err != nil {
+		return err
+	}
+	var prevHash string
+	err = tx.QueryRowContext(ctx, `SELECT hash FROM audit_logs ORDER BY id DESC LIMIT 1`).Scan(&prevHash)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return err
+	}
+	if prevHash == "" {
+		prevHash = strings.Repeat("0", 64)
+	}
+
+	query := `INSERT INTO audit_logs (org_id, actor_type, actor_id, action, resource_type, resource_id, changes, ip, created_at, prev_hash, hash)
+		VALUES (NULLIF($1, 0), $2, NULLIF($3, 0), $4, $5, NULLIF($6, ''), $7, NULLIF($8, ''), $9, $10, $11) RETURNING id`
+	for _, e := range entries {
+		e.PrevHash = prevHash
+		e.Hash = seal(e.PrevHash, e)
+		var changes interface{}
+		if len(e.Changes) > 0 {
+			changes = []byte(e.Changes)
+		}
+		if err := tx.QueryRowContext(ctx, query, e.OrgID, e.ActorType, e.ActorID, e.Action, e.ResourceType, e.ResourceID,
+			changes, e.IP, e.CreatedAt, e.PrevHash, e.Hash).Scan(&e.ID); err != nil {
+			return err
+		}
+		prevHash = e.Hash
+	}
+	return tx.Commit()
+}
+
+func (r *auditLogRepo) Search(ctx context.Context, f models.AuditLogFilter) ([]models.AuditLog, int, error) {
+	var conds []string
+	var args []interface{}
+	add := func(cond string, v interface{}) {
+		args = append(args, v)
+		conds = append(conds, fmt.Sprintf(cond, len(args)))
+	}
+	if f.ActorType != "" {
+		add("actor_type = $%d", f.ActorType)
+	}
+	if f.ActorID != 0 {
+		add("actor_id = $%d", f.ActorID)
+	}
+	if f.Action != "" {
+		add("action = $%d", f.Action)
+	}
+	if f.ResourceType != "" {
+		add("resource_type = $%d", f.ResourceType)
+	}
+	if f.ResourceID != "" {
+		add("resource_id = $%d", f.ResourceID)
+	}
+	if f.From != nil {
+		add("created_at >= $%d", *f.From)
+	}
+	if f.To != nil {
+		add("created_at < $%d", *f.To)
+	}
+	if orgID, ok := tenant.OrgFilter(ctx); ok {
+		add("org_id = $%d", orgID)
+	}
+	where := ""
+	if len(conds) > 0 {
+		where = " WHERE " + strings.Join(conds, " AND ")
+	}
+
+	var total int
+	if err := r.db.QueryRowContext(ctx, `SELECT COUNT(1) FROM audit_logs`+where, args...).Scan(&total); err != nil {
+		return nil, 0, err
+	}
+	args = append(args, f.Limit, f.Offset)
+	query := fmt.Sprintf(`SELECT %s FROM audit_logs%s ORDER BY id DESC LIMIT $%d OFFSET $%d`,
+		auditLogColumns, where, len(args)-1, len(args))
+	logs, err := r.query(ctx, query, args...)
+	return logs, total, err
+}
+
+func (r *auditLogRepo) ListAfter(ctx context.Context, afterID int64, limit int) ([]models.AuditLog, error) {
+	return r.query(ctx, `SELECT `+auditLogColumns+` FROM audit_logs WHERE id > $1 ORDER BY id LIMIT $2`, afterID, limit)
+}
+
+func (r *auditLogRepo) query(ctx context.Context, query string, args ...interface{}) ([]models.AuditLog, error) {
+	rows, err := r.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var logs []models.AuditLog
+	for rows.Next() {
+		var l models.AuditLog
+		var changes []byte
+		if err := rows.Scan(&l.ID, &l.OrgID, &l.ActorType, &l.ActorID, &l.Action, &l.ResourceType, &l.ResourceID,
+			&changes, &l.IP, &l.CreatedAt, &l.PrevHash, &l.Hash); err != nil {
+			return nil, err
+		}
+		if len(changes) > 0 {
+			l.Changes = changes
+		}
+		logs = append(logs, l)
+	}
+	return logs, rows.Err()
+}
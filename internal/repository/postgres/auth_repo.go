@@ -9,10 +9,14 @@ import (
 	"errors"
 	"time"
 
+	"github.com/fire-disposal/health_DT_go/internal/fieldcrypt"
 	"github.com/fire-disposal/health_DT_go/internal/models"
 	"golang.org/x/crypto/bcrypt"
 )
 
+// ErrAppUserExists App 用户用户名或微信 openid 与已有账号冲突
+var ErrAppUserExists = errors.New("用户名或微信已被其他账号使用")
+
 // AuthRepository 定义鉴权数据仓储接口
 type AuthRepository interface {
 	Create(ctx context.Context, auth *models.Auth) error
@@ -23,35 +27,61 @@ type AuthRepository interface {
 	Delete(ctx context.Context, id int64) error
 
 	// 新增 Token 相关接口
-	CreateToken(userID int64, expireDuration time.Duration) (string, error)
+	CreateToken(userID int64, userType string, expireDuration time.Duration) (string, error)
 	GetToken(token string) (*models.Auth, error)
 	DeleteToken(token string) error
+	// DeleteUserTokens 删除用户的全部 Token，exceptToken 非空时保留该 Token（当前会话）
+	DeleteUserTokens(ctx context.Context, userType string, userID int64, exceptToken string) error
 
 	// 密码相关接口
 	SetPassword(ctx context.Context, userID int64, password string) error
 	VerifyPassword(ctx context.Context, userID int64, password string) (bool, error)
-	// 用户查找接口
-	GetAdminUserByUsername(username string) (*models.AdminUser, error)
+	// 用户查找接口（管理员查找见 AdminUserRepository）
 	GetAppUserByUsername(username string) (*models.AppUser, error)
 	// 新增：通过微信 openid 查询 app_user
 	GetAppUserByWechatOpenID(openid string) (*models.AppUser, error)
 	// 新增：创建 app_user（用于微信自动注册）
 	CreateAppUser(ctx context.Context, user *models.AppUser) (int64, error)
+	GetAppUserByID(ctx context.Context, id int64) (*models.AppUser, error)
+	// SetAppUserWechatOpenID 绑定（openid 非空）或解绑（openid 为空）微信
+	SetAppUserWechatOpenID(ctx context.Context, userID int64, openid string) error
+}
+
+// appUserColumns app_users 查询列，可空列统一转为零值；email / phone / wechat_openid 为加密存储
+const appUserColumns = `id, username, COALESCE(email, ''), COALESCE(phone, ''), password_hash, COALESCE(is_active, TRUE),
+	COALESCE(last_login, 'epoch'), COALESCE(wechat_openid, ''), created_at, updated_at`
+
+// scanAppUser 扫描一行 App 用户并解密个人标识字段，不存在返回 nil
+func scanAppUser(row rowScanner, keys *fieldcrypt.Keyring) (*models.AppUser, error) {
+	var user models.AppUser
+	err := row.Scan(&user.ID, &user.Username, &user.Email, &user.Phone, &user.PasswordHash, &user.IsActive,
+		&user.LastLogin, &user.WechatOpenID, &user.CreatedAt, &user.UpdatedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := openAppUser(keys, &user); err != nil {
+		return nil, err
+	}
+	return &user, nil
 }
 
 // authRepo 实现 AuthRepository
 type authRepo struct {
-	db *sql.DB
+	db   *sql.DB
+	keys *fieldcrypt.Keyring
 }
 
-// NewAuthRepository 创建鉴权仓储实例
-func NewAuthRepository(db *sql.DB) AuthRepository {
-	return &authRepo{db: db}
+// NewAuthRepository 创建鉴权仓储实例，keys 用于 App 用户个人标识字段加解密
+func NewAuthRepository(db *sql.DB, keys *fieldcrypt.Keyring) AuthRepository {
+	return &authRepo{db: db, keys: keys}
 }
 
 func (r *authRepo) Create(ctx context.Context, auth *models.Auth) error {
-	query := `INSERT INTO auth (user_id, token, expires_at) VALUES ($1, $2, $3) RETURNING id`
-	return r.db.QueryRowContext(ctx, query, auth.UserID, auth.Token, auth.ExpiresAt).Scan(&auth.ID)
+	query := `INSERT INTO auth (user_id, user_type, token, expires_at) VALUES ($1, $2, $3, $4) RETURNING id`
+	return r.db.QueryRowContext(ctx, query, auth.UserID, auth.UserType, auth.Token, auth.ExpiresAt).Scan(&auth.ID)
 }
 
 func (r *authRepo) GetByID(ctx context.Context, id int64) (*models.Auth, error) {
@@ -114,15 +144,15 @@ func generateToken() (string, error) {
 	return hex.EncodeToString(b), nil
 }
 
-func (r *authRepo) CreateToken(userID int64, expireDuration time.Duration) (string, error) {
+func (r *authRepo) CreateToken(userID int64, userType string, expireDuration time.Duration) (string, error) {
 	token, err := generateToken()
 	if err != nil {
 		return "", err
 	}
 	expiresAt := time.Now().Add(expireDuration)
-	query := `INSERT INTO auth (user_id, token, expires_at, created_at, updated_at) VALUES ($1, $2, $3, NOW(), NOW()) RETURNING id`
+	query := `INSERT INTO auth (user_id, user_type, token, expires_at, created_at, updated_at) VALUES ($1, $2, $3, $4, NOW(), NOW()) RETURNING id`
 	var id int64
-	err = r.db.QueryRowContext(context.Background(), query, userID, token, expiresAt).Scan(&id)
+	err = r.db.QueryRowContext(context.Background(), query, userID, userType, token, expiresAt).Scan(&id)
 	if err != nil {
 		return "", err
 	}
@@ -130,10 +160,10 @@ func (r *authRepo) CreateToken(userID int64, expireDuration time.Duration) (stri
 }
 
 func (r *authRepo) GetToken(token string) (*models.Auth, error) {
-	query := `SELECT id, user_id, token, expires_at, created_at, updated_at FROM auth WHERE token = $1`
+	query := `SELECT id, user_id, user_type, token, expires_at, created_at, updated_at FROM auth WHERE token = $1`
 	row := r.db.QueryRowContext(context.Background(), query, token)
 	var a models.Auth
-	err := row.Scan(&a.ID, &a.UserID, &a.Token, &a.ExpiresAt, &a.CreatedAt, &a.UpdatedAt)
+	err := row.Scan(&a.ID, &a.UserID, &a.UserType, &a.Token, &a.ExpiresAt, &a.CreatedAt, &a.UpdatedAt)
 	if err == sql.ErrNoRows {
 		return nil, nil
 	}
@@ -148,6 +178,13 @@ func (r *authRepo) DeleteToken(token string) error {
 	_, err := r.db.ExecContext(context.Background(), query, token)
 	return err
 }
+
+func (r *authRepo) DeleteUserTokens(ctx context.Context, userType string, userID int64, exceptToken string) error {
+	query := `DELETE FROM auth WHERE user_type = $1 AND user_id = $2 AND token <> $3`
+	_, err := r.db.ExecContext(ctx, query, userType, userID, exceptToken)
+	return err
+}
+
 func (r *authRepo) Delete(ctx context.Context, id int64) error {
 	query := `DELETE FROM auth WHERE id = $1`
 	_, err := r.db.ExecContext(ctx, query, id)
@@ -178,66 +215,50 @@ func (r *authRepo) VerifyPassword(ctx context.Context, userID int64, password st
 	return err == nil, nil
 }
 
-// 查询管理员用户
-func (r *authRepo) GetAdminUserByUsername(username string) (*models.AdminUser, error) {
-	query := "SELECT id, username, password, role, created_at, updated_at FROM admin_users WHERE username = $1"
-	row := r.db.QueryRow(query, username)
-	var admin models.AdminUser
-	err := row.Scan(
-		&admin.ID,
-		&admin.Username,
-		&admin.Email,
-		&admin.Phone,
-		&admin.PasswordHash,
-		&admin.Role,
-		&admin.IsActive,
-		&admin.LastLogin,
-		&admin.CreatedAt,
-		&admin.UpdatedAt,
-	)
-	if err == sql.ErrNoRows {
-		return nil, nil
-	}
-	if err != nil {
-		return nil, err
-	}
-	return &admin, nil
-}
-
-// 通过微信 openid 查询 app_user
+// 通过微信 openid 查询 app_user，按盲索引匹配，未命中时回退明文比较（未配置盲索引密钥或尚未重加密的行）
 func (r *authRepo) GetAppUserByWechatOpenID(openid string) (*models.AppUser, error) {
-	query := "SELECT id, username, email, phone, password_hash, is_active, last_login, wechat_openid, created_at, updated_at FROM app_users WHERE wechat_openid = $1"
-	row := r.db.QueryRow(query, openid)
-	var user models.AppUser
-	err := row.Scan(&user.ID, &user.Username, &user.Email, &user.Phone, &user.PasswordHash, &user.IsActive, &user.LastLogin, &user.WechatOpenID, &user.CreatedAt, &user.UpdatedAt)
-	if err == sql.ErrNoRows {
-		return nil, nil
-	}
-	if err != nil {
-		return nil, err
-	}
-	return &user, nil
+	return scanAppUser(r.db.QueryRow("SELECT "+appUserColumns+` FROM app_users
+		WHERE wechat_openid_bidx = $1 OR wechat_openid = $2`,
+		r.keys.BlindIndex(bidxAppUserOpenID, openid), openid), r.keys)
 }
 
 // 创建 app_user（用于微信自动注册）
 func (r *authRepo) CreateAppUser(ctx context.Context, user *models.AppUser) (int64, error) {
-	query := "INSERT INTO app_users (username, email, phone, password_hash, is_active, wechat_openid, created_at, updated_at) VALUES ($1, $2, $3, $4, $5, $6, $7, $8) RETURNING id"
+	pii, err := sealAppUserPII(r.keys, user.Email, user.Phone, user.WechatOpenID)
+	if err != nil {
+		return 0, err
+	}
+	query := `INSERT INTO app_users (username, email, email_bidx, phone, phone_bidx, password_hash, is_active,
+		wechat_openid, wechat_openid_bidx, created_at, updated_at)
+		VALUES ($1, NULLIF($2, ''), NULLIF($3, ''), NULLIF($4, ''), NULLIF($5, ''), $6, $7, NULLIF($8, ''), NULLIF($9, ''), $10, $11)
+		RETURNING id`
 	var id int64
-	err := r.db.QueryRowContext(ctx, query, user.Username, user.Email, user.Phone, user.PasswordHash, user.IsActive, user.WechatOpenID, user.CreatedAt, user.UpdatedAt).Scan(&id)
+	err = r.db.QueryRowContext(ctx, query, user.Username, pii.Email.Value, pii.Email.Index, pii.Phone.Value, pii.Phone.Index,
+		user.PasswordHash, user.IsActive, pii.OpenID.Value, pii.OpenID.Index, user.CreatedAt, user.UpdatedAt).Scan(&id)
+	if isUniqueViolation(err) {
+		return 0, ErrAppUserExists
+	}
 	return id, err
 }
 
 // 查询普通用户
 func (r *authRepo) GetAppUserByUsername(username string) (*models.AppUser, error) {
-	query := "SELECT id, username, email, phone, password_hash, is_active, last_login, wechat_openid, created_at, updated_at FROM app_users WHERE username = $1"
-	row := r.db.QueryRow(query, username)
-	var user models.AppUser
-	err := row.Scan(&user.ID, &user.Username, &user.Email, &user.Phone, &user.PasswordHash, &user.IsActive, &user.LastLogin, &user.WechatOpenID, &user.CreatedAt, &user.UpdatedAt)
-	if err == sql.ErrNoRows {
-		return nil, nil
-	}
+	return scanAppUser(r.db.QueryRow("SELECT "+appUserColumns+" FROM app_users WHERE username = $1", username), r.keys)
+}
+
+func (r *authRepo) GetAppUserByID(ctx context.Context, id int64) (*models.AppUser, error) {
+	return scanAppUser(r.db.QueryRowContext(ctx, "SELECT "+appUserColumns+" FROM app_users WHERE id = $1", id), r.keys)
+}
+
+func (r *authRepo) SetAppUserWechatOpenID(ctx context.Context, userID int64, openid string) error {
+	field, err := sealIndexed(r.keys, bidxAppUserOpenID, openid)
 	if err != nil {
-		return nil, err
+		return err
 	}
-	return &user, nil
+	_, err = r.db.ExecContext(ctx, `UPDATE app_users SET wechat_openid = NULLIF($1, ''), wechat_openid_bidx = NULLIF($2, ''),
+		updated_at = NOW() WHERE id = $3`, field.Value, field.Index, userID)
+	if isUniqueViolation(err) {
+		return ErrAppUserExists
+	}
+	return err
 }
@@ -0,0 +1,216 @@
+// Package postgres 设备绑定仓储
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/fire-disposal/health_DT_go/internal/models"
+	"github.com/lib/pq"
+)
+
+var (
+	// ErrCrossOrgAssignment 设备或档案不存在，或两者不属于同一组织
+	ErrCrossOrgAssignment = errors.New("设备与健康档案不存在或不属于同一组织")
+	// ErrAssignmentDeviceNotFound 绑定的设备不存在（或不在调用方组织内）
+	ErrAssignmentDeviceNotFound = errors.New("设备不存在")
+	// ErrAssignmentProfileNotFound 绑定的健康档案不存在（或不在调用方组织内）
+	ErrAssignmentProfileNotFound = errors.New("健康档案不存在")
+)
+
+const deviceAssignmentColumns = `a.id, a.device_id, a.health_profile_id, a.assigned_at, a.unassigned_at, COALESCE(a.end_reason, '')`
+
+// DeviceAssignmentFilter 绑定查询条件，零值字段不过滤
+type DeviceAssignmentFilter struct {
+	DeviceID   int
+	ProfileID  int
+	ActiveOnly bool
+	ProfileIDs []int // 非 nil 时仅返回这些档案的绑定（App 用户可访问的档案）
+	Limit      int
+}
+
+// DeviceAssignmentRepository 设备绑定仓储；按 context 租户范围以设备所属组织过滤
+type DeviceAssignmentRepository struct {
+	db *sql.DB
+}
+
+// NewDeviceAssignmentRepository 创建设备绑定仓储实例
+func NewDeviceAssignmentRepository(db *sql.DB) *DeviceAssignmentRepository {
+	return &DeviceAssignmentRepository{db: db}
+}
+
+func scanDeviceAssignment(row rowScanner) (*models.DeviceAssignment, error) {
+	var a models.DeviceAssignment
+	var unassignedAt sql.NullTime
+	if err := row.Scan(&a.ID, &a.DeviceID, &a.HealthProfileID, &a.AssignedAt, &unassignedAt, &a.EndReason); err != nil {
+		return nil, err
+	}
+	if unassignedAt.Valid {
+		a.UnassignedAt = &unassignedAt.Time
+	}
+	return &a, nil
+}
+
+// Assign 在事务内将设备绑定到档案：锁定设备行，校验设备与档案存在且属于同一组织，
+// 设备已有其他有效绑定时先解绑（end_reason 为 reassigned）。已绑定到同一档案时不做修改，返回 created 为 false。
+// authorize 非 nil 时在锁定设备行、读取当前有效绑定（无则为 nil）后调用，返回错误则回滚，
+// 保证权限校验所依据的原绑定在提交前不会被并发改绑
+func (r *DeviceAssignmentRepository) Assign(ctx context.Context, deviceID, profileID int,
+	authorize func(current *models.DeviceAssignment) error) (assignment, replaced *models.DeviceAssignment, created bool, err error) {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, nil, false, err
+	}
+	defer tx.Rollback()
+
+	var (
+		deviceOrg  int
+		profileOrg sql.NullInt64
+	)
+	cond, args := orgClause(ctx, "org_id", []interface{}{deviceID})
+	err = tx.QueryRowContext(ctx, `SELECT org_id FROM devices WHERE id = $1`+cond+` FOR UPDATE`, args...).Scan(&deviceOrg)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil, false, ErrAssignmentDeviceNotFound
+	}
+	if err != nil {
+		return nil, nil, false, err
+	}
+	cond, args = orgClause(ctx, "org_id", []interface{}{profileID})
+	err = tx.QueryRowContext(ctx, `SELECT org_id FROM health_profiles WHERE id = $1`+cond, args...).Scan(&profileOrg)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil, false, ErrAssignmentProfileNotFound
+	}
+	if err != nil {
+		return nil, nil, false, err
+	}
+	// App 用户的个人档案不归属组织，可绑定任意组织的设备
+	if profileOrg.Valid && int(profileOrg.Int64) != deviceOrg {
+		return nil, nil, false, ErrCrossOrgAssignment
+	}
+
+	current, err := scanDeviceAssignment(tx.QueryRowContext(ctx,
+		`SELECT `+deviceAssignmentColumns+` FROM device_assignments a WHERE a.device_id = $1 AND a.unassigned_at IS NULL`, deviceID))
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return nil, nil, false, err
+	}
+	if authorize != nil {
+		if err := authorize(current); err != nil {
+			return nil, nil, false, err
+		}
+	}
+	if current != nil && current.HealthProfileID == profileID {
+		return current, nil, false, nil
+	}
+	if current != nil {
+		replaced, err = scanDeviceAssignment(tx.QueryRowContext(ctx,
+			`UPDATE device_assignments a SET unassigned_at = NOW(), end_reason = $2 WHERE a.id = $1
+			 RETURNING `+deviceAssignmentColumns, current.ID, models.AssignmentEndReassigned))
+		if err != nil {
+			return nil, nil, false, err
+		}
+	}
+	assignment, err = scanDeviceAssignment(tx.QueryRowContext(ctx,
+		`INSERT INTO device_assignments AS a (device_id, health_profile_id, assigned_at) VALUES ($1, $2, NOW())
+		 RETURNING `+deviceAssignmentColumns, deviceID, profileID))
+	if err != nil {
+		return nil, nil, false, err
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, nil, false, err
+	}
+	return assignment, replaced, true, nil
+}
+
+// Unassign 结束有效绑定，返回更新后的记录；绑定不存在或已结束时返回 nil
+func (r *DeviceAssignmentRepository) Unassign(ctx context.Context, id int) (*models.DeviceAssignment, error) {
+	cond, args := orgClause(ctx, "d.org_id", []interface{}{id, models.AssignmentEndUnassigned})
+	a, err := scanDeviceAssignment(r.db.QueryRowContext(ctx,
+		`UPDATE device_assignments a SET unassigned_at = NOW(), end_reason = $2 FROM devices d
+		 WHERE d.id = a.device_id AND a.id = $1 AND a.unassigned_at IS NULL`+cond+`
+		 RETURNING `+deviceAssignmentColumns, args...))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	return a, err
+}
+
+// Get 查询绑定记录，不存在返回 nil
+func (r *DeviceAssignmentRepository) Get(ctx context.Context, id int) (*models.DeviceAssignment, error) {
+	cond, args := orgClause(ctx, "d.org_id", []interface{}{id})
+	a, err := scanDeviceAssignment(r.db.QueryRowContext(ctx,
+		`SELECT `+deviceAssignmentColumns+` FROM device_assignments a JOIN devices d ON d.id = a.device_id
+		 WHERE a.id = $1`+cond, args...))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	return a, err
+}
+
+// Active 查询设备当前有效绑定，未绑定返回 nil
+func (r *DeviceAssignmentRepository) Active(ctx context.Context, deviceID int) (*models.DeviceAssignment, error) {
+	cond, args := orgClause(ctx, "d.org_id", []interface{}{deviceID})
+	a, err := scanDeviceAssignment(r.db.QueryRowContext(ctx,
+		`SELECT `+deviceAssignmentColumns+` FROM device_assignments a JOIN devices d ON d.id = a.device_id
+		 WHERE a.device_id = $1 AND a.unassigned_at IS NULL`+cond, args...))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	return a, err
+}
+
+// List 按条件查询绑定记录（含历史），按绑定时间倒序
+func (r *DeviceAssignmentRepository) List(ctx context.Context, f DeviceAssignmentFilter) ([]models.DeviceAssignment, error) {
+	var where []string
+	var args []interface{}
+	if f.DeviceID > 0 {
+		args = append(args, f.DeviceID)
+		where = append(where, fmt.Sprintf("a.device_id = $%d", len(args)))
+	}
+	if f.ProfileID > 0 {
+		args = append(args, f.ProfileID)
+		where = append(where, fmt.Sprintf("a.health_profile_id = $%d", len(args)))
+	}
+	if f.ProfileIDs != nil {
+		args = append(args, pq.Array(f.ProfileIDs))
+		where = append(where, fmt.Sprintf("a.health_profile_id = ANY($%d)", len(args)))
+	}
+	if f.ActiveOnly {
+		where = append(where, "a.unassigned_at IS NULL")
+	}
+	query := `SELECT ` + deviceAssignmentColumns + ` FROM device_assignments a JOIN devices d ON d.id = a.device_id WHERE TRUE`
+	if len(where) > 0 {
+		query += " AND " + strings.Join(where, " AND ")
+	}
+	cond, args := orgClause(ctx, "d.org_id", args)
+	args = append(args, f.Limit)
+	rows, err := r.db.QueryContext(ctx, fmt.Sprintf(`%s%s ORDER BY a.assigned_at DESC, a.id DESC LIMIT $%d`,
+		query, cond, len(args)), args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var list []models.DeviceAssignment
+	for rows.Next() {
+		a, err := scanDeviceAssignment(rows)
+		if err != nil {
+			return nil, err
+		}
+		list = append(list, *a)
+	}
+	return list, rows.Err()
+}
+
+// Delete 删除绑定记录（用于纠正误录，正常解绑应使用 Unassign 以保留历史），返回是否删除
+func (r *DeviceAssignmentRepository) Delete(ctx context.Context, id int) (bool, error) {
+	cond, args := orgClause(ctx, "d.org_id", []interface{}{id})
+	res, err := r.db.ExecContext(ctx,
+		`DELETE FROM device_assignments a USING devices d WHERE d.id = a.device_id AND a.id = $1`+cond, args...)
+	if err != nil {
+		return false, err
+	}
+	n, _ := res.RowsAffected()
+	return n > 0, nil
+}
@@ -0,0 +1,137 @@
+// Package postgres 设备下行指令仓储
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/fire-disposal/health_DT_go/internal/models"
+)
+
+const deviceCommandColumns = `id, org_id, device_id, request_id, name, params, status, result, COALESCE(error, ''),
+	COALESCE(created_by, 0), created_at, sent_at, acked_at, expires_at`
+
+// DeviceCommandRepository 设备下行指令仓储；查询按 context 租户范围过滤，
+// 回执与超时处理由接入层和后台任务调用，不做过滤
+type DeviceCommandRepository struct {
+	db *sql.DB
+}
+
+// NewDeviceCommandRepository 创建下行指令仓储实例
+func NewDeviceCommandRepository(db *sql.DB) *DeviceCommandRepository {
+	return &DeviceCommandRepository{db: db}
+}
+
+func scanDeviceCommand(row rowScanner) (*models.DeviceCommand, error) {
+	var cmd models.DeviceCommand
+	var params, result []byte
+	var sentAt, ackedAt sql.NullTime
+	if err := row.Scan(&cmd.ID, &cmd.OrgID, &cmd.DeviceID, &cmd.RequestID, &cmd.Name, &params, &cmd.Status, &result,
+		&cmd.Error, &cmd.CreatedBy, &cmd.CreatedAt, &sentAt, &ackedAt, &cmd.ExpiresAt); err != nil {
+		return nil, err
+	}
+	cmd.Params = json.RawMessage(params)
+	cmd.Result = json.RawMessage(result)
+	if sentAt.Valid {
+		cmd.SentAt = &sentAt.Time
+	}
+	if ackedAt.Valid {
+		cmd.AckedAt = &ackedAt.Time
+	}
+	return &cmd, nil
+}
+
+// nullJSON 空 JSON 写入 NULL
+func nullJSON(raw json.RawMessage) interface{} {
+	if len(raw) == 0 {
+		return nil
+	}
+	return []byte(raw)
+}
+
+// Create 写入 pending 指令，组织取设备所属组织
+func (r *DeviceCommandRepository) Create(ctx context.Context, cmd *models.DeviceCommand) error {
+	return r.db.QueryRowContext(ctx,
+		`INSERT INTO device_commands (org_id, device_id, request_id, name, params, status, created_by, created_at, expires_at)
+		 SELECT d.org_id, d.id, $2, $3, $4, $5, NULLIF($6, 0), NOW(), $7 FROM devices d WHERE d.id = $1
+		 RETURNING id, org_id, created_at`,
+		cmd.DeviceID, cmd.RequestID, cmd.Name, nullJSON(cmd.Params), models.DeviceCommandPending, cmd.CreatedBy, cmd.ExpiresAt,
+	).Scan(&cmd.ID, &cmd.OrgID, &cmd.CreatedAt)
+}
+
+// MarkSent 标记已发布；设备回执先于本调用到达时不覆盖
+func (r *DeviceCommandRepository) MarkSent(ctx context.Context, id int64) error {
+	_, err := r.db.ExecContext(ctx,
+		`UPDATE device_commands SET status = $1, sent_at = NOW() WHERE id = $2 AND status = $3`,
+		models.DeviceCommandSent, id, models.DeviceCommandPending)
+	return err
+}
+
+// MarkFailed 标记发布失败
+func (r *DeviceCommandRepository) MarkFailed(ctx context.Context, id int64, reason string) error {
+	_, err := r.db.ExecContext(ctx,
+		`UPDATE device_commands SET status = $1, error = $2 WHERE id = $3 AND status = $4`,
+		models.DeviceCommandFailed, reason, id, models.DeviceCommandPending)
+	return err
+}
+
+// Ack 按设备序列号与 request_id 记录回执，仅更新未结束的指令；返回是否命中
+func (r *DeviceCommandRepository) Ack(ctx context.Context, sn, requestID, status string, result json.RawMessage, reason string) (bool, error) {
+	res, err := r.db.ExecContext(ctx,
+		`UPDATE device_commands c SET status = $1, result = $2, error = NULLIF($3, ''), acked_at = NOW()
+		 FROM devices d
+		 WHERE d.id = c.device_id AND d.serial_number = $4 AND c.request_id = $5 AND c.status IN ($6, $7)`,
+		status, nullJSON(result), reason, sn, requestID, models.DeviceCommandPending, models.DeviceCommandSent)
+	if err != nil {
+		return false, err
+	}
+	n, _ := res.RowsAffected()
+	return n > 0, nil
+}
+
+// ExpireTimedOut 将超过确认时限的未结束指令标记为 timed_out，返回更新行数
+func (r *DeviceCommandRepository) ExpireTimedOut(ctx context.Context) (int64, error) {
+	res, err := r.db.ExecContext(ctx,
+		`UPDATE device_commands SET status = $1 WHERE status IN ($2, $3) AND expires_at < NOW()`,
+		models.DeviceCommandTimedOut, models.DeviceCommandPending, models.DeviceCommandSent)
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
+
+// Get 查询设备的一条指令，不存在返回 nil
+func (r *DeviceCommandRepository) Get(ctx context.Context, deviceID int, id int64) (*models.DeviceCommand, error) {
+	cond, args := orgClause(ctx, "org_id", []interface{}{id, deviceID})
+	cmd, err := scanDeviceCommand(r.db.QueryRowContext(ctx,
+		`SELECT `+deviceCommandColumns+` FROM device_commands WHERE id = $1 AND device_id = $2`+cond, args...))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	return cmd, err
+}
+
+// ListByDevice 设备指令历史，按创建时间倒序
+func (r *DeviceCommandRepository) ListByDevice(ctx context.Context, deviceID, limit int) ([]models.DeviceCommand, error) {
+	cond, args := orgClause(ctx, "org_id", []interface{}{deviceID})
+	args = append(args, limit)
+	rows, err := r.db.QueryContext(ctx, fmt.Sprintf(
+		`SELECT %s FROM device_commands WHERE device_id = $1%s ORDER BY created_at DESC, id DESC LIMIT $%d`,
+		deviceCommandColumns, cond, len(args)), args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var cmds []models.DeviceCommand
+	for rows.Next() {
+		cmd, err := scanDeviceCommand(rows)
+		if err != nil {
+			return nil, err
+		}
+		cmds = append(cmds, *cmd)
+	}
+	return cmds, rows.Err()
+}
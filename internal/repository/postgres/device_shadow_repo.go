@@ -0,0 +1,117 @@
+// Package postgres 设备影子仓储
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"time"
+
+	"github.com/fire-disposal/health_DT_go/internal/models"
+)
+
+// 设备尚无影子记录时按空影子返回
+const deviceShadowSelect = `SELECT d.id, d.serial_number, d.org_id, COALESCE(s.desired, '{}'), COALESCE(s.reported, '{}'),
+	COALESCE(s.version, 0), COALESCE(s.reported_version, 0), s.desired_updated_at, s.reported_updated_at
+	FROM devices d LEFT JOIN device_shadows s ON s.device_id = d.id`
+
+// DeviceShadowRepository 设备影子仓储；接口查询按 context 租户范围过滤，设备接入使用的 GetBySerialNumber 不过滤。
+// 写入均为条件更新，版本不符时不写入并返回 false
+type DeviceShadowRepository struct {
+	db *sql.DB
+}
+
+// NewDeviceShadowRepository 创建设备影子仓储实例
+func NewDeviceShadowRepository(db *sql.DB) *DeviceShadowRepository {
+	return &DeviceShadowRepository{db: db}
+}
+
+func scanDeviceShadow(row rowScanner) (*models.DeviceShadow, error) {
+	var shadow models.DeviceShadow
+	var desired, reported []byte
+	var desiredAt, reportedAt sql.NullTime
+	if err := row.Scan(&shadow.DeviceID, &shadow.SerialNumber, &shadow.OrgID, &desired, &reported, &shadow.Version, &shadow.ReportedVersion,
+		&desiredAt, &reportedAt); err != nil {
+		return nil, err
+	}
+	shadow.Desired = json.RawMessage(desired)
+	shadow.Reported = json.RawMessage(reported)
+	if desiredAt.Valid {
+		shadow.DesiredUpdatedAt = &desiredAt.Time
+	}
+	if reportedAt.Valid {
+		shadow.ReportedUpdatedAt = &reportedAt.Time
+	}
+	return &shadow, nil
+}
+
+// Get 查询设备影子，设备不存在返回 nil
+func (r *DeviceShadowRepository) Get(ctx context.Context, deviceID int) (*models.DeviceShadow, error) {
+	cond, args := orgClause(ctx, "d.org_id", []interface{}{deviceID})
+	shadow, err := scanDeviceShadow(r.db.QueryRowContext(ctx, deviceShadowSelect+` WHERE d.id = $1`+cond, args...))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	return shadow, err
+}
+
+// GetBySerialNumber 按序列号查询启用设备的影子，设备不存在或已停用返回 nil
+func (r *DeviceShadowRepository) GetBySerialNumber(ctx context.Context, sn string) (*models.DeviceShadow, error) {
+	shadow, err := scanDeviceShadow(r.db.QueryRowContext(ctx,
+		deviceShadowSelect+` WHERE d.serial_number = $1 AND d.is_active`, sn))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	return shadow, err
+}
+
+// ensure 为设备创建空影子记录（已存在时忽略）
+func (r *DeviceShadowRepository) ensure(ctx context.Context, shadow *models.DeviceShadow) error {
+	_, err := r.db.ExecContext(ctx,
+		`INSERT INTO device_shadows (device_id, org_id) VALUES ($1, $2) ON CONFLICT (device_id) DO NOTHING`,
+		shadow.DeviceID, shadow.OrgID)
+	return err
+}
+
+// UpdateDesired 当期望状态版本仍为 expectedVersion 时写入并将版本加一，回填新版本与更新时间
+func (r *DeviceShadowRepository) UpdateDesired(ctx context.Context, shadow *models.DeviceShadow, expectedVersion int64) (bool, error) {
+	if err := r.ensure(ctx, shadow); err != nil {
+		return false, err
+	}
+	var updatedAt time.Time
+	err := r.db.QueryRowContext(ctx,
+		`UPDATE device_shadows SET desired = $1, version = version + 1, desired_updated_at = NOW()
+		 WHERE device_id = $2 AND version = $3 RETURNING version, desired_updated_at`,
+		[]byte(shadow.Desired), shadow.DeviceID, expectedVersion,
+	).Scan(&shadow.Version, &updatedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	shadow.DesiredUpdatedAt = &updatedAt
+	return true, nil
+}
+
+// UpdateReported 当上报序号仍为 previousVersion 时写入设备上报状态与新序号，回填更新时间
+func (r *DeviceShadowRepository) UpdateReported(ctx context.Context, shadow *models.DeviceShadow, previousVersion int64) (bool, error) {
+	if err := r.ensure(ctx, shadow); err != nil {
+		return false, err
+	}
+	var updatedAt time.Time
+	err := r.db.QueryRowContext(ctx,
+		`UPDATE device_shadows SET reported = $1, reported_version = $2, reported_updated_at = NOW()
+		 WHERE device_id = $3 AND reported_version = $4 RETURNING reported_updated_at`,
+		[]byte(shadow.Reported), shadow.ReportedVersion, shadow.DeviceID, previousVersion,
+	).Scan(&updatedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	shadow.ReportedUpdatedAt = &updatedAt
+	return true, nil
+}
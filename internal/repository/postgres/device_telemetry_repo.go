@@ -0,0 +1,90 @@
+// Package postgres 设备电量与信号采样仓储
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/fire-disposal/health_DT_go/internal/models"
+	"github.com/lib/pq"
+)
+
+// DeviceTelemetryRepository 设备电量与信号采样仓储；History 按 context 租户范围过滤，
+// Latest 的设备 ID 由调用方在已过滤的设备列表中取得
+type DeviceTelemetryRepository struct {
+	db *sql.DB
+}
+
+// NewDeviceTelemetryRepository 创建设备电量与信号采样仓储实例
+func NewDeviceTelemetryRepository(db *sql.DB) *DeviceTelemetryRepository {
+	return &DeviceTelemetryRepository{db: db}
+}
+
+// Insert 写入一条采样
+func (r *DeviceTelemetryRepository) Insert(ctx context.Context, deviceID int, t *models.DeviceTelemetry) error {
+	_, err := r.db.ExecContext(ctx,
+		`INSERT INTO device_telemetry (device_id, battery, charging, rssi, snr, recorded_at) VALUES ($1, $2, $3, $4, $5, $6)`,
+		deviceID, t.Battery, t.Charging, t.RSSI, t.SNR, t.RecordedAt)
+	return err
+}
+
+// Latest 查询各设备最近一次采样，无采样的设备不在结果中
+func (r *DeviceTelemetryRepository) Latest(ctx context.Context, deviceIDs []int) (map[int]*models.DeviceTelemetry, error) {
+	out := make(map[int]*models.DeviceTelemetry, len(deviceIDs))
+	if len(deviceIDs) == 0 {
+		return out, nil
+	}
+	rows, err := r.db.QueryContext(ctx, `SELECT DISTINCT ON (device_id) device_id, battery, charging, rssi, snr, recorded_at
+		FROM device_telemetry WHERE device_id = ANY($1) ORDER BY device_id, recorded_at DESC`, pq.Array(deviceIDs))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var deviceID int
+		var t models.DeviceTelemetry
+		if err := rows.Scan(&deviceID, &t.Battery, &t.Charging, &t.RSSI, &t.SNR, &t.RecordedAt); err != nil {
+			return nil, err
+		}
+		out[deviceID] = &t
+	}
+	return out, rows.Err()
+}
+
+// History 查询设备 since 之后的采样（按时间先后），最多 limit 条
+func (r *DeviceTelemetryRepository) History(ctx context.Context, deviceID int, since time.Time, limit int) ([]models.DeviceTelemetry, error) {
+	cond, args := orgClause(ctx, "d.org_id", []interface{}{deviceID, since, limit})
+	rows, err := r.db.QueryContext(ctx, `SELECT t.battery, t.charging, t.rssi, t.snr, t.recorded_at
+		FROM device_telemetry t JOIN devices d ON d.id = t.device_id
+		WHERE t.device_id = $1 AND t.recorded_at >= $2`+cond+`
+		ORDER BY t.recorded_at DESC LIMIT $3`, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	list := []models.DeviceTelemetry{}
+	for rows.Next() {
+		var t models.DeviceTelemetry
+		if err := rows.Scan(&t.Battery, &t.Charging, &t.RSSI, &t.SNR, &t.RecordedAt); err != nil {
+			return nil, err
+		}
+		list = append(list, t)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	for i, j := 0, len(list)-1; i < j; i, j = i+1, j-1 {
+		list[i], list[j] = list[j], list[i]
+	}
+	return list, nil
+}
+
+// Prune 删除 before 之前的采样，返回删除条数
+func (r *DeviceTelemetryRepository) Prune(ctx context.Context, before time.Time) (int64, error) {
+	res, err := r.db.ExecContext(ctx, `DELETE FROM device_telemetry WHERE recorded_at < $1`, before)
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
@@ -0,0 +1,129 @@
+// Package postgres 设备类型目录仓储
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+
+	"github.com/fire-disposal/health_DT_go/internal/models"
+)
+
+// ErrDeviceTypeExists 设备类型编码已存在
+var ErrDeviceTypeExists = errors.New("设备类型编码已存在")
+
+const deviceTypeColumns = `code, name, description, reporting_interval_seconds, metrics, payload_schema, created_at, updated_at`
+
+// DeviceTypeRepository 设备类型目录仓储（平台级，不按组织过滤）
+type DeviceTypeRepository struct {
+	db *sql.DB
+}
+
+// NewDeviceTypeRepository 创建设备类型目录仓储实例
+func NewDeviceTypeRepository(db *sql.DB) *DeviceTypeRepository {
+	return &DeviceTypeRepository{db: db}
+}
+
+func scanDeviceType(row rowScanner) (*models.DeviceType, error) {
+	var t models.DeviceType
+	var metrics, schema []byte
+	if err := row.Scan(&t.Code, &t.Name, &t.Description, &t.ReportingIntervalSeconds, &metrics, &schema,
+		&t.CreatedAt, &t.UpdatedAt); err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(metrics, &t.Metrics); err != nil {
+		return nil, err
+	}
+	if t.Metrics == nil {
+		t.Metrics = []models.DeviceMetric{}
+	}
+	if len(schema) > 0 {
+		t.PayloadSchema = json.RawMessage(schema)
+	}
+	return &t, nil
+}
+
+// nullableJSON 空值写入 NULL
+func nullableJSON(raw json.RawMessage) interface{} {
+	if len(raw) == 0 {
+		return nil
+	}
+	return []byte(raw)
+}
+
+// Create 创建设备类型，编码已存在返回 ErrDeviceTypeExists
+func (r *DeviceTypeRepository) Create(ctx context.Context, t *models.DeviceType) error {
+	metrics, err := json.Marshal(t.Metrics)
+	if err != nil {
+		return err
+	}
+	err = r.db.QueryRowContext(ctx, `INSERT INTO device_types (code, name, description, reporting_interval_seconds, metrics, payload_schema)
+		VALUES ($1, $2, $3, $4, $5, $6) RETURNING created_at, updated_at`,
+		t.Code, t.Name, t.Description, t.ReportingIntervalSeconds, metrics, nullableJSON(t.PayloadSchema)).
+		Scan(&t.CreatedAt, &t.UpdatedAt)
+	if isUniqueViolation(err) {
+		return ErrDeviceTypeExists
+	}
+	return err
+}
+
+// Get 查询设备类型，不存在返回 nil
+func (r *DeviceTypeRepository) Get(ctx context.Context, code string) (*models.DeviceType, error) {
+	t, err := scanDeviceType(r.db.QueryRowContext(ctx, `SELECT `+deviceTypeColumns+` FROM device_types WHERE code = $1`, code))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	return t, err
+}
+
+// List 查询全部设备类型
+func (r *DeviceTypeRepository) List(ctx context.Context) ([]models.DeviceType, error) {
+	rows, err := r.db.QueryContext(ctx, `SELECT `+deviceTypeColumns+` FROM device_types ORDER BY code`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	list := []models.DeviceType{}
+	for rows.Next() {
+		t, err := scanDeviceType(rows)
+		if err != nil {
+			return nil, err
+		}
+		list = append(list, *t)
+	}
+	return list, rows.Err()
+}
+
+// Update 修改设备类型（编码不可修改），返回是否存在
+func (r *DeviceTypeRepository) Update(ctx context.Context, t *models.DeviceType) (bool, error) {
+	metrics, err := json.Marshal(t.Metrics)
+	if err != nil {
+		return false, err
+	}
+	err = r.db.QueryRowContext(ctx, `UPDATE device_types SET name = $2, description = $3, reporting_interval_seconds = $4,
+		metrics = $5, payload_schema = $6, updated_at = NOW() WHERE code = $1 RETURNING created_at, updated_at`,
+		t.Code, t.Name, t.Description, t.ReportingIntervalSeconds, metrics, nullableJSON(t.PayloadSchema)).
+		Scan(&t.CreatedAt, &t.UpdatedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+// InUse 是否有设备（不限组织）使用该类型
+func (r *DeviceTypeRepository) InUse(ctx context.Context, code string) (bool, error) {
+	var used bool
+	err := r.db.QueryRowContext(ctx, `SELECT EXISTS (SELECT 1 FROM devices WHERE device_type = $1)`, code).Scan(&used)
+	return used, err
+}
+
+// Delete 删除设备类型，返回是否存在
+func (r *DeviceTypeRepository) Delete(ctx context.Context, code string) (bool, error) {
+	res, err := r.db.ExecContext(ctx, `DELETE FROM device_types WHERE code = $1`, code)
+	if err != nil {
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	return n > 0, err
+}
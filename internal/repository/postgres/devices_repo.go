@@ -4,11 +4,13 @@ package postgres
 import (
 	"context"
 	"database/sql"
+	"fmt"
 	"time"
 
 	"github.com/fire-disposal/health_DT_go/internal/models"
 )
 
+// DevicesRepository 设备仓储；除设备接入使用的 GetBySerialNumber 外均按 context 租户范围过滤
 type DevicesRepository struct {
 	db *sql.DB
 }
@@ -20,60 +22,85 @@ func NewDevicesRepository(db *sql.DB) *DevicesRepository {
 func (r *DevicesRepository) Create(ctx context.Context, device *models.Device) (int, error) {
 	var id int
 	err := r.db.QueryRowContext(ctx,
-		`INSERT INTO devices (serial_number, name, device_type, is_active, created_at, updated_at)
-		 VALUES ($1, $2, $3, $4, $5, $6) RETURNING id`,
-		device.SerialNumber, device.Name, device.DeviceType, device.IsActive, device.CreatedAt, device.UpdatedAt,
+		`INSERT INTO devices (org_id, serial_number, name, device_type, is_active, secret_key, created_at, updated_at)
+		 VALUES ($1, $2, $3, $4, $5, $6, $7, $8) RETURNING id`,
+		device.OrgID, device.SerialNumber, device.Name, device.DeviceType, device.IsActive, device.SecretKey, device.CreatedAt, device.UpdatedAt,
 	).Scan(&id)
 	return id, err
 }
 
+const deviceColumns = `id, org_id, serial_number, name, device_type, is_active, location_id, created_at, updated_at`
+
+func scanDevice(row rowScanner) (*models.Device, error) {
+	var d models.Device
+	if err := row.Scan(&d.ID, &d.OrgID, &d.SerialNumber, &d.Name, &d.DeviceType, &d.IsActive, &d.LocationID,
+		&d.CreatedAt, &d.UpdatedAt); err != nil {
+		return nil, err
+	}
+	return &d, nil
+}
+
 func (r *DevicesRepository) Get(ctx context.Context, id int) (*models.Device, error) {
+	cond, args := orgClause(ctx, "org_id", []interface{}{id})
+	return scanDevice(r.db.QueryRowContext(ctx, `SELECT `+deviceColumns+` FROM devices WHERE id = $1`+cond, args...))
+}
+
+// GetBySerialNumber 根据序列号查询设备（含密钥，用于设备认证）
+func (r *DevicesRepository) GetBySerialNumber(ctx context.Context, sn string) (*models.Device, error) {
 	row := r.db.QueryRowContext(ctx,
-		`SELECT id, serial_number, name, device_type, is_active, created_at, updated_at FROM devices WHERE id = $1`, id)
+		`SELECT id, org_id, serial_number, name, device_type, is_active, COALESCE(secret_key, ''), created_at, updated_at
+		 FROM devices WHERE serial_number = $1`, sn)
 	var device models.Device
-	err := row.Scan(&device.ID, &device.SerialNumber, &device.Name, &device.DeviceType, &device.IsActive, &device.CreatedAt, &device.UpdatedAt)
+	err := row.Scan(&device.ID, &device.OrgID, &device.SerialNumber, &device.Name, &device.DeviceType, &device.IsActive,
+		&device.SecretKey, &device.CreatedAt, &device.UpdatedAt)
 	if err != nil {
 		return nil, err
 	}
 	return &device, nil
 }
 
+// UpdateSecretKey 更新设备密钥
+func (r *DevicesRepository) UpdateSecretKey(ctx context.Context, id int, secret string) error {
+	cond, args := orgClause(ctx, "org_id", []interface{}{secret, time.Now(), id})
+	return affectedOne(r.db.ExecContext(ctx, `UPDATE devices SET secret_key=$1, updated_at=$2 WHERE id=$3`+cond, args...))
+}
+
 func (r *DevicesRepository) Update(ctx context.Context, device *models.Device) error {
-	_, err := r.db.ExecContext(ctx,
-		`UPDATE devices SET serial_number=$1, name=$2, device_type=$3, is_active=$4, updated_at=$5 WHERE id=$6`,
-		device.SerialNumber, device.Name, device.DeviceType, device.IsActive, device.UpdatedAt, device.ID,
-	)
-	return err
+	cond, args := orgClause(ctx, "org_id",
+		[]interface{}{device.SerialNumber, device.Name, device.DeviceType, device.IsActive, device.UpdatedAt, device.ID})
+	return affectedOne(r.db.ExecContext(ctx,
+		`UPDATE devices SET serial_number=$1, name=$2, device_type=$3, is_active=$4, updated_at=$5 WHERE id=$6`+cond, args...))
 }
 
 func (r *DevicesRepository) Delete(ctx context.Context, id int) error {
-	_, err := r.db.ExecContext(ctx, `DELETE FROM devices WHERE id=$1`, id)
-	return err
+	cond, args := orgClause(ctx, "org_id", []interface{}{id})
+	return affectedOne(r.db.ExecContext(ctx, `DELETE FROM devices WHERE id=$1`+cond, args...))
 }
 
 func (r *DevicesRepository) FindAll(ctx context.Context) ([]models.Device, error) {
-	rows, err := r.db.QueryContext(ctx,
-		`SELECT id, serial_number, name, device_type, is_active, created_at, updated_at FROM devices`)
+	cond, args := orgClause(ctx, "org_id", nil)
+	return r.query(ctx, `SELECT `+deviceColumns+` FROM devices WHERE TRUE`+cond, args...)
+}
+
+// FindByLocation 查询放置在指定位置及其下级位置的设备
+func (r *DevicesRepository) FindByLocation(ctx context.Context, locationID int) ([]models.Device, error) {
+	cond, args := orgClause(ctx, "org_id", []interface{}{locationID})
+	return r.query(ctx, `SELECT `+deviceColumns+` FROM devices WHERE location_id IN `+fmt.Sprintf(locationSubtree, 1)+cond, args...)
+}
+
+func (r *DevicesRepository) query(ctx context.Context, query string, args ...interface{}) ([]models.Device, error) {
+	rows, err := r.db.QueryContext(ctx, query, args...)
 	if err != nil {
 		return nil, err
 	}
 	defer rows.Close()
 	var devices []models.Device
 	for rows.Next() {
-		var d models.Device
-		if err := rows.Scan(&d.ID, &d.SerialNumber, &d.Name, &d.DeviceType, &d.IsActive, &d.CreatedAt, &d.UpdatedAt); err != nil {
+		d, err := scanDevice(rows)
+		if err != nil {
 			return nil, err
 		}
-		devices = append(devices, d)
+		devices = append(devices, *d)
 	}
-	return devices, nil
-}
-
-// 设备绑定健康档案
-func (r *DevicesRepository) AssignDeviceToProfile(ctx context.Context, deviceID int, profileID int) error {
-	_, err := r.db.ExecContext(ctx,
-		`INSERT INTO device_assignments (device_id, health_profile_id, assigned_at) VALUES ($1, $2, $3)`,
-		deviceID, profileID, time.Now(),
-	)
-	return err
+	return devices, rows.Err()
 }
@@ -1,7 +1,11 @@
 package postgres
 
 import (
+	"context"
 	"database/sql"
+	"encoding/json"
+	"fmt"
+	"time"
 
 	"github.com/fire-disposal/health_DT_go/internal/models"
 )
@@ -17,7 +21,7 @@ func NewEventsRepository(db *sql.DB) *EventsRepository {
 
 // FindAll 查询全部事件（可扩展分页/筛选）
 func (r *EventsRepository) FindAll() ([]models.Event, error) {
-	rows, err := r.db.Query("SELECT id, event_type, health_profile_id, device_id, source_record_id, timestamp, data, metadata, created_at, updated_at FROM events LIMIT 100")
+	rows, err := r.db.Query("SELECT id, event_type, COALESCE(health_profile_id, 0), device_id, source_record_id, timestamp, data, metadata, created_at, updated_at FROM events LIMIT 100")
 	if err != nil {
 		return nil, err
 	}
@@ -35,3 +39,27 @@ func (r *EventsRepository) FindAll() ([]models.Event, error) {
 	}
 	return events, nil
 }
+
+// activeProfileOfDevice 设备当前绑定的健康档案（未绑定为 NULL），参数为设备ID
+const activeProfileOfDevice = `(SELECT health_profile_id FROM device_assignments
+	WHERE device_id = $%d AND unassigned_at IS NULL ORDER BY assigned_at DESC LIMIT 1)`
+
+// CreateDeviceEvent 记录设备事件，健康档案取设备当前绑定的档案
+func (r *EventsRepository) CreateDeviceEvent(ctx context.Context, eventType string, deviceID int, at time.Time, data json.RawMessage) (int, error) {
+	var id int
+	err := r.db.QueryRowContext(ctx,
+		`INSERT INTO events (event_type, health_profile_id, device_id, timestamp, data, created_at, updated_at)
+		 VALUES ($1, `+fmt.Sprintf(activeProfileOfDevice, 2)+`, $2, $3, $4, NOW(), NOW()) RETURNING id`,
+		eventType, deviceID, at, []byte(data)).Scan(&id)
+	return id, err
+}
+
+// CreateSystemEvent 记录不关联设备与档案的系统事件（如接入层连接状态变化）
+func (r *EventsRepository) CreateSystemEvent(ctx context.Context, eventType string, at time.Time, data json.RawMessage) (int, error) {
+	var id int
+	err := r.db.QueryRowContext(ctx,
+		`INSERT INTO events (event_type, timestamp, data, created_at, updated_at)
+		 VALUES ($1, $2, $3, NOW(), NOW()) RETURNING id`,
+		eventType, at, []byte(data)).Scan(&id)
+	return id, err
+}
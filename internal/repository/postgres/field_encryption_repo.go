@@ -0,0 +1,143 @@
+// Package postgres 个人标识字段重加密仓储
+package postgres
+
+import (
+	"context"
+	"database/sql"
+
+	"github.com/fire-disposal/health_DT_go/internal/fieldcrypt"
+	"github.com/fire-disposal/health_DT_go/internal/models"
+)
+
+// ReencryptBatch 单批重加密结果
+type ReencryptBatch struct {
+	LastID  int64 // 本批最大ID，作为下一批起点
+	Scanned int
+	Updated int
+}
+
+// FieldEncryptionRepository 按批将历史明文与旧主密钥密文重新加密到当前主密钥，并补齐盲索引。
+// 更新时比对原值，期间被业务修改的行跳过，由下次执行处理
+type FieldEncryptionRepository struct {
+	db   *sql.DB
+	keys *fieldcrypt.Keyring
+}
+
+// NewFieldEncryptionRepository 创建重加密仓储实例
+func NewFieldEncryptionRepository(db *sql.DB, keys *fieldcrypt.Keyring) *FieldEncryptionRepository {
+	return &FieldEncryptionRepository{db: db, keys: keys}
+}
+
+// ReencryptAppUsers 处理 id > afterID 的一批 App 用户
+func (r *FieldEncryptionRepository) ReencryptAppUsers(ctx context.Context, afterID int64, limit int) (ReencryptBatch, error) {
+	batch := ReencryptBatch{LastID: afterID}
+	rows, err := r.db.QueryContext(ctx, `SELECT id, COALESCE(email, ''), COALESCE(phone, ''), COALESCE(wechat_openid, ''),
+		COALESCE(email_bidx, ''), COALESCE(phone_bidx, ''), COALESCE(wechat_openid_bidx, '')
+		FROM app_users WHERE id > $1 ORDER BY id LIMIT $2`, afterID, limit)
+	if err != nil {
+		return batch, err
+	}
+	type row struct {
+		id                   int64
+		email, phone, openid string
+		emailIdx, phoneIdx   string
+		openidIdx            string
+	}
+	var pending []row
+	for rows.Next() {
+		var rw row
+		if err := rows.Scan(&rw.id, &rw.email, &rw.phone, &rw.openid, &rw.emailIdx, &rw.phoneIdx, &rw.openidIdx); err != nil {
+			rows.Close()
+			return batch, err
+		}
+		pending = append(pending, rw)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return batch, err
+	}
+
+	for _, rw := range pending {
+		batch.Scanned++
+		batch.LastID = rw.id
+		user := models.AppUser{Email: rw.email, Phone: rw.phone, WechatOpenID: rw.openid}
+		if err := openAppUser(r.keys, &user); err != nil {
+			return batch, err
+		}
+		pii, err := sealAppUserPII(r.keys, user.Email, user.Phone, user.WechatOpenID)
+		if err != nil {
+			return batch, err
+		}
+		if !r.keys.NeedsReencrypt(rw.email) && !r.keys.NeedsReencrypt(rw.phone) && !r.keys.NeedsReencrypt(rw.openid) &&
+			pii.Email.Index == rw.emailIdx && pii.Phone.Index == rw.phoneIdx && pii.OpenID.Index == rw.openidIdx {
+			continue
+		}
+		res, err := r.db.ExecContext(ctx, `UPDATE app_users SET email = NULLIF($1, ''), email_bidx = NULLIF($2, ''),
+			phone = NULLIF($3, ''), phone_bidx = NULLIF($4, ''), wechat_openid = NULLIF($5, ''), wechat_openid_bidx = NULLIF($6, '')
+			WHERE id = $7 AND COALESCE(email, '') = $8 AND COALESCE(phone, '') = $9 AND COALESCE(wechat_openid, '') = $10`,
+			pii.Email.Value, pii.Email.Index, pii.Phone.Value, pii.Phone.Index, pii.OpenID.Value, pii.OpenID.Index,
+			rw.id, rw.email, rw.phone, rw.openid)
+		if err != nil {
+			return batch, err
+		}
+		if n, _ := res.RowsAffected(); n > 0 {
+			batch.Updated++
+		}
+	}
+	return batch, nil
+}
+
+// ReencryptHealthProfiles 处理 id > afterID 的一批健康档案
+func (r *FieldEncryptionRepository) ReencryptHealthProfiles(ctx context.Context, afterID int64, limit int) (ReencryptBatch, error) {
+	batch := ReencryptBatch{LastID: afterID}
+	rows, err := r.db.QueryContext(ctx, `SELECT id, name, birth_date, metadata
+		FROM health_profiles WHERE id > $1 ORDER BY id LIMIT $2`, afterID, limit)
+	if err != nil {
+		return batch, err
+	}
+	type row struct {
+		id     int64
+		sealed sealedProfile
+	}
+	var pending []row
+	for rows.Next() {
+		var rw row
+		if err := rows.Scan(&rw.id, &rw.sealed.Name, &rw.sealed.BirthDate, &rw.sealed.Metadata); err != nil {
+			rows.Close()
+			return batch, err
+		}
+		pending = append(pending, rw)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return batch, err
+	}
+
+	for _, rw := range pending {
+		batch.Scanned++
+		batch.LastID = rw.id
+		old := rw.sealed
+		if !r.keys.NeedsReencrypt(old.Name) && !r.keys.NeedsReencrypt(old.BirthDate.String) &&
+			!r.keys.NeedsReencrypt(old.Metadata.String) {
+			continue
+		}
+		var profile models.HealthProfile
+		if err := openProfile(r.keys, &profile, &old); err != nil {
+			return batch, err
+		}
+		sealed, err := sealProfile(r.keys, &profile)
+		if err != nil {
+			return batch, err
+		}
+		res, err := r.db.ExecContext(ctx, `UPDATE health_profiles SET name = $1, birth_date = $2, metadata = $3
+			WHERE id = $4 AND name = $5 AND birth_date IS NOT DISTINCT FROM $6 AND metadata IS NOT DISTINCT FROM $7`,
+			sealed.Name, sealed.BirthDate, sealed.Metadata, rw.id, old.Name, old.BirthDate, old.Metadata)
+		if err != nil {
+			return batch, err
+		}
+		if n, _ := res.RowsAffected(); n > 0 {
+			batch.Updated++
+		}
+	}
+	return batch, nil
+}
@@ -4,76 +4,118 @@ package postgres
 import (
 	"context"
 	"database/sql"
-	"time"
 
+	"github.com/fire-disposal/health_DT_go/internal/fieldcrypt"
 	"github.com/fire-disposal/health_DT_go/internal/models"
+	"github.com/lib/pq"
 )
 
+const healthProfileColumns = "id, COALESCE(org_id, 0), user_id, name, gender, birth_date, metadata, bed_id, created_at, updated_at"
+
+// HealthProfilesRepository 健康档案仓储，均按 context 租户范围过滤；name / birth_date / metadata 加密存储
 type HealthProfilesRepository struct {
-	db *sql.DB
+	db   *sql.DB
+	keys *fieldcrypt.Keyring
+}
+
+func NewHealthProfilesRepository(db *sql.DB, keys *fieldcrypt.Keyring) *HealthProfilesRepository {
+	return &HealthProfilesRepository{db: db, keys: keys}
 }
 
-func NewHealthProfilesRepository(db *sql.DB) *HealthProfilesRepository {
-	return &HealthProfilesRepository{db: db}
+// scanHealthProfile 扫描一行健康档案并解密
+func (r *HealthProfilesRepository) scanHealthProfile(row rowScanner) (*models.HealthProfile, error) {
+	var (
+		profile models.HealthProfile
+		sealed  sealedProfile
+		gender  sql.NullString
+	)
+	if err := row.Scan(&profile.ID, &profile.OrgID, &profile.UserID, &sealed.Name, &gender, &sealed.BirthDate,
+		&sealed.Metadata, &profile.BedID, &profile.CreatedAt, &profile.UpdatedAt); err != nil {
+		return nil, err
+	}
+	profile.Gender = gender.String
+	if err := openProfile(r.keys, &profile, &sealed); err != nil {
+		return nil, err
+	}
+	return &profile, nil
 }
 
+// Create 创建健康档案；指定 user_id 时在同一事务内将其登记为档案拥有者，避免产生无人可访问的档案
 func (r *HealthProfilesRepository) Create(ctx context.Context, profile *models.HealthProfile) (int, error) {
+	sealed, err := sealProfile(r.keys, profile)
+	if err != nil {
+		return 0, err
+	}
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
 	var id int
-	err := r.db.QueryRowContext(ctx,
-		`INSERT INTO health_profiles (user_id, name, gender, birth_date, metadata, created_at, updated_at)
-		 VALUES ($1, $2, $3, $4, $5, $6, $7) RETURNING id`,
-		profile.UserID, profile.Name, profile.Gender, profile.BirthDate, profile.Metadata, profile.CreatedAt, profile.UpdatedAt,
+	err = tx.QueryRowContext(ctx,
+		`INSERT INTO health_profiles (org_id, user_id, name, gender, birth_date, metadata, created_at, updated_at)
+		 VALUES (NULLIF($1, 0), $2, $3, $4, $5, $6, $7, $8) RETURNING id`,
+		profile.OrgID, profile.UserID, sealed.Name, profile.Gender, sealed.BirthDate, sealed.Metadata, profile.CreatedAt, profile.UpdatedAt,
 	).Scan(&id)
-	return id, err
+	if err != nil {
+		return 0, err
+	}
+	if profile.UserID != nil {
+		if _, err := tx.ExecContext(ctx, `INSERT INTO profile_members (health_profile_id, user_id, role, status, approved_at, created_at)
+			VALUES ($1, $2, $3, $4, NOW(), NOW())`, id, *profile.UserID, models.ProfileRoleOwner, models.ProfileMemberActive); err != nil {
+			return 0, err
+		}
+	}
+	return id, tx.Commit()
 }
 
 func (r *HealthProfilesRepository) Get(ctx context.Context, id int) (*models.HealthProfile, error) {
-	row := r.db.QueryRowContext(ctx,
-		`SELECT id, user_id, name, gender, birth_date, metadata, created_at, updated_at FROM health_profiles WHERE id = $1`, id)
-	var profile models.HealthProfile
-	err := row.Scan(&profile.ID, &profile.UserID, &profile.Name, &profile.Gender, &profile.BirthDate, &profile.Metadata, &profile.CreatedAt, &profile.UpdatedAt)
-	if err != nil {
-		return nil, err
-	}
-	return &profile, nil
+	cond, args := orgClause(ctx, "org_id", []interface{}{id})
+	return r.scanHealthProfile(r.db.QueryRowContext(ctx,
+		`SELECT `+healthProfileColumns+` FROM health_profiles WHERE id = $1`+cond, args...))
 }
 
 func (r *HealthProfilesRepository) Update(ctx context.Context, profile *models.HealthProfile) error {
-	_, err := r.db.ExecContext(ctx,
-		`UPDATE health_profiles SET user_id=$1, name=$2, gender=$3, birth_date=$4, metadata=$5, updated_at=$6 WHERE id=$7`,
-		profile.UserID, profile.Name, profile.Gender, profile.BirthDate, profile.Metadata, profile.UpdatedAt, profile.ID,
-	)
-	return err
+	sealed, err := sealProfile(r.keys, profile)
+	if err != nil {
+		return err
+	}
+	cond, args := orgClause(ctx, "org_id", []interface{}{profile.UserID, sealed.Name, profile.Gender, sealed.BirthDate,
+		sealed.Metadata, profile.UpdatedAt, profile.ID})
+	return affectedOne(r.db.ExecContext(ctx,
+		`UPDATE health_profiles SET user_id=$1, name=$2, gender=$3, birth_date=$4, metadata=$5, updated_at=$6 WHERE id=$7`+cond, args...))
 }
 
 func (r *HealthProfilesRepository) Delete(ctx context.Context, id int) error {
-	_, err := r.db.ExecContext(ctx, `DELETE FROM health_profiles WHERE id=$1`, id)
-	return err
+	cond, args := orgClause(ctx, "org_id", []interface{}{id})
+	return affectedOne(r.db.ExecContext(ctx, `DELETE FROM health_profiles WHERE id=$1`+cond, args...))
 }
 
 func (r *HealthProfilesRepository) FindAll(ctx context.Context) ([]models.HealthProfile, error) {
-	rows, err := r.db.QueryContext(ctx,
-		`SELECT id, user_id, name, gender, birth_date, metadata, created_at, updated_at FROM health_profiles`)
+	cond, args := orgClause(ctx, "org_id", nil)
+	return r.query(ctx, `SELECT `+healthProfileColumns+` FROM health_profiles WHERE TRUE`+cond, args...)
+}
+
+// FindByIDs 查询指定ID的健康档案
+func (r *HealthProfilesRepository) FindByIDs(ctx context.Context, ids []int) ([]models.HealthProfile, error) {
+	cond, args := orgClause(ctx, "org_id", []interface{}{pq.Array(ids)})
+	return r.query(ctx, `SELECT `+healthProfileColumns+` FROM health_profiles WHERE id = ANY($1)`+cond, args...)
+}
+
+func (r *HealthProfilesRepository) query(ctx context.Context, query string, args ...interface{}) ([]models.HealthProfile, error) {
+	rows, err := r.db.QueryContext(ctx, query, args...)
 	if err != nil {
 		return nil, err
 	}
 	defer rows.Close()
 	var profiles []models.HealthProfile
 	for rows.Next() {
-		var p models.HealthProfile
-		if err := rows.Scan(&p.ID, &p.UserID, &p.Name, &p.Gender, &p.BirthDate, &p.Metadata, &p.CreatedAt, &p.UpdatedAt); err != nil {
+		p, err := r.scanHealthProfile(rows)
+		if err != nil {
 			return nil, err
 		}
-		profiles = append(profiles, p)
+		profiles = append(profiles, *p)
 	}
-	return profiles, nil
-}
-
-// 健康档案绑定设备
-func (r *HealthProfilesRepository) AssignProfileToDevice(ctx context.Context, profileID int, deviceID int) error {
-	_, err := r.db.ExecContext(ctx,
-		`INSERT INTO device_assignments (device_id, health_profile_id, assigned_at) VALUES ($1, $2, $3)`,
-		deviceID, profileID, time.Now(),
-	)
-	return err
+	return profiles, rows.Err()
 }
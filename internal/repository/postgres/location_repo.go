@@ -0,0 +1,238 @@
+// Package postgres 位置层级仓储
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+
+	"github.com/fire-disposal/health_DT_go/internal/models"
+	"github.com/lib/pq"
+)
+
+// ErrLocationNameExists 同一上级下位置名称已存在
+var ErrLocationNameExists = errors.New("同一上级下已存在同名位置")
+
+// ErrBedOccupied 床位已分配给其他健康档案
+var ErrBedOccupied = errors.New("床位已分配给其他健康档案")
+
+const locationColumns = `id, org_id, parent_id, kind, name, created_at, updated_at`
+
+// locationSubtree 指定位置及其全部下级位置的ID子查询，%d 为位置ID参数序号
+const locationSubtree = `(WITH RECURSIVE sub AS (
+	SELECT id FROM locations WHERE id = $%d
+	UNION ALL SELECT l.id FROM locations l JOIN sub ON l.parent_id = sub.id
+) SELECT id FROM sub)`
+
+// LocationRepository 位置仓储，按 context 租户范围过滤
+type LocationRepository struct {
+	db *sql.DB
+}
+
+// NewLocationRepository 创建位置仓储实例
+func NewLocationRepository(db *sql.DB) *LocationRepository {
+	return &LocationRepository{db: db}
+}
+
+func scanLocation(row rowScanner) (*models.Location, error) {
+	var l models.Location
+	if err := row.Scan(&l.ID, &l.OrgID, &l.ParentID, &l.Kind, &l.Name, &l.CreatedAt, &l.UpdatedAt); err != nil {
+		return nil, err
+	}
+	return &l, nil
+}
+
+// isUniqueViolation 判断是否为唯一约束冲突
+func isUniqueViolation(err error) bool {
+	var pqErr *pq.Error
+	return errors.As(err, &pqErr) && pqErr.Code == "23505"
+}
+
+// Create 创建位置
+func (r *LocationRepository) Create(ctx context.Context, l *models.Location) error {
+	err := r.db.QueryRowContext(ctx,
+		`INSERT INTO locations (org_id, parent_id, kind, name) VALUES ($1, $2, $3, $4) RETURNING id, created_at, updated_at`,
+		l.OrgID, l.ParentID, l.Kind, l.Name).Scan(&l.ID, &l.CreatedAt, &l.UpdatedAt)
+	if isUniqueViolation(err) {
+		return ErrLocationNameExists
+	}
+	return err
+}
+
+// Get 查询位置，不存在返回 nil
+func (r *LocationRepository) Get(ctx context.Context, id int) (*models.Location, error) {
+	cond, args := orgClause(ctx, "org_id", []interface{}{id})
+	l, err := scanLocation(r.db.QueryRowContext(ctx, `SELECT `+locationColumns+` FROM locations WHERE id = $1`+cond, args...))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	return l, err
+}
+
+// List 查询位置；parentID 非 nil 时仅返回其直接下级，为 0 时返回顶级位置
+func (r *LocationRepository) List(ctx context.Context, parentID *int) ([]models.Location, error) {
+	query := `SELECT ` + locationColumns + ` FROM locations WHERE TRUE`
+	var args []interface{}
+	switch {
+	case parentID == nil:
+	case *parentID == 0:
+		query += ` AND parent_id IS NULL`
+	default:
+		args = append(args, *parentID)
+		query += ` AND parent_id = $1`
+	}
+	cond, args := orgClause(ctx, "org_id", args)
+	rows, err := r.db.QueryContext(ctx, query+cond+` ORDER BY parent_id NULLS FIRST, name`, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var list []models.Location
+	for rows.Next() {
+		l, err := scanLocation(rows)
+		if err != nil {
+			return nil, err
+		}
+		list = append(list, *l)
+	}
+	return list, rows.Err()
+}
+
+// Rename 修改位置名称，返回是否更新
+func (r *LocationRepository) Rename(ctx context.Context, id int, name string) (bool, error) {
+	cond, args := orgClause(ctx, "org_id", []interface{}{id, name})
+	res, err := r.db.ExecContext(ctx, `UPDATE locations SET name = $2, updated_at = NOW() WHERE id = $1`+cond, args...)
+	if isUniqueViolation(err) {
+		return false, ErrLocationNameExists
+	}
+	if err != nil {
+		return false, err
+	}
+	n, _ := res.RowsAffected()
+	return n > 0, nil
+}
+
+// InUse 判断位置是否有下级、放置的设备或分配的档案
+func (r *LocationRepository) InUse(ctx context.Context, id int) (bool, error) {
+	var inUse bool
+	err := r.db.QueryRowContext(ctx, `SELECT EXISTS (SELECT 1 FROM locations WHERE parent_id = $1)
+		OR EXISTS (SELECT 1 FROM devices WHERE location_id = $1)
+		OR EXISTS (SELECT 1 FROM health_profiles WHERE bed_id = $1)`, id).Scan(&inUse)
+	return inUse, err
+}
+
+// Delete 删除位置，返回是否删除
+func (r *LocationRepository) Delete(ctx context.Context, id int) (bool, error) {
+	cond, args := orgClause(ctx, "org_id", []interface{}{id})
+	res, err := r.db.ExecContext(ctx, `DELETE FROM locations WHERE id = $1`+cond, args...)
+	if err != nil {
+		return false, err
+	}
+	n, _ := res.RowsAffected()
+	return n > 0, nil
+}
+
+// Paths 查询位置完整路径（上级在前，以 " / " 分隔），ids 应来自已按租户过滤的记录
+func (r *LocationRepository) Paths(ctx context.Context, ids []int) (map[int]string, error) {
+	paths := make(map[int]string, len(ids))
+	if len(ids) == 0 {
+		return paths, nil
+	}
+	rows, err := r.db.QueryContext(ctx,
+		`WITH RECURSIVE chain AS (
+			SELECT id AS leaf, parent_id, name, 0 AS depth FROM locations WHERE id = ANY($1)
+			UNION ALL
+			SELECT c.leaf, l.parent_id, l.name, c.depth + 1 FROM locations l JOIN chain c ON l.id = c.parent_id
+		)
+		SELECT leaf, string_agg(name, ' / ' ORDER BY depth DESC) FROM chain GROUP BY leaf`, pq.Array(ids))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var id int
+		var path string
+		if err := rows.Scan(&id, &path); err != nil {
+			return nil, err
+		}
+		paths[id] = path
+	}
+	return paths, rows.Err()
+}
+
+// SetDeviceLocation 设置设备放置位置（nil 为移出），位置须与设备属于同一组织；设备不存在或跨组织时返回 false
+func (r *LocationRepository) SetDeviceLocation(ctx context.Context, deviceID int, locationID *int) (bool, error) {
+	cond, args := orgClause(ctx, "d.org_id", []interface{}{deviceID, locationID})
+	res, err := r.db.ExecContext(ctx,
+		`UPDATE devices d SET location_id = $2, updated_at = NOW()
+		 WHERE d.id = $1 AND ($2::INT IS NULL OR EXISTS (SELECT 1 FROM locations l WHERE l.id = $2 AND l.org_id = d.org_id))`+cond,
+		args...)
+	if err != nil {
+		return false, err
+	}
+	n, _ := res.RowsAffected()
+	return n > 0, nil
+}
+
+// SetProfileBed 设置档案床位（nil 为退床），床位须与档案属于同一组织；档案不存在或跨组织时返回 false，
+// 床位已分配给其他档案时返回 ErrBedOccupied
+func (r *LocationRepository) SetProfileBed(ctx context.Context, profileID int, bedID *int) (bool, error) {
+	cond, args := orgClause(ctx, "p.org_id", []interface{}{profileID, bedID, models.LocationKindBed})
+	res, err := r.db.ExecContext(ctx,
+		`UPDATE health_profiles p SET bed_id = $2, updated_at = NOW()
+		 WHERE p.id = $1 AND ($2::INT IS NULL OR EXISTS (
+		 	SELECT 1 FROM locations l WHERE l.id = $2 AND l.org_id = p.org_id AND l.kind = $3))`+cond,
+		args...)
+	if isUniqueViolation(err) {
+		return false, ErrBedOccupied
+	}
+	if err != nil {
+		return false, err
+	}
+	n, _ := res.RowsAffected()
+	return n > 0, nil
+}
+
+// Occupancy 统计位置（含下级）内的床位总数与已分配床位数；locationID 为 0 时统计全部
+func (r *LocationRepository) Occupancy(ctx context.Context, locationID int) (beds, occupied int, err error) {
+	query := `SELECT COUNT(*), COUNT(p.id) FROM locations l LEFT JOIN health_profiles p ON p.bed_id = l.id WHERE l.kind = $1`
+	args := []interface{}{models.LocationKindBed}
+	if locationID > 0 {
+		args = append(args, locationID)
+		query += fmt.Sprintf(` AND l.id IN `+locationSubtree, len(args))
+	}
+	cond, args := orgClause(ctx, "l.org_id", args)
+	err = r.db.QueryRowContext(ctx, query+cond, args...).Scan(&beds, &occupied)
+	return beds, occupied, err
+}
+
+// DeviceLocation 设备所在位置：放置位置优先，未放置时为当前绑定档案的床位；均无时返回 nil
+func (r *LocationRepository) DeviceLocation(ctx context.Context, deviceID int) (*models.Location, error) {
+	return r.deviceLocation(ctx, "d.id = $1", deviceID)
+}
+
+// SerialLocation 按序列号查询设备所在位置，规则同 DeviceLocation
+func (r *LocationRepository) SerialLocation(ctx context.Context, sn string) (*models.Location, error) {
+	return r.deviceLocation(ctx, "d.serial_number = $1", sn)
+}
+
+func (r *LocationRepository) deviceLocation(ctx context.Context, where string, arg interface{}) (*models.Location, error) {
+	var id *int
+	err := r.db.QueryRowContext(ctx,
+		`SELECT COALESCE(d.location_id, p.bed_id) FROM devices d
+		 LEFT JOIN health_profiles p ON p.id = (SELECT health_profile_id FROM device_assignments
+		 	WHERE device_id = d.id AND unassigned_at IS NULL ORDER BY assigned_at DESC LIMIT 1)
+		 WHERE `+where, arg).Scan(&id)
+	if errors.Is(err, sql.ErrNoRows) || (err == nil && id == nil) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	paths, err := r.Paths(ctx, []int{*id})
+	if err != nil {
+		return nil, err
+	}
+	return &models.Location{ID: *id, Path: paths[*id]}, nil
+}
@@ -0,0 +1,101 @@
+// Package postgres 组织（租户）数据仓储
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+
+	"github.com/fire-disposal/health_DT_go/internal/models"
+)
+
+const organizationColumns = `id, code, name, created_at, updated_at`
+
+// OrganizationRepository 组织仓储接口；组织本身不按租户过滤，仅平台管理员可访问
+type OrganizationRepository interface {
+	Create(ctx context.Context, org *models.Organization) error
+	// Get 查询组织，不存在返回 nil
+	Get(ctx context.Context, id int) (*models.Organization, error)
+	GetByCode(ctx context.Context, code string) (*models.Organization, error)
+	List(ctx context.Context) ([]models.Organization, error)
+	Update(ctx context.Context, org *models.Organization) error
+	Delete(ctx context.Context, id int) error
+	// InUse 组织下是否仍有管理员、设备、健康档案或告警
+	InUse(ctx context.Context, id int) (bool, error)
+}
+
+type organizationRepo struct {
+	db *sql.DB
+}
+
+// NewOrganizationRepository 创建组织仓储实例
+func NewOrganizationRepository(db *sql.DB) OrganizationRepository {
+	return &organizationRepo{db: db}
+}
+
+func scanOrganization(row rowScanner) (*models.Organization, error) {
+	var org models.Organization
+	if err := row.Scan(&org.ID, &org.Code, &org.Name, &org.CreatedAt, &org.UpdatedAt); err != nil {
+		return nil, err
+	}
+	return &org, nil
+}
+
+func (r *organizationRepo) Create(ctx context.Context, org *models.Organization) error {
+	return r.db.QueryRowContext(ctx, `INSERT INTO organizations (code, name, created_at, updated_at)
+		VALUES ($1, $2, NOW(), NOW()) RETURNING id, created_at, updated_at`, org.Code, org.Name).
+		Scan(&org.ID, &org.CreatedAt, &org.UpdatedAt)
+}
+
+func (r *organizationRepo) Get(ctx context.Context, id int) (*models.Organization, error) {
+	org, err := scanOrganization(r.db.QueryRowContext(ctx, `SELECT `+organizationColumns+` FROM organizations WHERE id = $1`, id))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	return org, err
+}
+
+func (r *organizationRepo) GetByCode(ctx context.Context, code string) (*models.Organization, error) {
+	org, err := scanOrganization(r.db.QueryRowContext(ctx, `SELECT `+organizationColumns+` FROM organizations WHERE code = $1`, code))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	return org, err
+}
+
+func (r *organizationRepo) List(ctx context.Context) ([]models.Organization, error) {
+	rows, err := r.db.QueryContext(ctx, `SELECT `+organizationColumns+` FROM organizations ORDER BY id`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var orgs []models.Organization
+	for rows.Next() {
+		org, err := scanOrganization(rows)
+		if err != nil {
+			return nil, err
+		}
+		orgs = append(orgs, *org)
+	}
+	return orgs, rows.Err()
+}
+
+func (r *organizationRepo) Update(ctx context.Context, org *models.Organization) error {
+	return r.db.QueryRowContext(ctx, `UPDATE organizations SET name = $1, updated_at = NOW() WHERE id = $2 RETURNING updated_at`,
+		org.Name, org.ID).Scan(&org.UpdatedAt)
+}
+
+func (r *organizationRepo) Delete(ctx context.Context, id int) error {
+	_, err := r.db.ExecContext(ctx, `DELETE FROM organizations WHERE id = $1`, id)
+	return err
+}
+
+func (r *organizationRepo) InUse(ctx context.Context, id int) (bool, error) {
+	var inUse bool
+	err := r.db.QueryRowContext(ctx, `SELECT EXISTS (SELECT 1 FROM admin_users WHERE org_id = $1)
+		OR EXISTS (SELECT 1 FROM devices WHERE org_id = $1)
+		OR EXISTS (SELECT 1 FROM health_profiles WHERE org_id = $1)
+		OR EXISTS (SELECT 1 FROM alerts WHERE org_id = $1)
+		OR EXISTS (SELECT 1 FROM locations WHERE org_id = $1)`, id).Scan(&inUse)
+	return inUse, err
+}
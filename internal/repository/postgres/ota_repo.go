@@ -0,0 +1,371 @@
+// Package postgres 固件升级（OTA）仓储
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/fire-disposal/health_DT_go/internal/models"
+	"github.com/lib/pq"
+)
+
+// ErrFirmwareArtifactExists 同组织同设备类型的固件版本已存在
+var ErrFirmwareArtifactExists = errors.New("该设备类型的固件版本已存在")
+
+const firmwareArtifactColumns = `id, org_id, device_type, version, file_name, file_path, size, sha256, COALESCE(notes, ''),
+	COALESCE(created_by, 0), created_at`
+
+// 升级活动的设备类型与目标版本取自固件
+const otaCampaignSelect = `SELECT c.id, c.org_id, c.name, c.artifact_id, a.device_type, a.version, c.from_versions,
+	c.rollout_percent, c.failure_threshold_percent, c.min_samples, c.status, COALESCE(c.pause_reason, ''),
+	COALESCE(c.created_by, 0), c.created_at, c.updated_at
+	FROM ota_campaigns c JOIN firmware_artifacts a ON a.id = c.artifact_id`
+
+// OTACandidate 符合升级活动条件的设备
+type OTACandidate struct {
+	DeviceID     int
+	SerialNumber string
+	Version      string // 设备影子上报的当前固件版本
+}
+
+// OTARepository 固件与升级活动仓储；接口查询按 context 租户范围过滤，
+// 设备上报与后台任务使用的方法不做过滤
+type OTARepository struct {
+	db *sql.DB
+}
+
+// NewOTARepository 创建固件升级仓储实例
+func NewOTARepository(db *sql.DB) *OTARepository {
+	return &OTARepository{db: db}
+}
+
+func scanFirmwareArtifact(row rowScanner) (*models.FirmwareArtifact, error) {
+	var a models.FirmwareArtifact
+	if err := row.Scan(&a.ID, &a.OrgID, &a.DeviceType, &a.Version, &a.FileName, &a.FilePath, &a.Size, &a.SHA256,
+		&a.Notes, &a.CreatedBy, &a.CreatedAt); err != nil {
+		return nil, err
+	}
+	return &a, nil
+}
+
+func scanOTACampaign(row rowScanner) (*models.OTACampaign, error) {
+	var c models.OTACampaign
+	var fromVersions pq.StringArray
+	if err := row.Scan(&c.ID, &c.OrgID, &c.Name, &c.ArtifactID, &c.DeviceType, &c.TargetVersion, &fromVersions,
+		&c.RolloutPercent, &c.FailureThresholdPercent, &c.MinSamples, &c.Status, &c.PauseReason,
+		&c.CreatedBy, &c.CreatedAt, &c.UpdatedAt); err != nil {
+		return nil, err
+	}
+	c.FromVersions = []string(fromVersions)
+	if c.FromVersions == nil {
+		c.FromVersions = []string{}
+	}
+	return &c, nil
+}
+
+// CreateArtifact 写入固件记录；同组织同设备类型版本重复时返回 ErrFirmwareArtifactExists
+func (r *OTARepository) CreateArtifact(ctx context.Context, a *models.FirmwareArtifact) error {
+	err := r.db.QueryRowContext(ctx,
+		`INSERT INTO firmware_artifacts (org_id, device_type, version, file_name, file_path, size, sha256, notes, created_by)
+		 VALUES ($1, $2, $3, $4, $5, $6, $7, NULLIF($8, ''), NULLIF($9, 0)) RETURNING id, created_at`,
+		a.OrgID, a.DeviceType, a.Version, a.FileName, a.FilePath, a.Size, a.SHA256, a.Notes, a.CreatedBy,
+	).Scan(&a.ID, &a.CreatedAt)
+	if isUniqueViolation(err) {
+		return ErrFirmwareArtifactExists
+	}
+	return err
+}
+
+// GetArtifact 查询固件，不存在返回 nil
+func (r *OTARepository) GetArtifact(ctx context.Context, id int) (*models.FirmwareArtifact, error) {
+	cond, args := orgClause(ctx, "org_id", []interface{}{id})
+	a, err := scanFirmwareArtifact(r.db.QueryRowContext(ctx,
+		`SELECT `+firmwareArtifactColumns+` FROM firmware_artifacts WHERE id = $1`+cond, args...))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	return a, err
+}
+
+// ArtifactExists 组织内是否已有同设备类型、同版本的固件
+func (r *OTARepository) ArtifactExists(ctx context.Context, orgID int, deviceType, version string) (bool, error) {
+	var exists bool
+	err := r.db.QueryRowContext(ctx,
+		`SELECT EXISTS (SELECT 1 FROM firmware_artifacts WHERE org_id = $1 AND device_type = $2 AND version = $3)`,
+		orgID, deviceType, version).Scan(&exists)
+	return exists, err
+}
+
+// ListArtifacts 固件列表，deviceType 为空时不过滤，按创建时间倒序
+func (r *OTARepository) ListArtifacts(ctx context.Context, deviceType string) ([]models.FirmwareArtifact, error) {
+	cond, args := orgClause(ctx, "org_id", []interface{}{deviceType})
+	rows, err := r.db.QueryContext(ctx,
+		`SELECT `+firmwareArtifactColumns+` FROM firmware_artifacts WHERE ($1 = '' OR device_type = $1)`+cond+
+			` ORDER BY created_at DESC, id DESC`, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var list []models.FirmwareArtifact
+	for rows.Next() {
+		a, err := scanFirmwareArtifact(rows)
+		if err != nil {
+			return nil, err
+		}
+		list = append(list, *a)
+	}
+	return list, rows.Err()
+}
+
+// ArtifactForDevice 查询设备可下载的固件：设备须在使用该固件的进行中或已暂停活动内，不存在返回 nil
+func (r *OTARepository) ArtifactForDevice(ctx context.Context, sn string, artifactID int) (*models.FirmwareArtifact, error) {
+	a, err := scanFirmwareArtifact(r.db.QueryRowContext(ctx,
+		`SELECT `+firmwareArtifactColumns+` FROM firmware_artifacts WHERE id = $1 AND EXISTS (
+			SELECT 1 FROM ota_campaign_devices cd
+			JOIN ota_campaigns c ON c.id = cd.campaign_id
+			JOIN devices d ON d.id = cd.device_id
+			WHERE c.artifact_id = $1 AND d.serial_number = $2 AND c.status IN ($3, $4))`,
+		artifactID, sn, models.OTACampaignRunning, models.OTACampaignPaused))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	return a, err
+}
+
+// CreateCampaign 写入草稿状态的升级活动，回填设备类型与目标版本
+func (r *OTARepository) CreateCampaign(ctx context.Context, c *models.OTACampaign) error {
+	err := r.db.QueryRowContext(ctx,
+		`INSERT INTO ota_campaigns (org_id, name, artifact_id, from_versions, rollout_percent, failure_threshold_percent,
+			min_samples, status, created_by)
+		 VALUES ($1, $2, $3, $4, $5, $6, $7, $8, NULLIF($9, 0)) RETURNING id, status, created_at, updated_at`,
+		c.OrgID, c.Name, c.ArtifactID, pq.Array(c.FromVersions), c.RolloutPercent, c.FailureThresholdPercent,
+		c.MinSamples, models.OTACampaignDraft, c.CreatedBy,
+	).Scan(&c.ID, &c.Status, &c.CreatedAt, &c.UpdatedAt)
+	if err != nil {
+		return err
+	}
+	return r.db.QueryRowContext(ctx, `SELECT device_type, version FROM firmware_artifacts WHERE id = $1`, c.ArtifactID).
+		Scan(&c.DeviceType, &c.TargetVersion)
+}
+
+// GetCampaign 查询升级活动，不存在返回 nil
+func (r *OTARepository) GetCampaign(ctx context.Context, id int) (*models.OTACampaign, error) {
+	cond, args := orgClause(ctx, "c.org_id", []interface{}{id})
+	c, err := scanOTACampaign(r.db.QueryRowContext(ctx, otaCampaignSelect+` WHERE c.id = $1`+cond, args...))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	return c, err
+}
+
+// ListCampaigns 升级活动列表，status 为空时不过滤，按创建时间倒序
+func (r *OTARepository) ListCampaigns(ctx context.Context, status string) ([]models.OTACampaign, error) {
+	cond, args := orgClause(ctx, "c.org_id", []interface{}{status})
+	rows, err := r.db.QueryContext(ctx,
+		otaCampaignSelect+` WHERE ($1 = '' OR c.status = $1)`+cond+` ORDER BY c.created_at DESC, c.id DESC`, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var list []models.OTACampaign
+	for rows.Next() {
+		c, err := scanOTACampaign(rows)
+		if err != nil {
+			return nil, err
+		}
+		list = append(list, *c)
+	}
+	return list, rows.Err()
+}
+
+// RunningCampaignIDs 进行中的升级活动ID（后台任务使用，不按租户过滤）
+func (r *OTARepository) RunningCampaignIDs(ctx context.Context) ([]int, error) {
+	rows, err := r.db.QueryContext(ctx, `SELECT id FROM ota_campaigns WHERE status = $1 ORDER BY id`, models.OTACampaignRunning)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var ids []int
+	for rows.Next() {
+		var id int
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	return ids, rows.Err()
+}
+
+// TransitionCampaign 当活动状态在 from 之内时改为 to 并记录暂停原因，返回是否更新
+func (r *OTARepository) TransitionCampaign(ctx context.Context, id int, from []string, to, reason string) (bool, error) {
+	res, err := r.db.ExecContext(ctx,
+		`UPDATE ota_campaigns SET status = $1, pause_reason = NULLIF($2, ''), updated_at = NOW()
+		 WHERE id = $3 AND status = ANY($4)`,
+		to, reason, id, pq.Array(from))
+	if err != nil {
+		return false, err
+	}
+	n, _ := res.RowsAffected()
+	return n > 0, nil
+}
+
+// RaiseRollout 提高放量比例，仅当新比例大于当前比例且活动未结束时更新，返回是否更新
+func (r *OTARepository) RaiseRollout(ctx context.Context, id, percent int) (bool, error) {
+	res, err := r.db.ExecContext(ctx,
+		`UPDATE ota_campaigns SET rollout_percent = $1, updated_at = NOW()
+		 WHERE id = $2 AND rollout_percent < $1 AND status IN ($3, $4, $5)`,
+		percent, id, models.OTACampaignDraft, models.OTACampaignRunning, models.OTACampaignPaused)
+	if err != nil {
+		return false, err
+	}
+	n, _ := res.RowsAffected()
+	return n > 0, nil
+}
+
+// Candidates 查询符合活动条件、尚未纳入活动的设备：同组织、同设备类型的启用设备，
+// 当前固件（设备影子 reported.firmware）不是目标版本，且 from_versions 非空时须在其中
+func (r *OTARepository) Candidates(ctx context.Context, c *models.OTACampaign) ([]OTACandidate, error) {
+	rows, err := r.db.QueryContext(ctx,
+		`SELECT d.id, d.serial_number, COALESCE(s.reported->>'firmware', '')
+		 FROM devices d LEFT JOIN device_shadows s ON s.device_id = d.id
+		 WHERE d.org_id = $1 AND d.device_type = $2 AND d.is_active
+		   AND COALESCE(s.reported->>'firmware', '') <> $3
+		   AND (cardinality($4::text[]) = 0 OR s.reported->>'firmware' = ANY($4))
+		   AND NOT EXISTS (SELECT 1 FROM ota_campaign_devices cd WHERE cd.campaign_id = $5 AND cd.device_id = d.id)
+		 ORDER BY d.id`,
+		c.OrgID, c.DeviceType, c.TargetVersion, pq.Array(c.FromVersions), c.ID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var list []OTACandidate
+	for rows.Next() {
+		var cd OTACandidate
+		if err := rows.Scan(&cd.DeviceID, &cd.SerialNumber, &cd.Version); err != nil {
+			return nil, err
+		}
+		list = append(list, cd)
+	}
+	return list, rows.Err()
+}
+
+// Enroll 将设备以 pending 状态纳入活动（已纳入时忽略）
+func (r *OTARepository) Enroll(ctx context.Context, campaignID int, cd OTACandidate) error {
+	_, err := r.db.ExecContext(ctx,
+		`INSERT INTO ota_campaign_devices (campaign_id, device_id, from_version, status)
+		 VALUES ($1, $2, NULLIF($3, ''), $4) ON CONFLICT (campaign_id, device_id) DO NOTHING`,
+		campaignID, cd.DeviceID, cd.Version, models.OTADevicePending)
+	return err
+}
+
+// PendingDevices 活动中尚未下发的设备
+func (r *OTARepository) PendingDevices(ctx context.Context, campaignID int) ([]OTACandidate, error) {
+	rows, err := r.db.QueryContext(ctx,
+		`SELECT d.id, d.serial_number, COALESCE(cd.from_version, '')
+		 FROM ota_campaign_devices cd JOIN devices d ON d.id = cd.device_id
+		 WHERE cd.campaign_id = $1 AND cd.status = $2 ORDER BY d.id`,
+		campaignID, models.OTADevicePending)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var list []OTACandidate
+	for rows.Next() {
+		var cd OTACandidate
+		if err := rows.Scan(&cd.DeviceID, &cd.SerialNumber, &cd.Version); err != nil {
+			return nil, err
+		}
+		list = append(list, cd)
+	}
+	return list, rows.Err()
+}
+
+// MarkDeviceSent 标记已下发；设备状态上报先于本调用到达时不覆盖
+func (r *OTARepository) MarkDeviceSent(ctx context.Context, campaignID, deviceID int) error {
+	_, err := r.db.ExecContext(ctx,
+		`UPDATE ota_campaign_devices SET status = $1, sent_at = NOW(), updated_at = NOW()
+		 WHERE campaign_id = $2 AND device_id = $3 AND status = $4`,
+		models.OTADeviceSent, campaignID, deviceID, models.OTADevicePending)
+	return err
+}
+
+// UpdateDeviceStatus 按设备序列号记录升级进度，已成功或失败的记录、已取消或已结束的活动不再更新；返回是否命中
+func (r *OTARepository) UpdateDeviceStatus(ctx context.Context, campaignID int, sn, status string, progress int, reason string) (bool, error) {
+	res, err := r.db.ExecContext(ctx,
+		`UPDATE ota_campaign_devices cd SET status = $1, progress = $2, error = NULLIF($3, ''), updated_at = NOW()
+		 FROM devices d, ota_campaigns c
+		 WHERE d.id = cd.device_id AND d.serial_number = $4 AND cd.campaign_id = $5 AND cd.status NOT IN ($6, $7)
+		   AND c.id = cd.campaign_id AND c.status IN ($8, $9)`,
+		status, progress, reason, sn, campaignID, models.OTADeviceSucceeded, models.OTADeviceFailed,
+		models.OTACampaignRunning, models.OTACampaignPaused)
+	if err != nil {
+		return false, err
+	}
+	n, _ := res.RowsAffected()
+	return n > 0, nil
+}
+
+// ExpireStaleDevices 将已下发但超过 timeout 无进度上报的设备标记为失败，返回标记数
+func (r *OTARepository) ExpireStaleDevices(ctx context.Context, campaignID int, timeout time.Duration) (int64, error) {
+	res, err := r.db.ExecContext(ctx,
+		`UPDATE ota_campaign_devices SET status = $1, error = $2, updated_at = NOW()
+		 WHERE campaign_id = $3 AND status IN ($4, $5, $6) AND updated_at < $7`,
+		models.OTADeviceFailed, "升级超时：设备长时间未上报进度", campaignID,
+		models.OTADeviceSent, models.OTADeviceDownloading, models.OTADeviceInstalling, time.Now().Add(-timeout))
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
+
+// CampaignStats 统计活动中各状态的设备数
+func (r *OTARepository) CampaignStats(ctx context.Context, campaignID int) (*models.OTACampaignStats, error) {
+	rows, err := r.db.QueryContext(ctx,
+		`SELECT status, COUNT(*) FROM ota_campaign_devices WHERE campaign_id = $1 GROUP BY status`, campaignID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	stats := &models.OTACampaignStats{ByStatus: map[string]int{}}
+	for rows.Next() {
+		var status string
+		var n int
+		if err := rows.Scan(&status, &n); err != nil {
+			return nil, err
+		}
+		stats.ByStatus[status] = n
+		stats.Enrolled += n
+	}
+	return stats, rows.Err()
+}
+
+// ListCampaignDevices 活动中的设备，status 为空时不过滤
+func (r *OTARepository) ListCampaignDevices(ctx context.Context, campaignID int, status string, limit int) ([]models.OTACampaignDevice, error) {
+	rows, err := r.db.QueryContext(ctx,
+		`SELECT cd.campaign_id, cd.device_id, d.serial_number, COALESCE(cd.from_version, ''), cd.status, cd.progress,
+			COALESCE(cd.error, ''), cd.sent_at, cd.updated_at
+		 FROM ota_campaign_devices cd JOIN devices d ON d.id = cd.device_id
+		 WHERE cd.campaign_id = $1 AND ($2 = '' OR cd.status = $2)
+		 ORDER BY cd.updated_at DESC, cd.device_id LIMIT $3`,
+		campaignID, status, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var list []models.OTACampaignDevice
+	for rows.Next() {
+		var d models.OTACampaignDevice
+		var sentAt sql.NullTime
+		if err := rows.Scan(&d.CampaignID, &d.DeviceID, &d.SerialNumber, &d.FromVersion, &d.Status, &d.Progress,
+			&d.Error, &sentAt, &d.UpdatedAt); err != nil {
+			return nil, err
+		}
+		if sentAt.Valid {
+			d.SentAt = &sentAt.Time
+		}
+		list = append(list, d)
+	}
+	return list, rows.Err()
+}
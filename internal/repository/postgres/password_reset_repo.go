@@ -0,0 +1,82 @@
+// Package postgres 密码重置验证码数据仓储
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+
+	"github.com/fire-disposal/health_DT_go/internal/models"
+)
+
+// PasswordResetRepository 密码重置验证码仓储接口
+type PasswordResetRepository interface {
+	Create(ctx context.Context, code *models.PasswordResetCode) error
+	// GetLatestActive 查询用户最近一条未使用且未过期的验证码
+	GetLatestActive(ctx context.Context, userType string, userID int64) (*models.PasswordResetCode, error)
+	IncrementAttempts(ctx context.Context, id int64) error
+	MarkUsed(ctx context.Context, id int64) error
+	// InvalidateAll 作废用户所有未使用的验证码
+	InvalidateAll(ctx context.Context, userType string, userID int64) error
+}
+
+type passwordResetRepo struct {
+	db *sql.DB
+}
+
+// NewPasswordResetRepository 创建密码重置验证码仓储实例
+func NewPasswordResetRepository(db *sql.DB) PasswordResetRepository {
+	return &passwordResetRepo{db: db}
+}
+
+func (r *passwordResetRepo) Create(ctx context.Context, code *models.PasswordResetCode) error {
+	query := `INSERT INTO password_reset_codes (user_type, user_id, code_hash, attempts, expires_at, created_at)
+		VALUES ($1, $2, $3, 0, $4, NOW()) RETURNING id, created_at`
+	return r.db.QueryRowContext(ctx, query, code.UserType, code.UserID, code.CodeHash, code.ExpiresAt).Scan(&code.ID, &code.CreatedAt)
+}
+
+func (r *passwordResetRepo) GetLatestActive(ctx context.Context, userType string, userID int64) (*models.PasswordResetCode, error) {
+	query := `SELECT id, user_type, user_id, code_hash, attempts, expires_at, used_at, created_at
+		FROM password_reset_codes
+		WHERE user_type = $1 AND user_id = $2 AND used_at IS NULL AND expires_at > NOW()
+		ORDER BY created_at DESC LIMIT 1`
+	var c models.PasswordResetCode
+	err := r.db.QueryRowContext(ctx, query, userType, userID).Scan(
+		&c.ID, &c.UserType, &c.UserID, &c.CodeHash, &c.Attempts, &c.ExpiresAt, &c.UsedAt, &c.CreatedAt,
+	)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &c, nil
+}
+
+func (r *passwordResetRepo) IncrementAttempts(ctx context.Context, id int64) error {
+	_, err := r.db.ExecContext(ctx, `UPDATE password_reset_codes SET attempts = attempts + 1 WHERE id = $1`, id)
+	return err
+}
+
+// MarkUsed 标记验证码已使用；仅当尚未使用时更新，防止并发重复使用
+func (r *passwordResetRepo) MarkUsed(ctx context.Context, id int64) error {
+	res, err := r.db.ExecContext(ctx, `UPDATE password_reset_codes SET used_at = NOW() WHERE id = $1 AND used_at IS NULL`, id)
+	if err != nil {
+		return err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return errors.New("验证码已被使用")
+	}
+	return nil
+}
+
+func (r *passwordResetRepo) InvalidateAll(ctx context.Context, userType string, userID int64) error {
+	_, err := r.db.ExecContext(ctx,
+		`UPDATE password_reset_codes SET used_at = NOW() WHERE user_type = $1 AND user_id = $2 AND used_at IS NULL`,
+		userType, userID)
+	return err
+}
@@ -0,0 +1,80 @@
+// Package postgres 待注册设备仓储
+package postgres
+
+import (
+	"context"
+	"database/sql"
+
+	"github.com/fire-disposal/health_DT_go/internal/models"
+	"github.com/lib/pq"
+)
+
+// PendingDeviceRepository 待注册设备仓储；未注册设备尚无所属组织，不按租户过滤
+type PendingDeviceRepository struct {
+	db *sql.DB
+}
+
+// NewPendingDeviceRepository 创建待注册设备仓储实例
+func NewPendingDeviceRepository(db *sql.DB) *PendingDeviceRepository {
+	return &PendingDeviceRepository{db: db}
+}
+
+// Upsert 记录未注册序列号的一次上行；新序列号仅在待注册总数小于 limit 时写入，防止伪造序列号刷库
+func (r *PendingDeviceRepository) Upsert(ctx context.Context, sn, source, detail string, limit int) error {
+	_, err := r.db.ExecContext(ctx,
+		`INSERT INTO pending_devices (serial_number, source, detail)
+		 SELECT $1, $2, NULLIF($3, '') WHERE (SELECT COUNT(*) FROM pending_devices) < $4
+		 ON CONFLICT (serial_number) DO UPDATE
+		 SET source = EXCLUDED.source, detail = EXCLUDED.detail, last_seen_at = NOW(),
+		     seen_count = pending_devices.seen_count + 1`,
+		sn, source, detail, limit)
+	return err
+}
+
+// List 待注册设备，按最近上行时间倒序
+func (r *PendingDeviceRepository) List(ctx context.Context, limit int) ([]models.PendingDevice, error) {
+	rows, err := r.db.QueryContext(ctx,
+		`SELECT serial_number, source, COALESCE(detail, ''), first_seen_at, last_seen_at, seen_count
+		 FROM pending_devices ORDER BY last_seen_at DESC, serial_number LIMIT $1`, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var list []models.PendingDevice
+	for rows.Next() {
+		var d models.PendingDevice
+		if err := rows.Scan(&d.SerialNumber, &d.Source, &d.Detail, &d.FirstSeenAt, &d.LastSeenAt, &d.SeenCount); err != nil {
+			return nil, err
+		}
+		list = append(list, d)
+	}
+	return list, rows.Err()
+}
+
+// Existing 返回 sns 中仍在待注册列表内的序列号
+func (r *PendingDeviceRepository) Existing(ctx context.Context, sns []string) (map[string]bool, error) {
+	rows, err := r.db.QueryContext(ctx,
+		`SELECT serial_number FROM pending_devices WHERE serial_number = ANY($1)`, pq.Array(sns))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	found := make(map[string]bool, len(sns))
+	for rows.Next() {
+		var sn string
+		if err := rows.Scan(&sn); err != nil {
+			return nil, err
+		}
+		found[sn] = true
+	}
+	return found, rows.Err()
+}
+
+// Delete 从待注册列表移除序列号，返回移除行数
+func (r *PendingDeviceRepository) Delete(ctx context.Context, sns []string) (int64, error) {
+	res, err := r.db.ExecContext(ctx, `DELETE FROM pending_devices WHERE serial_number = ANY($1)`, pq.Array(sns))
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
@@ -0,0 +1,136 @@
+// Package postgres 个人标识字段加解密辅助
+package postgres
+
+import (
+	"database/sql"
+	"encoding/json"
+	"strings"
+	"time"
+
+	"github.com/fire-disposal/health_DT_go/internal/fieldcrypt"
+	"github.com/fire-disposal/health_DT_go/internal/models"
+)
+
+// 盲索引域，按列区分
+const (
+	bidxAppUserEmail  = "app_users.email"
+	bidxAppUserPhone  = "app_users.phone"
+	bidxAppUserOpenID = "app_users.wechat_openid"
+)
+
+const birthDateLayout = "2006-01-02"
+
+// sealedField 加密后的字段值及其盲索引
+type sealedField struct {
+	Value string
+	Index string
+}
+
+// appUserPII App 用户加密字段
+type appUserPII struct {
+	Email, Phone, OpenID sealedField
+}
+
+// sealIndexed 加密字段并计算盲索引，空值两者均为空
+func sealIndexed(keys *fieldcrypt.Keyring, domain, value string) (sealedField, error) {
+	enc, err := keys.Encrypt(value)
+	if err != nil {
+		return sealedField{}, err
+	}
+	return sealedField{Value: enc, Index: keys.BlindIndex(domain, value)}, nil
+}
+
+// normalizeEmail 邮箱大小写不敏感，盲索引前统一转小写
+func normalizeEmail(email string) string {
+	return strings.ToLower(strings.TrimSpace(email))
+}
+
+func sealAppUserPII(keys *fieldcrypt.Keyring, email, phone, openid string) (*appUserPII, error) {
+	var (
+		pii appUserPII
+		err error
+	)
+	if pii.Email, err = sealIndexed(keys, bidxAppUserEmail, email); err != nil {
+		return nil, err
+	}
+	pii.Email.Index = keys.BlindIndex(bidxAppUserEmail, normalizeEmail(email))
+	if pii.Phone, err = sealIndexed(keys, bidxAppUserPhone, strings.TrimSpace(phone)); err != nil {
+		return nil, err
+	}
+	if pii.OpenID, err = sealIndexed(keys, bidxAppUserOpenID, openid); err != nil {
+		return nil, err
+	}
+	return &pii, nil
+}
+
+// openAppUser 解密 App 用户加密字段
+func openAppUser(keys *fieldcrypt.Keyring, user *models.AppUser) error {
+	for _, field := range []*string{&user.Email, &user.Phone, &user.WechatOpenID} {
+		plain, err := keys.Decrypt(*field)
+		if err != nil {
+			return err
+		}
+		*field = plain
+	}
+	return nil
+}
+
+// sealedProfile 健康档案加密字段，birth_date 以 YYYY-MM-DD 文本加密，metadata 以 JSON 文本加密
+type sealedProfile struct {
+	Name      string
+	BirthDate sql.NullString
+	Metadata  sql.NullString
+}
+
+func sealProfile(keys *fieldcrypt.Keyring, profile *models.HealthProfile) (*sealedProfile, error) {
+	var (
+		s   sealedProfile
+		err error
+	)
+	if s.Name, err = keys.Encrypt(profile.Name); err != nil {
+		return nil, err
+	}
+	if profile.BirthDate != nil {
+		if s.BirthDate.String, err = keys.Encrypt(profile.BirthDate.Format(birthDateLayout)); err != nil {
+			return nil, err
+		}
+		s.BirthDate.Valid = true
+	}
+	if len(profile.Metadata) > 0 && string(profile.Metadata) != "null" {
+		if s.Metadata.String, err = keys.Encrypt(string(profile.Metadata)); err != nil {
+			return nil, err
+		}
+		s.Metadata.Valid = true
+	}
+	return &s, nil
+}
+
+// openProfile 解密健康档案加密字段并写回 profile
+func openProfile(keys *fieldcrypt.Keyring, profile *models.HealthProfile, s *sealedProfile) error {
+	name, err := keys.Decrypt(s.Name)
+	if err != nil {
+		return err
+	}
+	profile.Name = name
+	profile.BirthDate = nil
+	if s.BirthDate.Valid {
+		plain, err := keys.Decrypt(s.BirthDate.String)
+		if err != nil {
+			return err
+		}
+		birth, err := time.Parse(birthDateLayout, plain)
+		if err != nil {
+			return err
+		}
+		profile.BirthDate = &birth
+	}
+	profile.Metadata = nil
+	if s.Metadata.Valid {
+		plain, err := keys.Decrypt(s.Metadata.String)
+		if err != nil {
+			return err
+		}
+		profile.Metadata = json.RawMessage(plain)
+	}
+	return nil
+}
@@ -0,0 +1,245 @@
+// Package postgres 健康档案成员与共享邀请数据仓储
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+
+	"github.com/fire-disposal/health_DT_go/internal/models"
+)
+
+// ErrInvitationUnavailable 邀请已被使用、撤销或过期
+var ErrInvitationUnavailable = errors.New("邀请码无效或已失效")
+
+const profileMemberColumns = `id, health_profile_id, user_id, role, status, invitation_id, approved_by, approved_at, revoked_at, created_at`
+
+const profileInvitationColumns = `id, health_profile_id, code_hash, role, status, created_by, redeemed_by, redeemed_at, expires_at, created_at`
+
+// ProfileMemberRepository 健康档案成员与邀请仓储接口
+type ProfileMemberRepository interface {
+	AddMember(ctx context.Context, m *models.ProfileMember) error
+	// GetMember 查询用户在档案下未撤销的成员关系，不存在返回 nil
+	GetMember(ctx context.Context, profileID int, userID int64) (*models.ProfileMember, error)
+	GetMemberByID(ctx context.Context, id int64) (*models.ProfileMember, error)
+	ListMembers(ctx context.Context, profileID int) ([]models.ProfileMember, error)
+	// ApproveMember 将待批准成员置为有效，仅对 pending 状态生效
+	ApproveMember(ctx context.Context, id int64, approvedBy int64) (bool, error)
+	RevokeMember(ctx context.Context, id int64) (bool, error)
+	// ListActiveProfileIDs 用户拥有有效成员关系的档案ID
+	ListActiveProfileIDs(ctx context.Context, userID int64) ([]int, error)
+
+	CreateInvitation(ctx context.Context, inv *models.ProfileInvitation) error
+	GetInvitationByCodeHash(ctx context.Context, codeHash string) (*models.ProfileInvitation, error)
+	ListInvitations(ctx context.Context, profileID int) ([]models.ProfileInvitation, error)
+	RevokeInvitation(ctx context.Context, profileID int, id int64) (bool, error)
+	// RedeemInvitation 在同一事务内标记邀请已使用并创建待批准成员；
+	// 邀请已被使用、撤销或过期时返回 ErrInvitationUnavailable
+	RedeemInvitation(ctx context.Context, inv *models.ProfileInvitation, userID int64) (*models.ProfileMember, error)
+}
+
+type profileMemberRepo struct {
+	db *sql.DB
+}
+
+// NewProfileMemberRepository 创建档案成员仓储实例
+func NewProfileMemberRepository(db *sql.DB) ProfileMemberRepository {
+	return &profileMemberRepo{db: db}
+}
+
+func scanProfileMember(row rowScanner) (*models.ProfileMember, error) {
+	var m models.ProfileMember
+	var invitationID, approvedBy sql.NullInt64
+	var approvedAt, revokedAt sql.NullTime
+	if err := row.Scan(&m.ID, &m.HealthProfileID, &m.UserID, &m.Role, &m.Status, &invitationID, &approvedBy,
+		&approvedAt, &revokedAt, &m.CreatedAt); err != nil {
+		return nil, err
+	}
+	if invitationID.Valid {
+		m.InvitationID = &invitationID.Int64
+	}
+	if approvedBy.Valid {
+		m.ApprovedBy = &approvedBy.Int64
+	}
+	if approvedAt.Valid {
+		m.ApprovedAt = &approvedAt.Time
+	}
+	if revokedAt.Valid {
+		m.RevokedAt = &revokedAt.Time
+	}
+	return &m, nil
+}
+
+func scanProfileInvitation(row rowScanner) (*models.ProfileInvitation, error) {
+	var inv models.ProfileInvitation
+	var redeemedBy sql.NullInt64
+	var redeemedAt sql.NullTime
+	if err := row.Scan(&inv.ID, &inv.HealthProfileID, &inv.CodeHash, &inv.Role, &inv.Status, &inv.CreatedBy,
+		&redeemedBy, &redeemedAt, &inv.ExpiresAt, &inv.CreatedAt); err != nil {
+		return nil, err
+	}
+	if redeemedBy.Valid {
+		inv.RedeemedBy = &redeemedBy.Int64
+	}
+	if redeemedAt.Valid {
+		inv.RedeemedAt = &redeemedAt.Time
+	}
+	return &inv, nil
+}
+
+func (r *profileMemberRepo) AddMember(ctx context.Context, m *models.ProfileMember) error {
+	query := `INSERT INTO profile_members (health_profile_id, user_id, role, status, invitation_id, approved_by, approved_at, created_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, NOW()) RETURNING id, created_at`
+	return r.db.QueryRowContext(ctx, query, m.HealthProfileID, m.UserID, m.Role, m.Status, m.InvitationID,
+		m.ApprovedBy, m.ApprovedAt).Scan(&m.ID, &m.CreatedAt)
+}
+
+func (r *profileMemberRepo) GetMember(ctx context.Context, profileID int, userID int64) (*models.ProfileMember, error) {
+	row := r.db.QueryRowContext(ctx, `SELECT `+profileMemberColumns+` FROM profile_members
+		WHERE health_profile_id = $1 AND user_id = $2 AND status <> 'revoked'`, profileID, userID)
+	m, err := scanProfileMember(row)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	return m, err
+}
+
+func (r *profileMemberRepo) GetMemberByID(ctx context.Context, id int64) (*models.ProfileMember, error) {
+	row := r.db.QueryRowContext(ctx, `SELECT `+profileMemberColumns+` FROM profile_members WHERE id = $1`, id)
+	m, err := scanProfileMember(row)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	return m, err
+}
+
+func (r *profileMemberRepo) ListMembers(ctx context.Context, profileID int) ([]models.ProfileMember, error) {
+	rows, err := r.db.QueryContext(ctx, `SELECT `+profileMemberColumns+` FROM profile_members
+		WHERE health_profile_id = $1 AND status <> 'revoked' ORDER BY id`, profileID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var members []models.ProfileMember
+	for rows.Next() {
+		m, err := scanProfileMember(rows)
+		if err != nil {
+			return nil, err
+		}
+		members = append(members, *m)
+	}
+	return members, rows.Err()
+}
+
+func (r *profileMemberRepo) ApproveMember(ctx context.Context, id int64, approvedBy int64) (bool, error) {
+	res, err := r.db.ExecContext(ctx, `UPDATE profile_members SET status = 'active', approved_by = $2, approved_at = NOW()
+		WHERE id = $1 AND status = 'pending'`, id, approvedBy)
+	if err != nil {
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	return n > 0, err
+}
+
+func (r *profileMemberRepo) RevokeMember(ctx context.Context, id int64) (bool, error) {
+	res, err := r.db.ExecContext(ctx, `UPDATE profile_members SET status = 'revoked', revoked_at = NOW()
+		WHERE id = $1 AND status <> 'revoked'`, id)
+	if err != nil {
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	return n > 0, err
+}
+
+func (r *profileMemberRepo) ListActiveProfileIDs(ctx context.Context, userID int64) ([]int, error) {
+	rows, err := r.db.QueryContext(ctx,
+		`SELECT health_profile_id FROM profile_members WHERE user_id = $1 AND status = 'active' ORDER BY health_profile_id`, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var ids []int
+	for rows.Next() {
+		var id int
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	return ids, rows.Err()
+}
+
+func (r *profileMemberRepo) CreateInvitation(ctx context.Context, inv *models.ProfileInvitation) error {
+	query := `INSERT INTO profile_invitations (health_profile_id, code_hash, role, status, created_by, expires_at, created_at)
+		VALUES ($1, $2, $3, 'pending', $4, $5, NOW()) RETURNING id, status, created_at`
+	return r.db.QueryRowContext(ctx, query, inv.HealthProfileID, inv.CodeHash, inv.Role, inv.CreatedBy, inv.ExpiresAt).
+		Scan(&inv.ID, &inv.Status, &inv.CreatedAt)
+}
+
+func (r *profileMemberRepo) GetInvitationByCodeHash(ctx context.Context, codeHash string) (*models.ProfileInvitation, error) {
+	row := r.db.QueryRowContext(ctx, `SELECT `+profileInvitationColumns+` FROM profile_invitations WHERE code_hash = $1`, codeHash)
+	inv, err := scanProfileInvitation(row)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	return inv, err
+}
+
+func (r *profileMemberRepo) ListInvitations(ctx context.Context, profileID int) ([]models.ProfileInvitation, error) {
+	rows, err := r.db.QueryContext(ctx, `SELECT `+profileInvitationColumns+` FROM profile_invitations
+		WHERE health_profile_id = $1 ORDER BY id DESC`, profileID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var invitations []models.ProfileInvitation
+	for rows.Next() {
+		inv, err := scanProfileInvitation(rows)
+		if err != nil {
+			return nil, err
+		}
+		invitations = append(invitations, *inv)
+	}
+	return invitations, rows.Err()
+}
+
+func (r *profileMemberRepo) RevokeInvitation(ctx context.Context, profileID int, id int64) (bool, error) {
+	res, err := r.db.ExecContext(ctx, `UPDATE profile_invitations SET status = 'revoked'
+		WHERE id = $1 AND health_profile_id = $2 AND status = 'pending'`, id, profileID)
+	if err != nil {
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	return n > 0, err
+}
+
+func (r *profileMemberRepo) RedeemInvitation(ctx context.Context, inv *models.ProfileInvitation, userID int64) (*models.ProfileMember, error) {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	res, err := tx.ExecContext(ctx, `UPDATE profile_invitations SET status = 'redeemed', redeemed_by = $2, redeemed_at = NOW()
+		WHERE id = $1 AND status = 'pending' AND expires_at > NOW()`, inv.ID, userID)
+	if err != nil {
+		return nil, err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return nil, ErrInvitationUnavailable
+	}
+	m := &models.ProfileMember{
+		HealthProfileID: inv.HealthProfileID,
+		UserID:          userID,
+		Role:            inv.Role,
+		Status:          models.ProfileMemberPending,
+		InvitationID:    &inv.ID,
+	}
+	err = tx.QueryRowContext(ctx, `INSERT INTO profile_members (health_profile_id, user_id, role, status, invitation_id, created_at)
+		VALUES ($1, $2, $3, $4, $5, NOW()) RETURNING id, created_at`,
+		m.HealthProfileID, m.UserID, m.Role, m.Status, m.InvitationID).Scan(&m.ID, &m.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+	return m, tx.Commit()
+}
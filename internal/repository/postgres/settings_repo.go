@@ -0,0 +1,43 @@
+// Package postgres 系统设置数据仓储
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+)
+
+// SettingsRepository 系统设置（键值）仓储接口
+type SettingsRepository interface {
+	// Get 读取设置，不存在时 ok 为 false
+	Get(ctx context.Context, key string) (value string, ok bool, err error)
+	Set(ctx context.Context, key, value string, updatedBy int64) error
+}
+
+type settingsRepo struct {
+	db *sql.DB
+}
+
+// NewSettingsRepository 创建系统设置仓储实例
+func NewSettingsRepository(db *sql.DB) SettingsRepository {
+	return &settingsRepo{db: db}
+}
+
+func (r *settingsRepo) Get(ctx context.Context, key string) (string, bool, error) {
+	var value string
+	err := r.db.QueryRowContext(ctx, `SELECT value FROM system_settings WHERE key = $1`, key).Scan(&value)
+	if errors.Is(err, sql.ErrNoRows) {
+		return "", false, nil
+	}
+	if err != nil {
+		return "", false, err
+	}
+	return value, true, nil
+}
+
+func (r *settingsRepo) Set(ctx context.Context, key, value string, updatedBy int64) error {
+	query := `INSERT INTO system_settings (key, value, updated_by, updated_at) VALUES ($1, $2, $3, NOW())
+		ON CONFLICT (key) DO UPDATE SET value = EXCLUDED.value, updated_by = EXCLUDED.updated_by, updated_at = NOW()`
+	_, err := r.db.ExecContext(ctx, query, key, value, updatedBy)
+	return err
+}
@@ -0,0 +1,35 @@
+// Package postgres 租户过滤辅助
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+
+	"github.com/fire-disposal/health_DT_go/internal/tenant"
+)
+
+// orgClause 按 context 中的租户范围追加 " AND column = $n" 条件，不限组织时返回空串
+func orgClause(ctx context.Context, column string, args []interface{}) (string, []interface{}) {
+	orgID, ok := tenant.OrgFilter(ctx)
+	if !ok {
+		return "", args
+	}
+	args = append(args, orgID)
+	return fmt.Sprintf(" AND %s = $%d", column, len(args)), args
+}
+
+// affectedOne 检查按租户过滤的写操作是否命中记录，未命中（不存在或属于其他组织）时返回 sql.ErrNoRows
+func affectedOne(res sql.Result, err error) error {
+	if err != nil {
+		return err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
@@ -0,0 +1,199 @@
+// Package postgres 管理员两步验证数据仓储
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/fire-disposal/health_DT_go/internal/models"
+)
+
+// TwoFactorRepository 两步验证（TOTP、恢复码、登录挑战）仓储接口
+type TwoFactorRepository interface {
+	GetTOTP(ctx context.Context, adminID int64) (*models.AdminTOTP, error)
+	SetPendingSecret(ctx context.Context, adminID int64, secret string) error
+	// Enable 将待验证密钥转为正式密钥并启用
+	Enable(ctx context.Context, adminID int64, step int64) error
+	Disable(ctx context.Context, adminID int64) error
+	// ConsumeStep 记录已使用的时间步，仅当 step 大于上次记录时成功（防重放）
+	ConsumeStep(ctx context.Context, adminID int64, step int64) (bool, error)
+
+	// ReplaceRecoveryCodes 作废旧恢复码并写入新恢复码哈希
+	ReplaceRecoveryCodes(ctx context.Context, adminID int64, hashes []string) error
+	// UseRecoveryCode 使用恢复码，成功返回 true
+	UseRecoveryCode(ctx context.Context, adminID int64, hash string) (bool, error)
+	CountRecoveryCodes(ctx context.Context, adminID int64) (int, error)
+
+	// CreateChallenge 创建登录挑战，同时清理该管理员已过期的挑战，并只保留最新的 maxLive-1 个未过期挑战
+	CreateChallenge(ctx context.Context, c *models.LoginChallenge, maxLive int) error
+	GetChallengeByTokenHash(ctx context.Context, tokenHash string) (*models.LoginChallenge, error)
+	// ClaimChallengeAttempt 在校验前原子地计入一次尝试，已达 maxAttempts 或不存在时返回 nil
+	ClaimChallengeAttempt(ctx context.Context, tokenHash string, maxAttempts int) (*models.LoginChallenge, error)
+	DeleteChallenge(ctx context.Context, id int64) error
+}
+
+type twoFactorRepo struct {
+	db *sql.DB
+}
+
+// NewTwoFactorRepository 创建两步验证仓储实例
+func NewTwoFactorRepository(db *sql.DB) TwoFactorRepository {
+	return &twoFactorRepo{db: db}
+}
+
+func (r *twoFactorRepo) GetTOTP(ctx context.Context, adminID int64) (*models.AdminTOTP, error) {
+	query := `SELECT admin_id, COALESCE(secret, ''), COALESCE(pending_secret, ''), enabled, last_step, enabled_at, updated_at
+		FROM admin_totp WHERE admin_id = $1`
+	var t models.AdminTOTP
+	err := r.db.QueryRowContext(ctx, query, adminID).Scan(
+		&t.AdminID, &t.Secret, &t.PendingSecret, &t.Enabled, &t.LastStep, &t.EnabledAt, &t.UpdatedAt,
+	)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &t, nil
+}
+
+func (r *twoFactorRepo) SetPendingSecret(ctx context.Context, adminID int64, secret string) error {
+	query := `INSERT INTO admin_totp (admin_id, pending_secret, enabled, last_step, updated_at) VALUES ($1, $2, FALSE, 0, NOW())
+		ON CONFLICT (admin_id) DO UPDATE SET pending_secret = EXCLUDED.pending_secret, updated_at = NOW()`
+	_, err := r.db.ExecContext(ctx, query, adminID, secret)
+	return err
+}
+
+func (r *twoFactorRepo) Enable(ctx context.Context, adminID int64, step int64) error {
+	query := `UPDATE admin_totp SET secret = pending_secret, pending_secret = NULL, enabled = TRUE,
+		last_step = $2, enabled_at = NOW(), updated_at = NOW()
+		WHERE admin_id = $1 AND pending_secret IS NOT NULL`
+	res, err := r.db.ExecContext(ctx, query, adminID, step)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return errors.New("没有待验证的两步验证密钥")
+	}
+	return nil
+}
+
+func (r *twoFactorRepo) Disable(ctx context.Context, adminID int64) error {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	if _, err := tx.ExecContext(ctx, `DELETE FROM admin_totp WHERE admin_id = $1`, adminID); err != nil {
+		return err
+	}
+	if _, err := tx.ExecContext(ctx, `DELETE FROM admin_recovery_codes WHERE admin_id = $1`, adminID); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func (r *twoFactorRepo) ConsumeStep(ctx context.Context, adminID int64, step int64) (bool, error) {
+	res, err := r.db.ExecContext(ctx,
+		`UPDATE admin_totp SET last_step = $2, updated_at = NOW() WHERE admin_id = $1 AND last_step < $2`, adminID, step)
+	if err != nil {
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	return n > 0, err
+}
+
+func (r *twoFactorRepo) ReplaceRecoveryCodes(ctx context.Context, adminID int64, hashes []string) error {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	if _, err := tx.ExecContext(ctx, `DELETE FROM admin_recovery_codes WHERE admin_id = $1`, adminID); err != nil {
+		return err
+	}
+	for _, h := range hashes {
+		if _, err := tx.ExecContext(ctx,
+			`INSERT INTO admin_recovery_codes (admin_id, code_hash, created_at) VALUES ($1, $2, NOW())`, adminID, h); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+func (r *twoFactorRepo) UseRecoveryCode(ctx context.Context, adminID int64, hash string) (bool, error) {
+	res, err := r.db.ExecContext(ctx,
+		`UPDATE admin_recovery_codes SET used_at = NOW() WHERE admin_id = $1 AND code_hash = $2 AND used_at IS NULL`,
+		adminID, hash)
+	if err != nil {
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	return n > 0, err
+}
+
+func (r *twoFactorRepo) CountRecoveryCodes(ctx context.Context, adminID int64) (int, error) {
+	var count int
+	err := r.db.QueryRowContext(ctx,
+		`SELECT COUNT(1) FROM admin_recovery_codes WHERE admin_id = $1 AND used_at IS NULL`, adminID).Scan(&count)
+	return count, err
+}
+
+func (r *twoFactorRepo) CreateChallenge(ctx context.Context, c *models.LoginChallenge, maxLive int) error {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	// 锁定管理员行，串行化同一管理员的并发登录，保证未过期挑战数不超过上限
+	if _, err := tx.ExecContext(ctx, `SELECT id FROM admin_users WHERE id = $1 FOR UPDATE`, c.AdminID); err != nil {
+		return err
+	}
+	if _, err := tx.ExecContext(ctx, `DELETE FROM login_challenges WHERE admin_id = $1
+		AND (expires_at < $2 OR id NOT IN (
+			SELECT id FROM login_challenges WHERE admin_id = $1 AND expires_at >= $2 ORDER BY id DESC LIMIT $3))`,
+		c.AdminID, time.Now(), maxLive-1); err != nil {
+		return err
+	}
+	query := `INSERT INTO login_challenges (token_hash, admin_id, attempts, expires_at, created_at)
+		VALUES ($1, $2, 0, $3, NOW()) RETURNING id, created_at`
+	if err := tx.QueryRowContext(ctx, query, c.TokenHash, c.AdminID, c.ExpiresAt).Scan(&c.ID, &c.CreatedAt); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func (r *twoFactorRepo) GetChallengeByTokenHash(ctx context.Context, tokenHash string) (*models.LoginChallenge, error) {
+	query := `SELECT id, token_hash, admin_id, attempts, expires_at, created_at FROM login_challenges WHERE token_hash = $1`
+	var c models.LoginChallenge
+	err := r.db.QueryRowContext(ctx, query, tokenHash).Scan(&c.ID, &c.TokenHash, &c.AdminID, &c.Attempts, &c.ExpiresAt, &c.CreatedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &c, nil
+}
+
+func (r *twoFactorRepo) ClaimChallengeAttempt(ctx context.Context, tokenHash string, maxAttempts int) (*models.LoginChallenge, error) {
+	query := `UPDATE login_challenges SET attempts = attempts + 1 WHERE token_hash = $1 AND attempts < $2
+		RETURNING id, token_hash, admin_id, attempts, expires_at, created_at`
+	var c models.LoginChallenge
+	err := r.db.QueryRowContext(ctx, query, tokenHash, maxAttempts).Scan(
+		&c.ID, &c.TokenHash, &c.AdminID, &c.Attempts, &c.ExpiresAt, &c.CreatedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &c, nil
+}
+
+func (r *twoFactorRepo) DeleteChallenge(ctx context.Context, id int64) error {
+	_, err := r.db.ExecContext(ctx, `DELETE FROM login_challenges WHERE id = $1`, id)
+	return err
+}
@@ -4,7 +4,9 @@ package postgres
 import (
 	"context"
 	"database/sql"
+	"strings"
 
+	"github.com/fire-disposal/health_DT_go/internal/fieldcrypt"
 	"github.com/fire-disposal/health_DT_go/internal/models"
 	"golang.org/x/crypto/bcrypt"
 )
@@ -35,83 +37,68 @@ type UserRepository interface {
 
 // UserRepo 用户仓储结构体
 type UserRepo struct {
-	db *sql.DB
+	db   *sql.DB
+	keys *fieldcrypt.Keyring
 }
 
-// NewUserRepo 创建用户仓储实例
-func NewUserRepo(db *sql.DB) *UserRepo {
-	return &UserRepo{db: db}
+// NewUserRepo 创建用户仓储实例，keys 用于个人标识字段加解密
+func NewUserRepo(db *sql.DB, keys *fieldcrypt.Keyring) *UserRepo {
+	return &UserRepo{db: db, keys: keys}
 }
 
 // Create 新增用户
 func (r *UserRepo) Create(ctx context.Context, user *models.AppUser) (int64, error) {
-	query := "INSERT INTO app_users (username, email, phone, password_hash, is_active, created_at, updated_at) VALUES ($1, $2, $3, $4, $5, NOW(), NOW()) RETURNING id"
+	pii, err := sealAppUserPII(r.keys, user.Email, user.Phone, user.WechatOpenID)
+	if err != nil {
+		return 0, err
+	}
+	query := `INSERT INTO app_users (username, email, email_bidx, phone, phone_bidx, password_hash, is_active,
+		wechat_openid, wechat_openid_bidx, created_at, updated_at)
+		VALUES ($1, NULLIF($2, ''), NULLIF($3, ''), NULLIF($4, ''), NULLIF($5, ''), $6, $7, NULLIF($8, ''), NULLIF($9, ''), NOW(), NOW())
+		RETURNING id`
 	var id int64
-	err := r.db.QueryRowContext(ctx, query, user.Username, user.Email, user.Phone, user.PasswordHash, user.IsActive).Scan(&id)
+	err = r.db.QueryRowContext(ctx, query, user.Username, pii.Email.Value, pii.Email.Index, pii.Phone.Value, pii.Phone.Index,
+		user.PasswordHash, user.IsActive, pii.OpenID.Value, pii.OpenID.Index).Scan(&id)
 	return id, err
 }
 
 // GetByID 根据ID查询用户
 func (r *UserRepo) GetByID(ctx context.Context, id int64) (*models.AppUser, error) {
-	query := "SELECT id, username, email, phone, password_hash, is_active, last_login, wechat_openid, created_at, updated_at FROM app_users WHERE id = $1"
-	user := &models.AppUser{}
-	err := r.db.QueryRowContext(ctx, query, id).Scan(
-		&user.ID, &user.Username, &user.Email, &user.Phone, &user.PasswordHash,
-		&user.IsActive, &user.LastLogin, &user.WechatOpenID, &user.CreatedAt, &user.UpdatedAt,
-	)
-	if err == sql.ErrNoRows {
-		return nil, nil
-	}
-	return user, err
+	return scanAppUser(r.db.QueryRowContext(ctx, "SELECT "+appUserColumns+" FROM app_users WHERE id = $1", id), r.keys)
 }
 
 // GetByUsername 根据用户名查询用户
 func (r *UserRepo) GetByUsername(ctx context.Context, username string) (*models.AppUser, error) {
-	query := "SELECT id, username, email, phone, password_hash, is_active, last_login, wechat_openid, created_at, updated_at FROM app_users WHERE username = $1"
-	user := &models.AppUser{}
-	err := r.db.QueryRowContext(ctx, query, username).Scan(
-		&user.ID, &user.Username, &user.Email, &user.Phone, &user.PasswordHash,
-		&user.IsActive, &user.LastLogin, &user.WechatOpenID, &user.CreatedAt, &user.UpdatedAt,
-	)
-	if err == sql.ErrNoRows {
-		return nil, nil
-	}
-	return user, err
+	return scanAppUser(r.db.QueryRowContext(ctx, "SELECT "+appUserColumns+" FROM app_users WHERE username = $1", username), r.keys)
 }
 
-// GetByPhone 根据手机号查询用户
+// GetByPhone 根据手机号查询用户，按盲索引匹配，未命中时回退明文比较（未配置盲索引密钥或尚未重加密的行）
 func (r *UserRepo) GetByPhone(ctx context.Context, phone string) (*models.AppUser, error) {
-	query := "SELECT id, username, email, phone, password_hash, is_active, last_login, wechat_openid, created_at, updated_at FROM app_users WHERE phone = $1"
-	user := &models.AppUser{}
-	err := r.db.QueryRowContext(ctx, query, phone).Scan(
-		&user.ID, &user.Username, &user.Email, &user.Phone, &user.PasswordHash,
-		&user.IsActive, &user.LastLogin, &user.WechatOpenID, &user.CreatedAt, &user.UpdatedAt,
-	)
-	if err == sql.ErrNoRows {
-		return nil, nil
-	}
-	return user, err
+	phone = strings.TrimSpace(phone)
+	return scanAppUser(r.db.QueryRowContext(ctx, "SELECT "+appUserColumns+` FROM app_users
+		WHERE phone_bidx = $1 OR phone = $2`,
+		r.keys.BlindIndex(bidxAppUserPhone, phone), phone), r.keys)
 }
 
 // Update 更新用户信息
 func (r *UserRepo) Update(ctx context.Context, user *models.AppUser) error {
-	query := "UPDATE app_users SET username = $1, email = $2, phone = $3, password_hash = $4, is_active = $5, last_login = $6, wechat_openid = $7, updated_at = NOW() WHERE id = $8"
-	_, err := r.db.ExecContext(ctx, query, user.Username, user.Email, user.Phone, user.PasswordHash, user.IsActive, user.LastLogin, user.WechatOpenID, user.ID)
+	pii, err := sealAppUserPII(r.keys, user.Email, user.Phone, user.WechatOpenID)
+	if err != nil {
+		return err
+	}
+	query := `UPDATE app_users SET username = $1, email = NULLIF($2, ''), email_bidx = NULLIF($3, ''), phone = NULLIF($4, ''),
+		phone_bidx = NULLIF($5, ''), password_hash = $6, is_active = $7, last_login = $8, wechat_openid = NULLIF($9, ''),
+		wechat_openid_bidx = NULLIF($10, ''), updated_at = NOW() WHERE id = $11`
+	_, err = r.db.ExecContext(ctx, query, user.Username, pii.Email.Value, pii.Email.Index, pii.Phone.Value, pii.Phone.Index,
+		user.PasswordHash, user.IsActive, user.LastLogin, pii.OpenID.Value, pii.OpenID.Index, user.ID)
 	return err
 }
 
-// 通过微信 openid 查询用户
+// 通过微信 openid 查询用户，按盲索引匹配，未命中时回退明文比较（未配置盲索引密钥或尚未重加密的行）
 func (r *UserRepo) GetByWechatOpenID(ctx context.Context, openid string) (*models.AppUser, error) {
-	query := "SELECT id, username, email, phone, password_hash, is_active, last_login, wechat_openid, created_at, updated_at FROM app_users WHERE wechat_openid = $1"
-	user := &models.AppUser{}
-	err := r.db.QueryRowContext(ctx, query, openid).Scan(
-		&user.ID, &user.Username, &user.Email, &user.Phone, &user.PasswordHash,
-		&user.IsActive, &user.LastLogin, &user.WechatOpenID, &user.CreatedAt, &user.UpdatedAt,
-	)
-	if err == sql.ErrNoRows {
-		return nil, nil
-	}
-	return user, err
+	return scanAppUser(r.db.QueryRowContext(ctx, "SELECT "+appUserColumns+` FROM app_users
+		WHERE wechat_openid_bidx = $1 OR wechat_openid = $2`,
+		r.keys.BlindIndex(bidxAppUserOpenID, openid), openid), r.keys)
 }
 
 // Delete 删除用户
@@ -145,6 +132,12 @@ func (r *UserRepo) Register(ctx context.Context, user *models.AppUser, password
 	if err != nil {
 		return err
 	}
-	query := `INSERT INTO app_users (username, email, phone, password_hash, is_active, created_at, updated_at) VALUES ($1, $2, $3, $4, $5, $6, $7) RETURNING id`
-	return r.db.QueryRowContext(ctx, query, user.Username, user.Email, user.Phone, string(hash), true, user.CreatedAt, user.UpdatedAt).Scan(&user.ID)
+	pii, err := sealAppUserPII(r.keys, user.Email, user.Phone, "")
+	if err != nil {
+		return err
+	}
+	query := `INSERT INTO app_users (username, email, email_bidx, phone, phone_bidx, password_hash, is_active, created_at, updated_at)
+		VALUES ($1, NULLIF($2, ''), NULLIF($3, ''), NULLIF($4, ''), NULLIF($5, ''), $6, $7, $8, $9) RETURNING id`
+	return r.db.QueryRowContext(ctx, query, user.Username, pii.Email.Value, pii.Email.Index, pii.Phone.Value, pii.Phone.Index,
+		string(hash), true, user.CreatedAt, user.UpdatedAt).Scan(&user.ID)
 }
@@ -0,0 +1,113 @@
+// presence_repo.go
+package redis
+
+import (
+	"context"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+const (
+	presenceLastSeenKey  = "presence:last_seen"    // ZSET：序列号 -> 最近上行时间（毫秒）
+	presenceDisconnKey   = "presence:disconnected" // ZSET：序列号 -> 设备声明离线（遗嘱）时间（毫秒）
+	presenceStateKey     = "presence:state"        // HASH：序列号 -> 巡检已确认的在线状态
+	presenceSweepLockKey = "presence:sweeper_lock" // 多实例部署时仅一个实例执行巡检
+)
+
+// PresenceRepository 设备在线状态的 Redis 存取
+type PresenceRepository struct {
+	client *redis.Client
+}
+
+// NewPresenceRepository 构造
+func NewPresenceRepository(client *redis.Client) *PresenceRepository {
+	return &PresenceRepository{client: client}
+}
+
+// Touch 记录设备最近上行时间
+func (r *PresenceRepository) Touch(ctx context.Context, sn string, at time.Time) error {
+	return r.client.ZAdd(ctx, presenceLastSeenKey, redis.Z{Score: float64(at.UnixMilli()), Member: sn}).Err()
+}
+
+// MarkDisconnected 记录设备声明离线的时间
+func (r *PresenceRepository) MarkDisconnected(ctx context.Context, sn string, at time.Time) error {
+	return r.client.ZAdd(ctx, presenceDisconnKey, redis.Z{Score: float64(at.UnixMilli()), Member: sn}).Err()
+}
+
+// LastSeen 批量查询最近上行时间，从未上报的设备不在结果中
+func (r *PresenceRepository) LastSeen(ctx context.Context, sns []string) (map[string]time.Time, error) {
+	return r.scores(ctx, presenceLastSeenKey, sns)
+}
+
+// Disconnected 批量查询设备声明离线的时间，未声明过的设备不在结果中
+func (r *PresenceRepository) Disconnected(ctx context.Context, sns []string) (map[string]time.Time, error) {
+	return r.scores(ctx, presenceDisconnKey, sns)
+}
+
+func (r *PresenceRepository) scores(ctx context.Context, key string, sns []string) (map[string]time.Time, error) {
+	out := make(map[string]time.Time, len(sns))
+	if len(sns) == 0 {
+		return out, nil
+	}
+	scores, err := r.client.ZMScore(ctx, key, sns...).Result()
+	if err != nil {
+		return nil, err
+	}
+	for i, score := range scores {
+		if score > 0 {
+			out[sns[i]] = time.UnixMilli(int64(score))
+		}
+	}
+	return out, nil
+}
+
+// Members 全部有上行记录的序列号
+func (r *PresenceRepository) Members(ctx context.Context) ([]string, error) {
+	return r.client.ZRange(ctx, presenceLastSeenKey, 0, -1).Result()
+}
+
+// Remove 清除设备的上行记录与状态（设备已删除或未注册）
+func (r *PresenceRepository) Remove(ctx context.Context, sns ...string) error {
+	if len(sns) == 0 {
+		return nil
+	}
+	members := make([]interface{}, len(sns))
+	for i, sn := range sns {
+		members[i] = sn
+	}
+	pipe := r.client.TxPipeline()
+	pipe.ZRem(ctx, presenceLastSeenKey, members...)
+	pipe.ZRem(ctx, presenceDisconnKey, members...)
+	pipe.HDel(ctx, presenceStateKey, sns...)
+	_, err := pipe.Exec(ctx)
+	return err
+}
+
+// States 批量查询巡检已确认的在线状态，未确认的设备不在结果中
+func (r *PresenceRepository) States(ctx context.Context, sns []string) (map[string]string, error) {
+	out := make(map[string]string, len(sns))
+	if len(sns) == 0 {
+		return out, nil
+	}
+	vals, err := r.client.HMGet(ctx, presenceStateKey, sns...).Result()
+	if err != nil {
+		return nil, err
+	}
+	for i, v := range vals {
+		if s, ok := v.(string); ok {
+			out[sns[i]] = s
+		}
+	}
+	return out, nil
+}
+
+// SetState 保存巡检确认的在线状态
+func (r *PresenceRepository) SetState(ctx context.Context, sn, state string) error {
+	return r.client.HSet(ctx, presenceStateKey, sn, state).Err()
+}
+
+// AcquireSweepLock 获取巡检锁，锁在 ttl 后自动释放
+func (r *PresenceRepository) AcquireSweepLock(ctx context.Context, owner string, ttl time.Duration) (bool, error) {
+	return r.client.SetNX(ctx, presenceSweepLockKey, owner, ttl).Result()
+}
@@ -0,0 +1,211 @@
+// Package service 管理员用户业务逻辑服务
+package service
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/fire-disposal/health_DT_go/internal/models"
+	"github.com/fire-disposal/health_DT_go/internal/repository/postgres"
+	"github.com/fire-disposal/health_DT_go/internal/tenant"
+	"golang.org/x/crypto/bcrypt"
+)
+
+var (
+	ErrAdminUserNotFound   = errors.New("管理员不存在")
+	ErrAdminUsernameExists = errors.New("用户名已存在")
+	ErrInvalidAdminRole    = errors.New("无效的管理员角色")
+	ErrLastSuperAdmin      = errors.New("至少需要保留一个激活的超级管理员")
+	ErrLastPlatformAdmin   = errors.New("至少需要保留一个激活的平台管理员")
+	ErrInvalidAdminInput   = errors.New("管理员参数错误")
+	ErrPlatformAdminOnly   = errors.New("仅平台管理员可管理平台管理员")
+)
+
+// CreateAdminUserInput 创建管理员参数
+type CreateAdminUserInput struct {
+	Username string
+	Email    string
+	Phone    string
+	Password string
+	Role     string
+	OrgID    int // 所属组织，仅平台级调用方可指定，组织管理员创建时固定为其所属组织
+}
+
+// UpdateAdminUserInput 更新管理员参数，nil 表示不修改
+type UpdateAdminUserInput struct {
+	Email    *string
+	Phone    *string
+	Role     *string
+	IsActive *bool
+}
+
+// AdminUsersService 管理员用户服务
+type AdminUsersService struct {
+	repo postgres.AdminUserRepository
+}
+
+// NewAdminUsersService 构造管理员用户服务
+func NewAdminUsersService(repo postgres.AdminUserRepository) *AdminUsersService {
+	return &AdminUsersService{repo: repo}
+}
+
+// Create 创建管理员，密码使用 bcrypt 哈希存储
+func (s *AdminUsersService) Create(ctx context.Context, in CreateAdminUserInput) (*models.AdminUser, error) {
+	username := strings.TrimSpace(in.Username)
+	if username == "" {
+		return nil, fmt.Errorf("%w: 用户名不能为空", ErrInvalidAdminInput)
+	}
+	if in.Role == "" {
+		in.Role = models.AdminRoleAdmin
+	}
+	if !models.IsValidAdminRole(in.Role) {
+		return nil, ErrInvalidAdminRole
+	}
+	if in.Role == models.AdminRolePlatformAdmin && !tenant.IsPlatform(ctx) {
+		return nil, ErrPlatformAdminOnly
+	}
+	if err := DefaultPasswordPolicy.Validate(in.Password, username); err != nil {
+		return nil, err
+	}
+	existing, err := s.repo.GetByUsername(ctx, username)
+	if err != nil {
+		return nil, err
+	}
+	if existing != nil {
+		return nil, ErrAdminUsernameExists
+	}
+	hash, err := bcrypt.GenerateFromPassword([]byte(in.Password), bcrypt.DefaultCost)
+	if err != nil {
+		return nil, err
+	}
+	user := &models.AdminUser{
+		OrgID:        tenant.OrgForCreate(ctx, in.OrgID),
+		Username:     username,
+		Email:        in.Email,
+		Phone:        in.Phone,
+		PasswordHash: string(hash),
+		Role:         in.Role,
+		IsActive:     true,
+	}
+	id, err := s.repo.Create(ctx, user)
+	if err != nil {
+		return nil, err
+	}
+	return s.repo.GetByID(ctx, id)
+}
+
+// Get 查询管理员
+func (s *AdminUsersService) Get(ctx context.Context, id int64) (*models.AdminUser, error) {
+	user, err := s.repo.GetByID(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if user == nil {
+		return nil, ErrAdminUserNotFound
+	}
+	return user, nil
+}
+
+// List 管理员列表
+func (s *AdminUsersService) List(ctx context.Context) ([]*models.AdminUser, error) {
+	return s.repo.List(ctx)
+}
+
+// Update 更新管理员信息；降级或停用组织内最后一个超级管理员、最后一个平台管理员会被拒绝
+func (s *AdminUsersService) Update(ctx context.Context, id int64, in UpdateAdminUserInput) (*models.AdminUser, error) {
+	user, err := s.Get(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if in.Role != nil && !models.IsValidAdminRole(*in.Role) {
+		return nil, ErrInvalidAdminRole
+	}
+	promotesPlatform := in.Role != nil && *in.Role == models.AdminRolePlatformAdmin
+	if (user.Role == models.AdminRolePlatformAdmin || promotesPlatform) && !tenant.IsPlatform(ctx) {
+		return nil, ErrPlatformAdminOnly
+	}
+	losesRole := (in.Role != nil && *in.Role != user.Role) || (in.IsActive != nil && !*in.IsActive)
+	if losesRole {
+		if err := s.ensureNotLastPrivileged(ctx, user); err != nil {
+			return nil, err
+		}
+	}
+	if in.Email != nil {
+		user.Email = *in.Email
+	}
+	if in.Phone != nil {
+		user.Phone = *in.Phone
+	}
+	if in.Role != nil {
+		user.Role = *in.Role
+	}
+	if in.IsActive != nil {
+		user.IsActive = *in.IsActive
+	}
+	err = s.repo.Update(ctx, user)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrAdminUserNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return s.repo.GetByID(ctx, id)
+}
+
+// SetActive 激活或停用管理员
+func (s *AdminUsersService) SetActive(ctx context.Context, id int64, active bool) (*models.AdminUser, error) {
+	return s.Update(ctx, id, UpdateAdminUserInput{IsActive: &active})
+}
+
+// Delete 删除管理员
+func (s *AdminUsersService) Delete(ctx context.Context, id int64) error {
+	user, err := s.Get(ctx, id)
+	if err != nil {
+		return err
+	}
+	if user.Role == models.AdminRolePlatformAdmin && !tenant.IsPlatform(ctx) {
+		return ErrPlatformAdminOnly
+	}
+	if err := s.ensureNotLastPrivileged(ctx, user); err != nil {
+		return err
+	}
+	err = s.repo.Delete(ctx, id)
+	if errors.Is(err, sql.ErrNoRows) {
+		return ErrAdminUserNotFound
+	}
+	return err
+}
+
+// HasActiveRole 是否已存在指定角色的激活管理员（用于初始化命令），受 context 租户范围限制
+func (s *AdminUsersService) HasActiveRole(ctx context.Context, role string) (bool, error) {
+	count, err := s.repo.CountActiveByRole(ctx, role)
+	return count > 0, err
+}
+
+// ensureNotLastPrivileged 超级管理员按所属组织计数，平台管理员全局计数
+func (s *AdminUsersService) ensureNotLastPrivileged(ctx context.Context, user *models.AdminUser) error {
+	if !user.IsActive {
+		return nil
+	}
+	var scope tenant.Scope
+	var lastErr error
+	switch user.Role {
+	case models.AdminRoleSuperAdmin:
+		scope, lastErr = tenant.Scope{OrgID: user.OrgID}, ErrLastSuperAdmin
+	case models.AdminRolePlatformAdmin:
+		scope, lastErr = tenant.Scope{Platform: true}, ErrLastPlatformAdmin
+	default:
+		return nil
+	}
+	count, err := s.repo.CountActiveByRole(tenant.WithScope(ctx, scope), user.Role)
+	if err != nil {
+		return err
+	}
+	if count <= 1 {
+		return lastErr
+	}
+	return nil
+}
@@ -0,0 +1,189 @@
+// Package service 第三方系统 API Key 管理与认证
+package service
+
+import (
+	"context"
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/fire-disposal/health_DT_go/internal/models"
+	"github.com/fire-disposal/health_DT_go/internal/repository/postgres"
+	"github.com/fire-disposal/health_DT_go/internal/tenant"
+)
+
+const (
+	// APIKeyPrefix API Key 明文前缀，认证中间件据此区分 API Key 与用户 Token
+	APIKeyPrefix = "hdk_"
+
+	apiKeyIDBytes     = 4  // 前缀中的随机标识，十六进制 8 位
+	apiKeySecretBytes = 20 // 密钥部分，十六进制 40 位
+	apiKeyDefaultTTL  = 90 * 24 * time.Hour
+	apiKeyMaxTTL      = 365 * 24 * time.Hour
+)
+
+var (
+	ErrAPIKeyInvalid      = errors.New("API Key 无效、已过期或已撤销")
+	ErrAPIKeyNotFound     = errors.New("API Key 不存在或已撤销")
+	ErrInvalidAPIKeyScope = errors.New("无效的 API Key 授权范围")
+	ErrInvalidAPIKeyInput = errors.New("API Key 参数错误")
+	ErrAPIKeyScopeDenied  = errors.New("API Key 未授权访问该接口")
+)
+
+// CreateAPIKeyInput 创建 API Key 参数
+type CreateAPIKeyInput struct {
+	Name          string
+	Scopes        []string
+	ExpiresInDays int // 0 时默认 90 天，最长 365 天
+	OrgID         int // 仅平台级调用方可指定，组织管理员创建时固定为其所属组织
+}
+
+// APIKeyService API Key 服务：组织级、按授权范围限制，明文仅返回一次
+type APIKeyService struct {
+	repo postgres.APIKeyRepository
+}
+
+// NewAPIKeyService 构造 API Key 服务
+func NewAPIKeyService(repo postgres.APIKeyRepository) *APIKeyService {
+	return &APIKeyService{repo: repo}
+}
+
+// IsAPIKey 判断凭证是否为 API Key 格式
+func IsAPIKey(credential string) bool {
+	return strings.HasPrefix(credential, APIKeyPrefix)
+}
+
+// Create 创建 API Key，返回明文与记录
+func (s *APIKeyService) Create(ctx context.Context, createdBy int64, in CreateAPIKeyInput) (string, *models.APIKey, error) {
+	name := strings.TrimSpace(in.Name)
+	if name == "" {
+		return "", nil, fmt.Errorf("%w: 名称不能为空", ErrInvalidAPIKeyInput)
+	}
+	if len(in.Scopes) == 0 {
+		return "", nil, fmt.Errorf("%w: 至少需要一个授权范围", ErrInvalidAPIKeyScope)
+	}
+	for _, scope := range in.Scopes {
+		if !models.IsValidAPIKeyScope(scope) {
+			return "", nil, fmt.Errorf("%w: %s", ErrInvalidAPIKeyScope, scope)
+		}
+	}
+	ttl := time.Duration(in.ExpiresInDays) * 24 * time.Hour
+	if ttl <= 0 {
+		ttl = apiKeyDefaultTTL
+	}
+	if ttl > apiKeyMaxTTL {
+		ttl = apiKeyMaxTTL
+	}
+	plaintext, prefix, err := generateAPIKey()
+	if err != nil {
+		return "", nil, err
+	}
+	key := &models.APIKey{
+		OrgID:     tenant.OrgForCreate(ctx, in.OrgID),
+		Name:      name,
+		Prefix:    prefix,
+		KeyHash:   sha256Hex(plaintext),
+		Scopes:    in.Scopes,
+		CreatedBy: createdBy,
+		ExpiresAt: time.Now().Add(ttl),
+	}
+	if err := s.repo.Create(ctx, key); err != nil {
+		return "", nil, err
+	}
+	return plaintext, key, nil
+}
+
+// Get 查询 API Key
+func (s *APIKeyService) Get(ctx context.Context, id int64) (*models.APIKey, error) {
+	key, err := s.repo.Get(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if key == nil {
+		return nil, ErrAPIKeyNotFound
+	}
+	return key, nil
+}
+
+// List API Key 列表（含已撤销）
+func (s *APIKeyService) List(ctx context.Context) ([]models.APIKey, error) {
+	return s.repo.List(ctx)
+}
+
+// Rotate 轮换密钥：生成新明文，旧 Key 立即失效，名称、授权范围与有效期不变
+func (s *APIKeyService) Rotate(ctx context.Context, id int64) (string, *models.APIKey, error) {
+	plaintext, prefix, err := generateAPIKey()
+	if err != nil {
+		return "", nil, err
+	}
+	ok, err := s.repo.Rotate(ctx, id, prefix, sha256Hex(plaintext))
+	if err != nil {
+		return "", nil, err
+	}
+	if !ok {
+		return "", nil, ErrAPIKeyNotFound
+	}
+	key, err := s.Get(ctx, id)
+	if err != nil {
+		return "", nil, err
+	}
+	return plaintext, key, nil
+}
+
+// Revoke 撤销 API Key
+func (s *APIKeyService) Revoke(ctx context.Context, id int64) error {
+	ok, err := s.repo.Revoke(ctx, id)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return ErrAPIKeyNotFound
+	}
+	return nil
+}
+
+// Authenticate 校验 API Key 明文，并记录最近使用时间
+func (s *APIKeyService) Authenticate(ctx context.Context, plaintext string) (*models.APIKey, error) {
+	prefix, ok := apiKeyPrefixOf(plaintext)
+	if !ok {
+		return nil, ErrAPIKeyInvalid
+	}
+	key, err := s.repo.GetByPrefix(ctx, prefix)
+	if err != nil {
+		return nil, err
+	}
+	if key == nil || subtle.ConstantTimeCompare([]byte(key.KeyHash), []byte(sha256Hex(plaintext))) != 1 {
+		return nil, ErrAPIKeyInvalid
+	}
+	if key.RevokedAt != nil || !time.Now().Before(key.ExpiresAt) {
+		return nil, ErrAPIKeyInvalid
+	}
+	if err := s.repo.TouchLastUsed(ctx, key.ID); err != nil {
+		return nil, err
+	}
+	return key, nil
+}
+
+// generateAPIKey 生成明文 hdk_<8位标识>_<40位密钥>，返回明文与前缀 hdk_<8位标识>
+func generateAPIKey() (string, string, error) {
+	id, err := randomHex(apiKeyIDBytes)
+	if err != nil {
+		return "", "", err
+	}
+	secret, err := randomHex(apiKeySecretBytes)
+	if err != nil {
+		return "", "", err
+	}
+	prefix := APIKeyPrefix + id
+	return prefix + "_" + secret, prefix, nil
+}
+
+func apiKeyPrefixOf(plaintext string) (string, bool) {
+	rest := strings.TrimPrefix(plaintext, APIKeyPrefix)
+	if rest == plaintext || len(rest) <= apiKeyIDBytes*2 || rest[apiKeyIDBytes*2] != '_' {
+		return "", false
+	}
+	return APIKeyPrefix + rest[:apiKeyIDBytes*2], true
+}
@@ -0,0 +1,320 @@
+// Package service 审计日志业务逻辑
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/fire-disposal/health_DT_go/internal/models"
+	"github.com/fire-disposal/health_DT_go/internal/repository/postgres"
+	"github.com/fire-disposal/health_DT_go/internal/tenant"
+	"go.uber.org/zap"
+)
+
+const (
+	auditDefaultLimit = 50
+	auditMaxLimit     = 500
+	auditVerifyBatch  = 1000
+	auditQueueSize    = 4096            // 待写入的读取类日志队列长度，队列满时改为同步写入
+	auditWriteBatch   = 200             // 后台单次事务最多写入的日志条数
+	auditWriteTimeout = 5 * time.Second // 后台单批写入超时
+	// auditRedacted 标记 audit:"redact" 的字段在差异中以此占位，只体现字段发生了变更
+	auditRedacted = "[redacted]"
+)
+
+// AuditEntry 待记录的审计事件；Before/After 为变更前后的资源对象，按 JSON 字段比较生成差异
+type AuditEntry struct {
+	ActorType    string
+	ActorID      int64
+	Action       string
+	ResourceType string
+	ResourceID   string
+	Before       interface{}
+	After        interface{}
+	IP           string
+}
+
+// AuditFieldChange 单个字段的变更
+type AuditFieldChange struct {
+	Before interface{} `json:"before"`
+	After  interface{} `json:"after"`
+}
+
+// AuditChainReport hash 链校验结果
+type AuditChainReport struct {
+	Valid    bool   `json:"valid"`
+	Checked  int    `json:"checked"`
+	BrokenAt int64  `json:"broken_at,omitempty"` // 首条校验失败的日志ID
+	Reason   string `json:"reason,omitempty"`
+}
+
+// AuditService 审计日志服务。hash 链全局串行，变更类日志同步写入；
+// 查看、列表等读取类日志量大，交由 Run 中的单个写入协程批量追加，一次事务只争用一次链锁
+type AuditService struct {
+	repo postgres.AuditLogRepository
+
+	mu      sync.RWMutex
+	queue   chan *models.AuditLog
+	stopped bool // Run 已退出，读取类日志改为同步写入
+}
+
+// NewAuditService 构造审计日志服务
+func NewAuditService(repo postgres.AuditLogRepository) *AuditService {
+	return &AuditService{repo: repo, queue: make(chan *models.AuditLog, auditQueueSize)}
+}
+
+// Run 批量写入读取类日志，直到 ctx 取消；退出前写完队列中剩余日志
+func (s *AuditService) Run(ctx context.Context) {
+	for {
+		select {
+		case <-ctx.Done():
+			s.mu.Lock()
+			s.stopped = true
+			s.mu.Unlock()
+			for len(s.queue) > 0 {
+				s.writeBatch(<-s.queue)
+			}
+			return
+		case log := <-s.queue:
+			s.writeBatch(log)
+		}
+	}
+}
+
+// writeBatch 以 first 开头，取出队列中已有的日志（不超过 auditWriteBatch 条）一次写入
+func (s *AuditService) writeBatch(first *models.AuditLog) {
+	batch := []*models.AuditLog{first}
+fill:
+	for len(batch) < auditWriteBatch {
+		select {
+		case log := <-s.queue:
+			batch = append(batch, log)
+		default:
+			break fill
+		}
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), auditWriteTimeout)
+	defer cancel()
+	if err := s.repo.Append(ctx, batch, auditHash); err != nil {
+		zap.L().Error("审计日志批量写入失败", zap.Int("count", len(batch)), zap.Error(err))
+	}
+}
+
+// enqueue 将读取类日志交给后台写入，Run 已退出或队列已满时返回 false
+func (s *AuditService) enqueue(log *models.AuditLog) bool {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if s.stopped {
+		return false
+	}
+	select {
+	case s.queue <- log:
+		return true
+	default:
+		return false
+	}
+}
+
+// Record 追加一条审计日志；读取类日志（查看、列表）异步批量写入，写入失败只记日志
+func (s *AuditService) Record(ctx context.Context, entry AuditEntry) error {
+	changes, err := diffAuditFields(entry.Before, entry.After)
+	if err != nil {
+		return err
+	}
+	log := &models.AuditLog{
+		OrgID:        auditOrgID(ctx),
+		ActorType:    entry.ActorType,
+		ActorID:      entry.ActorID,
+		Action:       entry.Action,
+		ResourceType: entry.ResourceType,
+		ResourceID:   entry.ResourceID,
+		Changes:      changes,
+		IP:           entry.IP,
+		CreatedAt:    time.Now().UTC().Truncate(time.Microsecond), // 与数据库精度一致，保证 hash 可复算
+	}
+	if log.ActorType == "" {
+		log.ActorType = models.AuditActorAnonymous
+	}
+	if (log.Action == models.AuditActionView || log.Action == models.AuditActionList) && s.enqueue(log) {
+		return nil
+	}
+	return s.repo.Append(ctx, []*models.AuditLog{log}, auditHash)
+}
+
+// Search 按条件分页查询审计日志，返回日志与总数
+func (s *AuditService) Search(ctx context.Context, filter models.AuditLogFilter) ([]models.AuditLog, int, error) {
+	if filter.Limit <= 0 {
+		filter.Limit = auditDefaultLimit
+	}
+	if filter.Limit > auditMaxLimit {
+		filter.Limit = auditMaxLimit
+	}
+	if filter.Offset < 0 {
+		filter.Offset = 0
+	}
+	return s.repo.Search(ctx, filter)
+}
+
+// Verify 从头复算 hash 链，发现断链或内容被改动时返回首个异常位置
+func (s *AuditService) Verify(ctx context.Context) (*AuditChainReport, error) {
+	report := &AuditChainReport{Valid: true}
+	prevHash := strings.Repeat("0", 64)
+	var afterID int64
+	for {
+		logs, err := s.repo.ListAfter(ctx, afterID, auditVerifyBatch)
+		if err != nil {
+			return nil, err
+		}
+		for i := range logs {
+			l := &logs[i]
+			switch {
+			case l.PrevHash != prevHash:
+				report.Valid, report.BrokenAt, report.Reason = false, l.ID, "prev_hash 与上一条记录不一致"
+			case auditHash(l.PrevHash, l) != l.Hash:
+				report.Valid, report.BrokenAt, report.Reason = false, l.ID, "记录内容与 hash 不一致"
+			}
+			if !report.Valid {
+				return report, nil
+			}
+			report.Checked++
+			prevHash = l.Hash
+			afterID = l.ID
+		}
+		if len(logs) < auditVerifyBatch {
+			return report, nil
+		}
+	}
+}
+
+// auditHash 计算 SHA256(prev_hash + 规范化记录内容)
+func auditHash(prevHash string, l *models.AuditLog) string {
+	fields := []string{
+		prevHash,
+		l.ActorType,
+		strconv.FormatInt(l.ActorID, 10),
+		l.Action,
+		l.ResourceType,
+		l.ResourceID,
+		canonicalJSON(l.Changes),
+		l.IP,
+		l.CreatedAt.UTC().Format(time.RFC3339Nano),
+	}
+	// 组织字段追加在末尾且仅在非平台级记录中参与计算，引入组织前写入的日志 hash 保持不变
+	if l.OrgID != 0 {
+		fields = append(fields, strconv.Itoa(l.OrgID))
+	}
+	return sha256Hex(strings.Join(fields, "\n"))
+}
+
+// auditOrgID 审计日志归属组织：取调用方限定的组织，平台级及系统调用为 0
+func auditOrgID(ctx context.Context) int {
+	if orgID, ok := tenant.OrgFilter(ctx); ok {
+		return orgID
+	}
+	return 0
+}
+
+// canonicalJSON 规范化 JSON（键排序、去空白），消除 JSONB 存储带来的格式差异
+func canonicalJSON(raw json.RawMessage) string {
+	if len(raw) == 0 {
+		return ""
+	}
+	var v interface{}
+	if err := json.Unmarshal(raw, &v); err != nil {
+		return string(raw)
+	}
+	b, _ := json.Marshal(v)
+	return string(b)
+}
+
+// diffAuditFields 比较变更前后对象的 JSON 字段，仅保留发生变化的字段；
+// 字段标记为 json:"-" 的敏感信息（如密码哈希）不会进入审计日志，
+// 标记 audit:"redact" 的字段（加密存储的个人信息、健康数据）只记录变更、不记录取值
+func diffAuditFields(before, after interface{}) (json.RawMessage, error) {
+	if before == nil && after == nil {
+		return nil, nil
+	}
+	b, err := toAuditMap(before)
+	if err != nil {
+		return nil, err
+	}
+	a, err := toAuditMap(after)
+	if err != nil {
+		return nil, err
+	}
+	changes := make(map[string]AuditFieldChange)
+	for k, bv := range b {
+		if av, ok := a[k]; !ok || !reflect.DeepEqual(av, bv) {
+			changes[k] = AuditFieldChange{Before: bv, After: a[k]}
+		}
+	}
+	for k, av := range a {
+		if _, ok := b[k]; !ok {
+			changes[k] = AuditFieldChange{After: av}
+		}
+	}
+	if len(changes) == 0 {
+		return nil, nil
+	}
+	redacted := auditRedactedKeys(before)
+	for k := range auditRedactedKeys(after) {
+		redacted[k] = true
+	}
+	for k, ch := range changes {
+		if !redacted[k] {
+			continue
+		}
+		if ch.Before != nil {
+			ch.Before = auditRedacted
+		}
+		if ch.After != nil {
+			ch.After = auditRedacted
+		}
+		changes[k] = ch
+	}
+	return json.Marshal(changes)
+}
+
+// auditRedactedKeys 返回结构体中标记 audit:"redact" 的字段对应的 JSON 键
+func auditRedactedKeys(v interface{}) map[string]bool {
+	keys := make(map[string]bool)
+	t := reflect.TypeOf(v)
+	for t != nil && t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	if t == nil || t.Kind() != reflect.Struct {
+		return keys
+	}
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if f.Tag.Get("audit") != "redact" {
+			continue
+		}
+		name := strings.Split(f.Tag.Get("json"), ",")[0]
+		if name == "" {
+			name = f.Name
+		}
+		keys[name] = true
+	}
+	return keys
+}
+
+func toAuditMap(v interface{}) (map[string]interface{}, error) {
+	m := make(map[string]interface{})
+	if v == nil || reflect.ValueOf(v).Kind() == reflect.Ptr && reflect.ValueOf(v).IsNil() {
+		return m, nil
+	}
+	raw, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(raw, &m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
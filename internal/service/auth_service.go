@@ -3,29 +3,101 @@ package service
 
 import (
 	"context"
-	"encoding/json"
 	"errors"
-	"net/http"
+	"fmt"
 	"time"
 
-	"github.com/fire-disposal/health_DT_go/config"
 	"github.com/fire-disposal/health_DT_go/internal/models"
 	"github.com/fire-disposal/health_DT_go/internal/repository/postgres"
+	"github.com/fire-disposal/health_DT_go/internal/tenant"
+	"github.com/fire-disposal/health_DT_go/internal/wechat"
+	"golang.org/x/crypto/bcrypt"
+)
+
+var (
+	ErrWechatAppUserOnly      = errors.New("仅 App 用户可绑定微信")
+	ErrWechatAccountBound     = errors.New("当前账号已绑定微信，请先解绑")
+	ErrWechatOpenIDBound      = errors.New("该微信已绑定其他账号")
+	ErrWechatNotBound         = errors.New("当前账号未绑定微信")
+	ErrWechatUnbindNoPassword = errors.New("账号未设置密码，解绑微信后将无法登录")
+	ErrAccountDisabled        = errors.New("账号已停用")
 )
 
 // AuthService 提供 Token 相关业务方法
 type AuthService struct {
-	repo postgres.AuthRepository
+	repo      postgres.AuthRepository
+	adminRepo postgres.AdminUserRepository
+	twoFactor *TwoFactorService // 为 nil 时不启用两步验证
+	wechat    wechat.Client     // 为 nil 时微信登录不可用
+	apiKeys   *APIKeyService    // 为 nil 时不接受 API Key
 }
 
 // NewAuthService 构造鉴权服务
-func NewAuthService(repo postgres.AuthRepository) *AuthService {
-	return &AuthService{repo: repo}
+func NewAuthService(repo postgres.AuthRepository, adminRepo postgres.AdminUserRepository, twoFactor *TwoFactorService,
+	wx wechat.Client, apiKeys *APIKeyService) *AuthService {
+	return &AuthService{repo: repo, adminRepo: adminRepo, twoFactor: twoFactor, wechat: wx, apiKeys: apiKeys}
+}
+
+// Principal 当前请求的认证主体
+type Principal struct {
+	UserID   int64
+	UserType string   // admin / app / api_key
+	Role     string   // platform_admin / superadmin / admin / app / api_key
+	OrgID    int      // 管理员与 API Key 所属组织；App 用户为 0，其访问范围由档案成员关系决定
+	Scopes   []string // API Key 授权范围
+	Token    string
+}
+
+// IsAdmin 是否为管理员主体
+func (p *Principal) IsAdmin() bool {
+	return p != nil && p.UserType == models.UserTypeAdmin
+}
+
+// IsAPIKey 是否为第三方系统 API Key 主体
+func (p *Principal) IsAPIKey() bool {
+	return p != nil && p.UserType == models.UserTypeAPIKey
+}
+
+// HasScopes API Key 是否具备全部指定授权范围；非 API Key 主体不受授权范围限制
+func (p *Principal) HasScopes(scopes ...string) bool {
+	if !p.IsAPIKey() {
+		return true
+	}
+	for _, want := range scopes {
+		found := false
+		for _, s := range p.Scopes {
+			if s == want {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}
+
+// IsPlatformAdmin 是否为可跨组织操作的平台管理员
+func (p *Principal) IsPlatformAdmin() bool {
+	return p.IsAdmin() && p.Role == models.AdminRolePlatformAdmin
+}
+
+// TenantScope 主体的租户范围：组织管理员与 API Key 限定于所属组织；平台管理员不限组织，
+// 可通过 requestedOrg 临时限定到某个组织；App 用户不按组织过滤
+func (p *Principal) TenantScope(requestedOrg int) tenant.Scope {
+	switch {
+	case p.IsPlatformAdmin():
+		return tenant.Scope{OrgID: requestedOrg, Platform: true}
+	case p.IsAdmin(), p.IsAPIKey():
+		return tenant.Scope{OrgID: p.OrgID}
+	}
+	return tenant.Scope{}
 }
 
 // GenerateToken 生成 Token
-func (s *AuthService) GenerateToken(userID int64, expireDuration time.Duration) (string, error) {
-	token, err := s.repo.CreateToken(userID, expireDuration)
+func (s *AuthService) GenerateToken(userID int64, userType string, expireDuration time.Duration) (string, error) {
+	token, err := s.repo.CreateToken(userID, userType, expireDuration)
 	if err != nil {
 		return "", err
 	}
@@ -49,10 +121,62 @@ func (s *AuthService) InvalidateToken(token string) error {
 	return s.repo.DeleteToken(token)
 }
 
+// Authenticate 校验 Token 或 API Key 并解析认证主体；管理员实时读取角色与激活状态，停用后立即失效
+func (s *AuthService) Authenticate(ctx context.Context, token string) (*Principal, error) {
+	if IsAPIKey(token) {
+		return s.authenticateAPIKey(ctx, token)
+	}
+	auth, err := s.ValidateToken(token)
+	if err != nil {
+		return nil, err
+	}
+	principal := &Principal{UserID: auth.UserID, UserType: auth.UserType, Token: token}
+	switch auth.UserType {
+	case models.UserTypeAdmin:
+		admin, err := s.adminRepo.GetByID(ctx, auth.UserID)
+		if err != nil {
+			return nil, err
+		}
+		if admin == nil || !admin.IsActive {
+			return nil, errors.New("管理员账号不存在或已停用")
+		}
+		principal.Role = admin.Role
+		principal.OrgID = admin.OrgID
+	case models.UserTypeApp:
+		principal.Role = models.UserTypeApp
+	default:
+		return nil, errors.New("token invalid or expired")
+	}
+	return principal, nil
+}
+
+func (s *AuthService) authenticateAPIKey(ctx context.Context, plaintext string) (*Principal, error) {
+	if s.apiKeys == nil {
+		return nil, ErrAPIKeyInvalid
+	}
+	key, err := s.apiKeys.Authenticate(ctx, plaintext)
+	if err != nil {
+		return nil, err
+	}
+	return &Principal{
+		UserID:   key.ID,
+		UserType: models.UserTypeAPIKey,
+		Role:     models.UserTypeAPIKey,
+		OrgID:    key.OrgID,
+		Scopes:   key.Scopes,
+	}, nil
+}
+
 type LoginResult struct {
 	Token  string
 	UserID int64
 	Role   string
+
+	// 两步验证：密码校验通过但需验证码时，仅返回挑战令牌，不签发 Token
+	TwoFactorRequired  bool
+	EnrollmentRequired bool // 系统强制两步验证但该管理员尚未绑定
+	ChallengeToken     string
+	RecoveryCodes      []string // 登录过程中完成绑定时返回的恢复码，仅展示一次
 }
 
 // 登录业务方法，统一查找、校验、生成Token
@@ -60,18 +184,41 @@ func (s *AuthService) Login(loginType string, username string, password string)
 	var userID int64
 	var role string
 	switch loginType {
-	case "admin":
-		admin, err := s.repo.GetAdminUserByUsername(username)
+	case models.UserTypeAdmin:
+		ctx := context.Background()
+		admin, err := s.adminRepo.GetByUsername(ctx, username)
 		if err != nil || admin == nil {
 			return nil, errors.New("用户名或密码错误")
 		}
-		ok, err := s.repo.VerifyPassword(context.Background(), admin.ID, password)
-		if err != nil || !ok {
+		if bcrypt.CompareHashAndPassword([]byte(admin.PasswordHash), []byte(password)) != nil {
 			return nil, errors.New("用户名或密码错误")
 		}
+		if !admin.IsActive {
+			return nil, errors.New("账号已停用")
+		}
+		if s.twoFactor != nil {
+			need, err := s.twoFactor.NeedsChallenge(ctx, admin.ID)
+			if err != nil {
+				return nil, errors.New("两步验证状态查询失败")
+			}
+			if need {
+				challenge, enroll, err := s.twoFactor.CreateChallenge(ctx, admin.ID)
+				if err != nil {
+					return nil, errors.New("创建登录挑战失败")
+				}
+				return &LoginResult{
+					UserID:             admin.ID,
+					Role:               admin.Role,
+					TwoFactorRequired:  true,
+					EnrollmentRequired: enroll,
+					ChallengeToken:     challenge,
+				}, nil
+			}
+		}
+		_ = s.adminRepo.UpdateLastLogin(ctx, admin.ID, time.Now())
 		userID = admin.ID
 		role = admin.Role
-	case "app":
+	case models.UserTypeApp:
 		user, err := s.repo.GetAppUserByUsername(username)
 		if err != nil || user == nil {
 			return nil, errors.New("用户名或密码错误")
@@ -84,11 +231,11 @@ func (s *AuthService) Login(loginType string, username string, password string)
 			return nil, errors.New("用户名或密码错误")
 		}
 		userID = user.ID
-		role = "app"
+		role = models.UserTypeApp
 	default:
 		return nil, errors.New("未知登录类型")
 	}
-	token, err := s.GenerateToken(userID, 24*time.Hour)
+	token, err := s.GenerateToken(userID, loginType, 24*time.Hour)
 	if err != nil {
 		return nil, errors.New("生成Token失败")
 	}
@@ -99,68 +246,135 @@ func (s *AuthService) Login(loginType string, username string, password string)
 	}, nil
 }
 
-// 微信登录：通过 code 换 openid，查找/注册用户，生成 Token
-func (s *AuthService) LoginWithWechatCode(code string) (*LoginResult, error) {
-	// 1. 请求微信官方接口换取 openid
-	// 2. 查找用户，无则自动注册
-	// 3. 生成 Token 返回
-
-	// 从配置读取微信 appid/secret
-	cfg, err := config.Load()
-	if err != nil {
-		return nil, errors.New("微信配置加载失败")
+// CompleteTwoFactorLogin 校验登录挑战的 TOTP 验证码或恢复码，通过后签发管理员 Token
+func (s *AuthService) CompleteTwoFactorLogin(ctx context.Context, challengeToken, code, recoveryCode string) (*LoginResult, error) {
+	if s.twoFactor == nil {
+		return nil, errors.New("未启用两步验证")
 	}
-	appid := cfg.Wechat.AppID
-	secret := cfg.Wechat.Secret
-	url := "https://api.weixin.qq.com/sns/jscode2session?appid=" + appid + "&secret=" + secret + "&js_code=" + code + "&grant_type=authorization_code"
-
-	resp, err := http.Get(url)
+	adminID, recoveryCodes, err := s.twoFactor.ResolveChallenge(ctx, challengeToken, code, recoveryCode)
 	if err != nil {
-		return nil, errors.New("微信接口请求失败")
-	}
-	defer resp.Body.Close()
-	var wxResp struct {
-		OpenID     string `json:"openid"`
-		SessionKey string `json:"session_key"`
-		ErrCode    int    `json:"errcode"`
-		ErrMsg     string `json:"errmsg"`
+		return nil, err
 	}
-	if err := json.NewDecoder(resp.Body).Decode(&wxResp); err != nil {
-		return nil, errors.New("微信响应解析失败")
+	admin, err := s.adminRepo.GetByID(ctx, adminID)
+	if err != nil || admin == nil || !admin.IsActive {
+		return nil, errors.New("账号不存在或已停用")
 	}
-	if wxResp.OpenID == "" {
-		return nil, errors.New("微信登录失败: " + wxResp.ErrMsg)
+	_ = s.adminRepo.UpdateLastLogin(ctx, admin.ID, time.Now())
+	token, err := s.GenerateToken(admin.ID, models.UserTypeAdmin, 24*time.Hour)
+	if err != nil {
+		return nil, errors.New("生成Token失败")
 	}
+	return &LoginResult{Token: token, UserID: admin.ID, Role: admin.Role, RecoveryCodes: recoveryCodes}, nil
+}
 
-	// 2. 查找用户
-	user, err := s.repo.GetAppUserByWechatOpenID(wxResp.OpenID)
+// 微信登录：通过 code 换 openid，查找/注册用户，生成 Token
+func (s *AuthService) LoginWithWechatCode(ctx context.Context, code string) (*LoginResult, error) {
+	session, err := s.wechatSession(ctx, code)
 	if err != nil {
-		return nil, errors.New("数据库查询失败")
+		return nil, err
+	}
+	user, err := s.repo.GetAppUserByWechatOpenID(session.OpenID)
+	if err != nil {
+		return nil, fmt.Errorf("数据库查询失败: %w", err)
 	}
 	if user == nil {
-		// 自动注册
+		// 自动注册（无密码，仅微信登录），用户名随机生成
+		suffix, err := randomHex(6)
+		if err != nil {
+			return nil, err
+		}
+		now := time.Now()
 		user = &models.AppUser{
-			WechatOpenID: wxResp.OpenID,
+			Username:     "wx_" + suffix,
+			WechatOpenID: session.OpenID,
 			IsActive:     true,
-			CreatedAt:    time.Now(),
-			UpdatedAt:    time.Now(),
+			CreatedAt:    now,
+			UpdatedAt:    now,
+		}
+		id, err := s.repo.CreateAppUser(ctx, user)
+		if errors.Is(err, postgres.ErrAppUserExists) {
+			// 同一微信并发首次登录，另一请求已完成注册
+			return nil, ErrWechatOpenIDBound
 		}
-		// 注册到数据库（无密码，仅微信登录）
-		id, err := s.repo.CreateAppUser(context.Background(), user)
 		if err != nil {
-			return nil, errors.New("微信用户注册失败")
+			return nil, fmt.Errorf("微信用户注册失败: %w", err)
 		}
 		user.ID = id
 	}
+	if !user.IsActive {
+		return nil, ErrAccountDisabled
+	}
 
-	// 3. 生成 Token
-	token, err := s.GenerateToken(user.ID, 24*time.Hour)
+	token, err := s.GenerateToken(user.ID, models.UserTypeApp, 24*time.Hour)
 	if err != nil {
 		return nil, errors.New("生成Token失败")
 	}
 	return &LoginResult{
 		Token:  token,
 		UserID: user.ID,
-		Role:   "app",
+		Role:   models.UserTypeApp,
 	}, nil
 }
+
+// BindWechat 已登录的 App 用户（密码账号）绑定微信，之后可用微信登录同一账号
+func (s *AuthService) BindWechat(ctx context.Context, p *Principal, code string) error {
+	if p == nil || p.UserType != models.UserTypeApp {
+		return ErrWechatAppUserOnly
+	}
+	user, err := s.repo.GetAppUserByID(ctx, p.UserID)
+	if err != nil {
+		return err
+	}
+	if user == nil {
+		return ErrWechatAppUserOnly
+	}
+	if user.WechatOpenID != "" {
+		return ErrWechatAccountBound
+	}
+	session, err := s.wechatSession(ctx, code)
+	if err != nil {
+		return err
+	}
+	owner, err := s.repo.GetAppUserByWechatOpenID(session.OpenID)
+	if err != nil {
+		return err
+	}
+	if owner != nil {
+		return ErrWechatOpenIDBound
+	}
+	err = s.repo.SetAppUserWechatOpenID(ctx, user.ID, session.OpenID)
+	if errors.Is(err, postgres.ErrAppUserExists) {
+		return ErrWechatOpenIDBound
+	}
+	return err
+}
+
+// UnbindWechat 解绑微信；未设置密码的账号解绑后将无法登录，因此拒绝
+func (s *AuthService) UnbindWechat(ctx context.Context, p *Principal) error {
+	if p == nil || p.UserType != models.UserTypeApp {
+		return ErrWechatAppUserOnly
+	}
+	user, err := s.repo.GetAppUserByID(ctx, p.UserID)
+	if err != nil {
+		return err
+	}
+	if user == nil || user.WechatOpenID == "" {
+		return ErrWechatNotBound
+	}
+	if user.PasswordHash == "" {
+		return ErrWechatUnbindNoPassword
+	}
+	return s.repo.SetAppUserWechatOpenID(ctx, user.ID, "")
+}
+
+// wechatSession 调用微信客户端换取 openid，并统一错误
+func (s *AuthService) wechatSession(ctx context.Context, code string) (*wechat.Session, error) {
+	if s.wechat == nil {
+		return nil, wechat.ErrNotConfigured
+	}
+	session, err := s.wechat.Code2Session(ctx, code)
+	if err != nil {
+		return nil, fmt.Errorf("微信登录失败: %w", err)
+	}
+	return session, nil
+}
@@ -0,0 +1,134 @@
+// Package service 设备绑定业务逻辑
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/fire-disposal/health_DT_go/internal/models"
+	"github.com/fire-disposal/health_DT_go/internal/repository/postgres"
+)
+
+const (
+	deviceAssignmentListLimit    = 200
+	deviceAssignmentListMaxLimit = 1000
+)
+
+var (
+	ErrAssignmentNotFound = errors.New("设备绑定不存在")
+	ErrAssignmentEnded    = errors.New("设备绑定已解除")
+	ErrInvalidAssignment  = errors.New("设备绑定参数错误")
+)
+
+// DeviceAssignmentQuery 绑定查询条件；ProfileIDs 非 nil 时仅返回这些档案的绑定
+type DeviceAssignmentQuery struct {
+	DeviceID   int
+	ProfileID  int
+	ActiveOnly bool
+	ProfileIDs []int
+	Limit      int
+}
+
+// DeviceAssignmentResult 绑定结果；Replaced 为因改绑被自动解除的原绑定，Created 为 false 表示设备已绑定到该档案
+type DeviceAssignmentResult struct {
+	Assignment *models.DeviceAssignment `json:"assignment"`
+	Replaced   *models.DeviceAssignment `json:"replaced,omitempty"`
+	Created    bool                     `json:"created"`
+}
+
+// DeviceAssignmentService 设备绑定服务：每台设备同时至多一条有效绑定，改绑时在同一事务内解除原绑定，
+// 解绑只记录结束时间与原因，历史可按设备或档案查询
+type DeviceAssignmentService struct {
+	repo *postgres.DeviceAssignmentRepository
+}
+
+// NewDeviceAssignmentService 构造设备绑定服务
+func NewDeviceAssignmentService(repo *postgres.DeviceAssignmentRepository) *DeviceAssignmentService {
+	return &DeviceAssignmentService{repo: repo}
+}
+
+// Assign 将设备绑定到档案，设备与档案须存在且属于同一组织；
+// authorize 在绑定事务内以设备当前有效绑定（无则为 nil）调用，返回错误时不做修改
+func (s *DeviceAssignmentService) Assign(ctx context.Context, deviceID, profileID int,
+	authorize func(current *models.DeviceAssignment) error) (*DeviceAssignmentResult, error) {
+	if deviceID <= 0 || profileID <= 0 {
+		return nil, fmt.Errorf("%w: device_id 与 health_profile_id 必填", ErrInvalidAssignment)
+	}
+	assignment, replaced, created, err := s.repo.Assign(ctx, deviceID, profileID, authorize)
+	if err != nil {
+		return nil, err
+	}
+	return &DeviceAssignmentResult{Assignment: assignment, Replaced: replaced, Created: created}, nil
+}
+
+// Active 查询设备当前有效绑定，未绑定返回 nil
+func (s *DeviceAssignmentService) Active(ctx context.Context, deviceID int) (*models.DeviceAssignment, error) {
+	return s.repo.Active(ctx, deviceID)
+}
+
+// Get 查询绑定记录
+func (s *DeviceAssignmentService) Get(ctx context.Context, id int) (*models.DeviceAssignment, error) {
+	a, err := s.repo.Get(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if a == nil {
+		return nil, ErrAssignmentNotFound
+	}
+	return a, nil
+}
+
+// List 查询绑定记录（含历史），按绑定时间倒序，默认 200 条、最多 1000 条
+func (s *DeviceAssignmentService) List(ctx context.Context, q DeviceAssignmentQuery) ([]models.DeviceAssignment, error) {
+	if q.Limit <= 0 {
+		q.Limit = deviceAssignmentListLimit
+	}
+	if q.Limit > deviceAssignmentListMaxLimit {
+		q.Limit = deviceAssignmentListMaxLimit
+	}
+	if q.ProfileIDs != nil && len(q.ProfileIDs) == 0 {
+		return []models.DeviceAssignment{}, nil
+	}
+	list, err := s.repo.List(ctx, postgres.DeviceAssignmentFilter{
+		DeviceID:   q.DeviceID,
+		ProfileID:  q.ProfileID,
+		ActiveOnly: q.ActiveOnly,
+		ProfileIDs: q.ProfileIDs,
+		Limit:      q.Limit,
+	})
+	if err != nil {
+		return nil, err
+	}
+	if list == nil {
+		list = []models.DeviceAssignment{}
+	}
+	return list, nil
+}
+
+// Unassign 解除有效绑定；绑定不存在返回 ErrAssignmentNotFound，已解除返回 ErrAssignmentEnded
+func (s *DeviceAssignmentService) Unassign(ctx context.Context, id int) (*models.DeviceAssignment, error) {
+	a, err := s.repo.Unassign(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if a != nil {
+		return a, nil
+	}
+	if _, err := s.Get(ctx, id); err != nil {
+		return nil, err
+	}
+	return nil, ErrAssignmentEnded
+}
+
+// Delete 删除绑定记录（仅用于纠正误录，会丢失历史）
+func (s *DeviceAssignmentService) Delete(ctx context.Context, id int) error {
+	ok, err := s.repo.Delete(ctx, id)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return ErrAssignmentNotFound
+	}
+	return nil
+}
@@ -0,0 +1,320 @@
+// Package service 设备凭证与上行数据签名校验
+package service
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/fire-disposal/health_DT_go/internal/repository/postgres"
+	"go.uber.org/zap"
+)
+
+const (
+	deviceKeyCacheTTL = 30 * time.Second // 设备密钥缓存时间，避免每条消息查库
+	deviceKeyCacheMax = 100000           // 设备密钥缓存条目上限，清理过期条目后仍满时不再缓存新序列号
+	replayPruneEvery  = time.Minute      // 已用签名记录的清理间隔
+)
+
+var (
+	ErrDeviceUnknown      = errors.New("设备未注册或已停用")
+	ErrDeviceNoSecret     = errors.New("设备未签发密钥")
+	ErrSignatureMissing   = errors.New("缺少签名")
+	ErrSignatureInvalid   = errors.New("签名校验失败")
+	ErrSignatureExpired   = errors.New("签名时间戳超出允许范围")
+	ErrSignatureReplayed  = errors.New("签名已使用（重放）")
+	ErrDeviceUnauthorized = errors.New("连接未认证")
+)
+
+type deviceKeyEntry struct {
+	secret    string
+	known     bool // 设备已注册且启用；为 true 而 secret 为空表示尚未签发密钥
+	expiresAt time.Time
+}
+
+// DeviceAuthService 设备凭证服务：签发/轮换密钥，校验 MQTT、msgpack 与 HTTP 上行数据签名，并统计拒绝次数
+//
+// 签名算法：HEX(HMAC-SHA256(secret, 各字段以 "\n" 拼接))
+//   - MQTT 数据：sn \n data_type \n ts \n data 原始 JSON
+//   - HTTP 上报：同 MQTT 数据，msgpack 正文时 data 为该字段的 msgpack 原始编码
+//   - msgpack 握手：sn \n ts \n nonce（nonce 为连接建立后服务端下发的挑战）
+//   - 下行指令（服务端签名，设备校验）：sn \n cmd/{name} \n ts \n request_id \n params 原始 JSON
+//   - 影子差异（服务端签名，设备校验）：sn \n shadow/delta \n ts \n version \n state 原始 JSON
+//   - 固件升级通知（服务端签名，设备校验）：sn \n ota \n ts \n campaign_id \n version \n sha256
+//   - 固件下载请求：sn \n ota_download \n ts \n 固件ID
+//
+// 上行签名在时间戳有效期内只能使用一次，重复的签名视为重放并拒绝；同一设备在同一秒内发送内容完全相同的消息时，
+// 后一条同样被拒绝。已用签名记录在进程内，多实例部署时各实例分别判定。
+type DeviceAuthService struct {
+	repo     *postgres.DevicesRepository
+	required bool          // 是否强制签名，关闭时未签名数据放行但计数
+	maxSkew  time.Duration // 允许的时间戳偏差
+
+	mu         sync.Mutex
+	cache      map[string]deviceKeyEntry
+	cachePrune time.Time
+	counters   map[string]int64
+	used       map[string]time.Time // 已通过校验的签名 -> 时间戳失效时间，用于识别重放
+	lastPrune  time.Time
+}
+
+// NewDeviceAuthService 构造设备凭证服务
+func NewDeviceAuthService(repo *postgres.DevicesRepository, required bool, maxSkew time.Duration) *DeviceAuthService {
+	if maxSkew <= 0 {
+		maxSkew = 5 * time.Minute
+	}
+	return &DeviceAuthService{
+		repo:     repo,
+		required: required,
+		maxSkew:  maxSkew,
+		cache:    make(map[string]deviceKeyEntry),
+		counters: make(map[string]int64),
+		used:     make(map[string]time.Time),
+	}
+}
+
+// Required 是否强制设备认证
+func (s *DeviceAuthService) Required() bool {
+	return s.required
+}
+
+// RotateSecret 为设备重新签发密钥，旧密钥立即失效
+func (s *DeviceAuthService) RotateSecret(ctx context.Context, deviceID int) (string, error) {
+	device, err := s.repo.Get(ctx, deviceID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return "", ErrDeviceUnknown
+	}
+	if err != nil {
+		return "", err
+	}
+	secret, err := generateDeviceSecret()
+	if err != nil {
+		return "", err
+	}
+	if err := s.repo.UpdateSecretKey(ctx, deviceID, secret); errors.Is(err, sql.ErrNoRows) {
+		return "", ErrDeviceUnknown
+	} else if err != nil {
+		return "", err
+	}
+	s.Forget(device.SerialNumber)
+	return secret, nil
+}
+
+// Forget 清除设备密钥缓存（设备注册、停用、删除或密钥变更后调用，使其立即生效）
+func (s *DeviceAuthService) Forget(sn string) {
+	s.mu.Lock()
+	delete(s.cache, sn)
+	s.mu.Unlock()
+}
+
+// VerifyMessage 校验 MQTT 数据签名；未强制认证且未签名时放行
+func (s *DeviceAuthService) VerifyMessage(sn, dataType string, ts int64, data []byte, sig string) error {
+	return s.verifyData("mqtt", sn, dataType, ts, data, sig)
+}
+
+// VerifyIngest 校验 HTTP 上报数据签名，明文与 MQTT 数据相同。HTTP 接口对公网开放，
+// 无论是否强制设备认证都必须携带有效签名
+func (s *DeviceAuthService) VerifyIngest(sn, dataType string, ts int64, data []byte, sig string) error {
+	if sig == "" {
+		return s.reject("http", sn, ErrSignatureMissing)
+	}
+	return s.verifyData("http", sn, dataType, ts, data, sig)
+}
+
+func (s *DeviceAuthService) verifyData(source, sn, dataType string, ts int64, data []byte, sig string) error {
+	if sig == "" {
+		if s.required {
+			return s.reject(source, sn, ErrSignatureMissing)
+		}
+		s.count(source + ":unsigned")
+		return nil
+	}
+	msg := sn + "\n" + dataType + "\n" + strconv.FormatInt(ts, 10) + "\n" + string(data)
+	if err := s.verify(sn, ts, msg, sig); err != nil {
+		return s.reject(source, sn, err)
+	}
+	s.count(source + ":accepted")
+	return nil
+}
+
+// VerifyHandshake 校验 msgpack 连接认证帧，nonce 为服务端在该连接下发的挑战
+func (s *DeviceAuthService) VerifyHandshake(sn string, ts int64, nonce, sig string) error {
+	if sig == "" {
+		return s.reject("msgpack", sn, ErrSignatureMissing)
+	}
+	msg := sn + "\n" + strconv.FormatInt(ts, 10) + "\n" + nonce
+	if err := s.verify(sn, ts, msg, sig); err != nil {
+		return s.reject("msgpack", sn, err)
+	}
+	s.count("msgpack:accepted")
+	return nil
+}
+
+// VerifyCertificate 校验 msgpack 客户端证书 CN 对应的设备已注册且处于启用状态，不要求已签发密钥。
+// 每个连接只校验一次，直接查库，不使用密钥缓存
+func (s *DeviceAuthService) VerifyCertificate(sn string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	device, err := s.repo.GetBySerialNumber(ctx, sn)
+	if errors.Is(err, sql.ErrNoRows) || (err == nil && (device == nil || !device.IsActive)) {
+		err = ErrDeviceUnknown
+	}
+	if err != nil {
+		return s.reject("msgpack", sn, err)
+	}
+	s.count("msgpack:accepted")
+	return nil
+}
+
+// SignCommand 计算下行指令签名；设备未签发密钥时返回空签名
+func (s *DeviceAuthService) SignCommand(sn, name string, ts int64, requestID string, params []byte) (string, error) {
+	return s.signDownlink(sn, sn+"\ncmd/"+name+"\n"+strconv.FormatInt(ts, 10)+"\n"+requestID+"\n"+string(params))
+}
+
+// SignShadowDelta 计算设备影子差异下发签名；设备未签发密钥时返回空签名
+func (s *DeviceAuthService) SignShadowDelta(sn string, ts, version int64, state []byte) (string, error) {
+	return s.signDownlink(sn, sn+"\nshadow/delta\n"+strconv.FormatInt(ts, 10)+"\n"+strconv.FormatInt(version, 10)+"\n"+string(state))
+}
+
+// SignOTA 计算固件升级通知签名；设备未签发密钥时返回空签名
+func (s *DeviceAuthService) SignOTA(sn string, ts int64, campaignID int, version, sha256 string) (string, error) {
+	return s.signDownlink(sn, sn+"\nota\n"+strconv.FormatInt(ts, 10)+"\n"+strconv.Itoa(campaignID)+"\n"+version+"\n"+sha256)
+}
+
+func (s *DeviceAuthService) signDownlink(sn, msg string) (string, error) {
+	secret, err := s.secretFor(sn)
+	if errors.Is(err, ErrDeviceNoSecret) {
+		return "", nil
+	}
+	if err != nil {
+		return "", err
+	}
+	return SignDeviceMessage(secret, msg), nil
+}
+
+// CountRejected 记录被拒绝的上行数据（如未认证连接发送的数据帧）
+func (s *DeviceAuthService) CountRejected(source, sn string, err error) {
+	_ = s.reject(source, sn, err)
+}
+
+// Stats 返回认证统计计数快照
+func (s *DeviceAuthService) Stats() map[string]int64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	out := make(map[string]int64, len(s.counters))
+	for k, v := range s.counters {
+		out[k] = v
+	}
+	return out
+}
+
+func (s *DeviceAuthService) verify(sn string, ts int64, msg, sig string) error {
+	if d := time.Since(time.Unix(ts, 0)); d > s.maxSkew || d < -s.maxSkew {
+		return ErrSignatureExpired
+	}
+	secret, err := s.secretFor(sn)
+	if err != nil {
+		return err
+	}
+	expected := SignDeviceMessage(secret, msg)
+	if !hmac.Equal([]byte(expected), []byte(sig)) {
+		return ErrSignatureInvalid
+	}
+	return s.markUsed(expected, time.Unix(ts, 0).Add(s.maxSkew))
+}
+
+// markUsed 登记已通过校验的签名，有效期内再次出现时返回 ErrSignatureReplayed；
+// 只登记签名正确的消息，伪造数据无法撑大记录
+func (s *DeviceAuthService) markUsed(sig string, expiresAt time.Time) error {
+	now := time.Now()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if now.Sub(s.lastPrune) > replayPruneEvery {
+		for k, t := range s.used {
+			if now.After(t) {
+				delete(s.used, k)
+			}
+		}
+		s.lastPrune = now
+	}
+	if t, ok := s.used[sig]; ok && now.Before(t) {
+		return ErrSignatureReplayed
+	}
+	s.used[sig] = expiresAt
+	return nil
+}
+
+func (s *DeviceAuthService) secretFor(sn string) (string, error) {
+	s.mu.Lock()
+	entry, ok := s.cache[sn]
+	s.mu.Unlock()
+	if !ok || !time.Now().Before(entry.expiresAt) {
+		ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+		defer cancel()
+		device, err := s.repo.GetBySerialNumber(ctx, sn)
+		if err != nil && !errors.Is(err, sql.ErrNoRows) {
+			return "", err
+		}
+		entry = deviceKeyEntry{expiresAt: time.Now().Add(deviceKeyCacheTTL)}
+		if device != nil && device.IsActive {
+			entry.known, entry.secret = true, device.SecretKey
+		}
+		// 未知设备同样缓存，防止伪造序列号刷库
+		s.cacheKey(sn, entry)
+	}
+	if !entry.known {
+		return "", ErrDeviceUnknown
+	}
+	if entry.secret == "" {
+		return "", ErrDeviceNoSecret
+	}
+	return entry.secret, nil
+}
+
+// cacheKey 写入设备密钥缓存，定期清理过期条目，条目数达到上限时不再缓存
+func (s *DeviceAuthService) cacheKey(sn string, entry deviceKeyEntry) {
+	now := time.Now()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if now.Sub(s.cachePrune) > deviceKeyCacheTTL {
+		for k, e := range s.cache {
+			if !now.Before(e.expiresAt) {
+				delete(s.cache, k)
+			}
+		}
+		s.cachePrune = now
+	}
+	if _, ok := s.cache[sn]; ok || len(s.cache) < deviceKeyCacheMax {
+		s.cache[sn] = entry
+	}
+}
+
+func (s *DeviceAuthService) reject(source, sn string, err error) error {
+	s.count(source + ":rejected")
+	zap.L().Warn("设备数据认证失败", zap.String("source", source), zap.String("sn", sn), zap.Error(err))
+	return err
+}
+
+func (s *DeviceAuthService) count(key string) {
+	s.mu.Lock()
+	s.counters[key]++
+	s.mu.Unlock()
+}
+
+// SignDeviceMessage 计算设备消息签名（设备端与服务端使用相同算法）
+func SignDeviceMessage(secret, msg string) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(msg))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// generateDeviceSecret 生成 256 位随机设备密钥
+func generateDeviceSecret() (string, error) {
+	return randomHex(32)
+}
@@ -0,0 +1,267 @@
+// Package service 设备下行指令
+package service
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/fire-disposal/health_DT_go/internal/models"
+	"github.com/fire-disposal/health_DT_go/internal/repository/postgres"
+	"go.uber.org/zap"
+)
+
+const (
+	deviceCommandDefaultTimeout = 30 * time.Second
+	deviceCommandMaxTimeout     = 10 * time.Minute
+	deviceCommandExpireInterval = 5 * time.Second
+	deviceCommandHistoryLimit   = 50
+	deviceCommandQoS            = 1
+)
+
+var (
+	ErrUnknownDeviceCommand       = errors.New("不支持的设备指令")
+	ErrInvalidDeviceCommandParams = errors.New("设备指令参数错误")
+	ErrDeviceCommandNotFound      = errors.New("设备指令不存在")
+	ErrDeviceCommandPublish       = errors.New("设备指令发布失败")
+)
+
+// DownlinkPublisher 下行消息发布通道（MQTT 客户端）
+type DownlinkPublisher interface {
+	Publish(topic string, qos byte, retained bool, payload interface{}) error
+}
+
+// DirectDownlink 设备长连接下行通道（msgpack TCP）：设备在线时优先于 MQTT 使用，Send 在设备帧层确认后返回
+type DirectDownlink interface {
+	Connected(sn string) bool
+	Send(ctx context.Context, sn string, payload map[string]interface{}) error
+}
+
+// SendDeviceCommandInput 下发指令参数
+type SendDeviceCommandInput struct {
+	Name           string
+	Params         json.RawMessage
+	TimeoutSeconds int // 等待设备确认的时限，0 时默认 30 秒，最长 600 秒
+}
+
+// DeviceAck 设备回执（device/{sn}/ack 的 data 字段）
+type DeviceAck struct {
+	RequestID string          `json:"request_id"`
+	Status    string          `json:"status"` // ok / error
+	Result    json.RawMessage `json:"result"`
+	Error     string          `json:"error"`
+}
+
+// deviceCommandMessage 下发到 device/{sn}/cmd/{name} 的消息
+type deviceCommandMessage struct {
+	RequestID string          `json:"request_id"`
+	TS        int64           `json:"ts"`
+	Params    json.RawMessage `json:"params,omitempty"`
+	Sig       string          `json:"sig,omitempty"`
+}
+
+// DeviceCommandService 设备下行指令服务：记录指令、经 MQTT 下发（服务端签名），
+// 按 request_id 关联设备回执，超过时限未确认的指令由 Run 标记为 timed_out
+type DeviceCommandService struct {
+	repo       *postgres.DeviceCommandRepository
+	devices    *postgres.DevicesRepository
+	deviceAuth *DeviceAuthService
+	publisher  DownlinkPublisher
+	direct     DirectDownlink
+}
+
+// NewDeviceCommandService 构造下行指令服务
+func NewDeviceCommandService(repo *postgres.DeviceCommandRepository, devices *postgres.DevicesRepository,
+	deviceAuth *DeviceAuthService, publisher DownlinkPublisher) *DeviceCommandService {
+	return &DeviceCommandService{repo: repo, devices: devices, deviceAuth: deviceAuth, publisher: publisher}
+}
+
+// SetDirectDownlink 设置长连接下行通道，设备有 msgpack 连接时经该连接下发，帧层确认即视为已送达
+func (s *DeviceCommandService) SetDirectDownlink(direct DirectDownlink) {
+	s.direct = direct
+}
+
+// Send 创建并下发指令。发布失败时指令记为 failed，返回记录与 ErrDeviceCommandPublish
+func (s *DeviceCommandService) Send(ctx context.Context, deviceID int, createdBy int64, in SendDeviceCommandInput) (*models.DeviceCommand, error) {
+	if !models.IsValidDeviceCommand(in.Name) {
+		return nil, fmt.Errorf("%w: %s", ErrUnknownDeviceCommand, in.Name)
+	}
+	timeout := deviceCommandDefaultTimeout
+	if in.TimeoutSeconds != 0 {
+		timeout = time.Duration(in.TimeoutSeconds) * time.Second
+		if timeout < time.Second || timeout > deviceCommandMaxTimeout {
+			return nil, fmt.Errorf("%w: timeout_seconds 须在 1-%d 之间", ErrInvalidDeviceCommandParams,
+				int(deviceCommandMaxTimeout.Seconds()))
+		}
+	}
+	params, err := normalizeCommandParams(in.Name, in.Params)
+	if err != nil {
+		return nil, err
+	}
+	device, err := s.devices.Get(ctx, deviceID)
+	if errors.Is(err, sql.ErrNoRows) || (err == nil && !device.IsActive) {
+		return nil, ErrDeviceUnknown
+	}
+	if err != nil {
+		return nil, err
+	}
+	requestID, err := randomHex(16)
+	if err != nil {
+		return nil, err
+	}
+	cmd := &models.DeviceCommand{
+		DeviceID:  deviceID,
+		RequestID: requestID,
+		Name:      in.Name,
+		Params:    params,
+		Status:    models.DeviceCommandPending,
+		CreatedBy: createdBy,
+		ExpiresAt: time.Now().Add(timeout),
+	}
+	if err := s.repo.Create(ctx, cmd); err != nil {
+		return nil, err
+	}
+
+	if err := s.publish(ctx, device.SerialNumber, cmd); err != nil {
+		cmd.Status = models.DeviceCommandFailed
+		cmd.Error = err.Error()
+		if markErr := s.repo.MarkFailed(ctx, cmd.ID, cmd.Error); markErr != nil {
+			zap.L().Error("设备指令状态更新失败", zap.Int64("id", cmd.ID), zap.Error(markErr))
+		}
+		return cmd, fmt.Errorf("%w: %v", ErrDeviceCommandPublish, err)
+	}
+	if err := s.repo.MarkSent(ctx, cmd.ID); err != nil {
+		// 消息已发出，状态仍为 pending，不影响后续回执与超时处理
+		zap.L().Error("设备指令状态更新失败", zap.Int64("id", cmd.ID), zap.Error(err))
+		return cmd, nil
+	}
+	now := time.Now()
+	cmd.Status = models.DeviceCommandSent
+	cmd.SentAt = &now
+	return cmd, nil
+}
+
+// publish 下发指令：设备有 msgpack 连接时经长连接下发并等待帧层确认，否则发布到 MQTT
+func (s *DeviceCommandService) publish(ctx context.Context, sn string, cmd *models.DeviceCommand) error {
+	direct := s.direct != nil && s.direct.Connected(sn)
+	if s.publisher == nil && !direct {
+		return errors.New("下行通道未启用")
+	}
+	msg := deviceCommandMessage{RequestID: cmd.RequestID, TS: time.Now().Unix(), Params: cmd.Params}
+	if s.deviceAuth != nil {
+		sig, err := s.deviceAuth.SignCommand(sn, cmd.Name, msg.TS, msg.RequestID, msg.Params)
+		if err != nil {
+			return err
+		}
+		msg.Sig = sig
+	}
+	if direct {
+		// params 以原始 JSON 字符串下发，设备按与 MQTT 相同的明文校验签名
+		frame := map[string]interface{}{"type": "cmd", "name": cmd.Name, "request_id": msg.RequestID, "ts": msg.TS}
+		if len(msg.Params) > 0 {
+			frame["params"] = string(msg.Params)
+		}
+		if msg.Sig != "" {
+			frame["sig"] = msg.Sig
+		}
+		return s.direct.Send(ctx, sn, frame)
+	}
+	payload, err := json.Marshal(msg)
+	if err != nil {
+		return err
+	}
+	return s.publisher.Publish(fmt.Sprintf("device/%s/cmd/%s", sn, cmd.Name), deviceCommandQoS, false, payload)
+}
+
+// HandleAck 记录设备回执；未知、已结束或已超时的 request_id 忽略
+func (s *DeviceCommandService) HandleAck(ctx context.Context, sn string, ack DeviceAck) error {
+	if ack.RequestID == "" {
+		return fmt.Errorf("%w: 缺少 request_id", ErrInvalidDeviceCommandParams)
+	}
+	status := models.DeviceCommandAcked
+	if ack.Status != "" && ack.Status != "ok" {
+		status = models.DeviceCommandFailed
+		if ack.Error == "" {
+			ack.Error = ack.Status
+		}
+	}
+	matched, err := s.repo.Ack(ctx, sn, ack.RequestID, status, ack.Result, ack.Error)
+	if err != nil {
+		return err
+	}
+	if !matched {
+		zap.L().Warn("设备指令回执未匹配（未知、已结束或已超时）",
+			zap.String("sn", sn), zap.String("request_id", ack.RequestID))
+	}
+	return nil
+}
+
+// Get 查询设备的一条指令
+func (s *DeviceCommandService) Get(ctx context.Context, deviceID int, id int64) (*models.DeviceCommand, error) {
+	cmd, err := s.repo.Get(ctx, deviceID, id)
+	if err != nil {
+		return nil, err
+	}
+	if cmd == nil {
+		return nil, ErrDeviceCommandNotFound
+	}
+	return cmd, nil
+}
+
+// History 设备指令历史（最近 limit 条，默认 50）
+func (s *DeviceCommandService) History(ctx context.Context, deviceID, limit int) ([]models.DeviceCommand, error) {
+	if limit <= 0 || limit > 200 {
+		limit = deviceCommandHistoryLimit
+	}
+	return s.repo.ListByDevice(ctx, deviceID, limit)
+}
+
+// Run 定期将超时未确认的指令标记为 timed_out，直到 ctx 取消
+func (s *DeviceCommandService) Run(ctx context.Context) {
+	ticker := time.NewTicker(deviceCommandExpireInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			n, err := s.repo.ExpireTimedOut(ctx)
+			if err != nil {
+				zap.L().Error("设备指令超时处理失败", zap.Error(err))
+			} else if n > 0 {
+				zap.L().Info("设备指令超时未确认", zap.Int64("count", n))
+			}
+		}
+	}
+}
+
+// normalizeCommandParams 校验指令参数，params 须为 JSON 对象或为空；校时指令由服务端填入当前时间
+func normalizeCommandParams(name string, raw json.RawMessage) (json.RawMessage, error) {
+	params := map[string]interface{}{}
+	if trimmed := bytes.TrimSpace(raw); len(trimmed) > 0 && !bytes.Equal(trimmed, []byte("null")) {
+		if err := json.Unmarshal(trimmed, &params); err != nil {
+			return nil, fmt.Errorf("%w: params 须为 JSON 对象", ErrInvalidDeviceCommandParams)
+		}
+	}
+	switch name {
+	case models.DeviceCommandSetSamplingInterval:
+		v, ok := params["interval_seconds"].(float64)
+		if !ok || v != float64(int(v)) || v < 1 || v > 86400 {
+			return nil, fmt.Errorf("%w: interval_seconds 须为 1-86400 的整数", ErrInvalidDeviceCommandParams)
+		}
+	case models.DeviceCommandReboot:
+		if len(params) > 0 {
+			return nil, fmt.Errorf("%w: reboot 不接受参数", ErrInvalidDeviceCommandParams)
+		}
+	case models.DeviceCommandSyncClock:
+		params["server_time"] = time.Now().UnixMilli()
+	}
+	if len(params) == 0 {
+		return nil, nil
+	}
+	return json.Marshal(params)
+}
@@ -0,0 +1,266 @@
+// Package service 设备影子
+package service
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"time"
+
+	"github.com/fire-disposal/health_DT_go/internal/models"
+	"github.com/fire-disposal/health_DT_go/internal/repository/postgres"
+	"go.uber.org/zap"
+)
+
+const (
+	deviceShadowQoS           = 1
+	deviceShadowDirectTimeout = 15 * time.Second // 经长连接下发差异时等待设备确认的总时长
+)
+
+var (
+	ErrDeviceShadowConflict     = errors.New("设备影子版本已变更，请刷新后重试")
+	ErrDeviceShadowStale        = errors.New("设备影子上报序号过旧")
+	ErrInvalidDeviceShadowState = errors.New("设备影子状态须为 JSON 对象")
+)
+
+// DeviceShadowReport 设备上报（device/{sn}/shadow/reported 的 data 字段）：
+// version 为设备侧单调递增序号（建议使用毫秒时间戳，重启后仍递增），state 按合并补丁写入，值为 null 删除该项
+type DeviceShadowReport struct {
+	Version int64           `json:"version"`
+	State   json.RawMessage `json:"state"`
+}
+
+// deviceShadowDeltaMessage 下发到 device/{sn}/shadow/delta 的消息
+type deviceShadowDeltaMessage struct {
+	Version int64           `json:"version"`
+	State   json.RawMessage `json:"state"`
+	TS      int64           `json:"ts"`
+	Sig     string          `json:"sig,omitempty"`
+}
+
+// DeviceShadowService 设备影子服务：期望状态由接口修改（需携带当前版本），设备上报实际状态，
+// 二者差异在期望状态修改、设备重连或设备请求时经 MQTT（设备有 msgpack 连接时经该连接）下发
+type DeviceShadowService struct {
+	repo       *postgres.DeviceShadowRepository
+	deviceAuth *DeviceAuthService
+	publisher  DownlinkPublisher
+	direct     DirectDownlink
+}
+
+// NewDeviceShadowService 构造设备影子服务，publisher 为 nil 时仅存储不下发
+func NewDeviceShadowService(repo *postgres.DeviceShadowRepository, deviceAuth *DeviceAuthService, publisher DownlinkPublisher) *DeviceShadowService {
+	return &DeviceShadowService{repo: repo, deviceAuth: deviceAuth, publisher: publisher}
+}
+
+// SetDirectDownlink 设置长连接下行通道，设备有 msgpack 连接时差异经该连接下发
+func (s *DeviceShadowService) SetDirectDownlink(direct DirectDownlink) {
+	s.direct = direct
+}
+
+// Get 查询设备影子（含差异）
+func (s *DeviceShadowService) Get(ctx context.Context, deviceID int) (*models.DeviceShadow, error) {
+	shadow, err := s.repo.Get(ctx, deviceID)
+	if err != nil {
+		return nil, err
+	}
+	if shadow == nil {
+		return nil, ErrDeviceUnknown
+	}
+	return shadow, fillShadowDelta(shadow)
+}
+
+// UpdateDesired 以合并补丁修改期望状态（值为 null 删除该项）。expectedVersion 为调用方读取到的版本，
+// 与当前版本不一致时返回 ErrDeviceShadowConflict；为 nil 时基于当前版本修改。修改后向设备下发差异
+func (s *DeviceShadowService) UpdateDesired(ctx context.Context, deviceID int, patch json.RawMessage, expectedVersion *int64) (*models.DeviceShadow, error) {
+	patchState, err := decodeShadowState(patch)
+	if err != nil {
+		return nil, err
+	}
+	shadow, err := s.repo.Get(ctx, deviceID)
+	if err != nil {
+		return nil, err
+	}
+	if shadow == nil {
+		return nil, ErrDeviceUnknown
+	}
+	if expectedVersion != nil && *expectedVersion != shadow.Version {
+		return nil, ErrDeviceShadowConflict
+	}
+	desired, err := decodeShadowState(shadow.Desired)
+	if err != nil {
+		return nil, err
+	}
+	mergeShadowState(desired, patchState)
+	if shadow.Desired, err = json.Marshal(desired); err != nil {
+		return nil, err
+	}
+	ok, err := s.repo.UpdateDesired(ctx, shadow, shadow.Version)
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return nil, ErrDeviceShadowConflict
+	}
+	if err := fillShadowDelta(shadow); err != nil {
+		return nil, err
+	}
+	s.publishDelta(shadow)
+	return shadow, nil
+}
+
+// HandleReport 写入设备上报状态；序号不大于已记录序号时返回 ErrDeviceShadowStale
+func (s *DeviceShadowService) HandleReport(ctx context.Context, sn string, report DeviceShadowReport) error {
+	patchState, err := decodeShadowState(report.State)
+	if err != nil {
+		return err
+	}
+	shadow, err := s.repo.GetBySerialNumber(ctx, sn)
+	if err != nil {
+		return err
+	}
+	if shadow == nil {
+		return ErrDeviceUnknown
+	}
+	if report.Version <= shadow.ReportedVersion {
+		return fmt.Errorf("%w: %d <= %d", ErrDeviceShadowStale, report.Version, shadow.ReportedVersion)
+	}
+	reported, err := decodeShadowState(shadow.Reported)
+	if err != nil {
+		return err
+	}
+	mergeShadowState(reported, patchState)
+	if shadow.Reported, err = json.Marshal(reported); err != nil {
+		return err
+	}
+	previous := shadow.ReportedVersion
+	shadow.ReportedVersion = report.Version
+	ok, err := s.repo.UpdateReported(ctx, shadow, previous)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return ErrDeviceShadowStale
+	}
+	return nil
+}
+
+// SyncDevice 向设备下发当前差异（设备重连或主动请求时调用），无差异时不下发
+func (s *DeviceShadowService) SyncDevice(ctx context.Context, sn string) error {
+	shadow, err := s.repo.GetBySerialNumber(ctx, sn)
+	if err != nil || shadow == nil {
+		return err
+	}
+	if err := fillShadowDelta(shadow); err != nil {
+		return err
+	}
+	s.publishDelta(shadow)
+	return nil
+}
+
+// publishDelta 下发差异，失败仅记录日志：设备重连时会再次同步
+func (s *DeviceShadowService) publishDelta(shadow *models.DeviceShadow) {
+	sn := shadow.SerialNumber
+	direct := s.direct != nil && s.direct.Connected(sn)
+	if (s.publisher == nil && !direct) || bytes.Equal(shadow.Delta, []byte("{}")) {
+		return
+	}
+	msg := deviceShadowDeltaMessage{Version: shadow.Version, State: shadow.Delta, TS: time.Now().Unix()}
+	if s.deviceAuth != nil {
+		sig, err := s.deviceAuth.SignShadowDelta(sn, msg.TS, msg.Version, msg.State)
+		if err != nil {
+			zap.L().Warn("设备影子差异签名失败", zap.String("sn", sn), zap.Error(err))
+			return
+		}
+		msg.Sig = sig
+	}
+	if direct {
+		go s.sendDirect(sn, msg)
+		return
+	}
+	payload, err := json.Marshal(msg)
+	if err == nil {
+		err = s.publisher.Publish(fmt.Sprintf("device/%s/shadow/delta", sn), deviceShadowQoS, false, payload)
+	}
+	if err != nil {
+		zap.L().Warn("设备影子差异下发失败", zap.String("sn", sn), zap.Error(err))
+	}
+}
+
+// sendDirect 经长连接下发差异，state 以原始 JSON 字符串下发以便设备校验签名；等待设备确认，失败仅记录日志
+func (s *DeviceShadowService) sendDirect(sn string, msg deviceShadowDeltaMessage) {
+	frame := map[string]interface{}{"type": "shadow_delta", "version": msg.Version, "ts": msg.TS, "state": string(msg.State)}
+	if msg.Sig != "" {
+		frame["sig"] = msg.Sig
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), deviceShadowDirectTimeout)
+	defer cancel()
+	if err := s.direct.Send(ctx, sn, frame); err != nil {
+		zap.L().Warn("设备影子差异经长连接下发失败", zap.String("sn", sn), zap.Error(err))
+	}
+}
+
+// decodeShadowState 解析 JSON 对象，空值视为空对象
+func decodeShadowState(raw json.RawMessage) (map[string]interface{}, error) {
+	state := map[string]interface{}{}
+	if trimmed := bytes.TrimSpace(raw); len(trimmed) > 0 && !bytes.Equal(trimmed, []byte("null")) {
+		if err := json.Unmarshal(trimmed, &state); err != nil {
+			return nil, ErrInvalidDeviceShadowState
+		}
+	}
+	return state, nil
+}
+
+// mergeShadowState 按 JSON 合并补丁（RFC 7386）语义将 patch 合并到 dst
+func mergeShadowState(dst, patch map[string]interface{}) {
+	for k, v := range patch {
+		if v == nil {
+			delete(dst, k)
+			continue
+		}
+		if sub, ok := v.(map[string]interface{}); ok {
+			existing, ok := dst[k].(map[string]interface{})
+			if !ok {
+				existing = map[string]interface{}{}
+			}
+			mergeShadowState(existing, sub)
+			dst[k] = existing
+			continue
+		}
+		dst[k] = v
+	}
+}
+
+// shadowDelta 计算 desired 中与 reported 不一致的部分，嵌套对象逐层比较
+func shadowDelta(desired, reported map[string]interface{}) map[string]interface{} {
+	delta := map[string]interface{}{}
+	for k, want := range desired {
+		have, exists := reported[k]
+		wantObj, wantIsObj := want.(map[string]interface{})
+		haveObj, haveIsObj := have.(map[string]interface{})
+		switch {
+		case wantIsObj && haveIsObj:
+			if sub := shadowDelta(wantObj, haveObj); len(sub) > 0 {
+				delta[k] = sub
+			}
+		case !exists || !reflect.DeepEqual(want, have):
+			delta[k] = want
+		}
+	}
+	return delta
+}
+
+func fillShadowDelta(shadow *models.DeviceShadow) error {
+	desired, err := decodeShadowState(shadow.Desired)
+	if err != nil {
+		return err
+	}
+	reported, err := decodeShadowState(shadow.Reported)
+	if err != nil {
+		return err
+	}
+	shadow.Delta, err = json.Marshal(shadowDelta(desired, reported))
+	return err
+}
@@ -0,0 +1,358 @@
+// Package service 设备电量与信号监测
+package service
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"sync"
+	"time"
+
+	"github.com/fire-disposal/health_DT_go/internal/models"
+	"github.com/fire-disposal/health_DT_go/internal/repository/postgres"
+	"go.uber.org/zap"
+)
+
+const (
+	defaultLowBatteryPercent     = 20
+	defaultPoorSignalRSSI        = -100
+	defaultTelemetryInterval     = time.Minute
+	defaultTelemetryRetention    = 72 * time.Hour
+	telemetryPruneInterval       = time.Hour
+	telemetryHistoryLimit        = 5000
+	batteryRecoverMargin         = 5 // 电量回升到阈值 + 5% 才解除告警，避免在阈值附近反复触发
+	signalRecoverMargin          = 5 // 信号回升到阈值 + 5dBm 才解除告警
+	telemetryObserveTimeout      = 3 * time.Second
+	telemetryObserveCleanupLimit = 10000
+	telemetryQueueSize           = 1024 // 待处理采样队列长度，队列满时丢弃新采样
+)
+
+// DeviceTelemetryConfig 电量与信号监测参数
+type DeviceTelemetryConfig struct {
+	LowBattery       int            // 默认低电量阈值（%），0 时默认 20
+	PoorSignal       int            // 默认弱信号阈值（dBm），0 时默认 -100
+	LowBatteryByType map[string]int // 按 device_type 覆盖低电量阈值
+	PoorSignalByType map[string]int // 按 device_type 覆盖弱信号阈值
+	RecordInterval   time.Duration  // 同一设备采样记录间隔，0 时默认 1 分钟
+	Retention        time.Duration  // 历史保留时长，0 时默认 72 小时
+}
+
+// telemetryMark 设备最近一次记录的时间与充电状态
+type telemetryMark struct {
+	at       time.Time
+	charging *bool
+}
+
+// telemetrySample 待处理的设备采样
+type telemetrySample struct {
+	sn string
+	t  *models.DeviceTelemetry
+}
+
+// DeviceTelemetryService 设备电量与信号监测：从上行数据、心跳与影子上报中提取电量、充电状态、RSSI 与 SNR，
+// 按记录间隔写入历史（充电状态变化时立即记录），低于设备类型阈值时创建告警、恢复后自动解除
+type DeviceTelemetryService struct {
+	repo    *postgres.DeviceTelemetryRepository
+	devices *postgres.DevicesRepository
+	alerts  *postgres.AlertsRepository
+	cfg     DeviceTelemetryConfig
+
+	queue chan telemetrySample // 接入层提交的采样，由 Run 串行处理
+
+	mu   sync.Mutex
+	last map[string]telemetryMark // 已注册设备序列号 -> 最近记录，用于节流
+}
+
+// NewDeviceTelemetryService 构造电量与信号监测服务
+func NewDeviceTelemetryService(repo *postgres.DeviceTelemetryRepository, devices *postgres.DevicesRepository,
+	alerts *postgres.AlertsRepository, cfg DeviceTelemetryConfig) *DeviceTelemetryService {
+	if cfg.LowBattery <= 0 {
+		cfg.LowBattery = defaultLowBatteryPercent
+	}
+	if cfg.PoorSignal >= 0 {
+		cfg.PoorSignal = defaultPoorSignalRSSI
+	}
+	if cfg.RecordInterval <= 0 {
+		cfg.RecordInterval = defaultTelemetryInterval
+	}
+	if cfg.Retention <= 0 {
+		cfg.Retention = defaultTelemetryRetention
+	}
+	return &DeviceTelemetryService{
+		repo:    repo,
+		devices: devices,
+		alerts:  alerts,
+		cfg:     cfg,
+		queue:   make(chan telemetrySample, telemetryQueueSize),
+		last:    make(map[string]telemetryMark),
+	}
+}
+
+// Thresholds 设备类型对应的低电量（%）与弱信号（dBm）阈值
+func (s *DeviceTelemetryService) Thresholds(deviceType string) (lowBattery, poorSignal int) {
+	lowBattery, poorSignal = s.cfg.LowBattery, s.cfg.PoorSignal
+	if v, ok := s.cfg.LowBatteryByType[deviceType]; ok && v > 0 {
+		lowBattery = v
+	}
+	if v, ok := s.cfg.PoorSignalByType[deviceType]; ok && v < 0 {
+		poorSignal = v
+	}
+	return lowBattery, poorSignal
+}
+
+// Observe 从设备上行内容中提取电量与信号，提交到队列由 Run 异步记录，内容不含相关字段时忽略。
+// 接入层回调中调用，不访问数据库；队列满时丢弃本次采样并记录日志
+func (s *DeviceTelemetryService) Observe(sn string, payload map[string]interface{}) {
+	if sn == "" {
+		return
+	}
+	t, ok := ExtractTelemetry(payload)
+	if !ok {
+		return
+	}
+	t.RecordedAt = time.Now()
+	select {
+	case s.queue <- telemetrySample{sn: sn, t: t}:
+	default:
+		zap.L().Warn("设备电量与信号队列已满，丢弃采样", zap.String("sn", sn))
+	}
+}
+
+// record 记录一次采样：同一设备按记录间隔节流，未注册设备忽略且不进入节流表，失败仅记录日志
+func (s *DeviceTelemetryService) record(ctx context.Context, sn string, t *models.DeviceTelemetry) {
+	if s.throttled(sn, t) {
+		return
+	}
+	ctx, cancel := context.WithTimeout(ctx, telemetryObserveTimeout)
+	defer cancel()
+	d, err := s.devices.GetBySerialNumber(ctx, sn)
+	if err != nil {
+		return
+	}
+	if !s.due(sn, t) {
+		return
+	}
+	if err := s.repo.Insert(ctx, d.ID, t); err != nil {
+		zap.L().Warn("设备电量与信号记录失败", zap.String("sn", sn), zap.Error(err))
+		return
+	}
+	if err := s.evaluate(ctx, *d, t); err != nil {
+		zap.L().Warn("设备电量与信号告警处理失败", zap.String("sn", sn), zap.Error(err))
+	}
+}
+
+// throttled 判断已记录过的设备本次采样是否仍在记录间隔内且充电状态未变化，仅查询不更新节流表
+func (s *DeviceTelemetryService) throttled(sn string, t *models.DeviceTelemetry) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	prev, ok := s.last[sn]
+	return ok && !s.changed(prev, t)
+}
+
+// changed 本次采样距上次记录超过间隔，或充电状态发生变化
+func (s *DeviceTelemetryService) changed(prev telemetryMark, t *models.DeviceTelemetry) bool {
+	chargingChanged := t.Charging != nil && (prev.charging == nil || *prev.charging != *t.Charging)
+	return t.RecordedAt.Sub(prev.at) >= s.cfg.RecordInterval || chargingChanged
+}
+
+// due 判断是否应记录本次采样并更新节流表，仅对已确认注册的设备调用
+func (s *DeviceTelemetryService) due(sn string, t *models.DeviceTelemetry) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	prev, ok := s.last[sn]
+	if ok && !s.changed(prev, t) {
+		return false
+	}
+	// 未携带充电状态的采样沿用上次状态，避免充电中的设备因仅上报电量而触发低电量告警
+	if t.Charging == nil {
+		t.Charging = prev.charging
+	}
+	s.last[sn] = telemetryMark{at: t.RecordedAt, charging: t.Charging}
+	if len(s.last) > telemetryObserveCleanupLimit {
+		for k, m := range s.last {
+			if t.RecordedAt.Sub(m.at) > s.cfg.RecordInterval {
+				delete(s.last, k)
+			}
+		}
+	}
+	return true
+}
+
+// evaluate 按设备类型阈值创建或解除低电量、弱信号告警；充电中不产生低电量告警
+func (s *DeviceTelemetryService) evaluate(ctx context.Context, d models.Device, t *models.DeviceTelemetry) error {
+	lowBattery, poorSignal := s.Thresholds(d.DeviceType)
+	charging := t.Charging != nil && *t.Charging
+	if t.Battery != nil {
+		low := *t.Battery < lowBattery && !charging
+		recovered := charging || *t.Battery >= lowBattery+batteryRecoverMargin
+		msg := fmt.Sprintf("设备 %s 电量过低：%d%%（阈值 %d%%）", d.SerialNumber, *t.Battery, lowBattery)
+		if err := s.applyAlert(ctx, d, models.AlertRuleLowBattery, low, recovered, msg); err != nil {
+			return err
+		}
+	}
+	if t.RSSI != nil {
+		poor := *t.RSSI < poorSignal
+		recovered := *t.RSSI >= poorSignal+signalRecoverMargin
+		msg := fmt.Sprintf("设备 %s 信号较弱：RSSI %ddBm（阈值 %ddBm）", d.SerialNumber, *t.RSSI, poorSignal)
+		if err := s.applyAlert(ctx, d, models.AlertRulePoorSignal, poor, recovered, msg); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// applyAlert 触发时创建告警（已有未解除告警时不重复创建，位置由仓储附加），恢复时解除；介于二者之间保持现状
+func (s *DeviceTelemetryService) applyAlert(ctx context.Context, d models.Device, rule string, fire, recovered bool,
+	message string) error {
+	switch {
+	case fire:
+		created, err := s.alerts.OpenDeviceAlert(ctx, d.ID, nil, rule, "warning", message)
+		if err == nil && created {
+			zap.L().Info("设备电量与信号告警", zap.String("sn", d.SerialNumber), zap.String("rule", rule))
+		}
+		return err
+	case recovered:
+		_, err := s.alerts.ResolveDeviceAlerts(ctx, d.ID, rule)
+		return err
+	}
+	return nil
+}
+
+// Annotate 为设备列表填充最近一次电量与信号
+func (s *DeviceTelemetryService) Annotate(ctx context.Context, devices []models.Device) error {
+	ids := make([]int, len(devices))
+	for i, d := range devices {
+		ids[i] = d.ID
+	}
+	latest, err := s.repo.Latest(ctx, ids)
+	if err != nil {
+		return err
+	}
+	for i := range devices {
+		devices[i].Telemetry = latest[devices[i].ID]
+	}
+	return nil
+}
+
+// History 查询设备 since 之后的采样（按时间先后，最多 5000 条）
+func (s *DeviceTelemetryService) History(ctx context.Context, deviceID int, since time.Time) ([]models.DeviceTelemetry, error) {
+	return s.repo.History(ctx, deviceID, since, telemetryHistoryLimit)
+}
+
+// Retention 历史保留时长
+func (s *DeviceTelemetryService) Retention() time.Duration {
+	return s.cfg.Retention
+}
+
+// Run 处理 Observe 提交的采样，并每小时清理超过保留时长的采样，直到 ctx 取消
+func (s *DeviceTelemetryService) Run(ctx context.Context) {
+	ticker := time.NewTicker(telemetryPruneInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case sample := <-s.queue:
+			s.record(ctx, sample.sn, sample.t)
+		case <-ticker.C:
+			n, err := s.repo.Prune(ctx, time.Now().Add(-s.cfg.Retention))
+			if err != nil {
+				zap.L().Error("设备电量与信号历史清理失败", zap.Error(err))
+			} else if n > 0 {
+				zap.L().Info("设备电量与信号历史已清理", zap.Int64("rows", n))
+			}
+		}
+	}
+}
+
+// ExtractTelemetry 从上行内容中提取电量与信号，兼容常见字段名：
+// battery / battery_level / bat（百分比，或 {"level": .., "charging": ..}）、charging / is_charging（布尔或 0/1）、
+// rssi、snr（顶层或 signal 对象内）。超出合理范围的值忽略；均未提取到时返回 false
+func ExtractTelemetry(payload map[string]interface{}) (*models.DeviceTelemetry, bool) {
+	if payload == nil {
+		return nil, false
+	}
+	t := &models.DeviceTelemetry{}
+	for _, key := range []string{"battery", "battery_level", "bat"} {
+		v, ok := payload[key]
+		if !ok {
+			continue
+		}
+		if obj, ok := v.(map[string]interface{}); ok {
+			v = obj["level"]
+			if c, ok := toBool(obj["charging"]); ok {
+				t.Charging = &c
+			}
+		}
+		if f, ok := toFloat(v); ok && f >= 0 && f <= 100 {
+			b := int(math.Round(f))
+			t.Battery = &b
+			break
+		}
+	}
+	if t.Charging == nil {
+		for _, key := range []string{"charging", "is_charging"} {
+			if c, ok := toBool(payload[key]); ok {
+				t.Charging = &c
+				break
+			}
+		}
+	}
+	signal := payload
+	if obj, ok := payload["signal"].(map[string]interface{}); ok {
+		signal = obj
+	}
+	if f, ok := toFloat(signal["rssi"]); ok && f >= -150 && f <= 0 {
+		r := int(math.Round(f))
+		t.RSSI = &r
+	}
+	if f, ok := toFloat(signal["snr"]); ok && f >= -50 && f <= 50 {
+		t.SNR = &f
+	}
+	if t.Battery == nil && t.Charging == nil && t.RSSI == nil && t.SNR == nil {
+		return nil, false
+	}
+	return t, true
+}
+
+// toFloat 数值转换，兼容 JSON（float64）与 msgpack（各类整数、float32）解码结果
+func toFloat(v interface{}) (float64, bool) {
+	switch n := v.(type) {
+	case float64:
+		return n, !math.IsNaN(n)
+	case float32:
+		return float64(n), !math.IsNaN(float64(n))
+	case int:
+		return float64(n), true
+	case int8:
+		return float64(n), true
+	case int16:
+		return float64(n), true
+	case int32:
+		return float64(n), true
+	case int64:
+		return float64(n), true
+	case uint:
+		return float64(n), true
+	case uint8:
+		return float64(n), true
+	case uint16:
+		return float64(n), true
+	case uint32:
+		return float64(n), true
+	case uint64:
+		return float64(n), true
+	}
+	return 0, false
+}
+
+// toBool 布尔转换，兼容 0/1 数值
+func toBool(v interface{}) (bool, bool) {
+	if b, ok := v.(bool); ok {
+		return b, true
+	}
+	if f, ok := toFloat(v); ok && (f == 0 || f == 1) {
+		return f == 1, true
+	}
+	return false, false
+}
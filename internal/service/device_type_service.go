@@ -0,0 +1,348 @@
+// Package service 设备类型目录与上报数据校验
+package service
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/fire-disposal/health_DT_go/internal/jsonschema"
+	"github.com/fire-disposal/health_DT_go/internal/models"
+	"github.com/fire-disposal/health_DT_go/internal/repository/postgres"
+	"go.uber.org/zap"
+)
+
+const (
+	deviceTypeCacheTTL        = time.Minute // 目录与序列号类型缓存时长，多实例部署时修改最迟 1 分钟生效
+	deviceTypeMetricLimit     = 64
+	deviceTypeNameMaxLen      = 64
+	deviceTypeSchemaMaxBytes  = 64 << 10
+	deviceTypeValidateTimeout = 3 * time.Second
+	deviceTypeSNCacheLimit    = 10000
+)
+
+var deviceTypeCodePattern = regexp.MustCompile(`^[A-Za-z0-9_.-]{1,64}$`)
+
+var (
+	ErrDeviceTypeNotFound = errors.New("设备类型不存在")
+	ErrInvalidDeviceType  = errors.New("设备类型参数错误")
+	ErrDeviceTypeInUse    = errors.New("仍有设备使用该类型，无法删除")
+	ErrPayloadRejected    = errors.New("上报数据不符合设备类型定义")
+)
+
+// DeviceTypeInput 创建或修改设备类型参数
+type DeviceTypeInput struct {
+	Name                     string
+	Description              string
+	ReportingIntervalSeconds int
+	Metrics                  []models.DeviceMetric
+	PayloadSchema            json.RawMessage
+}
+
+// compiledDeviceType 目录条目及编译后的 Schema
+type compiledDeviceType struct {
+	def    models.DeviceType
+	schema *jsonschema.Schema
+}
+
+// deviceTypeOfSN 序列号对应的设备类型缓存
+type deviceTypeOfSN struct {
+	deviceType string
+	expires    time.Time
+}
+
+// DeviceTypeService 设备类型目录：平台管理员通过接口维护设备类型（新增传感器型号无需改代码），
+// 接入层按设备所属类型校验上报数据，未登记的类型不校验
+type DeviceTypeService struct {
+	repo    *postgres.DeviceTypeRepository
+	devices *postgres.DevicesRepository
+
+	mu       sync.RWMutex
+	catalog  map[string]*compiledDeviceType
+	loadedAt time.Time
+	sns      map[string]deviceTypeOfSN
+}
+
+// NewDeviceTypeService 构造设备类型目录服务
+func NewDeviceTypeService(repo *postgres.DeviceTypeRepository, devices *postgres.DevicesRepository) *DeviceTypeService {
+	return &DeviceTypeService{repo: repo, devices: devices, sns: make(map[string]deviceTypeOfSN)}
+}
+
+// Create 登记设备类型
+func (s *DeviceTypeService) Create(ctx context.Context, code string, in DeviceTypeInput) (*models.DeviceType, error) {
+	code = strings.TrimSpace(code)
+	if !deviceTypeCodePattern.MatchString(code) {
+		return nil, fmt.Errorf("%w: code 须为 1-64 位字母、数字、下划线、点或连字符", ErrInvalidDeviceType)
+	}
+	t, err := buildDeviceType(code, in)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.repo.Create(ctx, t); err != nil {
+		return nil, err
+	}
+	s.invalidate()
+	return t, nil
+}
+
+// Get 查询设备类型
+func (s *DeviceTypeService) Get(ctx context.Context, code string) (*models.DeviceType, error) {
+	t, err := s.repo.Get(ctx, code)
+	if err != nil {
+		return nil, err
+	}
+	if t == nil {
+		return nil, ErrDeviceTypeNotFound
+	}
+	return t, nil
+}
+
+// List 查询全部设备类型
+func (s *DeviceTypeService) List(ctx context.Context) ([]models.DeviceType, error) {
+	return s.repo.List(ctx)
+}
+
+// Update 修改设备类型（整体替换，编码不可修改）
+func (s *DeviceTypeService) Update(ctx context.Context, code string, in DeviceTypeInput) (*models.DeviceType, error) {
+	t, err := buildDeviceType(code, in)
+	if err != nil {
+		return nil, err
+	}
+	ok, err := s.repo.Update(ctx, t)
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return nil, ErrDeviceTypeNotFound
+	}
+	s.invalidate()
+	return t, nil
+}
+
+// Delete 删除设备类型，仍有设备使用时返回 ErrDeviceTypeInUse
+func (s *DeviceTypeService) Delete(ctx context.Context, code string) error {
+	inUse, err := s.repo.InUse(ctx, code)
+	if err != nil {
+		return err
+	}
+	if inUse {
+		return ErrDeviceTypeInUse
+	}
+	ok, err := s.repo.Delete(ctx, code)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return ErrDeviceTypeNotFound
+	}
+	s.invalidate()
+	return nil
+}
+
+// Check 按设备类型定义校验一条示例数据，便于登记类型后调试 Schema
+func (s *DeviceTypeService) Check(ctx context.Context, code string, payload map[string]interface{}) error {
+	t, err := s.Get(ctx, code)
+	if err != nil {
+		return err
+	}
+	compiled, err := compileDeviceType(*t)
+	if err != nil {
+		return err
+	}
+	return compiled.validate(payload)
+}
+
+// Validate 校验设备上报数据（MQTT data 字段或 msgpack 数据帧）：设备未注册或类型未登记时不校验，
+// 不符合 payload_schema 或指标取值超出范围时返回 ErrPayloadRejected；目录查询失败时放行并记录日志
+func (s *DeviceTypeService) Validate(sn string, payload map[string]interface{}) error {
+	ctx, cancel := context.WithTimeout(context.Background(), deviceTypeValidateTimeout)
+	defer cancel()
+	deviceType, err := s.deviceTypeOf(ctx, sn)
+	if err != nil {
+		zap.L().Warn("设备类型查询失败，跳过上报数据校验", zap.String("sn", sn), zap.Error(err))
+		return nil
+	}
+	if deviceType == "" {
+		return nil
+	}
+	entry, err := s.lookup(ctx, deviceType)
+	if err != nil {
+		zap.L().Warn("设备类型目录加载失败，跳过上报数据校验", zap.String("device_type", deviceType), zap.Error(err))
+		return nil
+	}
+	if entry == nil {
+		return nil
+	}
+	return entry.validate(payload)
+}
+
+// ReportingInterval 设备类型的预期上报间隔，类型未登记、未声明间隔或目录加载失败时返回 0
+func (s *DeviceTypeService) ReportingInterval(deviceType string) time.Duration {
+	ctx, cancel := context.WithTimeout(context.Background(), deviceTypeValidateTimeout)
+	defer cancel()
+	entry, err := s.lookup(ctx, deviceType)
+	if err != nil || entry == nil {
+		return 0
+	}
+	return time.Duration(entry.def.ReportingIntervalSeconds) * time.Second
+}
+
+// deviceTypeOf 查询序列号对应的设备类型（缓存），设备未注册返回空串
+func (s *DeviceTypeService) deviceTypeOf(ctx context.Context, sn string) (string, error) {
+	now := time.Now()
+	s.mu.RLock()
+	cached, ok := s.sns[sn]
+	s.mu.RUnlock()
+	if ok && now.Before(cached.expires) {
+		return cached.deviceType, nil
+	}
+	deviceType := ""
+	d, err := s.devices.GetBySerialNumber(ctx, sn)
+	if err == nil {
+		deviceType = d.DeviceType
+	} else if !errors.Is(err, sql.ErrNoRows) {
+		return "", err
+	}
+	s.mu.Lock()
+	if len(s.sns) >= deviceTypeSNCacheLimit {
+		for k, v := range s.sns {
+			if now.After(v.expires) {
+				delete(s.sns, k)
+			}
+		}
+	}
+	s.sns[sn] = deviceTypeOfSN{deviceType: deviceType, expires: now.Add(deviceTypeCacheTTL)}
+	s.mu.Unlock()
+	return deviceType, nil
+}
+
+// lookup 查询目录条目（整个目录缓存，过期后重新加载），未登记返回 nil
+func (s *DeviceTypeService) lookup(ctx context.Context, deviceType string) (*compiledDeviceType, error) {
+	s.mu.RLock()
+	catalog, fresh := s.catalog, time.Since(s.loadedAt) < deviceTypeCacheTTL
+	s.mu.RUnlock()
+	if catalog == nil || !fresh {
+		list, err := s.repo.List(ctx)
+		if err != nil {
+			return nil, err
+		}
+		catalog = make(map[string]*compiledDeviceType, len(list))
+		for _, t := range list {
+			compiled, err := compileDeviceType(t)
+			if err != nil {
+				// 入库前已校验，此处仅防御历史数据
+				zap.L().Error("设备类型 Schema 无效，跳过校验", zap.String("device_type", t.Code), zap.Error(err))
+				compiled = &compiledDeviceType{def: t}
+			}
+			catalog[t.Code] = compiled
+		}
+		s.mu.Lock()
+		s.catalog, s.loadedAt = catalog, time.Now()
+		s.mu.Unlock()
+	}
+	return catalog[deviceType], nil
+}
+
+// invalidate 目录修改后清空缓存，本实例立即生效
+func (s *DeviceTypeService) invalidate() {
+	s.mu.Lock()
+	s.catalog = nil
+	s.sns = make(map[string]deviceTypeOfSN)
+	s.mu.Unlock()
+}
+
+// validate 按 Schema 与指标取值范围校验上报数据
+func (c *compiledDeviceType) validate(payload map[string]interface{}) error {
+	if c.schema != nil {
+		if err := c.schema.Validate(payload); err != nil {
+			return fmt.Errorf("%w: %v", ErrPayloadRejected, err)
+		}
+	}
+	for _, m := range c.def.Metrics {
+		v, ok := payload[m.Key]
+		if !ok || v == nil {
+			continue
+		}
+		f, ok := toFloat(v)
+		if !ok {
+			return fmt.Errorf("%w: %s 须为数值", ErrPayloadRejected, m.Key)
+		}
+		if (m.Min != nil && f < *m.Min) || (m.Max != nil && f > *m.Max) {
+			return fmt.Errorf("%w: %s 超出有效范围", ErrPayloadRejected, m.Key)
+		}
+	}
+	return nil
+}
+
+// buildDeviceType 校验参数并构造设备类型
+func buildDeviceType(code string, in DeviceTypeInput) (*models.DeviceType, error) {
+	t := &models.DeviceType{
+		Code:                     code,
+		Name:                     strings.TrimSpace(in.Name),
+		Description:              strings.TrimSpace(in.Description),
+		ReportingIntervalSeconds: in.ReportingIntervalSeconds,
+		Metrics:                  in.Metrics,
+	}
+	if t.Name == "" || len([]rune(t.Name)) > deviceTypeNameMaxLen {
+		return nil, fmt.Errorf("%w: 名称不能为空且不超过 %d 字符", ErrInvalidDeviceType, deviceTypeNameMaxLen)
+	}
+	if t.ReportingIntervalSeconds < 0 || t.ReportingIntervalSeconds > 7*86400 {
+		return nil, fmt.Errorf("%w: reporting_interval_seconds 须在 0-604800 之间", ErrInvalidDeviceType)
+	}
+	if t.Metrics == nil {
+		t.Metrics = []models.DeviceMetric{}
+	}
+	if len(t.Metrics) > deviceTypeMetricLimit {
+		return nil, fmt.Errorf("%w: 指标不能超过 %d 个", ErrInvalidDeviceType, deviceTypeMetricLimit)
+	}
+	seen := make(map[string]bool, len(t.Metrics))
+	for i := range t.Metrics {
+		m := &t.Metrics[i]
+		m.Key = strings.TrimSpace(m.Key)
+		if m.Key == "" || seen[m.Key] {
+			return nil, fmt.Errorf("%w: 指标 key 不能为空且不能重复", ErrInvalidDeviceType)
+		}
+		seen[m.Key] = true
+		if m.Name == "" {
+			m.Name = m.Key
+		}
+		if m.Min != nil && m.Max != nil && *m.Min > *m.Max {
+			return nil, fmt.Errorf("%w: 指标 %s 的 min 不能大于 max", ErrInvalidDeviceType, m.Key)
+		}
+		switch m.Chart {
+		case "":
+			m.Chart = models.DeviceMetricChartLine
+		case models.DeviceMetricChartLine, models.DeviceMetricChartBar, models.DeviceMetricChartNone:
+		default:
+			return nil, fmt.Errorf("%w: 指标 %s 的 chart 须为 line / bar / none", ErrInvalidDeviceType, m.Key)
+		}
+	}
+	if schema := strings.TrimSpace(string(in.PayloadSchema)); schema != "" && schema != "null" {
+		if len(schema) > deviceTypeSchemaMaxBytes {
+			return nil, fmt.Errorf("%w: payload_schema 不能超过 64KB", ErrInvalidDeviceType)
+		}
+		t.PayloadSchema = json.RawMessage(schema)
+	}
+	if _, err := compileDeviceType(*t); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidDeviceType, err)
+	}
+	return t, nil
+}
+
+func compileDeviceType(t models.DeviceType) (*compiledDeviceType, error) {
+	c := &compiledDeviceType{def: t}
+	if len(t.PayloadSchema) > 0 {
+		schema, err := jsonschema.Compile(t.PayloadSchema)
+		if err != nil {
+			return nil, err
+		}
+		c.schema = schema
+	}
+	return c, nil
+}
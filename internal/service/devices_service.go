@@ -3,9 +3,11 @@ package service
 
 import (
 	"context"
+	"time"
 
 	"github.com/fire-disposal/health_DT_go/internal/models"
 	"github.com/fire-disposal/health_DT_go/internal/repository/postgres"
+	"github.com/fire-disposal/health_DT_go/internal/tenant"
 )
 
 type DevicesService struct {
@@ -16,7 +18,17 @@ func NewDevicesService(repo *postgres.DevicesRepository) *DevicesService {
 	return &DevicesService{repo: repo}
 }
 
+// Create 注册设备并签发设备密钥，密钥通过 device.SecretKey 回传调用方（仅此一次）
 func (s *DevicesService) Create(ctx context.Context, device *models.Device) (int, error) {
+	secret, err := generateDeviceSecret()
+	if err != nil {
+		return 0, err
+	}
+	now := time.Now()
+	device.OrgID = tenant.OrgForCreate(ctx, device.OrgID)
+	device.SecretKey = secret
+	device.CreatedAt = now
+	device.UpdatedAt = now
 	return s.repo.Create(ctx, device)
 }
 
@@ -25,6 +37,7 @@ func (s *DevicesService) Get(ctx context.Context, id int) (*models.Device, error
 }
 
 func (s *DevicesService) Update(ctx context.Context, device *models.Device) error {
+	device.UpdatedAt = time.Now()
 	return s.repo.Update(ctx, device)
 }
 
@@ -36,7 +49,7 @@ func (s *DevicesService) List(ctx context.Context) ([]models.Device, error) {
 	return s.repo.FindAll(ctx)
 }
 
-// 设备绑定健康档案
-func (s *DevicesService) AssignDeviceToProfile(ctx context.Context, deviceID int, profileID int) error {
-	return s.repo.AssignDeviceToProfile(ctx, deviceID, profileID)
+// ListByLocation 查询放置在指定位置及其下级位置的设备
+func (s *DevicesService) ListByLocation(ctx context.Context, locationID int) ([]models.Device, error) {
+	return s.repo.FindByLocation(ctx, locationID)
 }
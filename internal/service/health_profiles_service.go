@@ -6,6 +6,7 @@ import (
 
 	"github.com/fire-disposal/health_DT_go/internal/models"
 	"github.com/fire-disposal/health_DT_go/internal/repository/postgres"
+	"github.com/fire-disposal/health_DT_go/internal/tenant"
 )
 
 type HealthProfilesService struct {
@@ -16,7 +17,17 @@ func NewHealthProfilesService(repo *postgres.HealthProfilesRepository) *HealthPr
 	return &HealthProfilesService{repo: repo}
 }
 
+// Create 创建健康档案，归属组织按调用方租户范围确定；指定 user_id 时同时登记为档案拥有者
 func (s *HealthProfilesService) Create(ctx context.Context, profile *models.HealthProfile) (int, error) {
+	profile.OrgID = tenant.OrgForCreate(ctx, profile.OrgID)
+	return s.repo.Create(ctx, profile)
+}
+
+// CreatePersonal App 用户创建个人档案：不归属任何组织，创建者登记为拥有者，
+// 仅档案成员可访问，组织管理员不可见
+func (s *HealthProfilesService) CreatePersonal(ctx context.Context, profile *models.HealthProfile, ownerID int) (int, error) {
+	profile.OrgID = 0
+	profile.UserID = &ownerID
 	return s.repo.Create(ctx, profile)
 }
 
@@ -36,7 +47,10 @@ func (s *HealthProfilesService) List(ctx context.Context) ([]models.HealthProfil
 	return s.repo.FindAll(ctx)
 }
 
-// 健康档案绑定设备
-func (s *HealthProfilesService) AssignProfileToDevice(ctx context.Context, profileID int, deviceID int) error {
-	return s.repo.AssignProfileToDevice(ctx, profileID, deviceID)
+// ListByIDs 查询指定ID的健康档案
+func (s *HealthProfilesService) ListByIDs(ctx context.Context, ids []int) ([]models.HealthProfile, error) {
+	if len(ids) == 0 {
+		return []models.HealthProfile{}, nil
+	}
+	return s.repo.FindByIDs(ctx, ids)
 }
@@ -0,0 +1,113 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/fire-disposal/health_DT_go/internal/fieldcrypt"
+	"github.com/fire-disposal/health_DT_go/internal/models"
+	"github.com/fire-disposal/health_DT_go/internal/repository/postgres"
+	"github.com/fire-disposal/health_DT_go/internal/tenant"
+)
+
+// openTestDB 连接 TEST_POSTGRES_DSN 指定的数据库，在临时 schema 中加载 docs/new3.sql，测试结束后删除；
+// 未设置时跳过
+func openTestDB(t *testing.T) *sql.DB {
+	t.Helper()
+	dsn := os.Getenv("TEST_POSTGRES_DSN")
+	if dsn == "" {
+		t.Skip("未设置 TEST_POSTGRES_DSN，跳过数据库测试")
+	}
+	schemaSQL, err := os.ReadFile("../../docs/new3.sql")
+	if err != nil {
+		t.Fatalf("读取表结构: %v", err)
+	}
+	db, err := sql.Open("postgres", dsn)
+	if err != nil {
+		t.Fatalf("sql.Open: %v", err)
+	}
+	// 单连接保证 search_path 对后续查询生效
+	db.SetMaxOpenConns(1)
+	schema := fmt.Sprintf("test_%d", time.Now().UnixNano())
+	t.Cleanup(func() {
+		_, _ = db.Exec(`DROP SCHEMA IF EXISTS ` + schema + ` CASCADE`)
+		db.Close()
+	})
+	if _, err := db.Exec(`CREATE SCHEMA ` + schema + `; SET search_path TO ` + schema); err != nil {
+		t.Fatalf("创建测试 schema: %v", err)
+	}
+	if _, err := db.Exec(string(schemaSQL)); err != nil {
+		t.Fatalf("加载表结构: %v", err)
+	}
+	return db
+}
+
+// App 用户创建的个人档案不归属组织，默认组织的管理员无法查看、列出或授权访问，拥有者可正常访问
+func TestPersonalProfileHiddenFromOrgAdmin(t *testing.T) {
+	db := openTestDB(t)
+	ctx := context.Background()
+
+	var userID int
+	if err := db.QueryRow(`INSERT INTO app_users (username, password_hash) VALUES ('family', 'x') RETURNING id`).
+		Scan(&userID); err != nil {
+		t.Fatalf("创建 App 用户: %v", err)
+	}
+	keys, err := fieldcrypt.New(fieldcrypt.Config{})
+	if err != nil {
+		t.Fatalf("fieldcrypt.New: %v", err)
+	}
+	profiles := postgres.NewHealthProfilesRepository(db, keys)
+	svc := NewHealthProfilesService(profiles)
+	sharing := NewProfileSharingService(postgres.NewProfileMemberRepository(db), profiles)
+
+	owner := &Principal{UserID: int64(userID), UserType: models.UserTypeApp, Role: models.UserTypeApp}
+	ownerCtx := tenant.WithScope(ctx, owner.TenantScope(0))
+	id, err := svc.CreatePersonal(ownerCtx, &models.HealthProfile{Name: "张三"}, userID)
+	if err != nil {
+		t.Fatalf("CreatePersonal: %v", err)
+	}
+
+	var orgID sql.NullInt64
+	if err := db.QueryRow(`SELECT org_id FROM health_profiles WHERE id = $1`, id).Scan(&orgID); err != nil {
+		t.Fatalf("查询档案组织: %v", err)
+	}
+	if orgID.Valid {
+		t.Fatalf("org_id = %d, want NULL", orgID.Int64)
+	}
+
+	admin := &Principal{UserID: 1, UserType: models.UserTypeAdmin, Role: models.AdminRoleAdmin, OrgID: tenant.DefaultOrgID}
+	adminCtx := tenant.WithScope(ctx, admin.TenantScope(0))
+	if err := sharing.Authorize(adminCtx, admin, id, models.ProfileRoleViewer); !errors.Is(err, ErrProfileForbidden) {
+		t.Fatalf("组织管理员 Authorize = %v, want ErrProfileForbidden", err)
+	}
+	if _, err := svc.Get(adminCtx, id); !errors.Is(err, sql.ErrNoRows) {
+		t.Fatalf("组织管理员 Get = %v, want sql.ErrNoRows", err)
+	}
+	list, err := svc.List(adminCtx)
+	if err != nil {
+		t.Fatalf("List: %v", err)
+	}
+	for _, p := range list {
+		if p.ID == id {
+			t.Fatalf("组织管理员的档案列表包含个人档案 %d", id)
+		}
+	}
+	scope, err := sharing.Scope(adminCtx, admin)
+	if err != nil {
+		t.Fatalf("Scope: %v", err)
+	}
+	for _, pid := range scope.ProfileIDs {
+		if pid == id {
+			t.Fatalf("组织管理员的档案范围包含个人档案 %d", id)
+		}
+	}
+
+	if err := sharing.Authorize(ownerCtx, owner, id, models.ProfileRoleOwner); err != nil {
+		t.Fatalf("拥有者 Authorize = %v, want nil", err)
+	}
+}
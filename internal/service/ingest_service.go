@@ -0,0 +1,119 @@
+// Package service 设备 HTTP 数据上报
+package service
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/fire-disposal/health_DT_go/internal/app"
+)
+
+const (
+	// IngestMaxBatch 单次请求最多上报的数据条数
+	IngestMaxBatch           = 500
+	ingestDataTypeMaxLen     = 64
+	ingestProvisioningDetail = "ingest/"
+)
+
+var (
+	// ErrInvalidReading 上报数据缺少必填字段或 data 不是对象
+	ErrInvalidReading = errors.New("上报数据格式错误")
+	// ErrIngestRateLimited 签名有效但该设备上报过于频繁
+	ErrIngestRateLimited = errors.New("设备上报过于频繁，请稍后再试")
+)
+
+// IngestReading 一条上报数据，字段同 MQTT 数据消息，sn 与 type 对应 MQTT 主题中的序列号与数据类型
+type IngestReading struct {
+	SN     string
+	Type   string
+	TS     int64
+	Sig    string
+	Data   []byte                 // data 字段原始字节（JSON 文本或 msgpack 编码），用于签名校验
+	Fields map[string]interface{} // data 字段解析结果，不是对象时为 nil
+	Err    error                  // 该条数据无法解析时的原因，非 nil 时直接拒绝
+}
+
+// IngestResult 单条上报数据的处理结果，index 为请求中的位置
+type IngestResult struct {
+	Index    int    `json:"index"`
+	SN       string `json:"sn,omitempty"`
+	Accepted bool   `json:"accepted"`
+	Error    string `json:"error,omitempty"`
+}
+
+// IngestService 设备 HTTP 数据上报：逐条校验设备签名与设备类型定义，经与 MQTT 相同的流程进入 Pipeline
+type IngestService struct {
+	pipeline     *app.Pipeline
+	deviceAuth   *DeviceAuthService
+	presence     *PresenceService
+	provisioning *ProvisioningService
+	telemetry    *DeviceTelemetryService
+	deviceTypes  *DeviceTypeService
+}
+
+// NewIngestService 构造 HTTP 数据上报服务，除 pipeline 外的依赖均可为 nil（跳过对应处理）
+func NewIngestService(pipeline *app.Pipeline, deviceAuth *DeviceAuthService, presence *PresenceService,
+	provisioning *ProvisioningService, telemetry *DeviceTelemetryService, deviceTypes *DeviceTypeService) *IngestService {
+	return &IngestService{pipeline: pipeline, deviceAuth: deviceAuth, presence: presence,
+		provisioning: provisioning, telemetry: telemetry, deviceTypes: deviceTypes}
+}
+
+// Ingest 逐条处理上报数据，单条失败不影响其他数据，返回与请求顺序一致的结果；
+// allow 非 nil 时对签名校验通过的数据按设备序列号限流，返回 false 的数据以 ErrIngestRateLimited 拒绝
+func (s *IngestService) Ingest(readings []IngestReading, allow func(sn string) bool) []IngestResult {
+	results := make([]IngestResult, len(readings))
+	for i, r := range readings {
+		results[i] = IngestResult{Index: i, SN: r.SN, Accepted: true}
+		if err := s.ingest(r, allow); err != nil {
+			results[i].Accepted = false
+			results[i].Error = err.Error()
+		}
+	}
+	return results
+}
+
+func (s *IngestService) ingest(r IngestReading, allow func(sn string) bool) error {
+	if r.Err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidReading, r.Err)
+	}
+	if r.SN == "" || len(r.SN) > deviceSerialNumberMaxLen {
+		return fmt.Errorf("%w: sn 必填且不超过 %d 个字符", ErrInvalidReading, deviceSerialNumberMaxLen)
+	}
+	if r.Type == "" || len(r.Type) > ingestDataTypeMaxLen {
+		return fmt.Errorf("%w: type 必填且不超过 %d 个字符", ErrInvalidReading, ingestDataTypeMaxLen)
+	}
+	if s.provisioning != nil {
+		s.provisioning.Observe("http", r.SN, ingestProvisioningDetail+r.Type)
+	}
+	// HTTP 上报只接受已签名数据，未配置设备凭证服务时全部拒绝
+	if s.deviceAuth == nil {
+		return ErrDeviceUnauthorized
+	}
+	if err := s.deviceAuth.VerifyIngest(r.SN, r.Type, r.TS, r.Data, r.Sig); err != nil {
+		return err
+	}
+	if allow != nil && !allow(r.SN) {
+		return ErrIngestRateLimited
+	}
+	if s.presence != nil {
+		s.presence.Touch(r.SN)
+	}
+	if r.Fields == nil {
+		return fmt.Errorf("%w: data 须为对象", ErrInvalidReading)
+	}
+	if s.deviceTypes != nil {
+		if err := s.deviceTypes.Validate(r.SN, r.Fields); err != nil {
+			return err
+		}
+	}
+	if s.telemetry != nil {
+		s.telemetry.Observe(r.SN, r.Fields)
+	}
+	s.pipeline.ReceiveEventAsync(app.HealthEvent{
+		DeviceID:  r.SN,
+		EventType: r.Type,
+		Payload:   r.Fields,
+		Source:    "http",
+	})
+	return nil
+}
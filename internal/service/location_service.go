@@ -0,0 +1,219 @@
+// Package service 位置层级（楼栋/楼层/房间/床位）业务逻辑
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/fire-disposal/health_DT_go/internal/models"
+	"github.com/fire-disposal/health_DT_go/internal/repository/postgres"
+	"github.com/fire-disposal/health_DT_go/internal/tenant"
+)
+
+const locationNameMaxLen = 64
+
+var (
+	ErrLocationNotFound       = errors.New("位置不存在")
+	ErrLocationInUse          = errors.New("位置下仍有下级位置、设备或健康档案，无法删除")
+	ErrInvalidLocation        = errors.New("位置参数错误")
+	ErrLocationTargetNotFound = errors.New("设备或健康档案不存在，或与位置不属于同一组织")
+)
+
+// CreateLocationInput 创建位置参数
+type CreateLocationInput struct {
+	OrgID    int
+	ParentID *int
+	Kind     string
+	Name     string
+}
+
+// LocationService 位置层级服务：楼栋 > 楼层 > 房间 > 床位，设备可放置在任意层级，健康档案分配到床位；
+// 按位置筛选时包含全部下级位置
+type LocationService struct {
+	repo *postgres.LocationRepository
+}
+
+// NewLocationService 构造位置服务
+func NewLocationService(repo *postgres.LocationRepository) *LocationService {
+	return &LocationService{repo: repo}
+}
+
+// Create 创建位置，上级类型须符合层级（楼栋为顶级），下级归属上级所在组织
+func (s *LocationService) Create(ctx context.Context, in CreateLocationInput) (*models.Location, error) {
+	name := strings.TrimSpace(in.Name)
+	if name == "" || len([]rune(name)) > locationNameMaxLen {
+		return nil, fmt.Errorf("%w: 名称不能为空且不超过 %d 字符", ErrInvalidLocation, locationNameMaxLen)
+	}
+	parentKind, ok := models.LocationParentKind[in.Kind]
+	if !ok {
+		return nil, fmt.Errorf("%w: kind 须为 building / floor / room / bed", ErrInvalidLocation)
+	}
+	loc := &models.Location{Kind: in.Kind, Name: name}
+	if parentKind == "" {
+		if in.ParentID != nil {
+			return nil, fmt.Errorf("%w: 楼栋不能有上级位置", ErrInvalidLocation)
+		}
+		loc.OrgID = tenant.OrgForCreate(ctx, in.OrgID)
+	} else {
+		if in.ParentID == nil {
+			return nil, fmt.Errorf("%w: %s 须指定上级 %s", ErrInvalidLocation, in.Kind, parentKind)
+		}
+		parent, err := s.repo.Get(ctx, *in.ParentID)
+		if err != nil {
+			return nil, err
+		}
+		if parent == nil {
+			return nil, fmt.Errorf("%w: 上级位置不存在", ErrInvalidLocation)
+		}
+		if parent.Kind != parentKind {
+			return nil, fmt.Errorf("%w: %s 的上级须为 %s", ErrInvalidLocation, in.Kind, parentKind)
+		}
+		loc.OrgID = parent.OrgID
+		loc.ParentID = &parent.ID
+	}
+	if err := s.repo.Create(ctx, loc); err != nil {
+		return nil, err
+	}
+	if err := s.Annotate(ctx, []*models.Location{loc}); err != nil {
+		return nil, err
+	}
+	return loc, nil
+}
+
+// Get 查询位置（含完整路径）
+func (s *LocationService) Get(ctx context.Context, id int) (*models.Location, error) {
+	loc, err := s.repo.Get(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if loc == nil {
+		return nil, ErrLocationNotFound
+	}
+	if err := s.Annotate(ctx, []*models.Location{loc}); err != nil {
+		return nil, err
+	}
+	return loc, nil
+}
+
+// List 查询位置（含完整路径）；parentID 非 nil 时仅返回其直接下级，为 0 时返回顶级楼栋
+func (s *LocationService) List(ctx context.Context, parentID *int) ([]models.Location, error) {
+	list, err := s.repo.List(ctx, parentID)
+	if err != nil {
+		return nil, err
+	}
+	if list == nil {
+		return []models.Location{}, nil
+	}
+	ptrs := make([]*models.Location, len(list))
+	for i := range list {
+		ptrs[i] = &list[i]
+	}
+	if err := s.Annotate(ctx, ptrs); err != nil {
+		return nil, err
+	}
+	return list, nil
+}
+
+// Rename 修改位置名称（层级关系创建后不可修改）
+func (s *LocationService) Rename(ctx context.Context, id int, name string) (*models.Location, error) {
+	name = strings.TrimSpace(name)
+	if name == "" || len([]rune(name)) > locationNameMaxLen {
+		return nil, fmt.Errorf("%w: 名称不能为空且不超过 %d 字符", ErrInvalidLocation, locationNameMaxLen)
+	}
+	ok, err := s.repo.Rename(ctx, id, name)
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return nil, ErrLocationNotFound
+	}
+	return s.Get(ctx, id)
+}
+
+// Delete 删除位置，有下级位置、放置的设备或分配的档案时返回 ErrLocationInUse
+func (s *LocationService) Delete(ctx context.Context, id int) error {
+	if _, err := s.Get(ctx, id); err != nil {
+		return err
+	}
+	inUse, err := s.repo.InUse(ctx, id)
+	if err != nil {
+		return err
+	}
+	if inUse {
+		return ErrLocationInUse
+	}
+	ok, err := s.repo.Delete(ctx, id)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return ErrLocationNotFound
+	}
+	return nil
+}
+
+// PlaceDevice 设置设备放置位置，locationID 为 nil 时移出
+func (s *LocationService) PlaceDevice(ctx context.Context, deviceID int, locationID *int) error {
+	if locationID != nil {
+		if _, err := s.Get(ctx, *locationID); err != nil {
+			return err
+		}
+	}
+	ok, err := s.repo.SetDeviceLocation(ctx, deviceID, locationID)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return ErrLocationTargetNotFound
+	}
+	return nil
+}
+
+// AssignBed 为健康档案分配床位，bedID 为 nil 时退床；每张床位至多一个档案
+func (s *LocationService) AssignBed(ctx context.Context, profileID int, bedID *int) error {
+	if bedID != nil {
+		bed, err := s.Get(ctx, *bedID)
+		if err != nil {
+			return err
+		}
+		if bed.Kind != models.LocationKindBed {
+			return fmt.Errorf("%w: 只能分配到床位", ErrInvalidLocation)
+		}
+	}
+	ok, err := s.repo.SetProfileBed(ctx, profileID, bedID)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return ErrLocationTargetNotFound
+	}
+	return nil
+}
+
+// Occupancy 统计位置（含下级）内的床位总数与已分配床位数，locationID 为 0 时统计全部
+func (s *LocationService) Occupancy(ctx context.Context, locationID int) (beds, occupied int, err error) {
+	return s.repo.Occupancy(ctx, locationID)
+}
+
+// Paths 查询位置完整路径，如 "1号楼 / 3层 / 301 / 1床"
+func (s *LocationService) Paths(ctx context.Context, ids []int) (map[int]string, error) {
+	return s.repo.Paths(ctx, ids)
+}
+
+// Annotate 填充位置完整路径
+func (s *LocationService) Annotate(ctx context.Context, locations []*models.Location) error {
+	ids := make([]int, 0, len(locations))
+	for _, l := range locations {
+		ids = append(ids, l.ID)
+	}
+	paths, err := s.repo.Paths(ctx, ids)
+	if err != nil {
+		return err
+	}
+	for _, l := range locations {
+		l.Path = paths[l.ID]
+	}
+	return nil
+}
@@ -0,0 +1,103 @@
+// Package service 组织（租户）管理业务逻辑
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/fire-disposal/health_DT_go/internal/models"
+	"github.com/fire-disposal/health_DT_go/internal/repository/postgres"
+	"github.com/fire-disposal/health_DT_go/internal/tenant"
+)
+
+var (
+	ErrOrganizationNotFound   = errors.New("组织不存在")
+	ErrOrganizationCodeExists = errors.New("组织编码已存在")
+	ErrOrganizationInUse      = errors.New("组织下仍有管理员、设备、健康档案、告警或位置，无法删除")
+	ErrDefaultOrganization    = errors.New("默认组织不可删除")
+	ErrInvalidOrganization    = errors.New("组织参数错误")
+)
+
+// OrganizationService 组织管理服务，仅供平台管理员使用
+type OrganizationService struct {
+	repo postgres.OrganizationRepository
+}
+
+// NewOrganizationService 构造组织管理服务
+func NewOrganizationService(repo postgres.OrganizationRepository) *OrganizationService {
+	return &OrganizationService{repo: repo}
+}
+
+// Create 创建组织，编码全局唯一
+func (s *OrganizationService) Create(ctx context.Context, code, name string) (*models.Organization, error) {
+	code, name = strings.TrimSpace(code), strings.TrimSpace(name)
+	if code == "" || name == "" {
+		return nil, fmt.Errorf("%w: 编码与名称不能为空", ErrInvalidOrganization)
+	}
+	existing, err := s.repo.GetByCode(ctx, code)
+	if err != nil {
+		return nil, err
+	}
+	if existing != nil {
+		return nil, ErrOrganizationCodeExists
+	}
+	org := &models.Organization{Code: code, Name: name}
+	if err := s.repo.Create(ctx, org); err != nil {
+		return nil, err
+	}
+	return org, nil
+}
+
+// Get 查询组织
+func (s *OrganizationService) Get(ctx context.Context, id int) (*models.Organization, error) {
+	org, err := s.repo.Get(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if org == nil {
+		return nil, ErrOrganizationNotFound
+	}
+	return org, nil
+}
+
+// List 组织列表
+func (s *OrganizationService) List(ctx context.Context) ([]models.Organization, error) {
+	return s.repo.List(ctx)
+}
+
+// Rename 修改组织名称，编码创建后不可变更
+func (s *OrganizationService) Rename(ctx context.Context, id int, name string) (*models.Organization, error) {
+	name = strings.TrimSpace(name)
+	if name == "" {
+		return nil, fmt.Errorf("%w: 名称不能为空", ErrInvalidOrganization)
+	}
+	org, err := s.Get(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	org.Name = name
+	if err := s.repo.Update(ctx, org); err != nil {
+		return nil, err
+	}
+	return org, nil
+}
+
+// Delete 删除组织；默认组织及仍有数据的组织不可删除
+func (s *OrganizationService) Delete(ctx context.Context, id int) error {
+	if id == tenant.DefaultOrgID {
+		return ErrDefaultOrganization
+	}
+	if _, err := s.Get(ctx, id); err != nil {
+		return err
+	}
+	inUse, err := s.repo.InUse(ctx, id)
+	if err != nil {
+		return err
+	}
+	if inUse {
+		return ErrOrganizationInUse
+	}
+	return s.repo.Delete(ctx, id)
+}
@@ -0,0 +1,536 @@
+// Package service 固件升级（OTA）
+package service
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/fire-disposal/health_DT_go/internal/models"
+	"github.com/fire-disposal/health_DT_go/internal/repository/postgres"
+	"github.com/fire-disposal/health_DT_go/internal/tenant"
+	"go.uber.org/zap"
+)
+
+const (
+	otaQoS                     = 1
+	otaAdvanceInterval         = 30 * time.Second
+	otaDefaultFailureThreshold = 20
+	otaDefaultMinSamples       = 5
+	otaCampaignDevicesLimit    = 200
+	otaDefaultDeviceTimeout    = time.Hour
+)
+
+var (
+	ErrFirmwareNotFound     = errors.New("固件不存在")
+	ErrFirmwareExists       = errors.New("该设备类型的固件版本已存在")
+	ErrFirmwareTooLarge     = errors.New("固件文件超过大小限制")
+	ErrFirmwareChecksum     = errors.New("固件 SHA256 校验不一致")
+	ErrInvalidFirmware      = errors.New("固件参数错误")
+	ErrOTACampaignNotFound  = errors.New("升级活动不存在")
+	ErrOTACampaignState     = errors.New("升级活动当前状态不允许该操作")
+	ErrInvalidOTACampaign   = errors.New("升级活动参数错误")
+	ErrOTADownloadForbidden = errors.New("设备无权下载该固件")
+)
+
+// UploadFirmwareInput 上传固件参数
+type UploadFirmwareInput struct {
+	OrgID      int
+	DeviceType string
+	Version    string
+	Notes      string
+	FileName   string
+	SHA256     string // 可选，上传方提供的校验值，与实际内容不一致时拒绝
+	Content    io.Reader
+}
+
+// CreateOTACampaignInput 创建升级活动参数
+type CreateOTACampaignInput struct {
+	OrgID                   int
+	Name                    string
+	ArtifactID              int
+	FromVersions            []string
+	RolloutPercent          int
+	FailureThresholdPercent int // 0 时默认 20
+	MinSamples              int // 0 时默认 5
+}
+
+// OTAStatusReport 设备升级状态上报（device/{sn}/ota/status 的 data 字段）
+type OTAStatusReport struct {
+	CampaignID int    `json:"campaign_id"`
+	Status     string `json:"status"`   // downloading / installing / succeeded / failed
+	Progress   int    `json:"progress"` // 0-100
+	Error      string `json:"error"`
+}
+
+// otaMessage 下发到 device/{sn}/ota 的升级通知
+type otaMessage struct {
+	CampaignID int    `json:"campaign_id"`
+	Version    string `json:"version"`
+	URL        string `json:"url"`
+	Size       int64  `json:"size"`
+	SHA256     string `json:"sha256"`
+	TS         int64  `json:"ts"`
+	Sig        string `json:"sig,omitempty"`
+}
+
+// OTAService 固件升级服务：固件存于本地目录并记录 SHA256；升级活动按设备类型与当前固件版本（设备影子
+// reported.firmware）选取设备，按放量比例分批纳入并经 MQTT 通知设备，设备上报进度；
+// 失败率超过阈值时自动暂停，全部完成后自动结束
+type OTAService struct {
+	repo            *postgres.OTARepository
+	deviceAuth      *DeviceAuthService
+	publisher       DownlinkPublisher
+	storageDir      string
+	maxUploadBytes  int64
+	downloadBaseURL string
+	deviceTimeout   time.Duration // 已下发设备无进度上报超过该时长判为失败
+}
+
+// NewOTAService 构造固件升级服务，publisher 为 nil 时活动只记录不下发；deviceTimeout 为 0 时默认 1 小时
+func NewOTAService(repo *postgres.OTARepository, deviceAuth *DeviceAuthService, publisher DownlinkPublisher,
+	storageDir string, maxUploadBytes int64, downloadBaseURL string, deviceTimeout time.Duration) *OTAService {
+	if deviceTimeout <= 0 {
+		deviceTimeout = otaDefaultDeviceTimeout
+	}
+	return &OTAService{
+		repo:            repo,
+		deviceAuth:      deviceAuth,
+		publisher:       publisher,
+		storageDir:      storageDir,
+		maxUploadBytes:  maxUploadBytes,
+		downloadBaseURL: strings.TrimRight(downloadBaseURL, "/"),
+		deviceTimeout:   deviceTimeout,
+	}
+}
+
+// UploadFirmware 保存固件文件并写入记录，文件按 SHA256 命名存放
+func (s *OTAService) UploadFirmware(ctx context.Context, createdBy int64, in UploadFirmwareInput) (*models.FirmwareArtifact, error) {
+	in.DeviceType, in.Version = strings.TrimSpace(in.DeviceType), strings.TrimSpace(in.Version)
+	if in.DeviceType == "" || in.Version == "" || len(in.Version) > 64 || len(in.DeviceType) > 64 {
+		return nil, fmt.Errorf("%w: device_type 与 version 必填且不超过 64 字符", ErrInvalidFirmware)
+	}
+	orgID := tenant.OrgForCreate(ctx, in.OrgID)
+	exists, err := s.repo.ArtifactExists(ctx, orgID, in.DeviceType, in.Version)
+	if err != nil {
+		return nil, err
+	}
+	if exists {
+		return nil, ErrFirmwareExists
+	}
+
+	if err := os.MkdirAll(s.storageDir, 0o750); err != nil {
+		return nil, err
+	}
+	tmp, err := os.CreateTemp(s.storageDir, "upload-*")
+	if err != nil {
+		return nil, err
+	}
+	defer os.Remove(tmp.Name())
+	hash := sha256.New()
+	size, err := io.Copy(io.MultiWriter(tmp, hash), io.LimitReader(in.Content, s.maxUploadBytes+1))
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return nil, err
+	}
+	if size == 0 {
+		return nil, fmt.Errorf("%w: 固件文件为空", ErrInvalidFirmware)
+	}
+	if size > s.maxUploadBytes {
+		return nil, ErrFirmwareTooLarge
+	}
+	sum := hex.EncodeToString(hash.Sum(nil))
+	if in.SHA256 != "" && !strings.EqualFold(in.SHA256, sum) {
+		return nil, ErrFirmwareChecksum
+	}
+	path := filepath.Join(s.storageDir, sum+".bin")
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return nil, err
+	}
+
+	artifact := &models.FirmwareArtifact{
+		OrgID:      orgID,
+		DeviceType: in.DeviceType,
+		Version:    in.Version,
+		FileName:   filepath.Base(in.FileName),
+		FilePath:   path,
+		Size:       size,
+		SHA256:     sum,
+		Notes:      in.Notes,
+		CreatedBy:  createdBy,
+	}
+	if err := s.repo.CreateArtifact(ctx, artifact); err != nil {
+		// 文件按内容命名，可能被其他固件记录引用，写入失败时保留
+		if errors.Is(err, postgres.ErrFirmwareArtifactExists) {
+			return nil, ErrFirmwareExists
+		}
+		return nil, err
+	}
+	return artifact, nil
+}
+
+// GetFirmware 查询固件
+func (s *OTAService) GetFirmware(ctx context.Context, id int) (*models.FirmwareArtifact, error) {
+	a, err := s.repo.GetArtifact(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if a == nil {
+		return nil, ErrFirmwareNotFound
+	}
+	return a, nil
+}
+
+// ListFirmware 固件列表，deviceType 为空时返回全部
+func (s *OTAService) ListFirmware(ctx context.Context, deviceType string) ([]models.FirmwareArtifact, error) {
+	return s.repo.ListArtifacts(ctx, deviceType)
+}
+
+// FirmwareForDevice 校验设备下载请求签名，返回设备可下载的固件（设备须在使用该固件的进行中或已暂停活动内）
+func (s *OTAService) FirmwareForDevice(ctx context.Context, sn string, id int, ts int64, sig string) (*models.FirmwareArtifact, error) {
+	if s.deviceAuth != nil {
+		if err := s.deviceAuth.VerifyMessage(sn, "ota_download", ts, []byte(strconv.Itoa(id)), sig); err != nil {
+			return nil, err
+		}
+	}
+	a, err := s.repo.ArtifactForDevice(ctx, sn, id)
+	if err != nil {
+		return nil, err
+	}
+	if a == nil {
+		return nil, ErrOTADownloadForbidden
+	}
+	return a, nil
+}
+
+// CreateCampaign 创建草稿状态的升级活动
+func (s *OTAService) CreateCampaign(ctx context.Context, createdBy int64, in CreateOTACampaignInput) (*models.OTACampaign, error) {
+	in.Name = strings.TrimSpace(in.Name)
+	if in.Name == "" {
+		return nil, fmt.Errorf("%w: name 必填", ErrInvalidOTACampaign)
+	}
+	if in.FailureThresholdPercent == 0 {
+		in.FailureThresholdPercent = otaDefaultFailureThreshold
+	}
+	if in.MinSamples == 0 {
+		in.MinSamples = otaDefaultMinSamples
+	}
+	if in.RolloutPercent < 0 || in.RolloutPercent > 100 || in.FailureThresholdPercent < 1 || in.FailureThresholdPercent > 100 {
+		return nil, fmt.Errorf("%w: rollout_percent 须在 0-100 之间，failure_threshold_percent 须在 1-100 之间", ErrInvalidOTACampaign)
+	}
+	if in.MinSamples < 1 {
+		return nil, fmt.Errorf("%w: min_samples 须大于 0", ErrInvalidOTACampaign)
+	}
+	artifact, err := s.GetFirmware(ctx, in.ArtifactID)
+	if err != nil {
+		return nil, err
+	}
+	fromVersions := []string{}
+	for _, v := range in.FromVersions {
+		if v = strings.TrimSpace(v); v != "" && v != artifact.Version {
+			fromVersions = append(fromVersions, v)
+		}
+	}
+	c := &models.OTACampaign{
+		OrgID:                   artifact.OrgID,
+		Name:                    in.Name,
+		ArtifactID:              artifact.ID,
+		FromVersions:            fromVersions,
+		RolloutPercent:          in.RolloutPercent,
+		FailureThresholdPercent: in.FailureThresholdPercent,
+		MinSamples:              in.MinSamples,
+		CreatedBy:               createdBy,
+	}
+	if err := s.repo.CreateCampaign(ctx, c); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// GetCampaign 查询升级活动（含进度统计）
+func (s *OTAService) GetCampaign(ctx context.Context, id int) (*models.OTACampaign, error) {
+	c, err := s.repo.GetCampaign(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if c == nil {
+		return nil, ErrOTACampaignNotFound
+	}
+	if c.Progress, err = s.repo.CampaignStats(ctx, id); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// ListCampaigns 升级活动列表，status 为空时返回全部
+func (s *OTAService) ListCampaigns(ctx context.Context, status string) ([]models.OTACampaign, error) {
+	return s.repo.ListCampaigns(ctx, status)
+}
+
+// CampaignDevices 升级活动中的设备，status 为空时返回全部
+func (s *OTAService) CampaignDevices(ctx context.Context, id int, status string) ([]models.OTACampaignDevice, error) {
+	if _, err := s.GetCampaign(ctx, id); err != nil {
+		return nil, err
+	}
+	return s.repo.ListCampaignDevices(ctx, id, status, otaCampaignDevicesLimit)
+}
+
+// Start 启动草稿活动，立即纳入首批设备并下发
+func (s *OTAService) Start(ctx context.Context, id int) (*models.OTACampaign, error) {
+	return s.transition(ctx, id, []string{models.OTACampaignDraft}, models.OTACampaignRunning, true)
+}
+
+// Pause 暂停进行中的活动：不再纳入和通知设备，已开始升级的设备仍可上报进度与下载固件
+func (s *OTAService) Pause(ctx context.Context, id int) (*models.OTACampaign, error) {
+	return s.transition(ctx, id, []string{models.OTACampaignRunning}, models.OTACampaignPaused, false)
+}
+
+// Resume 恢复已暂停的活动（含自动暂停），清除暂停原因
+func (s *OTAService) Resume(ctx context.Context, id int) (*models.OTACampaign, error) {
+	return s.transition(ctx, id, []string{models.OTACampaignPaused}, models.OTACampaignRunning, true)
+}
+
+// Cancel 取消未结束的活动，设备不再可下载该活动的固件
+func (s *OTAService) Cancel(ctx context.Context, id int) (*models.OTACampaign, error) {
+	return s.transition(ctx, id, []string{models.OTACampaignDraft, models.OTACampaignRunning, models.OTACampaignPaused},
+		models.OTACampaignCancelled, false)
+}
+
+// SetRollout 提高放量比例（只增不减），进行中的活动立即纳入新增批次
+func (s *OTAService) SetRollout(ctx context.Context, id, percent int) (*models.OTACampaign, error) {
+	if percent < 1 || percent > 100 {
+		return nil, fmt.Errorf("%w: rollout_percent 须在 1-100 之间", ErrInvalidOTACampaign)
+	}
+	c, err := s.GetCampaign(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if percent <= c.RolloutPercent {
+		return nil, fmt.Errorf("%w: 放量比例只能提高（当前 %d%%）", ErrInvalidOTACampaign, c.RolloutPercent)
+	}
+	ok, err := s.repo.RaiseRollout(ctx, id, percent)
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return nil, ErrOTACampaignState
+	}
+	if c.Status == models.OTACampaignRunning {
+		c.RolloutPercent = percent
+		s.advance(ctx, c)
+	}
+	return s.GetCampaign(ctx, id)
+}
+
+func (s *OTAService) transition(ctx context.Context, id int, from []string, to string, advance bool) (*models.OTACampaign, error) {
+	c, err := s.GetCampaign(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	ok, err := s.repo.TransitionCampaign(ctx, id, from, to, "")
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrOTACampaignState, c.Status)
+	}
+	if advance {
+		c.Status = to
+		s.advance(ctx, c)
+	}
+	return s.GetCampaign(ctx, id)
+}
+
+// HandleStatus 记录设备上报的升级进度，设备失败时检查活动失败率
+func (s *OTAService) HandleStatus(ctx context.Context, sn string, report OTAStatusReport) error {
+	if report.CampaignID <= 0 || !models.IsOTADeviceReportStatus(report.Status) {
+		return fmt.Errorf("%w: campaign_id 或 status 无效", ErrInvalidOTACampaign)
+	}
+	if report.Progress < 0 {
+		report.Progress = 0
+	}
+	if report.Progress > 100 || report.Status == models.OTADeviceSucceeded {
+		report.Progress = 100
+	}
+	matched, err := s.repo.UpdateDeviceStatus(ctx, report.CampaignID, sn, report.Status, report.Progress, report.Error)
+	if err != nil {
+		return err
+	}
+	if !matched {
+		zap.L().Warn("固件升级状态未匹配（未纳入活动或已结束）",
+			zap.String("sn", sn), zap.Int("campaign_id", report.CampaignID))
+		return nil
+	}
+	if report.Status != models.OTADeviceSucceeded && report.Status != models.OTADeviceFailed {
+		return nil
+	}
+	c, err := s.repo.GetCampaign(ctx, report.CampaignID)
+	if err != nil || c == nil || c.Status != models.OTACampaignRunning {
+		return err
+	}
+	_, err = s.evaluate(ctx, c)
+	return err
+}
+
+// Run 定期推进进行中的活动：纳入新符合条件的设备、重试未下发的通知、判断暂停与完成，直到 ctx 取消
+func (s *OTAService) Run(ctx context.Context) {
+	ticker := time.NewTicker(otaAdvanceInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			ids, err := s.repo.RunningCampaignIDs(ctx)
+			if err != nil {
+				zap.L().Error("查询进行中的升级活动失败", zap.Error(err))
+				continue
+			}
+			for _, id := range ids {
+				c, err := s.repo.GetCampaign(ctx, id)
+				if err != nil || c == nil {
+					continue
+				}
+				s.advance(ctx, c)
+			}
+		}
+	}
+}
+
+// advance 推进一个进行中的活动，失败仅记录日志，由 Run 下一轮重试；
+// 已下发但超时未上报进度的设备先判为失败，避免活动永远无法完成，并计入失败率
+func (s *OTAService) advance(ctx context.Context, c *models.OTACampaign) {
+	log := zap.L().With(zap.Int("campaign_id", c.ID))
+	if n, err := s.repo.ExpireStaleDevices(ctx, c.ID, s.deviceTimeout); err != nil {
+		log.Error("升级超时设备标记失败", zap.Error(err))
+	} else if n > 0 {
+		log.Warn("升级设备超时判为失败", zap.Int64("devices", n))
+	}
+	paused, err := s.evaluate(ctx, c)
+	if err != nil {
+		log.Error("升级活动状态检查失败", zap.Error(err))
+		return
+	}
+	if paused {
+		return
+	}
+	candidates, err := s.repo.Candidates(ctx, c)
+	if err != nil {
+		log.Error("查询升级候选设备失败", zap.Error(err))
+		return
+	}
+	for _, cd := range candidates {
+		if otaBucket(c.ID, cd.SerialNumber) >= c.RolloutPercent {
+			continue
+		}
+		if err := s.repo.Enroll(ctx, c.ID, cd); err != nil {
+			log.Error("设备纳入升级活动失败", zap.String("sn", cd.SerialNumber), zap.Error(err))
+		}
+	}
+	s.dispatch(ctx, c)
+	if _, err := s.evaluate(ctx, c); err != nil {
+		log.Error("升级活动状态检查失败", zap.Error(err))
+	}
+}
+
+// dispatch 向活动中尚未下发的设备发送升级通知
+func (s *OTAService) dispatch(ctx context.Context, c *models.OTACampaign) {
+	if s.publisher == nil {
+		return
+	}
+	artifact, err := s.repo.GetArtifact(ctx, c.ArtifactID)
+	if err != nil || artifact == nil {
+		zap.L().Error("升级活动固件读取失败", zap.Int("campaign_id", c.ID), zap.Error(err))
+		return
+	}
+	pending, err := s.repo.PendingDevices(ctx, c.ID)
+	if err != nil {
+		zap.L().Error("查询待下发设备失败", zap.Int("campaign_id", c.ID), zap.Error(err))
+		return
+	}
+	for _, cd := range pending {
+		if err := s.notify(cd.SerialNumber, c, artifact); err != nil {
+			zap.L().Warn("固件升级通知下发失败", zap.String("sn", cd.SerialNumber), zap.Int("campaign_id", c.ID), zap.Error(err))
+			continue
+		}
+		if err := s.repo.MarkDeviceSent(ctx, c.ID, cd.DeviceID); err != nil {
+			zap.L().Error("升级设备状态更新失败", zap.String("sn", cd.SerialNumber), zap.Error(err))
+		}
+	}
+}
+
+func (s *OTAService) notify(sn string, c *models.OTACampaign, artifact *models.FirmwareArtifact) error {
+	msg := otaMessage{
+		CampaignID: c.ID,
+		Version:    artifact.Version,
+		URL:        fmt.Sprintf("%s/api/v1/ota/firmware/%d/download", s.downloadBaseURL, artifact.ID),
+		Size:       artifact.Size,
+		SHA256:     artifact.SHA256,
+		TS:         time.Now().Unix(),
+	}
+	if s.deviceAuth != nil {
+		sig, err := s.deviceAuth.SignOTA(sn, msg.TS, msg.CampaignID, msg.Version, msg.SHA256)
+		if err != nil {
+			return err
+		}
+		msg.Sig = sig
+	}
+	payload, err := json.Marshal(msg)
+	if err != nil {
+		return err
+	}
+	return s.publisher.Publish(fmt.Sprintf("device/%s/ota", sn), otaQoS, false, payload)
+}
+
+// evaluate 按已完成设备的失败率判断是否自动暂停，放量达到 100% 且无未完成设备时标记完成；返回活动是否已停止推进
+func (s *OTAService) evaluate(ctx context.Context, c *models.OTACampaign) (bool, error) {
+	stats, err := s.repo.CampaignStats(ctx, c.ID)
+	if err != nil {
+		return false, err
+	}
+	failed := stats.ByStatus[models.OTADeviceFailed]
+	finished := failed + stats.ByStatus[models.OTADeviceSucceeded]
+	if finished >= c.MinSamples && failed*100 >= c.FailureThresholdPercent*finished {
+		reason := fmt.Sprintf("失败率 %d%%（%d/%d）达到阈值 %d%%，已自动暂停",
+			failed*100/finished, failed, finished, c.FailureThresholdPercent)
+		ok, err := s.repo.TransitionCampaign(ctx, c.ID, []string{models.OTACampaignRunning}, models.OTACampaignPaused, reason)
+		if err != nil {
+			return false, err
+		}
+		if ok {
+			zap.L().Warn("升级活动自动暂停", zap.Int("campaign_id", c.ID), zap.String("reason", reason))
+		}
+		return true, nil
+	}
+	if c.RolloutPercent < 100 || stats.Enrolled == 0 || finished < stats.Enrolled {
+		return false, nil
+	}
+	candidates, err := s.repo.Candidates(ctx, c)
+	if err != nil || len(candidates) > 0 {
+		return false, err
+	}
+	ok, err := s.repo.TransitionCampaign(ctx, c.ID, []string{models.OTACampaignRunning}, models.OTACampaignCompleted, "")
+	if ok {
+		zap.L().Info("升级活动完成", zap.Int("campaign_id", c.ID), zap.Int("succeeded", finished-failed), zap.Int("failed", failed))
+	}
+	return ok, err
+}
+
+// otaBucket 设备在活动中的放量分桶（0-99），同一活动内固定，提高放量比例时已纳入的设备保持不变
+func otaBucket(campaignID int, sn string) int {
+	h := fnv.New32a()
+	h.Write([]byte(strconv.Itoa(campaignID) + "/" + sn))
+	return int(h.Sum32() % 100)
+}
@@ -0,0 +1,63 @@
+// Package service 密码强度策略
+package service
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"unicode"
+)
+
+// ErrWeakPassword 密码不满足强度策略
+var ErrWeakPassword = errors.New("密码强度不足")
+
+// PasswordPolicy 密码强度策略
+type PasswordPolicy struct {
+	MinLength      int  // 最小长度
+	MaxLength      int  // 最大长度（bcrypt 仅使用前72字节）
+	RequireLetter  bool // 必须包含字母
+	RequireDigit   bool // 必须包含数字
+	RequireSpecial bool // 必须包含特殊字符
+}
+
+// DefaultPasswordPolicy 默认密码策略：8-72位，至少包含字母和数字
+var DefaultPasswordPolicy = PasswordPolicy{
+	MinLength:     8,
+	MaxLength:     72,
+	RequireLetter: true,
+	RequireDigit:  true,
+}
+
+// Validate 校验密码强度，username 非空时禁止密码包含用户名
+func (p PasswordPolicy) Validate(password, username string) error {
+	if len(password) < p.MinLength {
+		return fmt.Errorf("%w: 长度不能少于%d位", ErrWeakPassword, p.MinLength)
+	}
+	if p.MaxLength > 0 && len(password) > p.MaxLength {
+		return fmt.Errorf("%w: 长度不能超过%d位", ErrWeakPassword, p.MaxLength)
+	}
+	var hasLetter, hasDigit, hasSpecial bool
+	for _, r := range password {
+		switch {
+		case unicode.IsLetter(r):
+			hasLetter = true
+		case unicode.IsDigit(r):
+			hasDigit = true
+		case unicode.IsPunct(r) || unicode.IsSymbol(r):
+			hasSpecial = true
+		}
+	}
+	if p.RequireLetter && !hasLetter {
+		return fmt.Errorf("%w: 需包含字母", ErrWeakPassword)
+	}
+	if p.RequireDigit && !hasDigit {
+		return fmt.Errorf("%w: 需包含数字", ErrWeakPassword)
+	}
+	if p.RequireSpecial && !hasSpecial {
+		return fmt.Errorf("%w: 需包含特殊字符", ErrWeakPassword)
+	}
+	if username != "" && strings.Contains(strings.ToLower(password), strings.ToLower(username)) {
+		return fmt.Errorf("%w: 不能包含用户名", ErrWeakPassword)
+	}
+	return nil
+}
@@ -0,0 +1,201 @@
+// Package service 密码修改与找回业务逻辑
+package service
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"math/big"
+	"time"
+
+	"github.com/fire-disposal/health_DT_go/internal/models"
+	"github.com/fire-disposal/health_DT_go/internal/notifier"
+	"github.com/fire-disposal/health_DT_go/internal/repository/postgres"
+	"go.uber.org/zap"
+	"golang.org/x/crypto/bcrypt"
+)
+
+const (
+	resetCodeTTL         = 15 * time.Minute // 验证码有效期
+	resetCodeMaxAttempts = 5                // 验证码最大错误次数
+)
+
+var (
+	ErrWrongPassword    = errors.New("当前密码错误")
+	ErrInvalidResetCode = errors.New("验证码无效或已过期")
+)
+
+// PasswordService 密码修改与找回服务
+type PasswordService struct {
+	authRepo  postgres.AuthRepository
+	adminRepo postgres.AdminUserRepository
+	resetRepo postgres.PasswordResetRepository
+	notifier  notifier.Notifier
+	policy    PasswordPolicy
+}
+
+// NewPasswordService 构造密码服务
+func NewPasswordService(authRepo postgres.AuthRepository, adminRepo postgres.AdminUserRepository,
+	resetRepo postgres.PasswordResetRepository, n notifier.Notifier) *PasswordService {
+	return &PasswordService{
+		authRepo:  authRepo,
+		adminRepo: adminRepo,
+		resetRepo: resetRepo,
+		notifier:  n,
+		policy:    DefaultPasswordPolicy,
+	}
+}
+
+// ChangePassword 已登录用户修改密码，需校验当前密码，成功后注销除当前会话外的所有 Token
+func (s *PasswordService) ChangePassword(ctx context.Context, p *Principal, currentPassword, newPassword string) error {
+	var username string
+	switch p.UserType {
+	case models.UserTypeAdmin:
+		admin, err := s.adminRepo.GetByID(ctx, p.UserID)
+		if err != nil {
+			return err
+		}
+		if admin == nil {
+			return ErrAdminUserNotFound
+		}
+		if bcrypt.CompareHashAndPassword([]byte(admin.PasswordHash), []byte(currentPassword)) != nil {
+			return ErrWrongPassword
+		}
+		username = admin.Username
+	case models.UserTypeApp:
+		ok, err := s.authRepo.VerifyPassword(ctx, p.UserID, currentPassword)
+		if err != nil || !ok {
+			return ErrWrongPassword
+		}
+	default:
+		return errors.New("未知用户类型")
+	}
+	if err := s.policy.Validate(newPassword, username); err != nil {
+		return err
+	}
+	if err := s.setPassword(ctx, p.UserType, p.UserID, newPassword); err != nil {
+		return err
+	}
+	return s.authRepo.DeleteUserTokens(ctx, p.UserType, p.UserID, p.Token)
+}
+
+// RequestReset 申请重置密码验证码。为避免账号枚举，账号不存在或无联系方式时同样返回成功
+func (s *PasswordService) RequestReset(ctx context.Context, userType, username string) error {
+	userID, destination, err := s.lookupAccount(ctx, userType, username)
+	if err != nil {
+		return err
+	}
+	if userID == 0 || destination == "" {
+		zap.L().Info("密码重置申请未发送验证码", zap.String("user_type", userType), zap.String("username", username))
+		return nil
+	}
+	code, err := generateNumericCode(6)
+	if err != nil {
+		return err
+	}
+	// 新验证码生成后作废旧验证码，保证同一时刻只有一个有效
+	if err := s.resetRepo.InvalidateAll(ctx, userType, userID); err != nil {
+		return err
+	}
+	record := &models.PasswordResetCode{
+		UserType:  userType,
+		UserID:    userID,
+		CodeHash:  sha256Hex(code),
+		ExpiresAt: time.Now().Add(resetCodeTTL),
+	}
+	if err := s.resetRepo.Create(ctx, record); err != nil {
+		return err
+	}
+	return s.notifier.Send(ctx, notifier.Message{
+		To:      destination,
+		Subject: "密码重置验证码",
+		Body:    fmt.Sprintf("您的密码重置验证码为 %s，%d 分钟内有效。如非本人操作请忽略。", code, int(resetCodeTTL.Minutes())),
+		SentAt:  time.Now(),
+	})
+}
+
+// ResetPassword 使用验证码重置密码，验证码单次有效，成功后注销该用户全部 Token
+func (s *PasswordService) ResetPassword(ctx context.Context, userType, username, code, newPassword string) error {
+	userID, _, err := s.lookupAccount(ctx, userType, username)
+	if err != nil {
+		return err
+	}
+	if userID == 0 {
+		return ErrInvalidResetCode
+	}
+	record, err := s.resetRepo.GetLatestActive(ctx, userType, userID)
+	if err != nil {
+		return err
+	}
+	if record == nil || record.Attempts >= resetCodeMaxAttempts {
+		return ErrInvalidResetCode
+	}
+	if subtle.ConstantTimeCompare([]byte(record.CodeHash), []byte(sha256Hex(code))) != 1 {
+		_ = s.resetRepo.IncrementAttempts(ctx, record.ID)
+		return ErrInvalidResetCode
+	}
+	if err := s.policy.Validate(newPassword, username); err != nil {
+		return err
+	}
+	if err := s.resetRepo.MarkUsed(ctx, record.ID); err != nil {
+		return ErrInvalidResetCode
+	}
+	if err := s.setPassword(ctx, userType, userID, newPassword); err != nil {
+		return err
+	}
+	return s.authRepo.DeleteUserTokens(ctx, userType, userID, "")
+}
+
+// lookupAccount 按用户名查找账号ID及验证码接收方（优先邮箱）
+func (s *PasswordService) lookupAccount(ctx context.Context, userType, username string) (int64, string, error) {
+	switch userType {
+	case models.UserTypeAdmin:
+		admin, err := s.adminRepo.GetByUsername(ctx, username)
+		if err != nil || admin == nil || !admin.IsActive {
+			return 0, "", err
+		}
+		return admin.ID, firstNonEmpty(admin.Email, admin.Phone), nil
+	case models.UserTypeApp:
+		user, err := s.authRepo.GetAppUserByUsername(username)
+		if err != nil || user == nil || !user.IsActive {
+			return 0, "", err
+		}
+		return user.ID, firstNonEmpty(user.Email, user.Phone), nil
+	}
+	return 0, "", errors.New("未知用户类型")
+}
+
+func (s *PasswordService) setPassword(ctx context.Context, userType string, userID int64, password string) error {
+	if userType == models.UserTypeApp {
+		return s.authRepo.SetPassword(ctx, userID, password)
+	}
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return err
+	}
+	return s.adminRepo.UpdatePasswordHash(ctx, userID, string(hash))
+}
+
+// generateNumericCode 生成指定位数的随机数字验证码
+func generateNumericCode(digits int) (string, error) {
+	max := big.NewInt(1)
+	for i := 0; i < digits; i++ {
+		max.Mul(max, big.NewInt(10))
+	}
+	n, err := rand.Int(rand.Reader, max)
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%0*d", digits, n), nil
+}
+
+func firstNonEmpty(values ...string) string {
+	for _, v := range values {
+		if v != "" {
+			return v
+		}
+	}
+	return ""
+}
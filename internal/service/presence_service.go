@@ -0,0 +1,310 @@
+// Package service 设备在线状态跟踪
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/fire-disposal/health_DT_go/internal/app/eventbus"
+	"github.com/fire-disposal/health_DT_go/internal/models"
+	"github.com/fire-disposal/health_DT_go/internal/repository/postgres"
+	redisrepo "github.com/fire-disposal/health_DT_go/internal/repository/redis"
+	"go.uber.org/zap"
+)
+
+const (
+	defaultPresenceSweepInterval = 30 * time.Second
+	defaultPresenceTimeout       = 5 * time.Minute
+	presenceTouchTimeout         = 2 * time.Second
+	presenceMissedReports        = 3 // 按设备类型目录的上报间隔推算静默时长时，允许连续缺失的上报次数
+)
+
+// PresenceConfig 在线状态参数
+type PresenceConfig struct {
+	SweepInterval  time.Duration            // 巡检间隔，0 时默认 30 秒
+	DefaultTimeout time.Duration            // 默认静默时长，0 时默认 5 分钟
+	Timeouts       map[string]time.Duration // 按 device_type 覆盖静默时长
+}
+
+// PresenceService 设备在线状态服务：接入层每收到一条上行消息调用 Touch 记录最近上行时间（Redis），
+// 巡检任务定期比对静默时长，状态变化时写入 device_online / device_offline 事件并发布到事件总线，
+// 离线时创建告警、恢复在线时自动解除
+type PresenceService struct {
+	repo      *redisrepo.PresenceRepository
+	devices   *postgres.DevicesRepository
+	events    *postgres.EventsRepository
+	alerts    *postgres.AlertsRepository
+	locations *postgres.LocationRepository
+	bus       *eventbus.EventBus
+	cfg       PresenceConfig
+	owner     string // 巡检锁持有者标识
+
+	intervals func(deviceType string) time.Duration // 设备类型目录中的预期上报间隔，可为 nil
+}
+
+// NewPresenceService 构造在线状态服务，locations、bus 可为 nil
+func NewPresenceService(repo *redisrepo.PresenceRepository, devices *postgres.DevicesRepository,
+	events *postgres.EventsRepository, alerts *postgres.AlertsRepository, locations *postgres.LocationRepository,
+	bus *eventbus.EventBus, cfg PresenceConfig) *PresenceService {
+	if cfg.SweepInterval <= 0 {
+		cfg.SweepInterval = defaultPresenceSweepInterval
+	}
+	if cfg.DefaultTimeout <= 0 {
+		cfg.DefaultTimeout = defaultPresenceTimeout
+	}
+	host, _ := os.Hostname()
+	return &PresenceService{
+		repo:      repo,
+		devices:   devices,
+		events:    events,
+		alerts:    alerts,
+		locations: locations,
+		bus:       bus,
+		cfg:       cfg,
+		owner:     fmt.Sprintf("%s:%d", host, os.Getpid()),
+	}
+}
+
+// SetReportingIntervals 设置设备类型预期上报间隔来源，须在 Run 之前调用
+func (s *PresenceService) SetReportingIntervals(fn func(deviceType string) time.Duration) {
+	s.intervals = fn
+}
+
+// Timeout 设备类型对应的静默时长：优先使用配置，其次为设备类型目录上报间隔的 3 倍，否则为默认时长
+func (s *PresenceService) Timeout(deviceType string) time.Duration {
+	if d, ok := s.cfg.Timeouts[deviceType]; ok && d > 0 {
+		return d
+	}
+	if s.intervals != nil {
+		if interval := s.intervals(deviceType); interval > 0 {
+			return interval * presenceMissedReports
+		}
+	}
+	return s.cfg.DefaultTimeout
+}
+
+// Touch 记录设备上行（数据或心跳），失败仅记录日志，不影响数据处理
+func (s *PresenceService) Touch(sn string) {
+	if sn == "" {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), presenceTouchTimeout)
+	defer cancel()
+	if err := s.repo.Touch(ctx, sn, time.Now()); err != nil {
+		zap.L().Warn("设备在线状态更新失败", zap.String("sn", sn), zap.Error(err))
+	}
+}
+
+// Disconnect 记录设备声明离线（设备遗嘱或主动下线），下次巡检确认离线，无需等待静默超时；
+// 之后再收到上行即恢复在线
+func (s *PresenceService) Disconnect(sn string) {
+	if sn == "" {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), presenceTouchTimeout)
+	defer cancel()
+	if err := s.repo.MarkDisconnected(ctx, sn, time.Now()); err != nil {
+		zap.L().Warn("设备离线状态记录失败", zap.String("sn", sn), zap.Error(err))
+	}
+}
+
+// Annotate 为设备列表填充在线状态（按最近上行时间实时计算）
+func (s *PresenceService) Annotate(ctx context.Context, devices []models.Device) error {
+	snap, err := s.snapshot(ctx, devices)
+	if err != nil {
+		return err
+	}
+	now := time.Now()
+	for i := range devices {
+		devices[i].Presence = s.presenceOf(devices[i], snap, now)
+	}
+	return nil
+}
+
+// presenceSnapshot 一批设备的最近上行与声明离线时间
+type presenceSnapshot struct {
+	lastSeen     map[string]time.Time
+	disconnected map[string]time.Time
+}
+
+func (s *PresenceService) snapshot(ctx context.Context, devices []models.Device) (presenceSnapshot, error) {
+	sns := make([]string, len(devices))
+	for i, d := range devices {
+		sns[i] = d.SerialNumber
+	}
+	var snap presenceSnapshot
+	var err error
+	if snap.lastSeen, err = s.repo.LastSeen(ctx, sns); err != nil {
+		return snap, err
+	}
+	snap.disconnected, err = s.repo.Disconnected(ctx, sns)
+	return snap, err
+}
+
+func (s *PresenceService) presenceOf(d models.Device, snap presenceSnapshot, now time.Time) *models.DevicePresence {
+	seen, ok := snap.lastSeen[d.SerialNumber]
+	if !ok {
+		return &models.DevicePresence{Status: models.DeviceUnknown}
+	}
+	p := &models.DevicePresence{Status: models.DeviceOnline, LastSeenAt: &seen}
+	if gone, ok := snap.disconnected[d.SerialNumber]; ok && !gone.Before(seen) {
+		p.Status = models.DeviceOffline
+		p.DisconnectedAt = &gone
+	} else if now.Sub(seen) > s.Timeout(d.DeviceType) {
+		p.Status = models.DeviceOffline
+	}
+	return p
+}
+
+// Run 按巡检间隔执行 Sweep，直到 ctx 取消
+func (s *PresenceService) Run(ctx context.Context) {
+	ticker := time.NewTicker(s.cfg.SweepInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := s.Sweep(ctx); err != nil {
+				zap.L().Error("设备在线状态巡检失败", zap.Error(err))
+			}
+		}
+	}
+}
+
+// Sweep 巡检一次：比对全部启用设备的在线状态，记录状态变化；清理未注册设备的上行记录。
+// 多实例部署时通过 Redis 锁保证每个巡检周期仅一个实例执行
+func (s *PresenceService) Sweep(ctx context.Context) error {
+	ok, err := s.repo.AcquireSweepLock(ctx, s.owner, s.cfg.SweepInterval*9/10)
+	if err != nil || !ok {
+		return err
+	}
+	devices, err := s.devices.FindAll(ctx)
+	if err != nil {
+		return err
+	}
+	registered := make(map[string]bool, len(devices))
+	var active []models.Device
+	for _, d := range devices {
+		registered[d.SerialNumber] = true
+		if d.IsActive {
+			active = append(active, d)
+		}
+	}
+	if err := s.pruneUnregistered(ctx, registered); err != nil {
+		return err
+	}
+
+	snap, err := s.snapshot(ctx, active)
+	if err != nil {
+		return err
+	}
+	sns := make([]string, len(active))
+	for i, d := range active {
+		sns[i] = d.SerialNumber
+	}
+	states, err := s.repo.States(ctx, sns)
+	if err != nil {
+		return err
+	}
+	now := time.Now()
+	for _, d := range active {
+		p := s.presenceOf(d, snap, now)
+		if p.Status == models.DeviceUnknown || states[d.SerialNumber] == p.Status {
+			continue
+		}
+		// 事件落库失败时不更新状态，下次巡检重试
+		if err := s.transition(ctx, d, p); err != nil {
+			zap.L().Error("设备在线状态变更记录失败", zap.String("sn", d.SerialNumber),
+				zap.String("status", p.Status), zap.Error(err))
+			continue
+		}
+		if err := s.repo.SetState(ctx, d.SerialNumber, p.Status); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// transition 记录状态变化事件，并创建或解除离线告警；事件包含设备所在位置，告警位置由仓储附加
+func (s *PresenceService) transition(ctx context.Context, d models.Device, p *models.DevicePresence) error {
+	eventType := models.EventDeviceOnline
+	if p.Status == models.DeviceOffline {
+		eventType = models.EventDeviceOffline
+	}
+	timeout := s.Timeout(d.DeviceType)
+	payload := map[string]interface{}{
+		"serial_number":   d.SerialNumber,
+		"last_seen_at":    p.LastSeenAt,
+		"disconnected_at": p.DisconnectedAt,
+		"timeout_seconds": int(timeout.Seconds()),
+	}
+	if loc := s.locationOf(ctx, d); loc != nil {
+		payload["location_id"] = loc.ID
+		payload["location"] = loc.Path
+	}
+	data, _ := json.Marshal(payload)
+	now := time.Now()
+	eventID, err := s.events.CreateDeviceEvent(ctx, eventType, d.ID, now, data)
+	if err != nil {
+		return err
+	}
+	if p.Status == models.DeviceOffline {
+		msg := fmt.Sprintf("设备 %s 已离线：超过 %s 未收到数据或心跳", d.SerialNumber, timeout)
+		if p.DisconnectedAt != nil {
+			msg = fmt.Sprintf("设备 %s 已离线：设备连接断开", d.SerialNumber)
+		}
+		if _, err := s.alerts.OpenDeviceAlert(ctx, d.ID, &eventID, models.AlertRuleDeviceOffline, "warning", msg); err != nil {
+			return err
+		}
+	} else if _, err := s.alerts.ResolveDeviceAlerts(ctx, d.ID, models.AlertRuleDeviceOffline); err != nil {
+		return err
+	}
+	if s.bus != nil {
+		s.bus.Publish(eventType, models.Event{
+			ID:        eventID,
+			EventType: eventType,
+			DeviceID:  &d.ID,
+			Timestamp: now,
+			Data:      data,
+		})
+	}
+	zap.L().Info("设备在线状态变化", zap.String("sn", d.SerialNumber), zap.String("status", p.Status))
+	return nil
+}
+
+// locationOf 查询设备所在位置（放置位置优先，其次绑定档案的床位），查询失败仅记录日志
+func (s *PresenceService) locationOf(ctx context.Context, d models.Device) *models.Location {
+	return deviceLocation(ctx, s.locations, d)
+}
+
+// deviceLocation 查询设备所在位置，repo 为 nil 或查询失败时返回 nil
+func deviceLocation(ctx context.Context, repo *postgres.LocationRepository, d models.Device) *models.Location {
+	if repo == nil {
+		return nil
+	}
+	loc, err := repo.DeviceLocation(ctx, d.ID)
+	if err != nil {
+		zap.L().Warn("设备位置查询失败", zap.String("sn", d.SerialNumber), zap.Error(err))
+		return nil
+	}
+	return loc
+}
+
+// pruneUnregistered 清除未注册设备（如未开启强制认证时的无效序列号）的上行记录
+func (s *PresenceService) pruneUnregistered(ctx context.Context, registered map[string]bool) error {
+	members, err := s.repo.Members(ctx)
+	if err != nil {
+		return err
+	}
+	var stale []string
+	for _, sn := range members {
+		if !registered[sn] {
+			stale = append(stale, sn)
+		}
+	}
+	return s.repo.Remove(ctx, stale...)
+}
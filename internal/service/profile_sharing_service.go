@@ -0,0 +1,301 @@
+// Package service 健康档案共享（成员、邀请与访问控制）业务逻辑
+package service
+
+import (
+	"context"
+	"crypto/rand"
+	"database/sql"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/fire-disposal/health_DT_go/internal/models"
+	"github.com/fire-disposal/health_DT_go/internal/repository/postgres"
+	"github.com/fire-disposal/health_DT_go/internal/tenant"
+)
+
+const (
+	invitationCodeLength = 8
+	invitationCodeAlpha  = "ABCDEFGHJKLMNPQRSTUVWXYZ23456789" // 去除易混淆字符 0/O/1/I
+	invitationDefaultTTL = 72 * time.Hour
+	invitationMaxTTL     = 30 * 24 * time.Hour
+)
+
+var (
+	ErrProfileUnauthenticated = errors.New("未登录")
+	ErrProfileForbidden       = errors.New("无权访问该健康档案")
+	ErrInvalidProfileRole     = errors.New("邀请角色仅支持 caregiver/viewer")
+	ErrInvalidInvitation      = errors.New("邀请码无效或已失效")
+	ErrAlreadyProfileMember   = errors.New("已是该档案成员或已提交申请")
+	ErrProfileMemberNotFound  = errors.New("档案成员不存在")
+	ErrProfileInvitationGone  = errors.New("邀请不存在或已失效")
+	ErrCannotRevokeOwner      = errors.New("不能移除档案拥有者")
+	ErrMemberNotPending       = errors.New("该成员不处于待批准状态")
+)
+
+// ProfileScope 用户可访问的档案范围；All 为 true 时不受限制（平台管理员）；
+// OrgWide 为 true 时 ProfileIDs 为所属组织的全部档案，组织级数据可直接按组织查询
+type ProfileScope struct {
+	All        bool
+	OrgWide    bool
+	ProfileIDs []int
+}
+
+// Contains 判断档案是否在可访问范围内
+func (s *ProfileScope) Contains(profileID int) bool {
+	if s.All {
+		return true
+	}
+	for _, id := range s.ProfileIDs {
+		if id == profileID {
+			return true
+		}
+	}
+	return false
+}
+
+// ProfileSharingService 档案共享服务：成员管理、邀请码与访问授权
+//
+// 权限等级 owner > caregiver > viewer：viewer 只读档案及其告警/数据，caregiver 可维护档案与绑定设备，
+// owner 另可删除档案、邀请与批准/移除成员。管理员不受档案成员限制，但仅能访问所属组织的档案。
+type ProfileSharingService struct {
+	repo     postgres.ProfileMemberRepository
+	profiles *postgres.HealthProfilesRepository
+}
+
+// NewProfileSharingService 构造档案共享服务
+func NewProfileSharingService(repo postgres.ProfileMemberRepository, profiles *postgres.HealthProfilesRepository) *ProfileSharingService {
+	return &ProfileSharingService{repo: repo, profiles: profiles}
+}
+
+// Authorize 校验主体对档案至少拥有 minRole 权限
+func (s *ProfileSharingService) Authorize(ctx context.Context, p *Principal, profileID int, minRole string) error {
+	if p == nil {
+		return ErrProfileUnauthenticated
+	}
+	if p.IsAdmin() || p.IsAPIKey() {
+		return s.authorizeAdmin(ctx, profileID)
+	}
+	member, err := s.repo.GetMember(ctx, profileID, p.UserID)
+	if err != nil {
+		return err
+	}
+	if member == nil || member.Status != models.ProfileMemberActive ||
+		models.ProfileRoleRank(member.Role) < models.ProfileRoleRank(minRole) {
+		return ErrProfileForbidden
+	}
+	return nil
+}
+
+// authorizeAdmin 组织管理员与 API Key 仅可访问本组织档案（仓储按 context 组织过滤），平台管理员不受限
+func (s *ProfileSharingService) authorizeAdmin(ctx context.Context, profileID int) error {
+	if _, restricted := tenant.OrgFilter(ctx); !restricted {
+		return nil
+	}
+	if _, err := s.profiles.Get(ctx, profileID); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return ErrProfileForbidden
+		}
+		return err
+	}
+	return nil
+}
+
+// Scope 返回主体可访问的档案范围，供列表类查询与实时推送过滤
+func (s *ProfileSharingService) Scope(ctx context.Context, p *Principal) (*ProfileScope, error) {
+	if p == nil {
+		return nil, ErrProfileUnauthenticated
+	}
+	if p.IsAdmin() || p.IsAPIKey() {
+		return s.adminScope(ctx)
+	}
+	ids, err := s.repo.ListActiveProfileIDs(ctx, p.UserID)
+	if err != nil {
+		return nil, err
+	}
+	return &ProfileScope{ProfileIDs: ids}, nil
+}
+
+// adminScope 平台管理员不受限；组织管理员与 API Key 为本组织全部档案
+func (s *ProfileSharingService) adminScope(ctx context.Context) (*ProfileScope, error) {
+	if _, restricted := tenant.OrgFilter(ctx); !restricted {
+		return &ProfileScope{All: true}, nil
+	}
+	profiles, err := s.profiles.FindAll(ctx)
+	if err != nil {
+		return nil, err
+	}
+	ids := make([]int, 0, len(profiles))
+	for _, profile := range profiles {
+		ids = append(ids, profile.ID)
+	}
+	return &ProfileScope{OrgWide: true, ProfileIDs: ids}, nil
+}
+
+// CreateInvitation 拥有者生成邀请码（明文仅返回一次）；ttl 为 0 时默认 72 小时，最长 30 天
+func (s *ProfileSharingService) CreateInvitation(ctx context.Context, p *Principal, profileID int, role string,
+	ttl time.Duration) (string, *models.ProfileInvitation, error) {
+	if err := s.requireAppOwner(ctx, p, profileID); err != nil {
+		return "", nil, err
+	}
+	if role != models.ProfileRoleCaregiver && role != models.ProfileRoleViewer {
+		return "", nil, ErrInvalidProfileRole
+	}
+	if ttl <= 0 {
+		ttl = invitationDefaultTTL
+	}
+	if ttl > invitationMaxTTL {
+		ttl = invitationMaxTTL
+	}
+	code, err := generateInvitationCode()
+	if err != nil {
+		return "", nil, err
+	}
+	inv := &models.ProfileInvitation{
+		HealthProfileID: profileID,
+		CodeHash:        sha256Hex(code),
+		Role:            role,
+		CreatedBy:       p.UserID,
+		ExpiresAt:       time.Now().Add(ttl),
+	}
+	if err := s.repo.CreateInvitation(ctx, inv); err != nil {
+		return "", nil, err
+	}
+	return code, inv, nil
+}
+
+// ListInvitations 拥有者查看档案的邀请记录
+func (s *ProfileSharingService) ListInvitations(ctx context.Context, p *Principal, profileID int) ([]models.ProfileInvitation, error) {
+	if err := s.requireOwner(ctx, p, profileID); err != nil {
+		return nil, err
+	}
+	return s.repo.ListInvitations(ctx, profileID)
+}
+
+// RevokeInvitation 拥有者撤销尚未使用的邀请
+func (s *ProfileSharingService) RevokeInvitation(ctx context.Context, p *Principal, profileID int, invitationID int64) error {
+	if err := s.requireOwner(ctx, p, profileID); err != nil {
+		return err
+	}
+	ok, err := s.repo.RevokeInvitation(ctx, profileID, invitationID)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return ErrProfileInvitationGone
+	}
+	return nil
+}
+
+// RedeemInvitation App 用户使用邀请码申请加入档案，需拥有者批准后生效
+func (s *ProfileSharingService) RedeemInvitation(ctx context.Context, p *Principal, code string) (*models.ProfileMember, error) {
+	if p == nil || p.UserType != models.UserTypeApp {
+		return nil, ErrProfileForbidden
+	}
+	code = strings.ToUpper(strings.TrimSpace(code))
+	inv, err := s.repo.GetInvitationByCodeHash(ctx, sha256Hex(code))
+	if err != nil {
+		return nil, err
+	}
+	if inv == nil || inv.Status != models.ProfileInvitationPending || inv.ExpiresAt.Before(time.Now()) {
+		return nil, ErrInvalidInvitation
+	}
+	existing, err := s.repo.GetMember(ctx, inv.HealthProfileID, p.UserID)
+	if err != nil {
+		return nil, err
+	}
+	if existing != nil {
+		return nil, ErrAlreadyProfileMember
+	}
+	member, err := s.repo.RedeemInvitation(ctx, inv, p.UserID)
+	if errors.Is(err, postgres.ErrInvitationUnavailable) {
+		return nil, ErrInvalidInvitation
+	}
+	return member, err
+}
+
+// ListMembers 档案成员列表，任意有效成员可查看
+func (s *ProfileSharingService) ListMembers(ctx context.Context, p *Principal, profileID int) ([]models.ProfileMember, error) {
+	if err := s.Authorize(ctx, p, profileID, models.ProfileRoleViewer); err != nil {
+		return nil, err
+	}
+	return s.repo.ListMembers(ctx, profileID)
+}
+
+// ApproveMember 拥有者批准待加入成员
+func (s *ProfileSharingService) ApproveMember(ctx context.Context, p *Principal, profileID int, memberID int64) (*models.ProfileMember, error) {
+	if err := s.requireAppOwner(ctx, p, profileID); err != nil {
+		return nil, err
+	}
+	member, err := s.memberOf(ctx, profileID, memberID)
+	if err != nil {
+		return nil, err
+	}
+	ok, err := s.repo.ApproveMember(ctx, memberID, p.UserID)
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return nil, ErrMemberNotPending
+	}
+	return s.repo.GetMemberByID(ctx, member.ID)
+}
+
+// RevokeMember 拥有者移除成员或拒绝申请；成员也可主动退出。拥有者本身不可被移除
+func (s *ProfileSharingService) RevokeMember(ctx context.Context, p *Principal, profileID int, memberID int64) error {
+	if p == nil {
+		return ErrProfileUnauthenticated
+	}
+	member, err := s.memberOf(ctx, profileID, memberID)
+	if err != nil {
+		return err
+	}
+	if member.Role == models.ProfileRoleOwner {
+		return ErrCannotRevokeOwner
+	}
+	selfLeave := p.UserType == models.UserTypeApp && p.UserID == member.UserID
+	if !selfLeave {
+		if err := s.requireOwner(ctx, p, profileID); err != nil {
+			return err
+		}
+	}
+	if _, err := s.repo.RevokeMember(ctx, memberID); err != nil {
+		return err
+	}
+	return nil
+}
+
+// requireOwner 成员管理仅限档案拥有者（管理员同样放行，便于运维处理）
+func (s *ProfileSharingService) requireOwner(ctx context.Context, p *Principal, profileID int) error {
+	return s.Authorize(ctx, p, profileID, models.ProfileRoleOwner)
+}
+
+// requireAppOwner 邀请与批准代表家属授权同意，只能由拥有者本人操作，管理员不可代办
+func (s *ProfileSharingService) requireAppOwner(ctx context.Context, p *Principal, profileID int) error {
+	if p != nil && p.IsAdmin() {
+		return ErrProfileForbidden
+	}
+	return s.requireOwner(ctx, p, profileID)
+}
+
+func (s *ProfileSharingService) memberOf(ctx context.Context, profileID int, memberID int64) (*models.ProfileMember, error) {
+	member, err := s.repo.GetMemberByID(ctx, memberID)
+	if err != nil {
+		return nil, err
+	}
+	if member == nil || member.HealthProfileID != profileID || member.Status == models.ProfileMemberRevoked {
+		return nil, ErrProfileMemberNotFound
+	}
+	return member, nil
+}
+
+func generateInvitationCode() (string, error) {
+	b := make([]byte, invitationCodeLength)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	for i := range b {
+		b[i] = invitationCodeAlpha[int(b[i])%len(invitationCodeAlpha)]
+	}
+	return string(b), nil
+}
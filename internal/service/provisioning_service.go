@@ -0,0 +1,281 @@
+// Package service 设备自动注册（待注册设备批准与批量导入）
+package service
+
+import (
+	"context"
+	"database/sql"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/fire-disposal/health_DT_go/internal/models"
+	"github.com/fire-disposal/health_DT_go/internal/repository/postgres"
+	"github.com/fire-disposal/health_DT_go/internal/tenant"
+	"go.uber.org/zap"
+)
+
+const (
+	pendingDeviceLimit       = 10000            // 待注册列表上限，超出后不再记录新序列号
+	observeTrackLimit        = 100000           // 节流记录跟踪的序列号上限，伪造序列号刷上行时不再记录新序列号
+	pendingObserveInterval   = time.Minute      // 同一未注册序列号的记录间隔
+	registeredObserveTTL     = 10 * time.Minute // 已注册序列号的检查间隔
+	pendingListLimit         = 500
+	provisionBatchLimit      = 1000
+	deviceImportRowLimit     = 5000
+	deviceSerialNumberMaxLen = 64
+)
+
+var (
+	ErrInvalidProvisioning = errors.New("设备注册参数错误")
+	ErrDeviceImportFormat  = errors.New("CSV 格式错误")
+)
+
+// ApproveDeviceItem 批准注册的单台设备，device_type 为空时使用批量请求的默认类型，name 为空时使用序列号
+type ApproveDeviceItem struct {
+	SerialNumber string `json:"serial_number" binding:"required"`
+	DeviceType   string `json:"device_type"`
+	Name         string `json:"name"`
+}
+
+// ApproveDevicesInput 批量批准待注册设备参数
+type ApproveDevicesInput struct {
+	OrgID      int
+	DeviceType string
+	Devices    []ApproveDeviceItem
+}
+
+// ProvisioningService 设备自动注册服务：未注册序列号在 MQTT / msgpack 上行时记入待注册列表（记录首次与最近上行信息），
+// 管理员批量批准后注册到所属组织并签发密钥；也支持从 CSV 批量导入设备
+type ProvisioningService struct {
+	repo       *postgres.PendingDeviceRepository
+	devices    *postgres.DevicesRepository
+	deviceAuth *DeviceAuthService
+
+	mu   sync.Mutex
+	next map[string]time.Time // 序列号 -> 下次检查时间，避免每条消息查库
+}
+
+// NewProvisioningService 构造设备自动注册服务，deviceAuth 可为 nil
+func NewProvisioningService(repo *postgres.PendingDeviceRepository, devices *postgres.DevicesRepository,
+	deviceAuth *DeviceAuthService) *ProvisioningService {
+	return &ProvisioningService{repo: repo, devices: devices, deviceAuth: deviceAuth, next: make(map[string]time.Time)}
+}
+
+// Observe 记录设备上行：序列号未注册时写入待注册列表。source 为 mqtt / msgpack / http，detail 为主题类型、对端地址或上报数据类型。
+// 同一序列号按间隔节流，失败仅记录日志，不影响上行处理
+func (s *ProvisioningService) Observe(source, sn, detail string) {
+	if sn == "" || len(sn) > deviceSerialNumberMaxLen {
+		return
+	}
+	now := time.Now()
+	s.mu.Lock()
+	if now.Before(s.next[sn]) {
+		s.mu.Unlock()
+		return
+	}
+	if _, tracked := s.next[sn]; !tracked && len(s.next) >= observeTrackLimit {
+		for k, t := range s.next {
+			if now.After(t) {
+				delete(s.next, k)
+			}
+		}
+		if len(s.next) >= observeTrackLimit {
+			s.mu.Unlock()
+			return
+		}
+	}
+	s.next[sn] = now.Add(pendingObserveInterval)
+	s.mu.Unlock()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	_, err := s.devices.GetBySerialNumber(ctx, sn)
+	if err == nil {
+		s.mu.Lock()
+		s.next[sn] = now.Add(registeredObserveTTL)
+		s.mu.Unlock()
+		return
+	}
+	if errors.Is(err, sql.ErrNoRows) {
+		if len(detail) > 128 {
+			detail = detail[:128]
+		}
+		err = s.repo.Upsert(ctx, sn, source, detail, pendingDeviceLimit)
+	}
+	if err != nil {
+		zap.L().Warn("待注册设备记录失败", zap.String("sn", sn), zap.Error(err))
+	}
+}
+
+// Pending 待注册设备列表（最近上行在前，最多 500 条）
+func (s *ProvisioningService) Pending(ctx context.Context) ([]models.PendingDevice, error) {
+	return s.repo.List(ctx, pendingListLimit)
+}
+
+// Approve 批量批准待注册设备：逐台注册到所属组织并签发密钥，单台失败不影响其他设备；
+// 序列号须在待注册列表内，注册成功后从列表移除
+func (s *ProvisioningService) Approve(ctx context.Context, in ApproveDevicesInput) ([]models.DeviceProvisionResult, error) {
+	if len(in.Devices) == 0 || len(in.Devices) > provisionBatchLimit {
+		return nil, fmt.Errorf("%w: devices 数量须在 1-%d 之间", ErrInvalidProvisioning, provisionBatchLimit)
+	}
+	sns := make([]string, 0, len(in.Devices))
+	for _, d := range in.Devices {
+		sns = append(sns, strings.TrimSpace(d.SerialNumber))
+	}
+	pending, err := s.repo.Existing(ctx, sns)
+	if err != nil {
+		return nil, err
+	}
+	orgID := tenant.OrgForCreate(ctx, in.OrgID)
+	results := make([]models.DeviceProvisionResult, 0, len(in.Devices))
+	for i, d := range in.Devices {
+		sn := sns[i]
+		deviceType := strings.TrimSpace(d.DeviceType)
+		if deviceType == "" {
+			deviceType = strings.TrimSpace(in.DeviceType)
+		}
+		if !pending[sn] {
+			results = append(results, models.DeviceProvisionResult{SerialNumber: sn, Error: "不在待注册列表中"})
+			continue
+		}
+		results = append(results, s.register(ctx, orgID, sn, deviceType, d.Name))
+	}
+	s.removePending(ctx, results)
+	return results, nil
+}
+
+// Dismiss 从待注册列表移除序列号（设备再次上行时会重新记录），返回移除数量
+func (s *ProvisioningService) Dismiss(ctx context.Context, sns []string) (int64, error) {
+	if len(sns) == 0 || len(sns) > provisionBatchLimit {
+		return 0, fmt.Errorf("%w: serial_numbers 数量须在 1-%d 之间", ErrInvalidProvisioning, provisionBatchLimit)
+	}
+	return s.repo.Delete(ctx, sns)
+}
+
+// Import 从 CSV 批量导入设备，每行 serial_number,device_type[,name]，首行为表头时跳过；
+// 逐行注册，单行失败不影响其他行。CSV 本身无法解析时返回 ErrDeviceImportFormat
+func (s *ProvisioningService) Import(ctx context.Context, orgID int, r io.Reader) ([]models.DeviceProvisionResult, error) {
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = -1
+	reader.TrimLeadingSpace = true
+	reader.ReuseRecord = true
+	orgID = tenant.OrgForCreate(ctx, orgID)
+	seen := map[string]bool{}
+	var results []models.DeviceProvisionResult
+	for line := 1; ; line++ {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrDeviceImportFormat, err)
+		}
+		sn := strings.TrimSpace(strings.TrimPrefix(record[0], "\ufeff")) // 兼容带 BOM 的 Excel 导出
+		if line == 1 && strings.EqualFold(sn, "serial_number") {
+			continue
+		}
+		if len(record) == 1 && sn == "" {
+			continue // 空行
+		}
+		if len(results) >= deviceImportRowLimit {
+			return nil, fmt.Errorf("%w: 单次最多导入 %d 行", ErrDeviceImportFormat, deviceImportRowLimit)
+		}
+		result := models.DeviceProvisionResult{Line: line, SerialNumber: sn}
+		switch {
+		case len(record) < 2 || len(record) > 3:
+			result.Error = "列数须为 2-3（serial_number,device_type[,name]）"
+		case seen[sn]:
+			result.Error = "文件内序列号重复"
+		default:
+			seen[sn] = true
+			name := ""
+			if len(record) == 3 {
+				name = record[2]
+			}
+			result = s.register(ctx, orgID, sn, strings.TrimSpace(record[1]), name)
+			result.Line = line
+		}
+		results = append(results, result)
+	}
+	if len(results) == 0 {
+		return nil, fmt.Errorf("%w: 文件不含设备", ErrDeviceImportFormat)
+	}
+	s.removePending(ctx, results)
+	return results, nil
+}
+
+// register 注册单台设备并签发密钥，错误写入结果
+func (s *ProvisioningService) register(ctx context.Context, orgID int, sn, deviceType, name string) models.DeviceProvisionResult {
+	result := models.DeviceProvisionResult{SerialNumber: sn}
+	name = strings.TrimSpace(name)
+	if name == "" {
+		name = sn
+	}
+	switch {
+	case sn == "" || len(sn) > deviceSerialNumberMaxLen:
+		result.Error = fmt.Sprintf("序列号不能为空且不超过 %d 字符", deviceSerialNumberMaxLen)
+		return result
+	case deviceType == "" || len(deviceType) > 64:
+		result.Error = "device_type 不能为空且不超过 64 字符"
+		return result
+	case len(name) > 128:
+		result.Error = "name 不超过 128 字符"
+		return result
+	}
+	if _, err := s.devices.GetBySerialNumber(ctx, sn); err == nil {
+		result.Error = "序列号已注册"
+		return result
+	} else if !errors.Is(err, sql.ErrNoRows) {
+		result.Error = err.Error()
+		return result
+	}
+	secret, err := generateDeviceSecret()
+	if err != nil {
+		result.Error = err.Error()
+		return result
+	}
+	now := time.Now()
+	id, err := s.devices.Create(ctx, &models.Device{
+		OrgID:        orgID,
+		SerialNumber: sn,
+		Name:         name,
+		DeviceType:   deviceType,
+		IsActive:     true,
+		SecretKey:    secret,
+		CreatedAt:    now,
+		UpdatedAt:    now,
+	})
+	if err != nil {
+		result.Error = err.Error()
+		return result
+	}
+	if s.deviceAuth != nil {
+		s.deviceAuth.Forget(sn)
+	}
+	s.mu.Lock()
+	delete(s.next, sn)
+	s.mu.Unlock()
+	result.DeviceID = id
+	result.DeviceSecret = secret
+	return result
+}
+
+// removePending 将注册成功的序列号移出待注册列表
+func (s *ProvisioningService) removePending(ctx context.Context, results []models.DeviceProvisionResult) {
+	var registered []string
+	for _, r := range results {
+		if r.DeviceID > 0 {
+			registered = append(registered, r.SerialNumber)
+		}
+	}
+	if len(registered) == 0 {
+		return
+	}
+	if _, err := s.repo.Delete(ctx, registered); err != nil {
+		zap.L().Error("待注册设备移除失败", zap.Int("count", len(registered)), zap.Error(err))
+	}
+}
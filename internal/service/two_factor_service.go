@@ -0,0 +1,325 @@
+// Package service 管理员两步验证（TOTP）业务逻辑
+package service
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"strconv"
+	"time"
+
+	"github.com/fire-disposal/health_DT_go/internal/auth"
+	"github.com/fire-disposal/health_DT_go/internal/models"
+	"github.com/fire-disposal/health_DT_go/internal/repository/postgres"
+)
+
+const (
+	totpIssuer          = "HealthDT"
+	loginChallengeTTL   = 5 * time.Minute // 登录挑战有效期
+	loginChallengeTries = 5               // 登录挑战最大尝试次数
+	loginChallengeLive  = 3               // 单个管理员同时有效的登录挑战上限，超出时作废最早的挑战
+	recoveryCodeCount   = 10              // 恢复码数量
+)
+
+var (
+	ErrInvalid2FACode       = errors.New("两步验证码错误")
+	ErrInvalidChallenge     = errors.New("登录挑战无效或已过期")
+	Err2FAAlreadyEnabled    = errors.New("两步验证已启用")
+	Err2FANotEnabled        = errors.New("两步验证未启用")
+	Err2FARequiredByPolicy  = errors.New("系统要求管理员必须启用两步验证，无法关闭")
+	ErrNoPendingEnrollment  = errors.New("请先发起两步验证绑定")
+	ErrEnrollmentInProgress = errors.New("该登录需先完成两步验证绑定")
+)
+
+// TOTPEnrollment 绑定信息，secret 仅在绑定时返回一次
+type TOTPEnrollment struct {
+	Secret string `json:"secret"`
+	URI    string `json:"otpauth_uri"`
+}
+
+// TwoFactorStatus 两步验证状态
+type TwoFactorStatus struct {
+	Enabled           bool `json:"enabled"`
+	Required          bool `json:"required"`
+	RecoveryCodesLeft int  `json:"recovery_codes_left"`
+}
+
+// TwoFactorService 两步验证服务
+type TwoFactorService struct {
+	repo      postgres.TwoFactorRepository
+	settings  postgres.SettingsRepository
+	adminRepo postgres.AdminUserRepository
+}
+
+// NewTwoFactorService 构造两步验证服务
+func NewTwoFactorService(repo postgres.TwoFactorRepository, settings postgres.SettingsRepository,
+	adminRepo postgres.AdminUserRepository) *TwoFactorService {
+	return &TwoFactorService{repo: repo, settings: settings, adminRepo: adminRepo}
+}
+
+// IsRequired 是否强制所有管理员启用两步验证
+func (s *TwoFactorService) IsRequired(ctx context.Context) (bool, error) {
+	value, ok, err := s.settings.Get(ctx, models.SettingRequireAdmin2FA)
+	if err != nil || !ok {
+		return false, err
+	}
+	required, _ := strconv.ParseBool(value)
+	return required, nil
+}
+
+// SetRequired 设置是否强制所有管理员启用两步验证（仅平台管理员）
+func (s *TwoFactorService) SetRequired(ctx context.Context, required bool, updatedBy int64) error {
+	return s.settings.Set(ctx, models.SettingRequireAdmin2FA, strconv.FormatBool(required), updatedBy)
+}
+
+// Status 查询管理员两步验证状态
+func (s *TwoFactorService) Status(ctx context.Context, adminID int64) (*TwoFactorStatus, error) {
+	required, err := s.IsRequired(ctx)
+	if err != nil {
+		return nil, err
+	}
+	status := &TwoFactorStatus{Required: required}
+	totp, err := s.repo.GetTOTP(ctx, adminID)
+	if err != nil {
+		return nil, err
+	}
+	if totp != nil && totp.Enabled {
+		status.Enabled = true
+		if status.RecoveryCodesLeft, err = s.repo.CountRecoveryCodes(ctx, adminID); err != nil {
+			return nil, err
+		}
+	}
+	return status, nil
+}
+
+// BeginEnrollment 生成待验证密钥与 otpauth URI，需调用 ConfirmEnrollment 完成绑定
+func (s *TwoFactorService) BeginEnrollment(ctx context.Context, adminID int64) (*TOTPEnrollment, error) {
+	totp, err := s.repo.GetTOTP(ctx, adminID)
+	if err != nil {
+		return nil, err
+	}
+	if totp != nil && totp.Enabled {
+		return nil, Err2FAAlreadyEnabled
+	}
+	admin, err := s.adminRepo.GetByID(ctx, adminID)
+	if err != nil {
+		return nil, err
+	}
+	if admin == nil {
+		return nil, ErrAdminUserNotFound
+	}
+	secret, err := auth.GenerateTOTPSecret()
+	if err != nil {
+		return nil, err
+	}
+	if err := s.repo.SetPendingSecret(ctx, adminID, secret); err != nil {
+		return nil, err
+	}
+	return &TOTPEnrollment{Secret: secret, URI: auth.TOTPURI(totpIssuer, admin.Username, secret)}, nil
+}
+
+// ConfirmEnrollment 校验待验证密钥生成的验证码，启用两步验证并返回恢复码
+func (s *TwoFactorService) ConfirmEnrollment(ctx context.Context, adminID int64, code string) ([]string, error) {
+	totp, err := s.repo.GetTOTP(ctx, adminID)
+	if err != nil {
+		return nil, err
+	}
+	if totp == nil || totp.PendingSecret == "" {
+		return nil, ErrNoPendingEnrollment
+	}
+	step, ok := auth.ValidateTOTP(totp.PendingSecret, code, time.Now())
+	if !ok {
+		return nil, ErrInvalid2FACode
+	}
+	if err := s.repo.Enable(ctx, adminID, step); err != nil {
+		return nil, err
+	}
+	return s.issueRecoveryCodes(ctx, adminID)
+}
+
+// Disable 关闭两步验证，需提供有效验证码；系统强制启用时拒绝
+func (s *TwoFactorService) Disable(ctx context.Context, adminID int64, code string) error {
+	required, err := s.IsRequired(ctx)
+	if err != nil {
+		return err
+	}
+	if required {
+		return Err2FARequiredByPolicy
+	}
+	if err := s.verify(ctx, adminID, code, ""); err != nil {
+		return err
+	}
+	return s.repo.Disable(ctx, adminID)
+}
+
+// RegenerateRecoveryCodes 重新生成恢复码，旧恢复码全部作废
+func (s *TwoFactorService) RegenerateRecoveryCodes(ctx context.Context, adminID int64, code string) ([]string, error) {
+	if err := s.verify(ctx, adminID, code, ""); err != nil {
+		return nil, err
+	}
+	return s.issueRecoveryCodes(ctx, adminID)
+}
+
+// NeedsChallenge 判断管理员登录是否需要两步验证（已启用或系统强制）
+func (s *TwoFactorService) NeedsChallenge(ctx context.Context, adminID int64) (bool, error) {
+	totp, err := s.repo.GetTOTP(ctx, adminID)
+	if err != nil {
+		return false, err
+	}
+	if totp != nil && totp.Enabled {
+		return true, nil
+	}
+	return s.IsRequired(ctx)
+}
+
+// CreateChallenge 创建登录挑战，返回挑战令牌及是否需要先绑定
+func (s *TwoFactorService) CreateChallenge(ctx context.Context, adminID int64) (string, bool, error) {
+	token, err := randomHex(32)
+	if err != nil {
+		return "", false, err
+	}
+	challenge := &models.LoginChallenge{
+		TokenHash: sha256Hex(token),
+		AdminID:   adminID,
+		ExpiresAt: time.Now().Add(loginChallengeTTL),
+	}
+	if err := s.repo.CreateChallenge(ctx, challenge, loginChallengeLive); err != nil {
+		return "", false, err
+	}
+	totp, err := s.repo.GetTOTP(ctx, adminID)
+	if err != nil {
+		return "", false, err
+	}
+	return token, totp == nil || !totp.Enabled, nil
+}
+
+// BeginChallengeEnrollment 在登录挑战中发起绑定（系统强制但尚未绑定的管理员）
+func (s *TwoFactorService) BeginChallengeEnrollment(ctx context.Context, challengeToken string) (*TOTPEnrollment, error) {
+	challenge, err := s.loadChallenge(ctx, challengeToken)
+	if err != nil {
+		return nil, err
+	}
+	return s.BeginEnrollment(ctx, challenge.AdminID)
+}
+
+// ChallengeAdmin 返回有效登录挑战所属的管理员ID（不计尝试次数），用于按账号限流
+func (s *TwoFactorService) ChallengeAdmin(ctx context.Context, challengeToken string) (int64, error) {
+	challenge, err := s.loadChallenge(ctx, challengeToken)
+	if err != nil {
+		return 0, err
+	}
+	return challenge.AdminID, nil
+}
+
+// ResolveChallenge 校验登录挑战的验证码或恢复码，成功返回管理员ID；
+// 若本次挑战完成了绑定，同时返回新生成的恢复码。校验前先原子地计入一次尝试，并发请求也无法超出尝试上限
+func (s *TwoFactorService) ResolveChallenge(ctx context.Context, challengeToken, code, recoveryCode string) (int64, []string, error) {
+	if challengeToken == "" {
+		return 0, nil, ErrInvalidChallenge
+	}
+	challenge, err := s.repo.ClaimChallengeAttempt(ctx, sha256Hex(challengeToken), loginChallengeTries)
+	if err != nil {
+		return 0, nil, err
+	}
+	if challenge == nil || challenge.ExpiresAt.Before(time.Now()) {
+		return 0, nil, ErrInvalidChallenge
+	}
+	totp, err := s.repo.GetTOTP(ctx, challenge.AdminID)
+	if err != nil {
+		return 0, nil, err
+	}
+
+	var recoveryCodes []string
+	if totp != nil && totp.Enabled {
+		err = s.verify(ctx, challenge.AdminID, code, recoveryCode)
+	} else {
+		if totp == nil || totp.PendingSecret == "" {
+			return 0, nil, ErrEnrollmentInProgress
+		}
+		recoveryCodes, err = s.ConfirmEnrollment(ctx, challenge.AdminID, code)
+	}
+	if err != nil {
+		return 0, nil, err
+	}
+	if err := s.repo.DeleteChallenge(ctx, challenge.ID); err != nil {
+		return 0, nil, err
+	}
+	return challenge.AdminID, recoveryCodes, nil
+}
+
+func (s *TwoFactorService) loadChallenge(ctx context.Context, token string) (*models.LoginChallenge, error) {
+	if token == "" {
+		return nil, ErrInvalidChallenge
+	}
+	challenge, err := s.repo.GetChallengeByTokenHash(ctx, sha256Hex(token))
+	if err != nil {
+		return nil, err
+	}
+	if challenge == nil || challenge.ExpiresAt.Before(time.Now()) || challenge.Attempts >= loginChallengeTries {
+		return nil, ErrInvalidChallenge
+	}
+	return challenge, nil
+}
+
+// verify 校验 TOTP 验证码（带防重放）或恢复码（一次性）
+func (s *TwoFactorService) verify(ctx context.Context, adminID int64, code, recoveryCode string) error {
+	totp, err := s.repo.GetTOTP(ctx, adminID)
+	if err != nil {
+		return err
+	}
+	if totp == nil || !totp.Enabled {
+		return Err2FANotEnabled
+	}
+	if recoveryCode != "" {
+		ok, err := s.repo.UseRecoveryCode(ctx, adminID, sha256Hex(auth.NormalizeRecoveryCode(recoveryCode)))
+		if err != nil {
+			return err
+		}
+		if !ok {
+			return ErrInvalid2FACode
+		}
+		return nil
+	}
+	step, ok := auth.ValidateTOTP(totp.Secret, code, time.Now())
+	if !ok {
+		return ErrInvalid2FACode
+	}
+	consumed, err := s.repo.ConsumeStep(ctx, adminID, step)
+	if err != nil {
+		return err
+	}
+	if !consumed {
+		return ErrInvalid2FACode
+	}
+	return nil
+}
+
+func (s *TwoFactorService) issueRecoveryCodes(ctx context.Context, adminID int64) ([]string, error) {
+	codes, err := auth.GenerateRecoveryCodes(recoveryCodeCount)
+	if err != nil {
+		return nil, err
+	}
+	hashes := make([]string, len(codes))
+	for i, c := range codes {
+		hashes[i] = sha256Hex(auth.NormalizeRecoveryCode(c))
+	}
+	if err := s.repo.ReplaceRecoveryCodes(ctx, adminID, hashes); err != nil {
+		return nil, err
+	}
+	return codes, nil
+}
+
+func randomHex(n int) (string, error) {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+func sha256Hex(s string) string {
+	sum := sha256.Sum256([]byte(s))
+	return hex.EncodeToString(sum[:])
+}
@@ -76,6 +76,9 @@ func (s *UserService) Register(ctx context.Context, user *models.AppUser, passwo
 	if s.Repo == nil {
 		return errors.New("UserRepo未初始化")
 	}
+	if err := DefaultPasswordPolicy.Validate(password, user.Username); err != nil {
+		return err
+	}
 	user.CreatedAt = time.Now()
 	user.UpdatedAt = time.Now()
 	return s.Repo.Register(ctx, user, password)
@@ -0,0 +1,57 @@
+// Package tenant 多租户（组织）上下文
+//
+// HTTP 认证中间件根据登录主体将租户范围写入 context，仓储层据此追加 org_id 过滤条件。
+// 未携带租户范围的 context 视为系统内部调用（MQTT/Msgpack 接入、命令行工具），不做组织限制。
+package tenant
+
+import (
+	"context"
+)
+
+// DefaultOrgID 默认组织，存量数据迁移及未指定组织时使用
+const DefaultOrgID = 1
+
+type scopeKey struct{}
+
+// Scope 调用方租户范围
+type Scope struct {
+	OrgID    int  // 限定的组织，0 表示不限组织
+	Platform bool // 平台级权限，可跨组织管理
+}
+
+// WithScope 写入租户范围
+func WithScope(ctx context.Context, s Scope) context.Context {
+	return context.WithValue(ctx, scopeKey{}, s)
+}
+
+// FromContext 读取租户范围
+func FromContext(ctx context.Context) (Scope, bool) {
+	s, ok := ctx.Value(scopeKey{}).(Scope)
+	return s, ok
+}
+
+// OrgFilter 返回需要过滤的组织ID；ok 为 false 表示不限组织
+func OrgFilter(ctx context.Context) (int, bool) {
+	s, ok := FromContext(ctx)
+	if !ok || s.OrgID <= 0 {
+		return 0, false
+	}
+	return s.OrgID, true
+}
+
+// IsPlatform 是否具备平台级权限；无租户范围的系统内部调用视同平台级
+func IsPlatform(ctx context.Context) bool {
+	s, ok := FromContext(ctx)
+	return !ok || s.Platform
+}
+
+// OrgForCreate 新建数据归属的组织：受限调用方固定为其所属组织，否则使用请求指定的组织，缺省为默认组织
+func OrgForCreate(ctx context.Context, requested int) int {
+	if orgID, ok := OrgFilter(ctx); ok {
+		return orgID
+	}
+	if requested > 0 {
+		return requested
+	}
+	return DefaultOrgID
+}
@@ -0,0 +1,31 @@
+// Package wechat 本地开发与测试用的微信登录替身
+package wechat
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"strings"
+)
+
+// FakeCodeInvalid 以此前缀开头的 code 视为无效授权码，便于联调错误分支
+const FakeCodeInvalid = "invalid"
+
+// FakeClient 不访问网络的微信客户端：同一 code 总是映射到同一 openid（"fake_" + code），
+// 本地可用固定 code 模拟同一微信用户反复登录
+type FakeClient struct{}
+
+// NewFakeClient 构造替身客户端
+func NewFakeClient() *FakeClient {
+	return &FakeClient{}
+}
+
+// Code2Session 按 code 生成确定的会话信息
+func (f *FakeClient) Code2Session(ctx context.Context, code string) (*Session, error) {
+	code = strings.TrimSpace(code)
+	if code == "" || strings.HasPrefix(code, FakeCodeInvalid) {
+		return nil, &APIError{Code: 40029, Msg: "invalid code"}
+	}
+	sum := sha256.Sum256([]byte(code))
+	return &Session{OpenID: "fake_" + code, SessionKey: hex.EncodeToString(sum[:16])}, nil
+}
@@ -0,0 +1,87 @@
+package wechat
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+func TestFakeClientCode2Session(t *testing.T) {
+	f := NewFakeClient()
+	ctx := context.Background()
+
+	first, err := f.Code2Session(ctx, "abc")
+	if err != nil {
+		t.Fatalf("Code2Session: %v", err)
+	}
+	if first.OpenID != "fake_abc" {
+		t.Fatalf("openid = %q, want fake_abc", first.OpenID)
+	}
+	if len(first.SessionKey) != 32 {
+		t.Fatalf("session_key 长度 = %d, want 32", len(first.SessionKey))
+	}
+
+	// 同一 code 映射到同一会话，首尾空白忽略
+	again, err := f.Code2Session(ctx, "  abc ")
+	if err != nil {
+		t.Fatalf("Code2Session: %v", err)
+	}
+	if *again != *first {
+		t.Fatalf("同一 code 结果不一致: %+v vs %+v", again, first)
+	}
+
+	other, err := f.Code2Session(ctx, "abd")
+	if err != nil {
+		t.Fatalf("Code2Session: %v", err)
+	}
+	if other.OpenID == first.OpenID || other.SessionKey == first.SessionKey {
+		t.Fatalf("不同 code 不应映射到同一会话: %+v", other)
+	}
+}
+
+func TestFakeClientInvalidCode(t *testing.T) {
+	f := NewFakeClient()
+	for _, code := range []string{"", "   ", FakeCodeInvalid, FakeCodeInvalid + "_123"} {
+		_, err := f.Code2Session(context.Background(), code)
+		if !errors.Is(err, ErrInvalidCode) {
+			t.Errorf("code %q: err = %v, want ErrInvalidCode", code, err)
+		}
+		var apiErr *APIError
+		if !errors.As(err, &apiErr) || apiErr.Code != 40029 {
+			t.Errorf("code %q: err = %v, want APIError 40029", code, err)
+		}
+	}
+}
+
+func TestNewMode(t *testing.T) {
+	tests := []struct {
+		name      string
+		cfg       Config
+		wantErr   bool
+		forbidden bool
+		fake      bool
+	}{
+		{name: "默认 http", cfg: Config{}},
+		{name: "http", cfg: Config{Mode: "http"}},
+		{name: "fake 未显式允许", cfg: Config{Mode: "fake"}, wantErr: true, forbidden: true},
+		{name: "fake 已允许", cfg: Config{Mode: "fake", AllowFake: true}, fake: true},
+		{name: "未知模式", cfg: Config{Mode: "mock", AllowFake: true}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client, err := New(tt.cfg)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("err = %v, wantErr %v", err, tt.wantErr)
+			}
+			if errors.Is(err, ErrFakeForbidden) != tt.forbidden {
+				t.Fatalf("err = %v, want ErrFakeForbidden %v", err, tt.forbidden)
+			}
+			if err != nil {
+				return
+			}
+			if _, isFake := client.(*FakeClient); isFake != tt.fake {
+				t.Fatalf("client = %T, fake = %v", client, tt.fake)
+			}
+		})
+	}
+}
@@ -0,0 +1,161 @@
+// Package wechat 微信小程序登录接口客户端
+//
+// Client 抽象 code2session 调用：HTTPClient 请求微信开放接口（可配置 BaseURL 与超时），
+// FakeClient 不依赖网络，供本地开发与测试使用；替身可伪造任意 openid 登录，须显式开启且不得用于生产。
+package wechat
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// DefaultBaseURL 微信开放接口地址
+const DefaultBaseURL = "https://api.weixin.qq.com"
+
+const defaultTimeout = 5 * time.Second
+
+var (
+	ErrNotConfigured = errors.New("微信登录未配置 appid/secret")
+	ErrInvalidCode   = errors.New("微信授权码无效")
+	ErrCodeUsed      = errors.New("微信授权码已被使用")
+	ErrRateLimited   = errors.New("微信接口调用频率受限")
+	ErrUnavailable   = errors.New("微信接口暂不可用")
+	ErrFakeForbidden = errors.New("微信替身客户端仅限开发环境：需设置 allow_fake 且不在 release 模式下运行")
+)
+
+// Session code2session 换取的会话信息
+type Session struct {
+	OpenID     string
+	UnionID    string
+	SessionKey string
+}
+
+// Client 微信登录接口
+type Client interface {
+	// Code2Session 用小程序 wx.login 返回的 code 换取 openid；
+	// 错误可通过 errors.Is 与 ErrInvalidCode / ErrCodeUsed / ErrRateLimited / ErrUnavailable 比较
+	Code2Session(ctx context.Context, code string) (*Session, error)
+}
+
+// APIError 微信接口返回的错误码
+type APIError struct {
+	Code int
+	Msg  string
+}
+
+func (e *APIError) Error() string {
+	return fmt.Sprintf("微信接口错误 %d: %s", e.Code, e.Msg)
+}
+
+// Unwrap 将微信错误码映射为包内错误
+func (e *APIError) Unwrap() error {
+	switch e.Code {
+	case 40029:
+		return ErrInvalidCode
+	case 40163:
+		return ErrCodeUsed
+	case 45011:
+		return ErrRateLimited
+	case -1:
+		return ErrUnavailable
+	}
+	return nil
+}
+
+// Config 客户端配置
+type Config struct {
+	Mode      string // http（默认）/ fake
+	AllowFake bool   // 是否允许 fake 模式，调用方应仅在非生产（非 release）运行时置为 true
+	AppID     string
+	Secret    string
+	BaseURL   string        // 为空时使用 DefaultBaseURL
+	Timeout   time.Duration // 为 0 时默认 5 秒
+}
+
+// New 按模式创建客户端
+func New(cfg Config) (Client, error) {
+	switch cfg.Mode {
+	case "", "http":
+		return NewHTTPClient(cfg), nil
+	case "fake":
+		if !cfg.AllowFake {
+			return nil, ErrFakeForbidden
+		}
+		return NewFakeClient(), nil
+	default:
+		return nil, fmt.Errorf("未知微信客户端模式: %s", cfg.Mode)
+	}
+}
+
+// HTTPClient 调用微信开放接口
+type HTTPClient struct {
+	appID   string
+	secret  string
+	baseURL string
+	http    *http.Client
+}
+
+// NewHTTPClient 构造微信接口客户端
+func NewHTTPClient(cfg Config) *HTTPClient {
+	baseURL := strings.TrimRight(cfg.BaseURL, "/")
+	if baseURL == "" {
+		baseURL = DefaultBaseURL
+	}
+	timeout := cfg.Timeout
+	if timeout <= 0 {
+		timeout = defaultTimeout
+	}
+	return &HTTPClient{
+		appID:   cfg.AppID,
+		secret:  cfg.Secret,
+		baseURL: baseURL,
+		http:    &http.Client{Timeout: timeout},
+	}
+}
+
+// Code2Session 请求 /sns/jscode2session
+func (c *HTTPClient) Code2Session(ctx context.Context, code string) (*Session, error) {
+	if c.appID == "" || c.secret == "" {
+		return nil, ErrNotConfigured
+	}
+	q := url.Values{}
+	q.Set("appid", c.appID)
+	q.Set("secret", c.secret)
+	q.Set("js_code", code)
+	q.Set("grant_type", "authorization_code")
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, c.baseURL+"/sns/jscode2session?"+q.Encode(), nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrUnavailable, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("%w: HTTP %d", ErrUnavailable, resp.StatusCode)
+	}
+	var body struct {
+		OpenID     string `json:"openid"`
+		UnionID    string `json:"unionid"`
+		SessionKey string `json:"session_key"`
+		ErrCode    int    `json:"errcode"`
+		ErrMsg     string `json:"errmsg"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		return nil, fmt.Errorf("%w: 响应解析失败: %v", ErrUnavailable, err)
+	}
+	if body.ErrCode != 0 {
+		return nil, &APIError{Code: body.ErrCode, Msg: body.ErrMsg}
+	}
+	if body.OpenID == "" {
+		return nil, fmt.Errorf("%w: 响应缺少 openid", ErrUnavailable)
+	}
+	return &Session{OpenID: body.OpenID, UnionID: body.UnionID, SessionKey: body.SessionKey}, nil
+}
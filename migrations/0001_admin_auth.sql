@@ -0,0 +1,23 @@
+-- ================================================
+-- 0001 登录 Token 区分管理员与 App 用户
+-- 管理员与 App 用户 ID 空间独立，登录 Token 增加 user_type。
+-- 存量 Token 无法判断归属，全部作废，用户需重新登录。
+-- ================================================
+BEGIN;
+
+CREATE TABLE IF NOT EXISTS auth (
+    id SERIAL PRIMARY KEY,
+    user_id INT NOT NULL,
+    token VARCHAR(128) NOT NULL UNIQUE,
+    expires_at TIMESTAMP NOT NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+ALTER TABLE auth ADD COLUMN IF NOT EXISTS user_type VARCHAR(16);
+DELETE FROM auth WHERE user_type IS NULL;
+ALTER TABLE auth ALTER COLUMN user_type SET NOT NULL;
+
+CREATE INDEX IF NOT EXISTS idx_auth_user ON auth(user_type, user_id);
+
+COMMIT;
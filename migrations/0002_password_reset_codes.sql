@@ -0,0 +1,19 @@
+-- ================================================
+-- 0002 密码找回验证码
+-- ================================================
+BEGIN;
+
+-- 密码重置验证码表，仅保存验证码哈希，单次有效
+CREATE TABLE IF NOT EXISTS password_reset_codes (
+    id SERIAL PRIMARY KEY,
+    user_type VARCHAR(16) NOT NULL,
+    user_id INT NOT NULL,
+    code_hash VARCHAR(64) NOT NULL,
+    attempts INT NOT NULL DEFAULT 0,
+    expires_at TIMESTAMP NOT NULL,
+    used_at TIMESTAMP,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+CREATE INDEX IF NOT EXISTS idx_password_reset_user ON password_reset_codes(user_type, user_id);
+
+COMMIT;
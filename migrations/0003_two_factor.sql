@@ -0,0 +1,45 @@
+-- ================================================
+-- 0003 管理员两步验证（TOTP、恢复码、登录挑战）与系统设置
+-- ================================================
+BEGIN;
+
+-- 管理员 TOTP 两步验证
+CREATE TABLE IF NOT EXISTS admin_totp (
+    admin_id INT PRIMARY KEY REFERENCES admin_users(id) ON DELETE CASCADE,
+    secret VARCHAR(64),          -- 已启用密钥（Base32）
+    pending_secret VARCHAR(64),  -- 绑定中、待验证的密钥
+    enabled BOOLEAN NOT NULL DEFAULT FALSE,
+    last_step BIGINT NOT NULL DEFAULT 0, -- 最近使用的时间步，防重放
+    enabled_at TIMESTAMP,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+-- 两步验证恢复码（仅存哈希，单次有效）
+CREATE TABLE IF NOT EXISTS admin_recovery_codes (
+    id SERIAL PRIMARY KEY,
+    admin_id INT NOT NULL REFERENCES admin_users(id) ON DELETE CASCADE,
+    code_hash VARCHAR(64) NOT NULL,
+    used_at TIMESTAMP,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+CREATE INDEX IF NOT EXISTS idx_admin_recovery_codes_admin ON admin_recovery_codes(admin_id);
+
+-- 管理员登录挑战（密码通过、等待两步验证）
+CREATE TABLE IF NOT EXISTS login_challenges (
+    id SERIAL PRIMARY KEY,
+    token_hash VARCHAR(64) NOT NULL UNIQUE,
+    admin_id INT NOT NULL REFERENCES admin_users(id) ON DELETE CASCADE,
+    attempts INT NOT NULL DEFAULT 0,
+    expires_at TIMESTAMP NOT NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+-- 系统设置（键值）
+CREATE TABLE IF NOT EXISTS system_settings (
+    key VARCHAR(64) PRIMARY KEY,
+    value TEXT NOT NULL,
+    updated_by INT,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+COMMIT;
@@ -0,0 +1,9 @@
+-- ================================================
+-- 0004 设备签名密钥
+-- 存量设备没有密钥，需通过 POST /api/v1/devices/:id/rotate_secret 签发后再开启 device_auth.required。
+-- ================================================
+BEGIN;
+
+ALTER TABLE devices ADD COLUMN IF NOT EXISTS secret_key VARCHAR(128); -- 设备签名密钥（HMAC-SHA256）
+
+COMMIT;
@@ -0,0 +1,34 @@
+-- ================================================
+-- 0005 审计日志（仅追加，hash 链防篡改）
+-- ================================================
+BEGIN;
+
+CREATE TABLE IF NOT EXISTS audit_logs (
+    id BIGSERIAL PRIMARY KEY,
+    actor_type VARCHAR(16) NOT NULL,             -- admin / app / api_key / anonymous
+    actor_id BIGINT,
+    action VARCHAR(32) NOT NULL,                 -- view / list / create / update / delete ...
+    resource_type VARCHAR(64) NOT NULL,
+    resource_id VARCHAR(64),
+    changes JSONB,                               -- 变更字段：{"字段": {"before": .., "after": ..}}
+    ip VARCHAR(64),
+    created_at TIMESTAMPTZ NOT NULL,
+    prev_hash CHAR(64) NOT NULL,
+    hash CHAR(64) NOT NULL UNIQUE
+);
+CREATE INDEX IF NOT EXISTS idx_audit_logs_resource ON audit_logs(resource_type, resource_id, created_at);
+CREATE INDEX IF NOT EXISTS idx_audit_logs_actor ON audit_logs(actor_type, actor_id, created_at);
+CREATE INDEX IF NOT EXISTS idx_audit_logs_time ON audit_logs(created_at);
+
+-- 禁止修改与删除审计日志
+CREATE OR REPLACE FUNCTION audit_logs_append_only() RETURNS TRIGGER AS $$
+BEGIN
+    RAISE EXCEPTION 'audit_logs 为只追加表，禁止 %', TG_OP;
+END;
+$$ LANGUAGE plpgsql;
+DROP TRIGGER IF EXISTS trg_audit_logs_append_only ON audit_logs;
+CREATE TRIGGER trg_audit_logs_append_only
+    BEFORE UPDATE OR DELETE ON audit_logs
+    FOR EACH ROW EXECUTE FUNCTION audit_logs_append_only();
+
+COMMIT;
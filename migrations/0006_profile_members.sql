@@ -0,0 +1,44 @@
+-- ================================================
+-- 0006 健康档案成员与共享邀请
+-- 存量档案的 health_profiles.user_id 迁移为拥有者成员。
+-- ================================================
+BEGIN;
+
+-- 健康档案共享邀请（邀请码仅存哈希，单次有效）
+CREATE TABLE IF NOT EXISTS profile_invitations (
+    id BIGSERIAL PRIMARY KEY,
+    health_profile_id INT NOT NULL REFERENCES health_profiles(id) ON DELETE CASCADE,
+    code_hash CHAR(64) NOT NULL UNIQUE,
+    role VARCHAR(16) NOT NULL,                   -- caregiver / viewer
+    status VARCHAR(16) NOT NULL DEFAULT 'pending', -- pending / redeemed / revoked
+    created_by INT NOT NULL REFERENCES app_users(id) ON DELETE CASCADE,
+    redeemed_by INT REFERENCES app_users(id) ON DELETE SET NULL,
+    redeemed_at TIMESTAMP,
+    expires_at TIMESTAMP NOT NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+CREATE INDEX IF NOT EXISTS idx_profile_invitations_profile ON profile_invitations(health_profile_id, status);
+
+-- 健康档案成员（owner / caregiver / viewer），取代 health_profiles.user_id 的单一归属
+CREATE TABLE IF NOT EXISTS profile_members (
+    id BIGSERIAL PRIMARY KEY,
+    health_profile_id INT NOT NULL REFERENCES health_profiles(id) ON DELETE CASCADE,
+    user_id INT NOT NULL REFERENCES app_users(id) ON DELETE CASCADE,
+    role VARCHAR(16) NOT NULL,
+    status VARCHAR(16) NOT NULL,                 -- pending / active / revoked
+    invitation_id BIGINT REFERENCES profile_invitations(id) ON DELETE SET NULL,
+    approved_by INT REFERENCES app_users(id) ON DELETE SET NULL,
+    approved_at TIMESTAMP,
+    revoked_at TIMESTAMP,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+-- 同一用户在同一档案下最多一条有效成员关系
+CREATE UNIQUE INDEX IF NOT EXISTS uq_profile_members_live ON profile_members(health_profile_id, user_id) WHERE status <> 'revoked';
+CREATE INDEX IF NOT EXISTS idx_profile_members_user ON profile_members(user_id, status);
+
+-- 存量数据：health_profiles.user_id 迁移为拥有者成员
+INSERT INTO profile_members (health_profile_id, user_id, role, status, approved_at)
+SELECT id, user_id, 'owner', 'active', CURRENT_TIMESTAMP FROM health_profiles WHERE user_id IS NOT NULL
+ON CONFLICT DO NOTHING;
+
+COMMIT;
@@ -0,0 +1,50 @@
+-- ================================================
+-- 0007 组织（多租户）
+-- 新建 organizations 表，为管理员、设备、健康档案、告警与审计日志增加 org_id，
+-- 存量数据全部归入默认组织（id = 1）。新库直接使用 docs/new3.sql，无需执行本脚本。
+-- ================================================
+BEGIN;
+
+CREATE TABLE IF NOT EXISTS organizations (
+    id SERIAL PRIMARY KEY,
+    code VARCHAR(64) NOT NULL UNIQUE,
+    name VARCHAR(128) NOT NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+INSERT INTO organizations (id, code, name) VALUES (1, 'default', '默认组织') ON CONFLICT (id) DO NOTHING;
+SELECT setval('organizations_id_seq', (SELECT MAX(id) FROM organizations));
+
+-- ADD COLUMN ... DEFAULT 1 会将存量行填充为默认组织
+ALTER TABLE admin_users ADD COLUMN IF NOT EXISTS org_id INT NOT NULL DEFAULT 1 REFERENCES organizations(id);
+ALTER TABLE devices ADD COLUMN IF NOT EXISTS org_id INT NOT NULL DEFAULT 1 REFERENCES organizations(id);
+ALTER TABLE health_profiles ADD COLUMN IF NOT EXISTS org_id INT NOT NULL DEFAULT 1 REFERENCES organizations(id);
+ALTER TABLE alerts ADD COLUMN IF NOT EXISTS org_id INT NOT NULL DEFAULT 1 REFERENCES organizations(id);
+-- 审计日志只追加：存量记录 org_id 保持为空，hash 链不受影响
+ALTER TABLE audit_logs ADD COLUMN IF NOT EXISTS org_id INT REFERENCES organizations(id);
+
+CREATE INDEX IF NOT EXISTS idx_admin_users_org ON admin_users(org_id);
+CREATE INDEX IF NOT EXISTS idx_devices_org ON devices(org_id);
+CREATE INDEX IF NOT EXISTS idx_health_profiles_org ON health_profiles(org_id);
+CREATE INDEX IF NOT EXISTS idx_alerts_org ON alerts(org_id);
+CREATE INDEX IF NOT EXISTS idx_audit_logs_org ON audit_logs(org_id, created_at);
+
+CREATE OR REPLACE FUNCTION alerts_inherit_org() RETURNS TRIGGER AS $$
+BEGIN
+    SELECT org_id INTO NEW.org_id FROM devices WHERE id = NEW.device_id;
+    IF NEW.org_id IS NULL THEN
+        SELECT org_id INTO NEW.org_id FROM health_profiles WHERE id = NEW.health_profile_id;
+    END IF;
+    NEW.org_id := COALESCE(NEW.org_id, 1);
+    RETURN NEW;
+END;
+$$ LANGUAGE plpgsql;
+DROP TRIGGER IF EXISTS trg_alerts_inherit_org ON alerts;
+CREATE TRIGGER trg_alerts_inherit_org
+    BEFORE INSERT ON alerts
+    FOR EACH ROW EXECUTE FUNCTION alerts_inherit_org();
+
+-- 原超级管理员成为平台管理员，保证升级后仍可跨组织管理
+UPDATE admin_users SET role = 'platform_admin' WHERE role = 'superadmin';
+
+COMMIT;
@@ -0,0 +1,11 @@
+-- ================================================
+-- 0008 微信账号绑定
+-- 一个微信 openid 只能绑定一个 App 账号；空字符串统一置为 NULL。
+-- 执行前如有重复 openid，需先人工合并账号。
+-- ================================================
+BEGIN;
+
+UPDATE app_users SET wechat_openid = NULL WHERE wechat_openid = '';
+CREATE UNIQUE INDEX IF NOT EXISTS uq_app_users_wechat_openid ON app_users(wechat_openid) WHERE wechat_openid IS NOT NULL;
+
+COMMIT;
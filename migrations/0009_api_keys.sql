@@ -0,0 +1,23 @@
+-- ================================================
+-- 0009 第三方系统 API Key
+-- ================================================
+BEGIN;
+
+-- 第三方系统 API Key（组织级，仅存储 SHA256 哈希，前缀用于展示与查找）
+CREATE TABLE IF NOT EXISTS api_keys (
+    id BIGSERIAL PRIMARY KEY,
+    org_id INT NOT NULL REFERENCES organizations(id),
+    name VARCHAR(64) NOT NULL,
+    prefix VARCHAR(16) NOT NULL UNIQUE,           -- hdk_<8位标识>
+    key_hash CHAR(64) NOT NULL,
+    scopes TEXT[] NOT NULL,                       -- read:alerts / read:health_profiles / write:health_data
+    created_by INT REFERENCES admin_users(id) ON DELETE SET NULL,
+    expires_at TIMESTAMPTZ NOT NULL,
+    last_used_at TIMESTAMPTZ,
+    rotated_at TIMESTAMPTZ,
+    revoked_at TIMESTAMPTZ,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+CREATE INDEX IF NOT EXISTS idx_api_keys_org ON api_keys(org_id);
+
+COMMIT;
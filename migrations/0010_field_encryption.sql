@@ -0,0 +1,26 @@
+-- ================================================
+-- 0010 个人标识字段加密
+-- 放宽加密列类型并新增盲索引列；执行后须运行 go run ./cmd/reencrypt
+-- 加密历史数据并补齐盲索引（未补齐前按 openid / 手机号查找回退明文比较）。
+-- ================================================
+BEGIN;
+
+ALTER TABLE app_users
+    ALTER COLUMN email TYPE TEXT,
+    ALTER COLUMN phone TYPE TEXT,
+    ALTER COLUMN wechat_openid TYPE TEXT,
+    ADD COLUMN IF NOT EXISTS email_bidx CHAR(64),
+    ADD COLUMN IF NOT EXISTS phone_bidx CHAR(64),
+    ADD COLUMN IF NOT EXISTS wechat_openid_bidx CHAR(64);
+CREATE INDEX IF NOT EXISTS idx_app_users_email_bidx ON app_users(email_bidx);
+CREATE INDEX IF NOT EXISTS idx_app_users_phone_bidx ON app_users(phone_bidx);
+-- 密文每次加密结果不同，唯一约束改由盲索引保证
+DROP INDEX IF EXISTS uq_app_users_wechat_openid;
+CREATE UNIQUE INDEX IF NOT EXISTS uq_app_users_wechat_openid_bidx ON app_users(wechat_openid_bidx) WHERE wechat_openid_bidx IS NOT NULL;
+
+ALTER TABLE health_profiles
+    ALTER COLUMN name TYPE TEXT,
+    ALTER COLUMN birth_date TYPE TEXT USING to_char(birth_date, 'YYYY-MM-DD'),
+    ALTER COLUMN metadata TYPE TEXT USING metadata::text;
+
+COMMIT;
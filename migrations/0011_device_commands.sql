@@ -0,0 +1,26 @@
+-- ================================================
+-- 0011 设备下行指令
+-- ================================================
+BEGIN;
+
+-- 设备下行指令（device/{sn}/cmd/{name} 下发，device/{sn}/ack 按 request_id 回执）
+CREATE TABLE IF NOT EXISTS device_commands (
+    id BIGSERIAL PRIMARY KEY,
+    org_id INT NOT NULL REFERENCES organizations(id),
+    device_id INT NOT NULL REFERENCES devices(id) ON DELETE CASCADE,
+    request_id VARCHAR(32) NOT NULL UNIQUE,
+    name VARCHAR(64) NOT NULL,
+    params JSONB,
+    status VARCHAR(16) NOT NULL DEFAULT 'pending', -- pending / sent / acked / failed / timed_out
+    result JSONB,
+    error TEXT,
+    created_by INT REFERENCES admin_users(id) ON DELETE SET NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    sent_at TIMESTAMPTZ,
+    acked_at TIMESTAMPTZ,
+    expires_at TIMESTAMPTZ NOT NULL
+);
+CREATE INDEX IF NOT EXISTS idx_device_commands_device ON device_commands(device_id, created_at DESC);
+CREATE INDEX IF NOT EXISTS idx_device_commands_open ON device_commands(expires_at) WHERE status IN ('pending', 'sent');
+
+COMMIT;
@@ -0,0 +1,18 @@
+-- ================================================
+-- 0012 设备影子
+-- ================================================
+BEGIN;
+
+-- 设备影子（期望配置与设备上报状态）
+CREATE TABLE IF NOT EXISTS device_shadows (
+    device_id INT PRIMARY KEY REFERENCES devices(id) ON DELETE CASCADE,
+    org_id INT NOT NULL REFERENCES organizations(id),
+    desired JSONB NOT NULL DEFAULT '{}',
+    reported JSONB NOT NULL DEFAULT '{}',
+    version BIGINT NOT NULL DEFAULT 0,            -- 期望状态版本，每次修改加一
+    reported_version BIGINT NOT NULL DEFAULT 0,   -- 设备上报序号，只接受更大的值
+    desired_updated_at TIMESTAMPTZ,
+    reported_updated_at TIMESTAMPTZ
+);
+
+COMMIT;
@@ -0,0 +1,54 @@
+-- ================================================
+-- 0013 固件升级（OTA）
+-- ================================================
+BEGIN;
+
+-- 固件文件（存于本地磁盘，记录 SHA256）
+CREATE TABLE IF NOT EXISTS firmware_artifacts (
+    id SERIAL PRIMARY KEY,
+    org_id INT NOT NULL REFERENCES organizations(id),
+    device_type VARCHAR(64) NOT NULL,
+    version VARCHAR(64) NOT NULL,
+    file_name VARCHAR(255) NOT NULL,
+    file_path VARCHAR(512) NOT NULL,
+    size BIGINT NOT NULL,
+    sha256 CHAR(64) NOT NULL,
+    notes TEXT,
+    created_by BIGINT,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    UNIQUE (org_id, device_type, version)
+);
+
+-- 升级活动
+CREATE TABLE IF NOT EXISTS ota_campaigns (
+    id SERIAL PRIMARY KEY,
+    org_id INT NOT NULL REFERENCES organizations(id),
+    name VARCHAR(128) NOT NULL,
+    artifact_id INT NOT NULL REFERENCES firmware_artifacts(id),
+    from_versions TEXT[] NOT NULL DEFAULT '{}',        -- 为空表示除目标版本外的全部版本
+    rollout_percent INT NOT NULL DEFAULT 0,             -- 放量比例（0-100），只增不减
+    failure_threshold_percent INT NOT NULL DEFAULT 20,  -- 失败率达到该比例时自动暂停
+    min_samples INT NOT NULL DEFAULT 5,                 -- 计算失败率所需的最少完成设备数
+    status VARCHAR(16) NOT NULL DEFAULT 'draft',        -- draft / running / paused / completed / cancelled
+    pause_reason TEXT,
+    created_by BIGINT,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+CREATE INDEX IF NOT EXISTS idx_ota_campaigns_org ON ota_campaigns(org_id, created_at DESC);
+
+-- 升级活动中的设备
+CREATE TABLE IF NOT EXISTS ota_campaign_devices (
+    campaign_id INT NOT NULL REFERENCES ota_campaigns(id) ON DELETE CASCADE,
+    device_id INT NOT NULL REFERENCES devices(id) ON DELETE CASCADE,
+    from_version VARCHAR(64),
+    status VARCHAR(16) NOT NULL DEFAULT 'pending',      -- pending / sent / downloading / installing / succeeded / failed
+    progress INT NOT NULL DEFAULT 0,
+    error TEXT,
+    sent_at TIMESTAMPTZ,
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (campaign_id, device_id)
+);
+CREATE INDEX IF NOT EXISTS idx_ota_campaign_devices_device ON ota_campaign_devices(device_id);
+
+COMMIT;
@@ -0,0 +1,17 @@
+-- ================================================
+-- 0014 设备自动注册（待注册设备）
+-- ================================================
+BEGIN;
+
+-- 待注册设备（未注册序列号上行时记录，批准后删除）
+CREATE TABLE IF NOT EXISTS pending_devices (
+    serial_number VARCHAR(64) PRIMARY KEY,
+    source VARCHAR(16) NOT NULL,                  -- mqtt / msgpack
+    detail VARCHAR(128),                          -- MQTT 主题类型或 msgpack 对端地址
+    first_seen_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    last_seen_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    seen_count INT NOT NULL DEFAULT 1
+);
+CREATE INDEX IF NOT EXISTS idx_pending_devices_last_seen ON pending_devices(last_seen_at DESC);
+
+COMMIT;
@@ -0,0 +1,18 @@
+-- ================================================
+-- 0015 设备绑定持久化：每台设备仅一条有效绑定，保留历史
+-- ================================================
+BEGIN;
+
+ALTER TABLE device_assignments ADD COLUMN IF NOT EXISTS end_reason VARCHAR(16); -- unassigned / reassigned
+
+-- 同一设备存在多条有效绑定时仅保留最新一条，其余视为已被改绑
+UPDATE device_assignments a SET unassigned_at = NOW(), end_reason = 'reassigned'
+WHERE a.unassigned_at IS NULL AND EXISTS (
+    SELECT 1 FROM device_assignments b
+    WHERE b.device_id = a.device_id AND b.unassigned_at IS NULL
+      AND (b.assigned_at > a.assigned_at OR (b.assigned_at = a.assigned_at AND b.id > a.id))
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS uq_device_assignments_active ON device_assignments(device_id) WHERE unassigned_at IS NULL;
+
+COMMIT;
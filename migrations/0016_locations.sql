@@ -0,0 +1,26 @@
+-- ================================================
+-- 0016 位置层级（楼栋/楼层/房间/床位），设备放置与档案床位
+-- ================================================
+BEGIN;
+
+CREATE TABLE IF NOT EXISTS locations (
+    id SERIAL PRIMARY KEY,
+    org_id INT NOT NULL REFERENCES organizations(id),
+    parent_id INT REFERENCES locations(id),       -- 顶级楼栋为空；有下级时不可删除
+    kind VARCHAR(16) NOT NULL,                    -- building / floor / room / bed
+    name VARCHAR(64) NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+-- 同一上级下名称唯一
+CREATE UNIQUE INDEX IF NOT EXISTS uq_locations_name ON locations(org_id, COALESCE(parent_id, 0), name);
+CREATE INDEX IF NOT EXISTS idx_locations_parent ON locations(parent_id);
+
+ALTER TABLE devices ADD COLUMN IF NOT EXISTS location_id INT REFERENCES locations(id) ON DELETE SET NULL;
+CREATE INDEX IF NOT EXISTS idx_devices_location ON devices(location_id);
+
+ALTER TABLE health_profiles ADD COLUMN IF NOT EXISTS bed_id INT REFERENCES locations(id) ON DELETE SET NULL;
+-- 每张床位至多分配一个档案
+CREATE UNIQUE INDEX IF NOT EXISTS uq_health_profiles_bed ON health_profiles(bed_id) WHERE bed_id IS NOT NULL;
+
+COMMIT;
@@ -0,0 +1,19 @@
+-- ================================================
+-- 0017 设备电量与信号采样历史
+-- ================================================
+BEGIN;
+
+CREATE TABLE IF NOT EXISTS device_telemetry (
+    id BIGSERIAL PRIMARY KEY,
+    device_id INT NOT NULL REFERENCES devices(id) ON DELETE CASCADE,
+    battery SMALLINT,                  -- 电量百分比 0-100，未上报为空
+    charging BOOLEAN,                  -- 是否充电中，未上报为空
+    rssi SMALLINT,                     -- 信号强度（dBm）
+    snr REAL,                          -- 信噪比（dB）
+    recorded_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+CREATE INDEX IF NOT EXISTS idx_device_telemetry_device ON device_telemetry(device_id, recorded_at DESC);
+-- 按保留时长清理
+CREATE INDEX IF NOT EXISTS idx_device_telemetry_recorded ON device_telemetry(recorded_at);
+
+COMMIT;
@@ -0,0 +1,17 @@
+-- ================================================
+-- 0018 设备类型目录（指标、上报间隔、上报数据 JSON Schema）
+-- ================================================
+BEGIN;
+
+CREATE TABLE IF NOT EXISTS device_types (
+    code VARCHAR(64) PRIMARY KEY,                 -- 对应 devices.device_type
+    name VARCHAR(64) NOT NULL,
+    description TEXT NOT NULL DEFAULT '',
+    reporting_interval_seconds INT NOT NULL DEFAULT 0,  -- 预期上报间隔，0 表示不固定
+    metrics JSONB NOT NULL DEFAULT '[]',          -- [{"key", "name", "unit", "min", "max", "chart"}]
+    payload_schema JSONB,                         -- 上报数据 JSON Schema，为空不校验
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+COMMIT;
@@ -0,0 +1,12 @@
+-- ================================================
+-- 0019 个人标识字段明文回退查找
+-- 未配置盲索引密钥或尚未重加密的历史行以明文存储，按 openid / 手机号查找时回退明文比较，
+-- 恢复明文 openid 唯一约束（密文每次加密结果不同，不受影响），并为明文手机号补充索引。
+-- 执行前如有重复 openid，需先人工合并账号。
+-- ================================================
+BEGIN;
+
+CREATE UNIQUE INDEX IF NOT EXISTS uq_app_users_wechat_openid ON app_users(wechat_openid) WHERE wechat_openid IS NOT NULL;
+CREATE INDEX IF NOT EXISTS idx_app_users_phone ON app_users(phone);
+
+COMMIT;
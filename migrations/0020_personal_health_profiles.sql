@@ -0,0 +1,18 @@
+-- ================================================
+-- 0020 App 用户个人档案不归属组织
+-- health_profiles.org_id 允许为空并去掉默认值：App 用户创建的档案 org_id 为空，仅档案成员可访问，
+-- 组织管理员按组织过滤时不可见。审计日志中由 App 用户创建的存量档案一并移出默认组织；
+-- 审计日志启用前创建的档案无法区分来源，需人工核对。
+-- ================================================
+BEGIN;
+
+ALTER TABLE health_profiles ALTER COLUMN org_id DROP NOT NULL;
+ALTER TABLE health_profiles ALTER COLUMN org_id DROP DEFAULT;
+
+UPDATE health_profiles p SET org_id = NULL
+WHERE p.org_id = 1 AND p.bed_id IS NULL AND EXISTS (
+    SELECT 1 FROM audit_logs a
+    WHERE a.action = 'create' AND a.resource_type = 'health_profile' AND a.actor_type = 'app'
+      AND a.resource_id = p.id::TEXT);
+
+COMMIT;